@@ -0,0 +1,178 @@
+//go:build cshared
+
+// C API for using the player as a shared library:
+//
+//	go build -tags cshared -buildmode=c-shared -o libmodplayer.so ./cmd/libmodplayer
+//
+// This also generates the C header libmodplayer.h. Modules are referenced by handles (> 0); functions
+// returning an int return -1 on errors, with the message available from modplayer_last_error. Audio is
+// 16-bit signed little endian stereo at modplayer_sample_rate(); modplayer_render renders whole frames
+// (4 bytes) and returns the number of bytes written.
+//
+// Example (Python):
+//
+//	lib = ctypes.CDLL("./libmodplayer.so")
+//	h = lib.modplayer_load(b"song.mod")
+//	buf = ctypes.create_string_buffer(65536)
+//	n = lib.modplayer_render(h, buf, len(buf))
+package main
+
+/*
+#include <stdlib.h>
+*/
+import "C"
+
+import (
+	"errors"
+	"io"
+	"sync"
+	"unsafe"
+
+	"github.com/b0nefish/go-modplayer/mod"
+	"github.com/b0nefish/go-modplayer/player"
+)
+
+// main is required for building a shared library, but never called
+func main() {}
+
+// cModule is a module loaded through the C API, with the player rendering it
+type cModule struct {
+	module mod.Module
+	opts   player.PlayerOptions
+	player *player.Player
+}
+
+var (
+	cMu      sync.Mutex
+	cModules = map[int]*cModule{}
+	cNext    = 1
+	cLastErr *C.char
+
+	errInvalidHandle = errors.New("invalid module handle")
+	errInvalidSize   = errors.New("invalid buffer size")
+)
+
+// cError records err as the last error and returns -1
+func cError(err error) C.int {
+	cMu.Lock()
+	defer cMu.Unlock()
+	if cLastErr != nil {
+		C.free(unsafe.Pointer(cLastErr))
+	}
+	cLastErr = C.CString(err.Error())
+	return -1
+}
+
+func cAdd(module mod.Module) C.int {
+	m := &cModule{module: module, opts: player.PlayerOptions{}}
+	m.player = player.NewPlayer(module, m.opts)
+	cMu.Lock()
+	defer cMu.Unlock()
+	h := cNext
+	cNext++
+	cModules[h] = m
+	return C.int(h)
+}
+
+func cGet(h C.int) (*cModule, bool) {
+	cMu.Lock()
+	defer cMu.Unlock()
+	m, ok := cModules[int(h)]
+	return m, ok
+}
+
+//export modplayer_last_error
+func modplayer_last_error() *C.char {
+	cMu.Lock()
+	defer cMu.Unlock()
+	return cLastErr
+}
+
+//export modplayer_sample_rate
+func modplayer_sample_rate() C.int {
+	return player.SampleRate
+}
+
+//export modplayer_load
+func modplayer_load(path *C.char) C.int {
+	module, err := mod.LoadFile(C.GoString(path))
+	if err != nil {
+		return cError(err)
+	}
+	return cAdd(module)
+}
+
+//export modplayer_load_memory
+func modplayer_load_memory(data unsafe.Pointer, size C.int) C.int {
+	if size < 0 {
+		return cError(errInvalidSize)
+	}
+	module, err := mod.LoadData("", C.GoBytes(data, size))
+	if err != nil {
+		return cError(err)
+	}
+	return cAdd(module)
+}
+
+//export modplayer_free
+func modplayer_free(h C.int) {
+	cMu.Lock()
+	defer cMu.Unlock()
+	delete(cModules, int(h))
+}
+
+//export modplayer_render
+func modplayer_render(h C.int, buf unsafe.Pointer, size C.int) C.int {
+	m, ok := cGet(h)
+	switch {
+	case !ok:
+		return cError(errInvalidHandle)
+	case size < 0:
+		return cError(errInvalidSize)
+	}
+	// only whole frames are rendered: the bytes after the last one are left alone
+	frame := player.Channels * player.BytesPerSample
+	n, err := io.ReadFull(m.player, unsafe.Slice((*byte)(buf), int(size)/frame*frame))
+	if err != nil && err != io.EOF && err != io.ErrUnexpectedEOF {
+		return cError(err)
+	}
+	return C.int(n)
+}
+
+//export modplayer_seek
+func modplayer_seek(h C.int, order C.int) C.int {
+	m, ok := cGet(h)
+	if !ok {
+		return cError(errInvalidHandle)
+	}
+	if err := m.player.SeekOrder(int(order), 0); err != nil {
+		return cError(err)
+	}
+	return 0
+}
+
+//export modplayer_play
+func modplayer_play(h C.int) C.int {
+	m, ok := cGet(h)
+	if !ok {
+		return cError(errInvalidHandle)
+	}
+	if err := player.Play(m.module, m.opts); err != nil {
+		return cError(err)
+	}
+	return 0
+}
+
+//export modplayer_render_wav
+func modplayer_render_wav(h C.int, path *C.char, loops C.int) C.int {
+	m, ok := cGet(h)
+	if !ok {
+		return cError(errInvalidHandle)
+	}
+	opts := m.opts
+	opts.Loops = int(loops)
+	if err := player.RenderWAV(m.module, C.GoString(path), player.RenderOptions{PlayerOptions: opts}); err != nil {
+		return cError(err)
+	}
+	return 0
+}
@@ -0,0 +1,643 @@
+package main
+
+import (
+	"encoding/hex"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/b0nefish/go-modplayer/mod"
+	"github.com/b0nefish/go-modplayer/player"
+)
+
+func decodeNote(noteToDecode string) {
+	noteData, err := hex.DecodeString(noteToDecode)
+	if err != nil {
+		fmt.Println(err)
+		os.Exit(1)
+	}
+	if len(noteData) < 4 {
+		fmt.Println("not enough data to decode")
+		os.Exit(1)
+	}
+	note := mod.ReadNote(noteData, &mod.Module{})
+	note.Details()
+}
+
+func main() {
+	infoOnly := flag.Bool("info", false, "only show module info")
+	infoJSON := flag.Bool("json", false, "with info: print the module info as JSON; with lint: print a JSON object per file")
+	playSamples := flag.Bool("samples", false, "play only the samples rather than the complete song")
+	noteToDecode := flag.String("note", "", "specify a note to decode")
+	start := flag.Int("s", 0, "start from the specified order (pattern list index)")
+	flag.IntVar(start, "start-order", 0, "same as -s")
+	chans := flag.String("S", "", "play only specified channels")
+	patterns := flag.String("pattern", "", "play (or render) only the given comma-separated patterns, also those which aren't in the pattern table")
+	smooth := flag.Bool("smooth", false, "interpolate pitch slides and vibrato/tremolo for every sample (instead of authentic per-tick steps)")
+	out := flag.String("o", "", "render the module into the given WAV, FLAC or OGG file (by its extension) instead of playing it")
+	rate := flag.Int("rate", player.SampleRate, "sample rate of the audio output")
+	loops := flag.Int("loops", 1, "number of times to play the song loop (the song ends exactly at the end of the loop)")
+	flag.IntVar(loops, "loop", 1, "same as -loops")
+	fade := flag.Duration("fade", 0, "after the loops, fade the song out over the given time (e.g. 10s) instead of ending at the end of the loop")
+	fadeCurve := flag.String("fadecurve", "linear", "shape of the fade out: linear or exp (by the same number of dB per second)")
+	cue := flag.Bool("cue", false, "with -o: also write a cue sheet with one track per order")
+	format := flag.String("format", "int16", "with -o: sample format (int16, int24, int32 or float32; FLAC: int16 or int24)")
+	dither := flag.String("dither", "none", fmt.Sprintf("with -o and -format int16: dithering of the mix %v (reproducible with -seed)", player.DitherNames()))
+	mono := flag.Bool("mono", false, "with -o: render in mono")
+	sampleDir := flag.String("out", ".", "with samples: directory for the WAV files of the samples")
+	sampleRate := flag.Int("refrate", player.SampleRefRate, "with samples: sample rate of the WAV files of the samples")
+	sampleBits := flag.Int("bits", 8, "with samples: bits per sample of the WAV files of the samples (8 or 16)")
+	stems := flag.Bool("stems", false, "with -o: also write a WAV file for every channel (file-ch01.wav, ...); -o has to be a WAV file")
+	chapters := flag.Bool("chapters", false, "with -o: also write an FFMETADATA file with one chapter per order")
+	video := flag.String("video", "", "render the module into the given video file (using ffmpeg) with a pattern view")
+	midi := flag.String("midi", "", "export the pattern data into the given MIDI file instead of playing it")
+	midiMap := flag.String("midimap", "", "with -midi: JSON file mapping channels/instruments to MIDI channels and programs")
+	dump := flag.String("dump", "", "print the given pattern (a number, or all) in tracker notation instead of playing it")
+	dumpCSV := flag.Bool("csv", false, "with -dump: print the pattern as CSV")
+	graph := flag.String("graph", "", "print the order/jump graph of the module (dot or json) instead of playing it")
+	extract := flag.String("extract", "", "write the data appended after the end of the module into the given file")
+	stream := flag.Int("stream", 0, "stream the samples from the file with at most the given number of KiB in memory (0: load all samples)")
+	serve := flag.String("serve", "", "run as a web radio on the given address (e.g. :8000), playing all given files in turn; metrics at /metrics")
+	logLevel := flag.String("log", "", "log loader and player events to stderr at the given level (debug, info, warn, error)")
+	midiClock := flag.String("midiclock", "", "send MIDI clock to the given raw MIDI device (e.g. /dev/snd/midiC1D0) while playing")
+	midiLatency := flag.Duration("midilatency", 0, "with -midiclock/-oscsend: delay of the audio output to compensate for")
+	link := flag.String("link", "", "join an Ableton Link session: broadcast (set the session tempo) or follow (start on the next bar, use the session tempo)")
+	oscListen := flag.String("osc", "", "receive OSC control messages on the given UDP address (e.g. :9000) while playing")
+	oscSend := flag.String("oscsend", "", "send row/note OSC events to the given UDP address (host:port) while playing")
+	shuffle := flag.Bool("shuffle", false, "play the given files (and the modules in the given directories and playlists) in random order")
+	repeat := flag.Bool("repeat", false, "play the given files over and over again")
+	crossfade := flag.Duration("crossfade", 0, "with several files: fade each module into the next one over the given time (e.g. 3s) instead of a hard cut")
+	scan := flag.Bool("scan", false, "scan the given directory for modules and print collection statistics")
+	songLengths := flag.String("songlengths", "", "with -scan: write a song length database into the given file")
+	panning := flag.String("pan", "amiga", "stereo panning: amiga (hard left/right for MOD files), mono, real (also use the panning commands 8xx/E8x of MOD files) or a stereo separation in percent (e.g. 70)")
+	stereoSep := flag.Int("stereo-sep", -1, "stereo separation in percent (same as -pan with a percentage)")
+	led := flag.String("led", "auto", "Amiga LED filter: auto (switched by E0x in MOD files), on or off")
+	paula := flag.Bool("paula", false, "emulate the sample output of the Amiga (held sample values with band-limited steps) instead of resampling")
+	resampler := flag.String("resample", player.DefaultResampler, fmt.Sprintf("resampler for playing the samples %v", player.ResamplerNames()))
+	flag.StringVar(resampler, "interp", player.DefaultResampler, "same as -resample")
+	output := flag.String("output", player.DefaultOutput, fmt.Sprintf("audio output %v", player.OutputNames()))
+	seed := flag.Int64("seed", 0, "seed for the random vibrato/tremolo waveforms, for reproducible renders (0: random)")
+	tui := flag.Bool("tui", false, "show the playing pattern and VU meters of the channels in the terminal")
+	fx := flag.String("fx", "", fmt.Sprintf("effects applied to the mix, e.g. reverb:0.3,widen:0.5 %v (bass and treble in dB)", player.DSPNames()))
+	limiter := flag.String("limiter", "none", fmt.Sprintf("master stage against distortion of loud mixes %v", player.LimiterNames()))
+	normalize := flag.Float64("normalize", 0, fmt.Sprintf("scale the output to the given loudness in LUFS (e.g. %d like ReplayGain; the song is rendered twice)", player.ReplayGainLoudness))
+	headroom := flag.Float64("headroom", 0, "lower the mix by the given dB before the limiter (e.g. 6 for modules which clip)")
+	noDeclick := flag.Bool("no-declick", false, "change volumes and start notes at once, without the 1 ms ramps against clicks (bit-exact with earlier versions)")
+	workers := flag.Int("workers", 0, "render the channels of modules with 16 channels or more in parallel with the given number of goroutines")
+	vblank := flag.Bool("vblank", false, "Fxx always sets the speed, never the BPM (for old modules timed by the vertical blank)")
+	compat := flag.String("compat", player.AutoCompat, fmt.Sprintf("tracker compatibility profile %v, or %s to detect it from the module", player.CompatProfileNames(), player.AutoCompat))
+	flag.Usage = Usage
+	exportSamples, lintOnly, bench, loudness, repair := false, false, false, false, false
+	args := os.Args[1:]
+	if len(args) > 0 {
+		switch args[0] {
+		case "play":
+			args = args[1:]
+		case "info":
+			args = args[1:]
+			*infoOnly = true
+		case "samples":
+			args = args[1:]
+			exportSamples = true
+		case "lint":
+			args = args[1:]
+			lintOnly = true
+		case "bench":
+			args = args[1:]
+			bench = true
+		case "loudness":
+			args = args[1:]
+			loudness = true
+		case "repair":
+			args = args[1:]
+			repair = true
+		}
+	}
+	files := parseArgs(flag.CommandLine, args)
+
+	if *noteToDecode != "" {
+		decodeNote(*noteToDecode)
+		return
+	}
+
+	if *logLevel != "" {
+		var level slog.Level
+		if err := level.UnmarshalText([]byte(*logLevel)); err != nil {
+			fmt.Println(err)
+			os.Exit(1)
+		}
+		player.SetLogger(slog.New(slog.NewTextHandler(os.Stderr, &slog.HandlerOptions{Level: level})))
+	}
+
+	if len(files) < 1 {
+		fmt.Println("file name not specified")
+		os.Exit(1)
+	}
+	cp, err := player.FindCompatProfile(*compat)
+	if err != nil {
+		fmt.Println(err)
+		os.Exit(1)
+	}
+	if *stereoSep >= 0 {
+		*panning = strconv.Itoa(*stereoSep)
+	}
+	panMode, separation, err := player.ParsePanning(*panning)
+	if err != nil {
+		fmt.Println(err)
+		os.Exit(1)
+	}
+	rs, err := player.FindResampler(*resampler)
+	if err != nil {
+		fmt.Println(err)
+		os.Exit(1)
+	}
+	limit, err := player.ParseLimiter(*limiter)
+	if err != nil {
+		fmt.Println(err)
+		os.Exit(1)
+	}
+	dsp, err := player.ParseDSP(*fx, *rate)
+	if err != nil {
+		fmt.Println(err)
+		os.Exit(1)
+	}
+	outf, err := player.FindOutput(*output)
+	if err != nil {
+		fmt.Println(err)
+		os.Exit(1)
+	}
+	engine := player.EngineResampler
+	if *paula {
+		engine = player.PaulaBLEP
+	}
+	var ledMode player.LEDMode
+	switch *led {
+	case "auto":
+	case "on":
+		ledMode = player.LEDOn
+	case "off":
+		ledMode = player.LEDOff
+	default:
+		fmt.Println("unknown LED filter mode", *led)
+		os.Exit(1)
+	}
+	var curve player.FadeCurve
+	switch *fadeCurve {
+	case "linear":
+	case "exp":
+		curve = player.FadeExponential
+	default:
+		fmt.Println("unknown fade curve", *fadeCurve)
+		os.Exit(1)
+	}
+
+	if *serve != "" {
+		if files, err = mod.ExpandPlaylist(files); err != nil {
+			fmt.Println(err)
+			os.Exit(1)
+		}
+		radio := player.NewRadio(files, player.PlayerOptions{Channels: *chans, Compat: cp, Loops: *loops, Smooth: *smooth, Rate: *rate,
+			FadeOut: *fade, FadeCurve: curve, Panning: panMode, Separation: separation, LEDFilter: ledMode, Resampler: rs, Engine: engine, Seed: *seed, VBlank: *vblank, DSP: dsp, Limiter: limit, Headroom: *headroom, Normalize: *normalize, NoDeclick: *noDeclick, Workers: *workers})
+		fmt.Println("Streaming on", *serve)
+		fmt.Println(radio.ListenAndServe(*serve))
+		os.Exit(1)
+	}
+
+	fn := files[0]
+	if *scan {
+		if err := scanCollection(fn, *songLengths); err != nil {
+			fmt.Println(err)
+			os.Exit(1)
+		}
+		return
+	}
+	if lintOnly {
+		problems, err := lintFiles(files, *infoJSON)
+		if err != nil {
+			fmt.Println(err)
+			os.Exit(1)
+		}
+		if problems {
+			os.Exit(2)
+		}
+		return
+	}
+	if repair {
+		if len(files) != 2 {
+			fmt.Println("repair needs the module and the file to write the repaired copy into")
+			os.Exit(1)
+		}
+		// works on the raw file, as a broken header may prevent loading it as a module
+		if err := repairFile(fn, files[1]); err != nil {
+			fmt.Println(err)
+			os.Exit(1)
+		}
+		return
+	}
+	opts := player.PlayerOptions{Start: *start, Channels: *chans, Compat: cp, Loops: *loops, FadeOut: *fade, FadeCurve: curve, Smooth: *smooth,
+		Panning: panMode, Separation: separation, LEDFilter: ledMode, Resampler: rs, Engine: engine, Seed: *seed,
+		VBlank: *vblank, Rate: *rate, Output: outf, DSP: dsp, Limiter: limit, Headroom: *headroom, Normalize: *normalize, NoDeclick: *noDeclick, Workers: *workers}
+	if bench {
+		if err := benchmark(fn, opts); err != nil {
+			fmt.Println(err)
+			os.Exit(1)
+		}
+		return
+	}
+	if loudness {
+		if err := measureLoudness(files, opts); err != nil {
+			fmt.Println(err)
+			os.Exit(1)
+		}
+		return
+	}
+	if *midiClock != "" {
+		port, err := player.OpenMIDIPort(*midiClock)
+		if err != nil {
+			fmt.Println(err)
+			os.Exit(1)
+		}
+		defer port.Close()
+		opts.Clock = player.NewMIDIClock(port, *midiLatency)
+	}
+	if *link != "" {
+		switch *link {
+		case "broadcast":
+			opts.SyncMode = player.SyncBroadcast
+		case "follow":
+			opts.SyncMode = player.SyncFollow
+		default:
+			fmt.Println("unknown Link mode", *link)
+			os.Exit(1)
+		}
+		if opts.Sync, err = player.NewLinkSync(125); err != nil {
+			fmt.Println(err)
+			os.Exit(1)
+		}
+	}
+	if *oscSend != "" {
+		if opts.OSC, err = player.NewOSCClient(*oscSend, *midiLatency); err != nil {
+			fmt.Println(err)
+			os.Exit(1)
+		}
+		defer opts.OSC.Close()
+	}
+	list, err := mod.ExpandPlaylist(files)
+	if err != nil {
+		fmt.Println(err)
+		os.Exit(1)
+	}
+	switch {
+	case len(list) == 0:
+		fmt.Println("no modules found")
+		os.Exit(1)
+	case len(list) > 1 || *repeat:
+		// several modules: played one after the other (rendering and the other modes take a single module)
+		pl := player.NewPlaylist(list, opts)
+		pl.Shuffle, pl.Repeat, pl.Crossfade = *shuffle, *repeat, *crossfade
+		pl.OnTrack = func(fn string, m mod.Module) { m.Info() }
+		pl.OnError = func(fn string, err error) { fmt.Println(fn, err) }
+		if err := pl.Play(); err != nil {
+			fmt.Println(err)
+			os.Exit(1)
+		}
+		return
+	}
+	fn = list[0]
+
+	var module mod.Module
+	if *stream > 0 {
+		module, err = mod.LoadFileStreamed(fn, *stream*1024)
+	} else {
+		module, err = mod.LoadFile(fn)
+	}
+	if err != nil {
+		fmt.Println(err)
+		os.Exit(1)
+	}
+	defer module.Close()
+	if *start < 0 || *start >= len(module.PatternTable) {
+		fmt.Printf("start order %d out of range (song length %d)\n", *start, len(module.PatternTable))
+		os.Exit(1)
+	}
+
+	switch *graph {
+	case "":
+	case "dot":
+		module.FlowGraph().WriteDOT(os.Stdout)
+		return
+	case "json":
+		module.FlowGraph().WriteJSON(os.Stdout)
+		return
+	default:
+		fmt.Println("unknown graph format", *graph)
+		os.Exit(1)
+	}
+
+	if *dump != "" {
+		if err := dumpPatterns(module, *dump, *dumpCSV); err != nil {
+			fmt.Println(err)
+			os.Exit(1)
+		}
+		return
+	}
+
+	if *extract != "" {
+		if len(module.Trailing) == 0 {
+			fmt.Println("no trailing data found")
+			os.Exit(1)
+		}
+		fmt.Printf("Extracting %d bytes of trailing data (%s)\n", len(module.Trailing), module.TrailingType)
+		if err := os.WriteFile(*extract, module.Trailing, 0644); err != nil {
+			fmt.Println(err)
+			os.Exit(1)
+		}
+		return
+	}
+
+	if *midi != "" {
+		if err := exportMIDI(module, *midi, *midiMap); err != nil {
+			fmt.Println(err)
+			os.Exit(1)
+		}
+		return
+	}
+
+	if exportSamples {
+		names, err := player.ExportSamples(module, *sampleDir, *sampleRate, *sampleBits)
+		for _, fn := range names {
+			fmt.Println("Written:", fn)
+		}
+		if err != nil {
+			fmt.Println(err)
+			os.Exit(1)
+		}
+		return
+	}
+
+	if *patterns != "" {
+		var list []int
+		for _, f := range strings.Split(*patterns, ",") {
+			n, err := strconv.Atoi(strings.TrimSpace(f))
+			if err != nil {
+				fmt.Println("invalid pattern number", f)
+				os.Exit(1)
+			}
+			list = append(list, n)
+		}
+		if module, err = module.WithPatterns(list...); err != nil {
+			fmt.Println(err)
+			os.Exit(1)
+		}
+	}
+
+	if *infoOnly && *infoJSON {
+		if err := module.Summary().WriteJSON(os.Stdout); err != nil {
+			fmt.Println(err)
+			os.Exit(1)
+		}
+		return
+	}
+	module.Info()
+	if *infoOnly {
+		return
+	}
+	if *playSamples {
+		for i := 0; i < module.InstrTableLen; i++ {
+			if module.Instruments[i].Len > 0 {
+				fmt.Println("Playing sample", i)
+				player.PlaySample(module.Instruments[i])
+			}
+		} //*/
+		return
+	}
+
+	switch {
+	case *video != "":
+		err = player.RenderVideo(module, *video, player.VideoOptions{PlayerOptions: opts})
+	case *out != "":
+		ropts := player.RenderOptions{PlayerOptions: opts, CueSheet: *cue, Chapters: *chapters}
+		if ropts.Format, err = player.ParseSampleFormat(*format); err == nil {
+			ropts.Dither, err = player.ParseDither(*dither)
+		}
+		if err == nil {
+			if *mono {
+				ropts.Channels = 1
+			}
+			if *stems {
+				var names []string
+				if names, err = player.RenderStems(module, *out, ropts); err == nil {
+					fmt.Println("Written:", strings.Join(names, ", "))
+				}
+			} else {
+				err = player.RenderFile(module, *out, ropts)
+			}
+		}
+	default:
+		mp := player.NewPlayer(module, opts)
+		if *oscListen != "" {
+			go func() { fmt.Println(player.ServeOSC(*oscListen, mp)) }()
+		}
+		if err = mp.Play(); err == nil {
+			if *tui {
+				err = mp.ShowTUI(os.Stdout, terminalRows())
+			} else {
+				err = mp.Wait()
+			}
+		}
+	}
+	if err != nil {
+		fmt.Println(err)
+		os.Exit(1)
+	}
+
+}
+
+// terminalRows returns the height of the terminal (from $LINES, which most shells set; default 24)
+func terminalRows() int {
+	if rows, err := strconv.Atoi(os.Getenv("LINES")); err == nil && rows > 0 {
+		return rows
+	}
+	return 24
+}
+
+func exportMIDI(module mod.Module, fn, mapFn string) error {
+	mm := mod.DefaultMIDIMapping()
+	if mapFn != "" {
+		var err error
+		if mm, err = mod.LoadMIDIMapping(mapFn); err != nil {
+			return err
+		}
+	}
+	return writeFile(fn, func(w io.Writer) error { return module.ExportMIDI(w, mm) })
+}
+
+// dumpPatterns prints the pattern with the given number, or all patterns ("all")
+func dumpPatterns(module mod.Module, which string, csv bool) error {
+	format := mod.DumpText
+	if csv {
+		format = mod.DumpCSV
+	}
+	if which != "all" {
+		n, err := strconv.Atoi(which)
+		if err != nil {
+			return fmt.Errorf("invalid pattern number %q", which)
+		}
+		return module.DumpPattern(n, os.Stdout, format)
+	}
+	for n := range module.Patterns {
+		if !csv {
+			fmt.Printf("Pattern %d:\n", n)
+		}
+		if err := module.DumpPattern(n, os.Stdout, format); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func scanCollection(dir, songLengthsFn string) error {
+	cs, err := mod.ScanCollection(dir)
+	if err != nil {
+		return err
+	}
+	cs.Print(os.Stdout)
+	if songLengthsFn == "" {
+		return nil
+	}
+	return writeFile(songLengthsFn, cs.WriteSongLengths)
+}
+
+// lintFiles checks the given files (and the modules in the given directories and playlists) and prints
+// their problems, as text or as a JSON object per line. It returns true if problems have been found.
+func lintFiles(paths []string, asJSON bool) (bool, error) {
+	files, err := mod.ExpandPlaylist(paths)
+	if err != nil {
+		return false, err
+	}
+	problems := false
+	enc := json.NewEncoder(os.Stdout)
+	for _, fn := range files {
+		issues, err := mod.LintFile(fn)
+		problems = problems || err != nil || len(issues) > 0
+		if asJSON {
+			res := struct {
+				File   string          `json:"file"`
+				Issues []mod.LintIssue `json:"issues"`
+				Error  string          `json:"error,omitempty"` // the file couldn't be loaded
+			}{File: fn, Issues: issues}
+			if err != nil {
+				res.Error = err.Error()
+			}
+			if res.Issues == nil {
+				res.Issues = []mod.LintIssue{}
+			}
+			if err := enc.Encode(res); err != nil {
+				return problems, err
+			}
+			continue
+		}
+		switch {
+		case err != nil:
+			fmt.Printf("%s: %v\n", fn, err)
+		case len(issues) == 0:
+			fmt.Printf("%s: no problems found\n", fn)
+		}
+		for _, li := range issues {
+			fmt.Printf("%s: %v\n", fn, li)
+		}
+	}
+	return problems, nil
+}
+
+// benchmark renders the module file fn as fast as possible and prints the timings
+func benchmark(fn string, opts player.PlayerOptions) error {
+	br, err := player.BenchmarkFile(fn, opts)
+	if err != nil {
+		return err
+	}
+	fmt.Printf("%s: %v of audio (%d samples) rendered in %v, %.1fx realtime\n", fn, br.Audio.Round(time.Millisecond),
+		br.Samples, br.Render.Round(time.Microsecond), br.Realtime())
+	fmt.Printf("    parsing     %v\n", br.Parse.Round(time.Microsecond))
+	fmt.Printf("    replay      %v\n", br.Replay.Round(time.Microsecond))
+	fmt.Printf("    mixing      %v\n", br.Mixing.Round(time.Microsecond))
+	fmt.Printf("    resampling  %v (estimated, part of mixing)\n", br.Resampling.Round(time.Microsecond))
+	fmt.Printf("    allocations %d (%d KiB)\n", br.Allocs, br.AllocBytes/1024)
+	return nil
+}
+
+// measureLoudness prints the loudness of the modules and the gain to the ReplayGain reference loudness
+func measureLoudness(files []string, opts player.PlayerOptions) error {
+	for _, fn := range files {
+		module, err := mod.LoadFile(fn)
+		if err != nil {
+			return err
+		}
+		l := player.MeasureLoudness(module, opts)
+		module.Close()
+		fmt.Printf("%s: %.1f LUFS, peak %.1f dBFS, gain %+.1f dB (to %d LUFS)\n", fn, l.Integrated, l.Peak,
+			l.Gain(player.ReplayGainLoudness), player.ReplayGainLoudness)
+	}
+	return nil
+}
+
+func repairFile(fn, outFn string) error {
+	data, err := os.ReadFile(fn)
+	if err != nil {
+		return err
+	}
+	data, changes, err := mod.RepairModule(data)
+	if err != nil {
+		return err
+	}
+	for _, c := range changes {
+		fmt.Println("Repaired:", c)
+	}
+	if len(changes) == 0 {
+		fmt.Println("No problems found")
+	}
+	return os.WriteFile(outFn, data, 0644)
+}
+
+// writeFile creates the file fn and writes its contents with the given function
+func writeFile(fn string, write func(w io.Writer) error) error {
+	f, err := os.Create(fn)
+	if err != nil {
+		return err
+	}
+	if err := write(f); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+// parseArgs parses the flags in args, which (unlike with flag.Parse) may also follow the file names, and
+// returns the file names
+func parseArgs(fs *flag.FlagSet, args []string) []string {
+	var files []string
+	for {
+		fs.Parse(args) // exits on errors
+		rest := fs.Args()
+		if n := len(args) - len(rest); n > 0 && args[n-1] == "--" {
+			return append(files, rest...)
+		}
+		if len(rest) == 0 {
+			return files
+		}
+		files, args = append(files, rest[0]), rest[1:]
+	}
+}
+
+// Usage is our custom usage function
+var Usage = func() {
+	fmt.Fprintf(flag.CommandLine.Output(), "Usage: %s [play|info|samples|lint|bench|loudness|repair] [flags] file|directory|playlist... [flags]\n", os.Args[0])
+	fmt.Fprintf(flag.CommandLine.Output(), "  play  play (or render) the module (the default)\n  info  only show the module info (with -json as JSON)\n  samples  write the samples of the module as WAV files (into the directory given by -out)\n  lint  check the modules for problems (with -json as JSON lines; exit status 2 if any are found)\n  bench  render the module as fast as possible and print the timings\n  loudness  print the loudness of the modules (and the gain to the ReplayGain level)\n  repair  repair the header of the module (the first file) and write the cleaned copy into the second file\nFlags:\n")
+	flag.PrintDefaults()
+}
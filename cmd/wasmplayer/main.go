@@ -0,0 +1,84 @@
+//go:build js && wasm
+
+// The player in the browser, playing through Web Audio:
+//
+//	GOOS=js GOARCH=wasm go build -o cmd/wasmplayer/modplayer.wasm ./cmd/wasmplayer
+//	cp "$(go env GOROOT)/lib/wasm/wasm_exec.js" cmd/wasmplayer/ # misc/wasm before Go 1.24
+//
+// and serve the directory cmd/wasmplayer (index.html is the demo page). The page calls the functions
+// set by main:
+//
+//	modplayerPlay(data)  - play the module from the file data (a Uint8Array); returns its name or throws
+//	modplayerStop()      - stop playing
+package main
+
+import (
+	"errors"
+	"sync"
+	"syscall/js"
+
+	"github.com/b0nefish/go-modplayer/mod"
+	"github.com/b0nefish/go-modplayer/player"
+)
+
+var (
+	mu      sync.Mutex
+	playing *player.Player
+)
+
+// play plays the module in data (stopping the one playing)
+func play(data []byte) (string, error) {
+	module, err := mod.LoadData("", data)
+	if err != nil {
+		return "", err
+	}
+	out, err := player.FindOutput("webaudio")
+	if err != nil {
+		return "", err
+	}
+	stop()
+	p := player.NewPlayer(module, player.PlayerOptions{Rate: 44100, Output: out})
+	if err := p.Play(); err != nil {
+		return "", err
+	}
+	mu.Lock()
+	playing = p
+	mu.Unlock()
+	return module.Name, nil
+}
+
+// stop stops the module playing, if any
+func stop() {
+	mu.Lock()
+	p := playing
+	playing = nil
+	mu.Unlock()
+	if p != nil {
+		p.Stop()
+	}
+}
+
+// jsError returns a JavaScript Error to be thrown with the message of err
+func jsError(err error) js.Value {
+	return js.Global().Get("Error").New(err.Error())
+}
+
+func main() {
+	js.Global().Set("modplayerPlay", js.FuncOf(func(this js.Value, args []js.Value) interface{} {
+		if len(args) < 1 || args[0].Type() != js.TypeObject {
+			panic(jsError(errors.New("modplayerPlay: missing module data")))
+		}
+		data := make([]byte, args[0].Get("length").Int())
+		js.CopyBytesToGo(data, args[0])
+		name, err := play(data)
+		if err != nil {
+			panic(jsError(err))
+		}
+		return name
+	}))
+	js.Global().Set("modplayerStop", js.FuncOf(func(this js.Value, args []js.Value) interface{} {
+		stop()
+		return nil
+	}))
+	select {} // the functions are called by the page
+}
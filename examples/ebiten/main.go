@@ -0,0 +1,77 @@
+//go:build ebiten
+
+// Tracker music as the soundtrack of an Ebitengine game: the module is played in a loop, and the screen
+// flashes on every beat (4 rows).
+//
+//	go run -tags ebiten ./examples/ebiten song.mod
+package main
+
+import (
+	"fmt"
+	"image/color"
+	"log"
+	"os"
+	"sync/atomic"
+
+	"github.com/hajimehoshi/ebiten/v2"
+	"github.com/hajimehoshi/ebiten/v2/audio"
+	"github.com/hajimehoshi/ebiten/v2/ebitenutil"
+
+	"github.com/b0nefish/go-modplayer/mod"
+	"github.com/b0nefish/go-modplayer/player"
+)
+
+const sampleRate = 44100
+
+type game struct {
+	name       string
+	order, row atomic.Int32 // the position of the music (set by the OnRow callback)
+	flash      atomic.Int32 // brightness of the flash, fading over a few frames
+}
+
+func (g *game) Update() error {
+	if f := g.flash.Load(); f > 0 {
+		g.flash.CompareAndSwap(f, f-1)
+	}
+	return nil
+}
+
+func (g *game) Draw(screen *ebiten.Image) {
+	screen.Fill(color.Gray{uint8(g.flash.Load() * 24)})
+	ebitenutil.DebugPrint(screen, fmt.Sprintf("%s\norder %03d row %02d", g.name, g.order.Load(), g.row.Load()))
+}
+
+func (g *game) Layout(w, h int) (int, int) {
+	return 320, 240
+}
+
+func main() {
+	if len(os.Args) < 2 {
+		log.Fatal("usage: ebiten file")
+	}
+	m, err := mod.LoadFile(os.Args[1])
+	if err != nil {
+		log.Fatal(err)
+	}
+	defer m.Close()
+
+	g := &game{name: m.Name}
+	s := player.NewEbitenStream(m, player.PlayerOptions{Rate: sampleRate}, true)
+	s.OnRow(func(order, pattern, row int) {
+		g.order.Store(int32(order))
+		g.row.Store(int32(row))
+		if row%4 == 0 {
+			g.flash.Store(6)
+		}
+	})
+	p, err := audio.NewContext(sampleRate).NewPlayer(s)
+	if err != nil {
+		log.Fatal(err)
+	}
+	p.Play()
+
+	ebiten.SetWindowTitle(m.Name)
+	if err := ebiten.RunGame(g); err != nil {
+		log.Fatal(err)
+	}
+}
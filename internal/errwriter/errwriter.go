@@ -0,0 +1,27 @@
+// Package errwriter helps writing text formats: a Writer remembers the first error of a series of
+// writes, so it can be checked once at the end.
+package errwriter
+
+import (
+	"fmt"
+	"io"
+)
+
+// Writer is an io.Writer wrapper which remembers the first error, so we can check it once at the end
+type Writer struct {
+	w   io.Writer
+	Err error // the first error writing to w
+}
+
+// New returns a Writer writing to w
+func New(w io.Writer) *Writer {
+	return &Writer{w: w}
+}
+
+// Printf writes to the underlying writer as fmt.Fprintf does, unless an earlier write failed
+func (ew *Writer) Printf(format string, a ...interface{}) {
+	if ew.Err != nil {
+		return
+	}
+	_, ew.Err = fmt.Fprintf(ew.w, format, a...)
+}
@@ -0,0 +1,86 @@
+//go:build android
+
+package mobile
+
+/*
+#cgo LDFLAGS: -laaudio
+#include <aaudio/AAudio.h>
+
+// openStream opens and starts an AAudio output stream for 16-bit PCM
+static AAudioStream *openStream(int32_t rate, int32_t channels, aaudio_result_t *res) {
+	AAudioStreamBuilder *b;
+	AAudioStream *s = NULL;
+	if ((*res = AAudio_createStreamBuilder(&b)) != AAUDIO_OK) {
+		return NULL;
+	}
+	AAudioStreamBuilder_setFormat(b, AAUDIO_FORMAT_PCM_I16);
+	AAudioStreamBuilder_setSampleRate(b, rate);
+	AAudioStreamBuilder_setChannelCount(b, channels);
+	AAudioStreamBuilder_setPerformanceMode(b, AAUDIO_PERFORMANCE_MODE_LOW_LATENCY);
+	*res = AAudioStreamBuilder_openStream(b, &s);
+	AAudioStreamBuilder_delete(b);
+	if (*res != AAUDIO_OK) {
+		return NULL;
+	}
+	if ((*res = AAudioStream_requestStart(s)) != AAUDIO_OK) {
+		AAudioStream_close(s);
+		return NULL;
+	}
+	return s;
+}
+*/
+import "C"
+
+import (
+	"errors"
+	"time"
+	"unsafe"
+)
+
+// AudioOutput is an AudioSink playing through an AAudio stream (Android 8.0, API level 26 and later)
+type AudioOutput struct {
+	stream   *C.AAudioStream
+	channels int
+}
+
+// NewAudioOutput opens an AAudio stream with the given sample rate and number of channels (those of the
+// MobilePlayer), e.g. in Kotlin:
+//
+//	val mp = Mobile.newMobilePlayer(data)
+//	val out = Mobile.newAudioOutput(mp.sampleRate(), mp.channels())
+//	thread { mp.stream(out); out.close() }
+func NewAudioOutput(sampleRate, channels int) (*AudioOutput, error) {
+	var res C.aaudio_result_t
+	s := C.openStream(C.int32_t(sampleRate), C.int32_t(channels), &res)
+	if s == nil {
+		return nil, aaudioError(res)
+	}
+	return &AudioOutput{stream: s, channels: channels}, nil
+}
+
+// Write plays the PCM data (whole frames), blocking while the buffer of the stream is full
+func (o *AudioOutput) Write(pcm []byte) (int, error) {
+	frame := o.channels * 2
+	written := 0
+	for written+frame <= len(pcm) {
+		n := C.AAudioStream_write(o.stream, unsafe.Pointer(&pcm[written]), C.int32_t((len(pcm)-written)/frame), C.int64_t(time.Second))
+		if n < 0 {
+			return written, aaudioError(C.aaudio_result_t(n))
+		}
+		written += int(n) * frame
+	}
+	return written, nil
+}
+
+// Close stops and closes the stream
+func (o *AudioOutput) Close() error {
+	C.AAudioStream_requestStop(o.stream)
+	if res := C.AAudioStream_close(o.stream); res != C.AAUDIO_OK {
+		return aaudioError(res)
+	}
+	return nil
+}
+
+func aaudioError(res C.aaudio_result_t) error {
+	return errors.New("AAudio: " + C.GoString(C.AAudio_convertResultToText(res)))
+}
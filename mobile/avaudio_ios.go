@@ -0,0 +1,130 @@
+//go:build ios
+
+package mobile
+
+/*
+#cgo CFLAGS: -x objective-c -fobjc-arc
+#cgo LDFLAGS: -framework AVFoundation -framework Foundation
+#import <AVFoundation/AVFoundation.h>
+#include <stdlib.h>
+#include <string.h>
+
+// queuedBuffers is the number of buffers scheduled on the player node before writing blocks
+#define queuedBuffers 4
+
+@interface MPOutput : NSObject
+@property AVAudioEngine *engine;
+@property AVAudioPlayerNode *node;
+@property AVAudioFormat *format;
+@property dispatch_semaphore_t queued;
+@end
+
+@implementation MPOutput
+@end
+
+// errorText returns a copy of the description of the error (to be freed by the caller)
+static char *errorText(NSError *e) {
+	return strdup(e ? e.localizedDescription.UTF8String : "unknown error");
+}
+
+// openOutput starts an AVAudioEngine with a player node in the given format
+static void *openOutput(double rate, int channels, char **err) {
+	@autoreleasepool {
+		NSError *e = nil;
+		AVAudioSession *session = [AVAudioSession sharedInstance];
+		if (![session setCategory:AVAudioSessionCategoryPlayback error:&e] || ![session setActive:YES error:&e]) {
+			*err = errorText(e);
+			return NULL;
+		}
+		MPOutput *o = [[MPOutput alloc] init];
+		o.engine = [[AVAudioEngine alloc] init];
+		o.node = [[AVAudioPlayerNode alloc] init];
+		o.format = [[AVAudioFormat alloc] initStandardFormatWithSampleRate:rate channels:channels];
+		o.queued = dispatch_semaphore_create(queuedBuffers);
+		[o.engine attachNode:o.node];
+		[o.engine connect:o.node to:o.engine.mainMixerNode format:o.format];
+		if (![o.engine startAndReturnError:&e]) {
+			*err = errorText(e);
+			return NULL;
+		}
+		[o.node play];
+		return (__bridge_retained void *)o;
+	}
+}
+
+// writeOutput schedules the interleaved 16-bit frames as a buffer of the player node, blocking while
+// queuedBuffers buffers are waiting to be played
+static void writeOutput(void *p, const int16_t *pcm, int frames) {
+	@autoreleasepool {
+		MPOutput *o = (__bridge MPOutput *)p;
+		AVAudioChannelCount channels = o.format.channelCount;
+		AVAudioPCMBuffer *buf = [[AVAudioPCMBuffer alloc] initWithPCMFormat:o.format frameCapacity:frames];
+		buf.frameLength = frames;
+		for (AVAudioChannelCount c = 0; c < channels; c++) {
+			float *out = buf.floatChannelData[c];
+			for (int i = 0; i < frames; i++) {
+				out[i] = pcm[i * channels + c] / 32768.0f;
+			}
+		}
+		dispatch_semaphore_wait(o.queued, DISPATCH_TIME_FOREVER);
+		dispatch_semaphore_t queued = o.queued;
+		[o.node scheduleBuffer:buf completionHandler:^{
+			dispatch_semaphore_signal(queued);
+		}];
+	}
+}
+
+// closeOutput stops the engine and releases it
+static void closeOutput(void *p) {
+	@autoreleasepool {
+		MPOutput *o = (__bridge_transfer MPOutput *)p;
+		[o.node stop];
+		[o.engine stop];
+	}
+}
+*/
+import "C"
+
+import (
+	"errors"
+	"unsafe"
+)
+
+// AudioOutput is an AudioSink playing through a player node of an AVAudioEngine (the audio session
+// category is set to playback)
+type AudioOutput struct {
+	output   unsafe.Pointer
+	channels int
+}
+
+// NewAudioOutput starts an AVAudioEngine with the given sample rate and number of channels (those of
+// the MobilePlayer), e.g. in Swift:
+//
+//	var err: NSError?
+//	let mp = MobileNewMobilePlayer(data, &err)!
+//	let out = MobileNewAudioOutput(mp.sampleRate(), mp.channels(), &err)!
+//	DispatchQueue.global().async { try? mp.stream(out); try? out.close() }
+func NewAudioOutput(sampleRate, channels int) (*AudioOutput, error) {
+	var cErr *C.char
+	o := C.openOutput(C.double(sampleRate), C.int(channels), &cErr)
+	if o == nil {
+		defer C.free(unsafe.Pointer(cErr))
+		return nil, errors.New("AVAudioEngine: " + C.GoString(cErr))
+	}
+	return &AudioOutput{output: o, channels: channels}, nil
+}
+
+// Write plays the PCM data (whole frames), blocking while enough audio is queued
+func (o *AudioOutput) Write(pcm []byte) (int, error) {
+	frames := len(pcm) / (o.channels * 2)
+	if frames > 0 {
+		C.writeOutput(o.output, (*C.int16_t)(unsafe.Pointer(&pcm[0])), C.int(frames))
+	}
+	return frames * o.channels * 2, nil
+}
+
+// Close stops the engine
+func (o *AudioOutput) Close() error {
+	C.closeOutput(o.output)
+	return nil
+}
@@ -0,0 +1,133 @@
+// Package mobile provides a player API for Android and iOS apps, to be bound with gomobile.
+package mobile
+
+import (
+	"io"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/b0nefish/go-modplayer/mod"
+	"github.com/b0nefish/go-modplayer/player"
+)
+
+// AudioSink is an audio output for MobilePlayer.Stream. NewAudioOutput returns one for the platform (an
+// AAudio stream on Android, an AVAudioEngine player node on iOS); apps may implement their own in Java,
+// Kotlin or Swift. Write gets 16-bit signed little endian stereo PCM at the player's sample rate and
+// should block while the output buffer is full.
+type AudioSink interface {
+	Write(pcm []byte) (int, error)
+}
+
+// MobilePlayer is the subset of the player API which can be bound with gomobile (gomobile bind ./mobile):
+// its signatures only use basic types, byte slices, errors and interfaces (no channels or funcs).
+type MobilePlayer struct {
+	mu      sync.Mutex
+	module  mod.Module
+	opts    player.PlayerOptions
+	player  *player.Player
+	stopped atomic.Bool
+}
+
+// NewMobilePlayer loads a module from its file data (e.g. read from the app's assets)
+func NewMobilePlayer(data []byte) (*MobilePlayer, error) {
+	module, err := mod.LoadData("", data)
+	if err != nil {
+		return nil, err
+	}
+	mp := &MobilePlayer{module: module, opts: player.PlayerOptions{}}
+	mp.player = player.NewPlayer(module, mp.opts)
+	return mp, nil
+}
+
+// Name returns the name of the module
+func (mp *MobilePlayer) Name() string {
+	return mp.module.Name
+}
+
+// SongLength returns the number of orders (pattern table entries) of the module
+func (mp *MobilePlayer) SongLength() int {
+	return len(mp.module.PatternTable)
+}
+
+// Duration returns the play time of one pass through the song in milliseconds
+func (mp *MobilePlayer) Duration() (int, error) {
+	d, err := mp.module.Duration(player.SampleRate)
+	return int(d / time.Millisecond), err
+}
+
+// SampleRate returns the sample rate of the rendered audio
+func (mp *MobilePlayer) SampleRate() int {
+	return player.SampleRate
+}
+
+// Channels returns the number of audio channels of the rendered audio
+func (mp *MobilePlayer) Channels() int {
+	return player.Channels
+}
+
+// Render renders the next frames (at most the given number) as 16-bit stereo PCM; the result is empty
+// when the song has ended
+func (mp *MobilePlayer) Render(frames int) ([]byte, error) {
+	mp.mu.Lock()
+	defer mp.mu.Unlock()
+	buf := make([]byte, frames*player.Channels*player.BytesPerSample)
+	n, err := io.ReadFull(mp.player, buf)
+	if err == io.EOF || err == io.ErrUnexpectedEOF {
+		err = nil
+	}
+	return buf[:n], err
+}
+
+// Seek continues playing at the given order
+func (mp *MobilePlayer) Seek(order int) error {
+	mp.mu.Lock()
+	defer mp.mu.Unlock()
+	return mp.player.SeekOrder(order, 0)
+}
+
+// SeekTime continues playing at the given position in milliseconds
+func (mp *MobilePlayer) SeekTime(ms int) error {
+	mp.mu.Lock()
+	defer mp.mu.Unlock()
+	return mp.player.SeekTime(time.Duration(ms) * time.Millisecond)
+}
+
+// Mute mutes or unmutes a channel (0-based)
+func (mp *MobilePlayer) Mute(ch int, on bool) {
+	mp.player.Mute(ch, on)
+}
+
+// Solo plays only the given channel (0-based); a negative channel unmutes all channels
+func (mp *MobilePlayer) Solo(ch int) {
+	mp.player.Solo(ch)
+}
+
+// SetVolume sets the master volume (1.0: unchanged), ramped to avoid clicks
+func (mp *MobilePlayer) SetVolume(v float64) {
+	mp.player.SetVolume(v)
+}
+
+// Stream renders the song into the sink until it ends or Stop is called (blocks, so it should be called
+// from a background thread)
+func (mp *MobilePlayer) Stream(sink AudioSink) error {
+	mp.stopped.Store(false)
+	for !mp.stopped.Load() {
+		pcm, err := mp.Render(player.SampleRate / 50)
+		if err != nil {
+			return err
+		}
+		if len(pcm) == 0 {
+			return nil
+		}
+		if _, err := sink.Write(pcm); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Stop makes Stream return after the current block
+func (mp *MobilePlayer) Stop() {
+	mp.stopped.Store(true)
+}
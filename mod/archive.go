@@ -0,0 +1,98 @@
+package mod
+
+import (
+	"archive/zip"
+	"bytes"
+	"compress/gzip"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"path"
+	"strings"
+)
+
+// Module collections are mostly distributed as ZIP archives (or single gzipped files), so the loader
+// looks into archives and plays the first module inside. Like for crunched files, the archive is
+// detected by the file contents.
+
+// maxArchiveEntryLen limits the size of a file extracted from an archive
+const maxArchiveEntryLen = 64 << 20
+
+func isZIP(data []byte) bool {
+	return len(data) >= 4 && string(data[:4]) == "PK\x03\x04"
+}
+
+func isGzip(data []byte) bool {
+	return len(data) >= 2 && data[0] == 0x1F && data[1] == 0x8B
+}
+
+// isArchiveFileName returns true for file names of the archives the loader can look into
+func isArchiveFileName(name string) bool {
+	name = strings.ToLower(name)
+	return strings.HasSuffix(name, ".zip") || strings.HasSuffix(name, ".gz")
+}
+
+// loadZIP loads the first module in the ZIP archive data (read from the file fn)
+func loadZIP(fn string, data []byte) (Module, error) {
+	zr, err := zip.NewReader(bytes.NewReader(data), int64(len(data)))
+	if err != nil {
+		return Module{}, fmt.Errorf("ZIP archive: %v", err)
+	}
+	m, err := ReadFirstModFS(zr)
+	if fn != "" {
+		m.FileName = fn + "/" + m.FileName
+	}
+	return m, err
+}
+
+// loadGzip loads the module in the gzipped data (read from the file fn)
+func loadGzip(fn string, data []byte) (Module, error) {
+	zr, err := gzip.NewReader(bytes.NewReader(data))
+	if err != nil {
+		return Module{}, fmt.Errorf("gzip data: %v", err)
+	}
+	unpacked, err := io.ReadAll(io.LimitReader(zr, maxArchiveEntryLen+1))
+	if err != nil {
+		return Module{}, fmt.Errorf("gzip data: %v", err)
+	}
+	if len(unpacked) > maxArchiveEntryLen {
+		return Module{}, fmt.Errorf("gzip data: decompressed data exceeds %d bytes", maxArchiveEntryLen)
+	}
+	return LoadData(fn, unpacked)
+}
+
+// ReadFirstModFS reads the first module file (by extension or "mod." prefix, in lexical order of the
+// paths) in the file system fsys, e.g. an opened ZIP archive. If no file is named like a module, the
+// first file which loads is used.
+func ReadFirstModFS(fsys fs.FS) (Module, error) {
+	var files []string
+	err := fs.WalkDir(fsys, ".", func(name string, d fs.DirEntry, err error) error {
+		if err != nil || d.IsDir() {
+			return err
+		}
+		if info, err := d.Info(); err != nil || info.Size() > maxArchiveEntryLen {
+			return err
+		}
+		if isModFileName(d.Name()) {
+			files = append(files, name)
+			return fs.SkipAll
+		}
+		if !strings.HasPrefix(path.Base(name), ".") && !strings.HasPrefix(name, "__MACOSX/") {
+			files = append(files, name)
+		}
+		return nil
+	})
+	if err != nil {
+		return Module{}, err
+	}
+	if len(files) > 0 && isModFileName(path.Base(files[len(files)-1])) {
+		return ReadModFS(fsys, files[len(files)-1])
+	}
+	for _, name := range files {
+		if m, err := ReadModFS(fsys, name); err == nil {
+			return m, nil
+		}
+	}
+	return Module{}, errors.New("no module found in the archive")
+}
@@ -0,0 +1,170 @@
+package mod
+
+import (
+	"crypto/md5"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/b0nefish/go-modplayer/internal/errwriter"
+)
+
+// SongLengthEntry is the entry of a module in a song length database
+type SongLengthEntry struct {
+	File   string
+	MD5    string // of the file data
+	Length time.Duration
+	Looped bool // the song loops (Length is up to the start of the second pass)
+}
+
+// CollectionStats holds statistics over a collection of modules
+type CollectionStats struct {
+	Files     int               // modules loaded
+	Errors    map[string]string // files which could not be loaded, with the error
+	Formats   map[string]int    // by signature (or packer)
+	Channels  map[int]int
+	Effects   map[EffectType]int // number of uses
+	Looped    int                // number of songs which loop
+	TotalTime time.Duration
+	Songs     []SongLengthEntry
+}
+
+// isModFileName returns true for file names of modules (by extension or Amiga-style "mod." prefix)
+func isModFileName(name string) bool {
+	name = strings.ToLower(name)
+	return strings.HasSuffix(name, ".mod") || strings.HasSuffix(name, ".xm") || strings.HasSuffix(name, ".s3m") ||
+		strings.HasSuffix(name, ".it") || strings.HasPrefix(name, "mod.")
+}
+
+// loadForScan reads a module, turning a panic of the parser on broken data into an error
+func loadForScan(fn string, data []byte) (mod Module, err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("unable to parse module: %v", r)
+		}
+	}()
+	return LoadData(fn, data)
+}
+
+// ScanCollection reads all modules (also the ones in ZIP and gzip archives) below the directory root and
+// collects their statistics. Song lengths are computed by following the play flow of each song (see WalkSong).
+func ScanCollection(root string) (*CollectionStats, error) {
+	cs := &CollectionStats{
+		Errors:   map[string]string{},
+		Formats:  map[string]int{},
+		Channels: map[int]int{},
+		Effects:  map[EffectType]int{},
+	}
+	err := filepath.WalkDir(root, func(fn string, d fs.DirEntry, err error) error {
+		if err != nil || d.IsDir() || !isModFileName(d.Name()) && !isArchiveFileName(d.Name()) {
+			return err
+		}
+		data, err := os.ReadFile(fn)
+		if err != nil {
+			return err
+		}
+		mod, err := loadForScan(fn, data)
+		if err != nil {
+			cs.Errors[fn] = err.Error()
+			return nil
+		}
+		cs.Files++
+		format := strings.TrimRight(string(mod.Signature[:]), "\x00")
+		if mod.Format != FormatMOD {
+			format = mod.Format.String()
+		} else if mod.InstrTableLen == 15 {
+			format = "15 instruments"
+		}
+		if mod.Packer != "" {
+			format = mod.Packer
+		}
+		cs.Formats[format]++
+		if len(mod.Patterns) > 0 && len(mod.Patterns[0]) > 0 {
+			cs.Channels[len(mod.Patterns[0][0])]++
+		}
+		for eff, cnt := range mod.EffectStats().Total {
+			if cnt > 0 {
+				cs.Effects[EffectType(eff)] += cnt
+			}
+		}
+		length, looped := mod.songDuration(0)
+		if looped {
+			cs.Looped++
+		}
+		cs.TotalTime += length
+		sum := md5.Sum(data)
+		cs.Songs = append(cs.Songs, SongLengthEntry{File: fn, MD5: hex.EncodeToString(sum[:]), Length: length, Looped: looped})
+		return nil
+	})
+	return cs, err
+}
+
+// Print writes the statistics as text
+func (cs *CollectionStats) Print(w io.Writer) {
+	ew := errwriter.New(w)
+	ew.Printf("Modules: %d (%d could not be loaded)\n", cs.Files, len(cs.Errors))
+	ew.Printf("Total play time: %v (%d songs loop)\n", cs.TotalTime.Round(time.Second), cs.Looped)
+	ew.Printf("Formats:\n")
+	for _, f := range sortedKeys(cs.Formats) {
+		ew.Printf("    %-16s %d\n", f, cs.Formats[f])
+	}
+	ew.Printf("Channels:\n")
+	chans := make([]int, 0, len(cs.Channels))
+	for ch := range cs.Channels {
+		chans = append(chans, ch)
+	}
+	sort.Ints(chans)
+	for _, ch := range chans {
+		ew.Printf("    %-16d %d\n", ch, cs.Channels[ch])
+	}
+	ew.Printf("Most common effects:\n")
+	effs := make([]EffectType, 0, len(cs.Effects))
+	for eff := range cs.Effects {
+		effs = append(effs, eff)
+	}
+	sort.Slice(effs, func(i, j int) bool { return cs.Effects[effs[i]] > cs.Effects[effs[j]] })
+	for _, eff := range effs {
+		ew.Printf("    %-16v %d\n", eff, cs.Effects[eff])
+	}
+	for _, fn := range sortedKeys(cs.Errors) {
+		ew.Printf("Error: %s: %s\n", fn, cs.Errors[fn])
+	}
+}
+
+// sortedKeys returns the keys of the map sorted
+func sortedKeys[V any](m map[string]V) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// WriteSongLengths writes the song length database. The format follows the HVSC Songlengths.md5 file:
+//
+//	[Database]
+//	; path/of/the/file.mod
+//	<md5 of the file data>=<m:ss.sss>
+//
+// The path comments are informational only, entries are identified by the MD5 sum. Lengths of songs
+// which loop are marked with "(L)" after the time.
+func (cs *CollectionStats) WriteSongLengths(w io.Writer) error {
+	ew := errwriter.New(w)
+	ew.Printf("[Database]\n")
+	for _, s := range cs.Songs {
+		ms := s.Length.Milliseconds()
+		ew.Printf("; %s\n%s=%d:%02d.%03d", filepath.ToSlash(s.File), s.MD5, ms/60000, ms/1000%60, ms%1000)
+		if s.Looped {
+			ew.Printf("(L)")
+		}
+		ew.Printf("\n")
+	}
+	return ew.Err
+}
@@ -0,0 +1,106 @@
+package mod
+
+import (
+	"encoding/csv"
+	"fmt"
+	"io"
+	"math"
+	"strconv"
+
+	"github.com/b0nefish/go-modplayer/internal/errwriter"
+)
+
+// DumpFormat is the output format of DumpPattern
+type DumpFormat int
+
+// The pattern dump formats
+const (
+	DumpText DumpFormat = iota // tracker notation, a line per row: note, instrument, volume and effect of each channel
+	DumpCSV                    // a record per row and channel, with a header
+)
+
+// NoteName returns the name of the note (e.g. "C-2", see PeriodToNote) if its period is within a quarter
+// semitone of a note without finetune (in which pattern data is stored), otherwise the period. It returns
+// "===" for a key off and "---" if there is no note.
+func (n Note) NoteName() string {
+	switch {
+	case n.KeyOff:
+		return "==="
+	case n.Period == 0:
+		return "---"
+	}
+	note, octave := PeriodToNote(n.Period, 0)
+	if p, _ := NoteToPeriod(note, octave, 0); math.Abs(12*math.Log2(float64(p)/float64(n.Period))) < .25 {
+		return NoteString(note, octave)
+	}
+	return fmt.Sprintf("%03d", n.Period)
+}
+
+// hasEffect returns true if the note has an effect (an arpeggio only with parameters)
+func (n Note) hasEffect() bool {
+	return n.EffType != Arpeggio || n.Par() != 0
+}
+
+// DumpPattern writes the pattern n of the module to w in the given format, e.g. to inspect or diff it
+func (m Module) DumpPattern(n int, w io.Writer, format DumpFormat) error {
+	if n < 0 || n >= len(m.Patterns) {
+		return fmt.Errorf("pattern %d doesn't exist (the module has %d patterns)", n, len(m.Patterns))
+	}
+	if format == DumpCSV {
+		return m.dumpPatternCSV(n, w)
+	}
+	volumes := m.Format != FormatMOD // only the other formats have a volume column
+	ew := errwriter.New(w)
+	for row, line := range m.Patterns[n] {
+		ew.Printf("%02X", row)
+		for _, note := range line {
+			ins, vol, eff := "..", "..", "..."
+			if note.InsNum > 0 {
+				ins = fmt.Sprintf("%02X", note.InsNum)
+			}
+			if note.Vol > 0 {
+				vol = fmt.Sprintf("%02d", note.Vol-1)
+			}
+			if note.hasEffect() {
+				eff = fmt.Sprintf("%03X", note.EffCode)
+			}
+			if volumes {
+				ew.Printf(" | %s %s %s %s", note.NoteName(), ins, vol, eff)
+			} else {
+				ew.Printf(" | %s %s %s", note.NoteName(), ins, eff)
+			}
+		}
+		ew.Printf(" |\n")
+	}
+	return ew.Err
+}
+
+// dumpPatternCSV writes the pattern n as CSV; the effect is given by its name and its parameter byte (in
+// hex), empty fields stand for no instrument, volume or effect
+func (m Module) dumpPatternCSV(n int, w io.Writer) error {
+	cw := csv.NewWriter(w)
+	cw.Write([]string{"row", "channel", "note", "period", "instrument", "volume", "effect", "parameter"})
+	for row, line := range m.Patterns[n] {
+		for ch, note := range line {
+			rec := []string{strconv.Itoa(row), strconv.Itoa(ch), note.NoteName(), "", "", "", "", ""}
+			if rec[2] == "---" {
+				rec[2] = ""
+			}
+			if note.Period > 0 {
+				rec[3] = strconv.Itoa(note.Period)
+			}
+			if note.InsNum > 0 {
+				rec[4] = strconv.Itoa(note.InsNum)
+			}
+			if note.Vol > 0 {
+				rec[5] = strconv.Itoa(note.Vol - 1)
+			}
+			if note.hasEffect() {
+				rec[6], rec[7] = note.EffType.String(), fmt.Sprintf("%02X", note.Par())
+			}
+			cw.Write(rec)
+		}
+	}
+	cw.Flush()
+	return cw.Error()
+}
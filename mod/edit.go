@@ -0,0 +1,288 @@
+package mod
+
+import (
+	"errors"
+	"fmt"
+	"math"
+)
+
+// The editing functions change the module in place; they must not be called while a Player plays it.
+
+// NewEffect returns the effect given by a ProTracker command (e.g. 0xC40 sets the volume to 64, 0xE61
+// loops the pattern once)
+func NewEffect(code uint16) Effect {
+	code &= 0xFFF
+	if code>>8 != 0xE {
+		return Effect{EffectType(code >> 8), code}
+	}
+	return Effect{EffectType(16 + code>>4&0x0F), code}
+}
+
+// NewModule creates an empty MOD module with the given number of channels, e.g. for generating music:
+// 31 instruments without samples and a pattern table with a single empty pattern
+func NewModule(name string, channels int) (Module, error) {
+	if channels < 1 || channels > 32 {
+		return Module{}, fmt.Errorf("invalid number of channels %d (1-32)", channels)
+	}
+	if len(name) > 20 {
+		return Module{}, fmt.Errorf("module name %q too long (at most 20 characters)", name)
+	}
+	m := Module{Name: name, Format: FormatMOD, InstrTableLen: 31, Instruments: make([]Instrument, 32)}
+	for i := range m.Instruments {
+		m.Instruments[i].Num = i
+		m.Instruments[i].SetFinetune(0)
+	}
+	m.Instruments[0].Name = "NOP"
+	m.Patterns = [][][]Note{m.emptyPattern(64, channels)}
+	m.PatternTable = []int{0}
+	m.PatternCnt = 1
+	return m, nil
+}
+
+// emptyPattern returns a pattern without notes
+func (m *Module) emptyPattern(rows, channels int) [][]Note {
+	patt := make([][]Note, rows)
+	for i := range patt {
+		patt[i] = make([]Note, channels)
+		for j := range patt[i] {
+			patt[i][j].Ins = &m.Instruments[0]
+		}
+	}
+	return patt
+}
+
+// noteInstrument returns the instrument played by notes with the instrument number insNum: like when
+// loading, numbers of instruments without sample refer to the empty dummy
+func (m *Module) noteInstrument(insNum int) *Instrument {
+	if insNum <= 0 || insNum >= len(m.Instruments) || !m.Instruments[insNum].HasSample() {
+		return &m.Instruments[0]
+	}
+	return &m.Instruments[insNum]
+}
+
+// maxRows returns the maximum number of rows of a pattern in the format of the module
+func (m *Module) maxRows() int {
+	if m.Format == FormatMOD || m.Format == FormatS3M {
+		return 64
+	}
+	return 256
+}
+
+// SetNote sets the note in the given row and channel (0-based) of a pattern. The instrument is given by
+// n.InsNum (n.Ins is set from it), the effect by n.Effect (see NewEffect).
+func (m *Module) SetNote(pattern, row, ch int, n Note) error {
+	if pattern < 0 || pattern >= len(m.Patterns) {
+		return fmt.Errorf("pattern %d doesn't exist (the module has %d patterns)", pattern, len(m.Patterns))
+	}
+	if row < 0 || row >= len(m.Patterns[pattern]) {
+		return fmt.Errorf("row %d out of range (pattern %d has %d rows)", row, pattern, len(m.Patterns[pattern]))
+	}
+	if ch < 0 || ch >= len(m.Patterns[pattern][row]) {
+		return fmt.Errorf("channel %d out of range (the module has %d channels)", ch, len(m.Patterns[pattern][row]))
+	}
+	switch {
+	case n.InsNum < 0 || n.InsNum >= len(m.Instruments):
+		return fmt.Errorf("instrument %d doesn't exist", n.InsNum)
+	case n.Period < 0 || m.Format == FormatMOD && n.Period > 0xFFF:
+		return fmt.Errorf("invalid period %d", n.Period)
+	case n.Vol < 0 || n.Vol > 65:
+		return fmt.Errorf("invalid volume column %d", n.Vol)
+	case int(n.EffType) >= EffectTypeCnt || m.Format == FormatMOD && n.EffCode > 0xFFF:
+		return fmt.Errorf("invalid effect %v (%03X)", n.EffType, n.EffCode)
+	}
+	n.Ins = m.noteInstrument(n.InsNum)
+	m.Patterns[pattern][row][ch] = n
+	return nil
+}
+
+// InsertPattern inserts an empty pattern with the given number of rows before the pattern at (at the
+// end for len(m.Patterns)); the pattern table is updated, so the same patterns are played.
+func (m *Module) InsertPattern(at, rows int) error {
+	if at < 0 || at > len(m.Patterns) {
+		return fmt.Errorf("pattern %d out of range (the module has %d patterns)", at, len(m.Patterns))
+	}
+	if rows < 1 || rows > m.maxRows() {
+		return fmt.Errorf("invalid number of rows %d (1-%d)", rows, m.maxRows())
+	}
+	if m.Format == FormatMOD && len(m.Patterns) >= 128 {
+		return errors.New("a MOD file has at most 128 patterns")
+	}
+	m.Patterns = append(m.Patterns, nil)
+	copy(m.Patterns[at+1:], m.Patterns[at:])
+	m.Patterns[at] = m.emptyPattern(rows, m.ChannelCount())
+	for i, patt := range m.PatternTable {
+		if patt >= at {
+			m.PatternTable[i]++
+		}
+	}
+	m.PatternCnt = len(m.Patterns)
+	return nil
+}
+
+// AppendOrder appends the pattern to the pattern table
+func (m *Module) AppendOrder(pattern int) error {
+	if pattern < 0 || pattern >= len(m.Patterns) {
+		return fmt.Errorf("pattern %d doesn't exist (the module has %d patterns)", pattern, len(m.Patterns))
+	}
+	maxOrders := 256
+	if m.Format == FormatMOD {
+		maxOrders = 128
+	}
+	if len(m.PatternTable) >= maxOrders {
+		return fmt.Errorf("the pattern table is full (%d orders)", maxOrders)
+	}
+	m.PatternTable = append(m.PatternTable, pattern)
+	return nil
+}
+
+// AddInstrument adds an instrument with the sample pcm (played at full volume, without finetune) and
+// returns its number. The loop is given by its start and length (0: no loop) in samples. In MOD modules,
+// the first instrument without sample and name is used; lengths and loop points have to be even there,
+// like the file format stores them.
+func (m *Module) AddInstrument(name string, pcm []int8, repStart, repLen int) (int, error) {
+	if len(pcm) == 0 {
+		return 0, errors.New("empty sample")
+	}
+	if repLen != 0 && (repStart < 0 || repLen < 2 || repStart+repLen > len(pcm)) {
+		return 0, fmt.Errorf("loop %d+%d outside of the sample (%d samples)", repStart, repLen, len(pcm))
+	}
+	if len(m.SampleMaps) > 0 {
+		return 0, errors.New("instruments with sample maps can't be added")
+	}
+	num := len(m.Instruments)
+	if m.Format == FormatMOD {
+		switch {
+		case len(name) > 22:
+			return 0, fmt.Errorf("instrument name %q too long (at most 22 characters)", name)
+		case len(pcm) > 0x1FFFE:
+			return 0, fmt.Errorf("sample too long (%d, at most %d samples)", len(pcm), 0x1FFFE)
+		case len(pcm)%2 != 0 || repStart%2 != 0 || repLen%2 != 0:
+			return 0, errors.New("the sample length and the loop have to be even")
+		}
+		for i := 1; i < len(m.Instruments) && num == len(m.Instruments); i++ {
+			if !m.Instruments[i].HasSample() && m.Instruments[i].Name == "" {
+				num = i
+			}
+		}
+		if num == len(m.Instruments) {
+			return 0, fmt.Errorf("no free instrument (a MOD file has at most %d)", m.InstrTableLen)
+		}
+	} else {
+		m.Instruments = append(m.Instruments, Instrument{})
+		m.InstrTableLen = len(m.Instruments) - 1
+	}
+
+	ins := Instrument{Num: num, Name: name, Len: len(pcm), Volume: 64, RepStart: repStart, RepLen: repLen,
+		Sample: append([]int8(nil), pcm...)}
+	ins.SetFinetune(0)
+	m.Instruments[num] = ins
+	// the instruments may have moved, and notes with the new number play it now
+	for _, patt := range m.Patterns {
+		for _, line := range patt {
+			for i := range line {
+				line[i].Ins = m.noteInstrument(line[i].InsNum)
+			}
+		}
+	}
+	return num, nil
+}
+
+// Transpose transposes all notes of the module by the given number of semitones. In MOD modules, notes of
+// the period table are moved in the table and limited to C-1..B-3, the notes ProTracker plays; the periods
+// of other formats are scaled and limited to the notes C-0..B-9 of a sample at 8363 Hz. It returns the
+// number of notes which have been limited. The sample chosen by the keymap of XM and IT instruments isn't
+// changed.
+func (m *Module) Transpose(semitones int) (clamped int) {
+	if semitones == 0 {
+		return 0
+	}
+	const first, last = 12, 47 // C-1 and B-3 in the period tables
+	pt := PeriodTables[0]
+	lo, hi := pt[last].period, pt[first].period
+	if m.Format != FormatMOD {
+		lo, hi = s3mPeriod(119, 8363), s3mPeriod(0, 8363)
+	}
+	for _, patt := range m.Patterns {
+		for _, line := range patt {
+			for i := range line {
+				n := &line[i]
+				if n.Period == 0 {
+					continue
+				}
+				if _, idx, err := pt.FindPeriod(n.Period); err == nil && m.Format == FormatMOD {
+					idx += semitones
+					switch {
+					case idx < first:
+						idx, clamped = first, clamped+1
+					case idx > last:
+						idx, clamped = last, clamped+1
+					}
+					n.Period = pt[idx].period
+					continue
+				}
+				p := int(math.Round(float64(n.Period) * math.Pow(2, -float64(semitones)/12)))
+				switch {
+				case p < lo:
+					p, clamped = lo, clamped+1
+				case p > hi:
+					p, clamped = hi, clamped+1
+				}
+				n.Period = p
+			}
+		}
+	}
+	return clamped
+}
+
+// SwapChannels swaps the channels a and b (0-based) in all patterns
+func (m *Module) SwapChannels(a, b int) error {
+	order := make([]int, m.ChannelCount())
+	for i := range order {
+		order[i] = i
+	}
+	if a < 0 || a >= len(order) || b < 0 || b >= len(order) {
+		return fmt.Errorf("channels %d and %d out of range (the module has %d channels)", a, b, len(order))
+	}
+	order[a], order[b] = b, a
+	return m.RemapChannels(order)
+}
+
+// RemapChannels rearranges the channels of all patterns: channel i plays the old channel order[i], or
+// nothing for -1. The number of channels changes to len(order), so channels which aren't in order are
+// removed (e.g. to reduce a module to 4 channels). The initial panning moves with the channels, except in
+// MOD modules, which keep the Amiga panning of the channel numbers.
+func (m *Module) RemapChannels(order []int) error {
+	chans := m.ChannelCount()
+	if len(order) < 1 || len(order) > 32 {
+		return fmt.Errorf("invalid number of channels %d (1-32)", len(order))
+	}
+	for _, ch := range order {
+		if ch < -1 || ch >= chans {
+			return fmt.Errorf("channel %d out of range (the module has %d channels)", ch, chans)
+		}
+	}
+	for p, patt := range m.Patterns {
+		for r, line := range patt {
+			remapped := make([]Note, len(order))
+			for i, ch := range order {
+				if ch < 0 {
+					remapped[i].Ins = &m.Instruments[0]
+				} else {
+					remapped[i] = line[ch]
+				}
+			}
+			m.Patterns[p][r] = remapped
+		}
+	}
+	if len(m.ChannelPan) > 0 {
+		pan := make([]int, len(order))
+		for i, ch := range order {
+			pan[i] = 128
+			if ch >= 0 && ch < len(m.ChannelPan) {
+				pan[i] = m.ChannelPan[ch]
+			}
+		}
+		m.ChannelPan = pan
+	}
+	return nil
+}
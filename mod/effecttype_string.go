@@ -1,6 +1,6 @@
 // Code generated by "stringer -type=EffectType"; DO NOT EDIT.
 
-package main
+package mod
 
 import "strconv"
 
@@ -40,11 +40,21 @@ func _() {
 	_ = x[NoteDelay-29]
 	_ = x[PatternDelay-30]
 	_ = x[InvertLoop-31]
+	_ = x[SetPanning-32]
+	_ = x[SetGlobalVolume-33]
+	_ = x[GlobalVolSlide-34]
+	_ = x[KeyOff-35]
+	_ = x[SetEnvelopePos-36]
+	_ = x[PanSlide-37]
+	_ = x[MultiRetrig-38]
+	_ = x[Tremor-39]
+	_ = x[ExtraFineSlideUp-40]
+	_ = x[ExtraFineSlideDown-41]
 }
 
-const _EffectType_name = "ArpeggioSlideUpSlideDownPortamentoVibratoPortamentoVolSlideVibratoVolSlideTremoloNotUsed8SetSampleOffsetVolSlidePositionJumpSetVolPatternBreakExtendedSetSpeedSetFilterFineSlideUpFineSlideDownGlissandoControlSetVibratoWaveformSetFinetunePatternLoopSetTremoloWaveformNotUsedE8RetrigNoteFineVolSlideUpFineVolSlideDownNoteCutNoteDelayPatternDelayInvertLoop"
+const _EffectType_name = "ArpeggioSlideUpSlideDownPortamentoVibratoPortamentoVolSlideVibratoVolSlideTremoloNotUsed8SetSampleOffsetVolSlidePositionJumpSetVolPatternBreakExtendedSetSpeedSetFilterFineSlideUpFineSlideDownGlissandoControlSetVibratoWaveformSetFinetunePatternLoopSetTremoloWaveformNotUsedE8RetrigNoteFineVolSlideUpFineVolSlideDownNoteCutNoteDelayPatternDelayInvertLoopSetPanningSetGlobalVolumeGlobalVolSlideKeyOffSetEnvelopePosPanSlideMultiRetrigTremorExtraFineSlideUpExtraFineSlideDown"
 
-var _EffectType_index = [...]uint16{0, 8, 15, 24, 34, 41, 59, 74, 81, 89, 104, 112, 124, 130, 142, 150, 158, 167, 178, 191, 207, 225, 236, 247, 265, 274, 284, 298, 314, 321, 330, 342, 352}
+var _EffectType_index = [...]uint16{0, 8, 15, 24, 34, 41, 59, 74, 81, 89, 104, 112, 124, 130, 142, 150, 158, 167, 178, 191, 207, 225, 236, 247, 265, 274, 284, 298, 314, 321, 330, 342, 352, 362, 377, 391, 397, 411, 419, 430, 436, 452, 470}
 
 func (i EffectType) String() string {
 	if i < 0 || i >= EffectType(len(_EffectType_index)-1) {
@@ -0,0 +1,709 @@
+// Package mod reads Amiga MOD files (and packed variants) and provides the module data and analyses of
+// the song structure, independent of playback.
+package mod
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"log/slog"
+	"math"
+	"strings"
+	"time"
+	"unsafe"
+)
+
+// EffectType represents a module effect
+type EffectType int
+
+const (
+	// Arpeggio 0xy: x-first halfnote add, y-second - period cycles between p, p+x, p+y each tick
+	Arpeggio EffectType = iota
+	// SlideUp 1xx: upspeed - period is decreased by xx each tick
+	SlideUp
+	// SlideDown 2xx: downspeed - period is increased by xx each tick
+	SlideDown
+	// Portamento 3xx: up/down speed
+	Portamento
+	// Vibrato 4xy: x-speed, y-depth
+	Vibrato
+	// PortamentoVolSlide 5xy: x-upspeed, y-downspeed
+	PortamentoVolSlide
+	// VibratoVolSlide 6xy: x-upspeed, y-downspeed
+	VibratoVolSlide
+	// Tremolo 7xy: x-speed,   y-depth
+	Tremolo
+	// NotUsed8 value 8, unused
+	NotUsed8
+	// SetSampleOffset 9xx: offset (23 -> 2300)
+	SetSampleOffset
+	// VolSlide Axy: x-upspeed, y-downspeed
+	VolSlide
+	// PositionJump Bxx: songposition
+	PositionJump
+	// SetVol  Cxx: volume, 00-40
+	SetVol
+	// PatternBreak Dxx: break position in next patt
+	PatternBreak
+	// Extended Exy: see below...
+	Extended
+	// SetSpeed  Fxx: speed (00-1F) / tempo (20-FF)
+	SetSpeed
+
+	// SetFilter E0x: 0-filter on, 1-filter off
+	SetFilter
+	// FineSlideUp E1x: value
+	FineSlideUp
+	// FineSlideDown E2x: value
+	FineSlideDown
+	// GlissandoControl E3x: 0-off, 1-on (use with tonep.)
+	GlissandoControl
+	// SetVibratoWaveform E4x: 0-sine, 1-ramp down, 2-square
+	SetVibratoWaveform
+	// SetFinetune E5x: set finetune
+	SetFinetune
+	// PatternLoop E6x: set loop / jump to loop, play x times
+	PatternLoop
+	// SetTremoloWaveform E7x: 0-sine, 1-ramp down. 2-square
+	SetTremoloWaveform
+	// NotUsedE8 unused extended command
+	NotUsedE8
+	// RetrigNote E9x: retrig from note + x vblanks
+	RetrigNote
+	// FineVolSlideUp EAx: add x to volume
+	FineVolSlideUp
+	// FineVolSlideDown EBx: subtract x from volume
+	FineVolSlideDown
+	// NoteCut ECx: cut from note + x vblanks
+	NoteCut
+	// NoteDelay EDx: delay note x vblanks
+	NoteDelay
+	// PatternDelay EEx: delay pattern x notes
+	PatternDelay
+	// InvertLoop EFx: speed
+	InvertLoop
+
+	// effects of the XM format (with their letters in FastTracker II)
+
+	// SetPanning 8xx: panning, 00 (left) - FF (right)
+	SetPanning
+	// SetGlobalVolume Gxx: global volume, 00-40
+	SetGlobalVolume
+	// GlobalVolSlide Hxy: x-upspeed, y-downspeed
+	GlobalVolSlide
+	// KeyOff Kxx: release the note after xx ticks
+	KeyOff
+	// SetEnvelopePos Lxx: set the volume envelope position
+	SetEnvelopePos
+	// PanSlide Pxy: x-right speed, y-left speed
+	PanSlide
+	// MultiRetrig Rxy: x-volume change, y-retrig interval in ticks
+	MultiRetrig
+	// Tremor Txy: x-ticks on, y-ticks off
+	Tremor
+	// ExtraFineSlideUp X1x: value/4
+	ExtraFineSlideUp
+	// ExtraFineSlideDown X2x: value/4
+	ExtraFineSlideDown
+)
+
+//go:generate stringer -type=EffectType
+
+// EffectTypeCnt is the number of effect types
+const EffectTypeCnt = len(_EffectType_index) - 1
+
+// Effect is an effect/command (encoded as part of a note, but may affect the whole song)
+type Effect struct {
+	EffType EffectType
+	EffCode uint16
+}
+
+// Par returns the parameter byte in its entirety
+func (e Effect) Par() int {
+	return int(e.EffCode & 0xFF)
+}
+
+// ParX returns the first nibble of the parameter byte (only for "primary" commands/effects)
+func (e Effect) ParX() int {
+	return int(e.EffCode & 0xF0 >> 4)
+}
+
+// ParY returns the second nibble of the parameter byte (this is the only parameter for the "extended" commands/effects)
+func (e Effect) ParY() int {
+	return int(e.EffCode & 0x0F)
+}
+
+func findEffect(notes []Note, eff EffectType) (int, bool) {
+	for _, note := range notes {
+		if note.EffType == eff {
+			return note.Par(), true
+		}
+	}
+	return 0, false
+}
+
+// ############################################################################
+
+// Instrument represents an instrument used in a MOD file, including the sample data
+type Instrument struct {
+	Num      int
+	Name     string
+	Len      int
+	Volume   int
+	RepStart int
+	RepLen   int
+	Offset   int
+	Sample   []int8
+
+	Envelope *Envelope // volume envelope (XM, IT; nil if there is none)
+	FadeOut  int       // volume fadeout per tick after the note has been released (XM, IT; 65536 = full volume)
+
+	finetune int           // -8..7
+	samples  *SampleCache  // streamed sample data (if Sample is nil)
+	stream   *sampleStream // how the streamed samples are stored
+	*PeriodTable
+}
+
+// Envelope is the volume envelope of an instrument (XM, IT): the volume (0..64) at the given ticks after the
+// start of the note, linearly interpolated in between
+type Envelope struct {
+	Points    []EnvelopePoint
+	Sustain   int // index of the point held until the note is released (-1: none)
+	LoopStart int // index of the point the loop returns to
+	LoopEnd   int // index of the point at which the envelope loops (-1: no loop)
+}
+
+// EnvelopePoint is a point of an Envelope
+type EnvelopePoint struct {
+	Tick, Value int
+}
+
+// Value returns the envelope value at the given tick
+func (e *Envelope) Value(tick int) int {
+	if len(e.Points) == 0 {
+		return 64
+	}
+	for i := 1; i < len(e.Points); i++ {
+		p0, p1 := e.Points[i-1], e.Points[i]
+		if tick < p1.Tick {
+			if tick <= p0.Tick || p1.Tick == p0.Tick {
+				return p0.Value
+			}
+			return p0.Value + (p1.Value-p0.Value)*(tick-p0.Tick)/(p1.Tick-p0.Tick)
+		}
+	}
+	return e.Points[len(e.Points)-1].Value
+}
+
+// SampleMap is an instrument with several samples (XM, IT), which picks the sample depending on the note
+type SampleMap struct {
+	Name    string
+	Samples []int   // the samples of the instrument (indices into Module.Instruments)
+	Keymap  [96]int // the sample for each note (C-0 .. B-7; index into Samples)
+}
+
+// IncDec increments/decrements the given period by the given amount of halfNotes and returns the new period
+func (i *Instrument) IncDec(period, halfNotes int) int {
+	if halfNotes == 0 || i == nil || i.PeriodTable == nil {
+		return period
+	}
+	np, err := i.IncDecPeriod(period, halfNotes)
+	if err != nil {
+		// not a note of the table (e.g. periods converted from other formats)
+		return int(math.Round(float64(period) / math.Pow(2, float64(halfNotes)/12)))
+	}
+	return np.period
+}
+
+// Semitone returns the given period snapped to a semitone of the instrument's period table (see
+// PeriodTable.SemitonePeriod)
+func (i *Instrument) Semitone(period int) int {
+	if i == nil || i.PeriodTable == nil {
+		return period
+	}
+	return i.SemitonePeriod(period)
+}
+
+// GetPeriodDelta gets the difference between the given period to reach the given amount of halfNotes
+func (i *Instrument) GetPeriodDelta(period, halfNotes int) int {
+	if halfNotes == 0 || i.PeriodTable == nil {
+		return 0
+	}
+	return intAbs(i.IncDec(period, halfNotes) - period)
+}
+
+func intAbs(i int) int {
+	if i < 0 {
+		return -i
+	}
+	return i
+}
+
+// Finetune gets the current finetune value for this instrument (-8..7, in steps of 1/8 half-note)
+func (i *Instrument) Finetune() int {
+	return i.finetune
+}
+
+// SetFinetune sets the finetune value and the period table. f is the signed nibble as stored in the file
+// (0..7 for 0..7, 8..15 for -8..-1); values -8..-1 are accepted as well.
+func (i *Instrument) SetFinetune(f int) {
+	i.finetune = signedNibble(f)
+	i.PeriodTable = &PeriodTables[f&0x0F]
+}
+
+// NotePeriod returns the period at which a note is played with this instrument's finetune
+func (i *Instrument) NotePeriod(period int) int {
+	return FinetunedPeriod(period, i.finetune)
+}
+
+// signedNibble converts the lower 4 bits of n from two's complement to -8..7
+func signedNibble(n int) int {
+	n &= 0x0F
+	if n > 7 {
+		n -= 16
+	}
+	return n
+}
+
+// ReadInstrument constructs an instrument from the given instrData slice
+func ReadInstrument(instrData []byte) (ins Instrument, err error) {
+	ins.Name = strings.Trim(string(instrData[0:22]), " \t\n\v\f\r\x00")
+
+	ins.Len = int(instrData[22])<<9 | int(instrData[23])<<1
+	if ins.Len <= 2 {
+		ins.Len = 0 // a length of 1 word still means an empty sample
+	}
+
+	ins.SetFinetune(int(instrData[24] & 0x0F))
+
+	ins.Volume = int(instrData[25])
+
+	ins.RepStart = int(instrData[26])<<9 | int(instrData[27])<<1
+	if repLen := int(instrData[28])<<8 | int(instrData[29]); repLen > 1 {
+		ins.RepLen = repLen << 1
+	}
+	return
+}
+
+// int8Slice returns the bytes of b as signed 8-bit samples without copying them: the samples share the
+// memory of b
+func int8Slice(b []byte) []int8 {
+	if len(b) == 0 {
+		return nil
+	}
+	return unsafe.Slice((*int8)(unsafe.Pointer(&b[0])), len(b))
+}
+
+// checkLoop makes sure that the loop of the instrument lies within the sample (some trackers wrote loop
+// values beyond the sample end) and records a warning if it had to be changed
+func (i *Instrument) checkLoop(mod *Module) {
+	switch {
+	case i.RepLen == 0:
+	case i.RepStart+2 >= i.Len:
+		mod.Warnf("instrument %d: loop start %d is past the sample end (%d), loop removed", i.Num, i.RepStart, i.Len)
+		i.RepStart, i.RepLen = 0, 0
+	case i.RepStart+i.RepLen > i.Len:
+		mod.Warnf("instrument %d: loop end %d is past the sample end (%d), loop shortened", i.Num, i.RepStart+i.RepLen, i.Len)
+		i.RepLen = i.Len - i.RepStart
+	}
+}
+
+// ############################################################################
+
+// Note is an individual note, containing an Instrument, a Period and an Effect (with parameters)
+type Note struct {
+	InsNum int
+	Ins    *Instrument
+	Period int
+	Vol    int  // volume column (XM, S3M, IT): volume + 1 (1..65), 0 if empty
+	KeyOff bool // release the note (XM "===", IT note off), instead of playing a new one
+	Effect
+}
+
+func (n Note) String() string {
+	if !n.KeyOff && n.Period == 0 && n.InsNum == 0 && n.EffCode == 0 {
+		return "---i--e---"
+	}
+	return n.NoteName() + fmt.Sprintf("i%02xe%03x", n.InsNum, n.EffCode)
+}
+
+// Details prints detailed info about the given note
+func (n Note) Details() {
+	fmt.Println("Ins", n.InsNum)
+	fmt.Println("Period", n.Period)
+	fmt.Println("Effect", n.Effect)
+}
+
+// ReadNote constructs a Note from the given noteData slice. Without the instrument in the instrument
+// table of the module (e.g. for a note decoded on its own), Ins is nil.
+func ReadNote(noteData []byte, mod *Module) (n Note) {
+	n.InsNum = int(noteData[0]&0xF0 | (noteData[2]&0xF0)>>4)
+	switch {
+	case n.InsNum >= len(mod.Instruments):
+		if n.InsNum > 0 {
+			mod.Warnf("note references instrument %d, but the module only has %d instruments", n.InsNum, mod.InstrTableLen)
+		}
+	case n.InsNum > mod.InstrTableLen:
+		// e.g. instrument numbers > 15 in old modules - we keep the number but play nothing
+		mod.Warnf("note references instrument %d, but the module only has %d instruments", n.InsNum, mod.InstrTableLen)
+		n.Ins = &mod.Instruments[0]
+	case n.InsNum > 0 && mod.Instruments[n.InsNum].Len == 0:
+		mod.Warnf("note references empty instrument %d", n.InsNum)
+		n.Ins = &mod.Instruments[0]
+	default:
+		n.Ins = &mod.Instruments[n.InsNum]
+	}
+
+	bsl := []byte{noteData[0] & 0x0F, noteData[1]}
+	n.Period = (int)(binary.BigEndian.Uint16(bsl))
+
+	n.Effect = NewEffect(uint16(noteData[2]&0x0F)<<8 | uint16(noteData[3]))
+
+	return
+}
+
+// Pattern is a 2-dimensional slice of Notes (lines x channels)
+//type Pattern [][]Note FIXME not used - use or remove!
+
+// ############################################################################
+
+// Module contains the data for a MOD file (or a module converted from another format)
+type Module struct {
+	FileName         string
+	Name             string
+	Format           Format
+	Signature        [4]byte
+	InstrTableLen    int
+	PatternCnt       int
+	Instruments      []Instrument // the samples; index 0 is an empty dummy for notes without instrument
+	SampleMaps       []SampleMap  // instruments with several samples (XM, IT; empty for MOD and S3M)
+	PatternTable     []int
+	Patterns         [][][]Note
+	InitialTempo     int      // ticks per line at the start of the song (0: 6)
+	InitialBPM       int      // BPM at the start of the song (0: 125)
+	InitialGlobalVol int      // global volume at the start of the song (0: 64)
+	ChannelPan       []int    // initial panning of the channels, 0 (left) - 255 (right); empty: Amiga panning
+	Warnings         []string // problems found while reading the file which did not prevent loading it
+	Packer           string   // name of the packed format the module was converted from (empty if none)
+	Trailing         []byte   // data appended to the file after the end of the module (text, images, ...)
+	TrailingType     string   // guessed type of the trailing data
+	samples          *SampleCache
+}
+
+// ChannelCount returns the number of channels of the module
+func (m Module) ChannelCount() int {
+	if len(m.Patterns) == 0 || len(m.Patterns[0]) == 0 {
+		return 4
+	}
+	return len(m.Patterns[0][0])
+}
+
+// SoundtrackerEffects are the effects known to the Soundtracker versions which wrote modules with 15
+// instruments; the other effect numbers are ignored when playing these modules
+var SoundtrackerEffects = map[EffectType]bool{
+	Arpeggio:     true,
+	SlideUp:      true,
+	SlideDown:    true,
+	PositionJump: true,
+	SetVol:       true,
+	PatternBreak: true,
+	SetFilter:    true,
+	SetSpeed:     true,
+}
+
+// IsSoundtracker reports whether the module is an old Soundtracker module with 15 instruments. These are
+// timed by the vertical blank (Fxx only sets the ticks per line) and only use the SoundtrackerEffects.
+func (m Module) IsSoundtracker() bool {
+	return m.Format == FormatMOD && m.InstrTableLen == 15
+}
+
+// Warnf records a warning for the module (identical warnings are only recorded once)
+func (m *Module) Warnf(format string, a ...interface{}) {
+	w := fmt.Sprintf(format, a...)
+	for _, ow := range m.Warnings {
+		if ow == w {
+			return
+		}
+	}
+	m.Warnings = append(m.Warnings, w)
+	logEvent(slog.LevelWarn, "module problem", "file", m.FileName, "warning", w)
+}
+
+// Info prints information on the module file
+func (m Module) Info() {
+	fmt.Println("FileName:", m.FileName)
+	fmt.Println("Name:", m.Name)
+	if m.Format != FormatMOD {
+		fmt.Println("Format:", m.Format)
+	} else {
+		fmt.Printf("Signature: %#v %s\n", m.Signature, string(m.Signature[0:4]))
+	}
+	if m.Packer != "" {
+		fmt.Println("Converted from:", m.Packer)
+	}
+	if len(m.Trailing) > 0 {
+		fmt.Printf("Trailing data: %d bytes (%s)\n", len(m.Trailing), m.TrailingType)
+	}
+	fmt.Println("Patterns:", len(m.Patterns))
+	fmt.Println("Pattern sequence:", m.PatternTable)
+	if unused := m.UnreferencedPatterns(); len(unused) > 0 {
+		fmt.Println("Unreferenced patterns:", unused)
+	}
+	if d, looped := m.songDuration(0); looped {
+		fmt.Println("Duration:", d.Round(time.Millisecond), "(then loops)")
+	} else {
+		fmt.Println("Duration:", d.Round(time.Millisecond))
+	}
+	fmt.Println("Instruments:")
+	for idx, ins := range m.Instruments {
+		if ins.Len == 0 {
+			continue
+		}
+		fmt.Printf("    %d %s : Offs %x, Len %x, RepS %x, RepL %x; Finetune %d, Vol %d\n",
+			idx, ins.Name, ins.Offset, ins.Len, ins.RepStart, ins.RepLen, ins.Finetune(), ins.Volume)
+	}
+
+	fmt.Print("Effect counts: ")
+	for eff, cnt := range m.EffectStats().Total {
+		if cnt == 0 {
+			continue
+		}
+		fmt.Printf("%v: %d; ", EffectType(eff), cnt)
+	}
+	fmt.Println()
+	for _, w := range m.Warnings {
+		fmt.Println("Warning:", w)
+	}
+	fmt.Println()
+}
+
+// ErrTruncated is returned (wrapped) for MOD files which end before all of their pattern or sample data
+var ErrTruncated = errors.New("truncated module")
+
+// ReadModFile reads the full MOD file given by fn and loads the data into the relevant objects
+func ReadModFile(fn string) (mod Module, err error) {
+	data, err := ioutil.ReadFile(fn)
+	if err != nil {
+		return
+	}
+	return ReadModData(fn, data)
+}
+
+// ReadMod reads a MOD file from r (e.g. an HTTP response, an archive entry or an in-memory buffer) and
+// loads the data into the relevant objects
+func ReadMod(r io.Reader) (Module, error) {
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return Module{}, err
+	}
+	return ReadModData("", data)
+}
+
+// ReadModData loads the MOD file data (read from the file fn, which is only used as the module's FileName)
+// into the relevant objects. The samples aren't copied but refer to data, which must not be changed
+// afterwards.
+func ReadModData(fn string, data []byte) (mod Module, err error) {
+	return readModDataCached(fn, memSource(data), nil)
+}
+
+// readModDataCached loads the MOD file data like ReadModData, but only sets up the samples for streaming
+// through the cache (if it is not nil)
+func readModDataCached(fn string, src *source, cache *SampleCache) (mod Module, err error) {
+	mod.FileName = fn
+	mod.Format = FormatMOD
+	if up, ok := FindUnpacker(src.data); ok {
+		data, err := up.Unpack(src.prefix(src.size))
+		if err != nil {
+			return mod, err
+		}
+		src = memSource(data)
+		mod.Packer = up.Name
+		cache = nil // the offsets refer to the converted data
+	}
+	mod.samples = cache
+
+	// the smallest possible module: a header with 15 instruments, without any patterns
+	const minHeaderLen = 20 + 15*30 + 2 + 128
+	if src.size < minHeaderLen {
+		return mod, fmt.Errorf("file too short for a MOD header (%d bytes, need at least %d)", src.size, minHeaderLen)
+	}
+	data := src.data // the header (streamed modules: the start of the file)
+
+	// Module Name
+	mod.Name = strings.Trim(string(data[0:20]), " \t\n\v\f\r\x00")
+
+	// Signature (also tells us the number of instruments)
+	if src.size >= 1084 {
+		copy(mod.Signature[0:4], data[1080:1084])
+	}
+	// These are the default parameters for "original" SoundTracker modules (without signature)
+	mod.InstrTableLen = 31
+	signatureLen := 4
+	for _, c := range mod.Signature {
+		// if the signature is not an ASCII string, we have an old module with 15 instruments
+		if c < 32 {
+			mod.InstrTableLen = 15
+			signatureLen = 0 // in old modules without "M.K." (or similar) signature, there is no space for it either. Duh...
+		}
+	}
+	chanCnt, flt8 := 4, false
+	if signatureLen > 0 {
+		chanCnt, flt8 = modChannelLayout(mod.Signature)
+	}
+
+	// Pattern Table (have to read this first because this tells us the number of patterns)
+	patternTableOffset := 20 + mod.InstrTableLen*30 + 2
+	patternTableLen := int(data[20+mod.InstrTableLen*30 /*+1*/]) // 20+31*30
+	if patternTableLen > 128 {
+		patternTableLen = 128 // some MOD files (e.g. BeatWave.mod) have patternTableLen > 128, which is illegal!
+	}
+	if patternTableLen == 0 {
+		return mod, fmt.Errorf("invalid song length 0")
+	}
+	mod.PatternTable = make([]int, patternTableLen)
+	for i := range mod.PatternTable {
+		mod.PatternTable[i] = int(data[patternTableOffset+i])
+		if mod.PatternTable[i] >= 128 {
+			return mod, fmt.Errorf("invalid pattern table entry %d at position %d", mod.PatternTable[i], i)
+		}
+		if flt8 {
+			mod.PatternTable[i] /= 2 // the 8 channel patterns are stored as two 4 channel patterns
+		}
+		if mod.PatternTable[i]+1 > mod.PatternCnt {
+			mod.PatternCnt = mod.PatternTable[i] + 1
+		}
+	}
+	patternsOffset := 20 + mod.InstrTableLen*30 + 2 + 128 + signatureLen
+	patternSize := 64 * chanCnt * 4
+	patternsEnd := patternsOffset + mod.PatternCnt*patternSize
+	if patternsEnd > src.size {
+		return mod, fmt.Errorf("%w: %d patterns need %d bytes of pattern data, the file has %d", ErrTruncated, mod.PatternCnt, patternsEnd, src.size)
+	}
+	// like ProTracker, all 128 entries of the pattern table count for the number of patterns stored, so
+	// patterns which aren't played (hidden patterns) are loaded too
+	for _, patt := range data[patternTableOffset : patternTableOffset+128] {
+		if flt8 {
+			patt /= 2
+		}
+		if stored := int(patt) + 1; patt < 128 && stored > mod.PatternCnt && patternsOffset+stored*patternSize <= src.size {
+			mod.PatternCnt, patternsEnd = stored, patternsOffset+stored*patternSize
+		}
+	}
+	//fmt.Printf("offs %x, cnt %d, tableLen %d, %+v\n", patternTableOffset, mod.PatternCnt, patternTableLen, mod.PatternTable)
+
+	// Trailing data (has to be removed before reading the samples from the end of the file)
+	size := mod.splitTrailing(src, patternsOffset, chanCnt, flt8)
+
+	// Instruments
+	// We read the samples from the end of the file - this assumes that there is no additional data at the end of the file.
+	// Getting the sample offset from the previous data is unreliable because there may be patterns which are not in the pattern table.
+	mod.Instruments = make([]Instrument, mod.InstrTableLen+1)
+	mod.Instruments[0] = Instrument{Num: 0, Name: "NOP"}
+	mod.Instruments[0].SetFinetune(0) // notes without (or with invalid) instruments still need a period table
+	sampleOffset := size
+	for i := mod.InstrTableLen; i > 0; i-- {
+		instrOffset := 20 + (i-1)*30
+		mod.Instruments[i], err = ReadInstrument(data[instrOffset : instrOffset+30])
+		mod.Instruments[i].Num = i
+		// the stored length: the 2 bytes of a sample of 1 word are in the file, although it is empty
+		sampleOffset -= int(data[instrOffset+22])<<9 | int(data[instrOffset+23])<<1
+		if sampleOffset < patternsEnd {
+			return mod, fmt.Errorf("%w: sample data shorter than declared, %d bytes missing", ErrTruncated, patternsEnd-sampleOffset)
+		}
+		if mod.Instruments[i].Len == 0 {
+			continue
+		}
+		mod.Instruments[i].checkLoop(&mod)
+		mod.Instruments[i].Offset = sampleOffset
+		if cache != nil {
+			cache.stream(&mod.Instruments[i], src, sampleOffset, &sampleStream{length: mod.Instruments[i].Len})
+			continue
+		}
+		mod.Instruments[i].Sample = int8Slice(src.bytes(sampleOffset, mod.Instruments[i].Len))
+	}
+	if gap := sampleOffset - patternsEnd; gap > 0 && gap%patternSize == 0 {
+		// whole patterns between the patterns given by the pattern table and the samples: patterns which
+		// aren't referenced at all
+		mod.PatternCnt += gap / patternSize
+	}
+
+	// Patterns
+	data = src.prefix(patternsOffset + mod.PatternCnt*patternSize)
+	mod.Patterns = make([][][]Note, mod.PatternCnt)
+	//fmt.Printf("PatternsOffset %x:\n", patternsOffset)
+	for i := range mod.Patterns {
+		mod.Patterns[i] = make([][]Note, 64)
+		//fmt.Printf("\n\nPattern %d:\n", i)
+		for j := range mod.Patterns[i] {
+			mod.Patterns[i][j] = make([]Note, chanCnt)
+			for k := range mod.Patterns[i][j] {
+				noteOffset := patternsOffset + ((i*64+j)*chanCnt+k)*4
+				if flt8 {
+					noteOffset = patternsOffset + (((i*2+k/4)*64+j)*4+k%4)*4
+				}
+				mod.Patterns[i][j][k] = ReadNote(data[noteOffset:noteOffset+4], &mod)
+			}
+			//fmt.Println(mod.Patterns[i][j][0], mod.Patterns[i][j][1], mod.Patterns[i][j][2], mod.Patterns[i][j][3])
+		}
+	}
+
+	logEvent(slog.LevelInfo, "module loaded", "file", fn, "name", mod.Name, "instruments", mod.InstrTableLen,
+		"patterns", mod.PatternCnt, "packer", mod.Packer, "streamed", cache != nil)
+	if len(mod.Trailing) > 0 {
+		logEvent(slog.LevelWarn, "trailing data", "file", fn, "bytes", len(mod.Trailing), "type", mod.TrailingType)
+	}
+	return
+}
+
+// modChannelLayout returns the number of channels of a MOD file with the given signature, and whether
+// the patterns are stored in the FLT8 layout (an 8 channel pattern as two 4 channel patterns)
+func modChannelLayout(sig [4]byte) (chanCnt int, flt8 bool) {
+	digit := func(c byte) int {
+		if c < '0' || c > '9' {
+			return -1
+		}
+		return int(c - '0')
+	}
+	switch s := string(sig[:]); {
+	case s == "FLT8":
+		return 8, true
+	case s == "OCTA" || s == "OKTA" || s == "CD81":
+		return 8, false
+	case s == "CD61":
+		return 6, false
+	case s[1:] == "CHN" && digit(sig[0]) > 0: // 2CHN .. 9CHN
+		return digit(sig[0]), false
+	case s[:3] == "TDZ" && digit(sig[3]) > 0: // TakeTracker 1-3 channels
+		return digit(sig[3]), false
+	case (s[2:] == "CH" || s[2:] == "CN") && digit(sig[0]) > 0 && digit(sig[1]) >= 0: // 10CH .. 32CH
+		if n := digit(sig[0])*10 + digit(sig[1]); n <= 32 {
+			return n, false
+		}
+	}
+	return 4, false // M.K., M!K!, FLT4, 4CHN, ...
+}
+
+/*
+22        Sample's name, padded with null bytes. If a name begins with a
+          '#', it is assumed not to be an instrument name, and is
+          probably a message.
+2         Sample length in words (1 word = 2 bytes). The first word of
+          the sample is overwritten by the tracker, so a length of 1
+          still means an empty sample. See below for sample format.
+1         Lowest four bits represent a signed nibble (-8..7) which is
+          the finetune value for the sample. Each finetune step changes
+          the note 1/8th of a semitone. Implemented by switching to a
+          different table of period-values for each finetune value.
+1         Volume of sample. Legal values are 0..64. Volume is the linear
+          difference between sound intensities. 64 is full volume, and
+          the change in decibels can be calculated with 20*log10(Vol/64)
+2         Start of sample repeat offset in words. Once the sample has
+          been played all of the way through, it will loop if the repeat
+          length is greater than one. It repeats by jumping to this
+          position in the sample and playing for the repeat length, then
+          jumping back to this position, and playing for the repeat
+          length, etc.
+2         Length of sample repeat in words. Only loop if greater than 1.
+*/
@@ -0,0 +1,88 @@
+package mod
+
+import (
+	"bytes"
+	"testing"
+)
+
+// testModuleData returns a MOD file with a sample of 1 word (instrument 2) between two others
+func testModuleData(t testing.TB) []byte {
+	m, err := NewModule("one word", 4)
+	if err != nil {
+		t.Fatal(err)
+	}
+	pcm := make([]int8, 64)
+	for i := range pcm {
+		pcm[i] = int8(i)
+	}
+	for _, ins := range []struct {
+		name string
+		pcm  []int8
+	}{{"first", pcm}, {"one word", []int8{100, 101}}, {"last", pcm[32:]}} {
+		if _, err := m.AddInstrument(ins.name, ins.pcm, 0, 0); err != nil {
+			t.Fatal(err)
+		}
+	}
+	m.SetNote(0, 0, 0, Note{InsNum: 1, Period: 428, Effect: NewEffect(0xC40)})
+	var buf bytes.Buffer
+	if err := m.Write(&buf); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+func TestOneWordSample(t *testing.T) {
+	m, err := ReadModData("oneword.mod", testModuleData(t))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if m.Instruments[2].HasSample() {
+		t.Errorf("instrument 2 (1 word) has a sample of %d bytes, want none", m.Instruments[2].Len)
+	}
+	for _, c := range []struct {
+		ins  int
+		want int8
+		len  int
+	}{{1, 0, 64}, {3, 32, 32}} {
+		ins := m.Instruments[c.ins]
+		if ins.Len != c.len || len(ins.Sample) != c.len {
+			t.Fatalf("instrument %d: length %d (%d bytes), want %d", c.ins, ins.Len, len(ins.Sample), c.len)
+		}
+		for i, v := range ins.Sample {
+			if v != c.want+int8(i) {
+				t.Fatalf("instrument %d: sample %d is %d, want %d (shifted sample data)", c.ins, i, v, c.want+int8(i))
+			}
+		}
+	}
+}
+
+// FuzzReadModData checks that malformed MOD files return errors instead of panicking
+func FuzzReadModData(f *testing.F) {
+	data := testModuleData(f)
+	f.Add(data)
+	f.Add(data[:len(data)-40])
+	f.Add(data[:1084])
+	f.Fuzz(func(t *testing.T, data []byte) {
+		m, err := ReadModData("fuzz.mod", data)
+		if err != nil {
+			return
+		}
+		for _, ins := range m.Instruments {
+			if ins.Sample != nil && len(ins.Sample) < ins.Len {
+				t.Fatalf("instrument %d: %d bytes of sample data for a length of %d", ins.Num, len(ins.Sample), ins.Len)
+			}
+		}
+	})
+}
+
+func TestReadNoteWithoutInstruments(t *testing.T) {
+	var m Module
+	n := ReadNote([]byte{0x0C, 0x35, 0x00, 0x00}, &m)
+	if n.Period != 0xC35 || n.InsNum != 0 || n.Ins != nil {
+		t.Errorf("note 0c350000: period %#x, instrument %d (%v), want 0xc35, 0 (nil)", n.Period, n.InsNum, n.Ins)
+	}
+	n = ReadNote([]byte{0x10, 0xD6, 0x2C, 0x20}, &m)
+	if n.InsNum != 0x12 || n.Ins != nil || len(m.Warnings) != 1 {
+		t.Errorf("note 10d62c20: instrument %d (%v), %d warnings, want 18 (nil), 1", n.InsNum, n.Ins, len(m.Warnings))
+	}
+}
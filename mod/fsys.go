@@ -0,0 +1,61 @@
+package mod
+
+import (
+	"bufio"
+	"bytes"
+	"io/fs"
+	"path"
+	"strings"
+)
+
+// ReadModFS reads the module file name (in any of the supported formats) from the file system fsys (e.g. an embed.FS with the soundtrack of a game)
+func ReadModFS(fsys fs.FS, name string) (Module, error) {
+	data, err := fs.ReadFile(fsys, name)
+	if err != nil {
+		return Module{}, err
+	}
+	return LoadData(name, data)
+}
+
+// ReadModDirFS reads all module files (by extension or "mod." prefix) in the directory dir of fsys, sorted by name
+func ReadModDirFS(fsys fs.FS, dir string) ([]Module, error) {
+	entries, err := fs.ReadDir(fsys, dir)
+	if err != nil {
+		return nil, err
+	}
+	var mods []Module
+	for _, e := range entries {
+		if e.IsDir() || !isModFileName(e.Name()) {
+			continue
+		}
+		mod, err := ReadModFS(fsys, path.Join(dir, e.Name()))
+		if err != nil {
+			return nil, err
+		}
+		mods = append(mods, mod)
+	}
+	return mods, nil
+}
+
+// ReadPlaylistFS reads the modules listed in the M3U playlist name of fsys. Entries are relative to the
+// directory of the playlist; comments and empty lines are skipped.
+func ReadPlaylistFS(fsys fs.FS, name string) ([]Module, error) {
+	data, err := fs.ReadFile(fsys, name)
+	if err != nil {
+		return nil, err
+	}
+	var mods []Module
+	sc := bufio.NewScanner(bytes.NewReader(data))
+	for sc.Scan() {
+		entry := strings.TrimSpace(sc.Text())
+		if entry == "" || strings.HasPrefix(entry, "#") {
+			continue
+		}
+		mod, err := ReadModFS(fsys, path.Join(path.Dir(name), strings.ReplaceAll(entry, "\\", "/")))
+		if err != nil {
+			return nil, err
+		}
+		mods = append(mods, mod)
+	}
+	return mods, sc.Err()
+}
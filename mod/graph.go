@@ -0,0 +1,223 @@
+package mod
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"sort"
+
+	"github.com/b0nefish/go-modplayer/internal/errwriter"
+)
+
+// FlowEdge is a transition between two orders (pattern table positions) of a module
+type FlowEdge struct {
+	From  int    `json:"from"`  // order we come from
+	Row   int    `json:"row"`   // row of the From pattern at which we leave it
+	To    int    `json:"to"`    // order we go to (-1 for the end of the song)
+	ToRow int    `json:"toRow"` // row at which playing continues in the To pattern
+	Kind  string `json:"kind"`  // "next", "jump" (Bxx), "break" (Dxx) or "end"
+	Cycle bool   `json:"cycle"` // the edge is part of a loop (the song never ends once it is taken)
+}
+
+// FlowNode is an order (pattern table position) in a FlowGraph
+type FlowNode struct {
+	Order     int  `json:"order"`
+	Pattern   int  `json:"pattern"`
+	Reachable bool `json:"reachable"` // can be reached when playing from the start of the song
+}
+
+// FlowGraph is the directed graph of the play flow of a module, built from the pattern table and the
+// position jump (Bxx) and pattern break (Dxx) effects
+type FlowGraph struct {
+	Name                string     `json:"name"`
+	Nodes               []FlowNode `json:"nodes"`
+	Edges               []FlowEdge `json:"edges"`
+	UnreachableOrders   []int      `json:"unreachableOrders"`
+	UnreachablePatterns []int      `json:"unreachablePatterns"` // patterns not played by any reachable order
+}
+
+// flowPos is a position in the song at which playing continues after a line with a jump, or a new order
+type flowPos struct {
+	order, row int
+}
+
+// nextFlow finds the first line (starting from row) of the pattern at the given order which leaves
+// the pattern, and returns the edge describing the transition
+func (m Module) nextFlow(order, row int) FlowEdge {
+	patt := m.Patterns[m.PatternTable[order]]
+	for ; row < len(patt); row++ {
+		jumpTo, breakTo := -1, -1
+		for _, note := range patt[row] {
+			switch note.EffType {
+			case PositionJump:
+				jumpTo = note.Par()
+			case PatternBreak:
+				breakTo = note.ParX()*10 + note.ParY() // BCD
+			}
+		}
+		if jumpTo < 0 && breakTo < 0 {
+			continue
+		}
+		e := FlowEdge{From: order, Row: row, To: order + 1, Kind: "break"}
+		if jumpTo >= 0 {
+			e.To, e.Kind = jumpTo, "jump"
+		}
+		if breakTo > 0 && breakTo < 64 {
+			e.ToRow = breakTo
+		}
+		if e.To >= len(m.PatternTable) {
+			e.To = 0 // jumping past the end of the song restarts it
+		}
+		return e
+	}
+	e := FlowEdge{From: order, Row: len(patt) - 1, To: order + 1, Kind: "next"}
+	if e.To >= len(m.PatternTable) {
+		e.To, e.Kind = -1, "end"
+	}
+	return e
+}
+
+// FlowGraph builds the play flow graph of the module
+func (m Module) FlowGraph() FlowGraph {
+	g := FlowGraph{Name: m.Name}
+
+	// every position has exactly one successor; we follow the flow from the start of each order
+	// (and from every position reached by a pattern break)
+	next := map[flowPos]FlowEdge{}
+	var visit func(pos flowPos)
+	visit = func(pos flowPos) {
+		for {
+			if _, ok := next[pos]; ok {
+				return
+			}
+			e := m.nextFlow(pos.order, pos.row)
+			next[pos] = e
+			if e.To < 0 {
+				return
+			}
+			pos = flowPos{e.To, e.ToRow}
+		}
+	}
+	for order := range m.PatternTable {
+		visit(flowPos{order, 0})
+	}
+
+	reachable := map[int]bool{}
+	played := map[flowPos]bool{}
+	for pos := (flowPos{0, 0}); len(m.PatternTable) > 0 && !played[pos]; {
+		played[pos] = true
+		reachable[pos.order] = true
+		e := next[pos]
+		if e.To < 0 {
+			break
+		}
+		pos = flowPos{e.To, e.ToRow}
+	}
+
+	// a position is on a cycle if following the flow from it leads back to it
+	onCycle := func(start flowPos) bool {
+		pos := start
+		for i := 0; i <= len(next); i++ {
+			e := next[pos]
+			if e.To < 0 {
+				return false
+			}
+			pos = flowPos{e.To, e.ToRow}
+			if pos == start {
+				return true
+			}
+		}
+		return false
+	}
+
+	positions := make([]flowPos, 0, len(next))
+	for pos := range next {
+		positions = append(positions, pos)
+	}
+	sort.Slice(positions, func(i, j int) bool {
+		if positions[i].order != positions[j].order {
+			return positions[i].order < positions[j].order
+		}
+		return positions[i].row < positions[j].row
+	})
+	edgeIdx := map[FlowEdge]int{} // the same transition may be reached from several positions
+	for _, pos := range positions {
+		e := next[pos]
+		idx, ok := edgeIdx[e]
+		if !ok {
+			idx = len(g.Edges)
+			edgeIdx[e] = idx
+			g.Edges = append(g.Edges, e)
+		}
+		g.Edges[idx].Cycle = g.Edges[idx].Cycle || onCycle(pos)
+	}
+
+	playedPatterns := map[int]bool{}
+	for order, patt := range m.PatternTable {
+		g.Nodes = append(g.Nodes, FlowNode{Order: order, Pattern: patt, Reachable: reachable[order]})
+		if reachable[order] {
+			playedPatterns[patt] = true
+		} else {
+			g.UnreachableOrders = append(g.UnreachableOrders, order)
+		}
+	}
+	for patt := range m.Patterns {
+		if !playedPatterns[patt] {
+			g.UnreachablePatterns = append(g.UnreachablePatterns, patt)
+		}
+	}
+	return g
+}
+
+// WriteJSON writes the graph as JSON
+func (g FlowGraph) WriteJSON(w io.Writer) error {
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(g)
+}
+
+// WriteDOT writes the graph in Graphviz DOT format. Unreachable orders are drawn dashed, edges which
+// are part of a loop are drawn in red.
+func (g FlowGraph) WriteDOT(w io.Writer) error {
+	ew := errwriter.New(w)
+	ew.Printf("digraph %q {\n", g.Name)
+	ew.Printf("\tnode [shape=box];\n")
+	for _, n := range g.Nodes {
+		style := ""
+		if !n.Reachable {
+			style = ", style=dashed, color=gray"
+		}
+		ew.Printf("\to%d [label=\"%d: pattern %d\"%s];\n", n.Order, n.Order, n.Pattern, style)
+	}
+	ew.Printf("\tend [shape=doublecircle];\n")
+	for _, e := range g.Edges {
+		to := fmt.Sprintf("o%d", e.To)
+		if e.To < 0 {
+			to = "end"
+		}
+		var attrs string
+		switch {
+		case e.Kind == "jump" && e.ToRow > 0:
+			attrs = fmt.Sprintf("label=\"B+D%02d @%d\"", e.ToRow, e.Row)
+		case e.Kind == "jump":
+			attrs = fmt.Sprintf("label=\"B @%d\"", e.Row)
+		case e.Kind == "break":
+			attrs = fmt.Sprintf("label=\"D%02d @%d\"", e.ToRow, e.Row)
+		}
+		if e.Cycle {
+			if attrs != "" {
+				attrs += ", "
+			}
+			attrs += "color=red"
+		}
+		if attrs != "" {
+			attrs = " [" + attrs + "]"
+		}
+		ew.Printf("\to%d -> %s%s;\n", e.From, to, attrs)
+	}
+	for _, patt := range g.UnreachablePatterns {
+		ew.Printf("\tp%d [label=\"pattern %d (unreachable)\", shape=note, color=gray];\n", patt, patt)
+	}
+	ew.Printf("}\n")
+	return ew.Err
+}
@@ -0,0 +1,708 @@
+package mod
+
+import (
+	"encoding/binary"
+	"fmt"
+	"log/slog"
+	"strings"
+)
+
+// The IT (Impulse Tracker) format is converted into the MOD model like the XM and S3M formats: every
+// sample used by an instrument becomes an Instrument (with the envelope of the instrument), notes are
+// converted into Amiga periods, and the effects are mapped like the S3M effects. New note actions
+// (several notes playing in one channel) are not supported - a new note always replaces the old one.
+//
+// In the pattern cells, notes are stored as 1..120 (0: none) or one of the itNote values, and volumes as the
+// value of the volume column + 1 (0: none).
+
+const itSignature = "IMPM"
+
+// special notes of the IT format
+const (
+	itNoteFade = 0xFD
+	itNoteCut  = 0xFE
+	itNoteOff  = 0xFF
+)
+
+func isIT(data []byte) bool {
+	return len(data) >= len(itSignature) && string(data[:len(itSignature)]) == itSignature
+}
+
+// itKey is an entry of the keyboard table of an IT instrument: the note played and the sample
+// (index into Module.Instruments, 0: none)
+type itKey struct {
+	note, ins int
+}
+
+// itSong holds what is needed for converting the notes of an IT module
+type itSong struct {
+	keyboards [][120]itKey // by instrument number - 1 (empty if the module doesn't use instruments)
+	c5Speeds  []int        // the C5 speed of the samples (by index into Module.Instruments)
+}
+
+// ReadITData loads the IT file data (read from the file fn, which is only used as the module's FileName)
+func ReadITData(fn string, data []byte) (mod Module, err error) {
+	return readIT(fn, memSource(data), nil)
+}
+
+// readIT loads the IT module from src; the samples are streamed through the cache (if it is not nil)
+func readIT(fn string, src *source, cache *SampleCache) (mod Module, err error) {
+	if !isIT(src.data) {
+		return mod, fmt.Errorf("not an IT file")
+	}
+	const headerLen = 0xC0
+	if src.size < headerLen {
+		return mod, fmt.Errorf("file too short for an IT header (%d bytes, need at least %d)", src.size, headerLen)
+	}
+	le16 := func(ofs int) int { return int(binary.LittleEndian.Uint16(src.bytes(ofs, 2))) }
+	le32 := func(ofs int) int { return int(binary.LittleEndian.Uint32(src.bytes(ofs, 4))) }
+
+	mod.FileName = fn
+	mod.Format = FormatIT
+	mod.samples = cache
+	mod.Name = strings.Trim(string(src.bytes(4, 26)), " \t\n\v\f\r\x00")
+	ordCnt, insCnt, smpCnt, pattCnt := le16(0x20), le16(0x22), le16(0x24), le16(0x26)
+	compatVersion, flags := le16(0x2A), le16(0x2C)
+	switch {
+	case ordCnt == 0 || ordCnt > 256:
+		return mod, fmt.Errorf("invalid song length %d", ordCnt)
+	case insCnt > 255:
+		return mod, fmt.Errorf("invalid number of instruments %d", insCnt)
+	case smpCnt > 255:
+		return mod, fmt.Errorf("invalid number of samples %d", smpCnt)
+	case pattCnt > 256:
+		return mod, fmt.Errorf("invalid number of patterns %d", pattCnt)
+	case headerLen+ordCnt+4*(insCnt+smpCnt+pattCnt) > src.size:
+		return mod, fmt.Errorf("truncated pattern order table")
+	}
+	data := src.prefix(headerLen + ordCnt + 4*(insCnt+smpCnt+pattCnt)) // the header with the orders and pointers
+	useInstruments := flags&0x04 != 0
+	mod.InitialGlobalVol = int(data[0x30]) / 2
+	if mod.InitialGlobalVol == 0 || mod.InitialGlobalVol > 64 {
+		mod.InitialGlobalVol = 64
+	}
+	if speed := int(data[0x32]); speed > 0 {
+		mod.InitialTempo = speed
+	}
+	if bpm := int(data[0x33]); bpm >= 32 {
+		mod.InitialBPM = bpm
+	}
+	if flags&0x08 != 0 {
+		mod.Warnf("linear frequency slides are played as Amiga period slides")
+	}
+
+	// Orders: 254 is a marker (skipped), 255 the end of the song
+	for _, o := range data[headerLen : headerLen+ordCnt] {
+		if o == 255 {
+			break
+		}
+		if o != 254 {
+			mod.PatternTable = append(mod.PatternTable, int(o))
+		}
+	}
+	if len(mod.PatternTable) == 0 {
+		return mod, fmt.Errorf("invalid song length 0")
+	}
+	insPtrs := headerLen + ordCnt
+	smpPtrs := insPtrs + 4*insCnt
+	pattPtrs := smpPtrs + 4*smpCnt
+
+	// Samples
+	samples := make([]Instrument, smpCnt+1)
+	song := itSong{c5Speeds: make([]int, smpCnt+1)}
+	for i := 1; i <= smpCnt; i++ {
+		if samples[i], song.c5Speeds[i], err = mod.readITSample(src, cache, le32(smpPtrs+4*(i-1)), i); err != nil {
+			return mod, err
+		}
+	}
+
+	// Instruments (or the samples, if the module doesn't use instruments)
+	mod.Instruments = []Instrument{{Num: 0, Name: "NOP"}}
+	mod.Instruments[0].SetFinetune(0)
+	if !useInstruments {
+		insCnt = 0
+		mod.Instruments = append(mod.Instruments, samples[1:]...)
+	}
+	for i := 1; i <= insCnt; i++ {
+		ofs, size := le32(insPtrs+4*(i-1)), 0x182
+		if compatVersion < 0x200 {
+			size = 0x22A // Impulse Tracker 1.x format
+		}
+		if ofs+size > src.size || string(src.bytes(ofs, 4)) != "IMPI" {
+			return mod, fmt.Errorf("truncated header of instrument %d", i)
+		}
+		h := src.bytes(ofs, size)
+		sm := SampleMap{Name: strings.Trim(string(h[0x20:0x3A]), " \t\n\v\f\r\x00")}
+		var env *Envelope
+		var fadeOut int
+		if compatVersion < 0x200 {
+			env, fadeOut = mod.readOldITEnvelope(h), int(binary.LittleEndian.Uint16(h[0x18:]))<<7 // 1/512 steps
+		} else {
+			env, fadeOut = mod.readITEnvelope(h[0x130:]), int(binary.LittleEndian.Uint16(h[0x14:]))<<6 // 1/1024 steps
+			if h[0x11] != 0 {
+				mod.Warnf("instrument %d: new note actions are not supported", i)
+			}
+		}
+
+		// each sample of the instrument becomes an Instrument with the envelope of the instrument
+		var kb [120]itKey
+		insOfSample := map[int]int{}
+		for n := range kb {
+			note, smp := int(h[0x40+2*n]), int(h[0x41+2*n])
+			if smp == 0 || smp > smpCnt || note >= 120 || samples[smp].Len == 0 {
+				continue
+			}
+			if _, ok := insOfSample[smp]; !ok {
+				ins := samples[smp]
+				ins.Num = len(mod.Instruments)
+				ins.Envelope, ins.FadeOut = env, fadeOut
+				insOfSample[smp] = ins.Num
+				sm.Samples = append(sm.Samples, ins.Num)
+				mod.Instruments = append(mod.Instruments, ins)
+				song.c5Speeds = append(song.c5Speeds, song.c5Speeds[smp])
+			}
+			kb[n] = itKey{note: note, ins: insOfSample[smp]}
+		}
+		for n := range sm.Keymap {
+			sm.Keymap[n] = len(sm.Samples)
+			for k, ins := range sm.Samples {
+				if kb[n].ins == ins {
+					sm.Keymap[n] = k
+				}
+			}
+		}
+		song.keyboards = append(song.keyboards, kb)
+		mod.SampleMaps = append(mod.SampleMaps, sm)
+	}
+	if useInstruments {
+		// the c5 speeds of the samples are followed by the ones of the Instruments created for them
+		song.c5Speeds = append([]int{0}, song.c5Speeds[smpCnt+1:]...)
+	}
+	mod.InstrTableLen = len(mod.Instruments) - 1
+
+	// Patterns
+	cells := make([][][]patternCell, pattCnt)
+	chanCnt := 1
+	for i := range cells {
+		ofs := le32(pattPtrs + 4*i)
+		if ofs == 0 {
+			continue
+		}
+		if ofs+8 > src.size {
+			return mod, fmt.Errorf("truncated header of pattern %d", i)
+		}
+		packedLen, rows := le16(ofs), le16(ofs+2)
+		if rows < 1 || rows > 200 {
+			return mod, fmt.Errorf("invalid header of pattern %d", i)
+		}
+		if ofs+8+packedLen > src.size {
+			return mod, fmt.Errorf("truncated data of pattern %d", i)
+		}
+		if cells[i], err = unpackITPattern(src.bytes(ofs+8, packedLen), rows, data[0x40:0x80]); err != nil {
+			return mod, fmt.Errorf("pattern %d: %v", i, err)
+		}
+		for _, row := range cells[i] {
+			for ch, cell := range row {
+				if cell != (patternCell{}) && ch >= chanCnt {
+					chanCnt = ch + 1
+				}
+			}
+		}
+	}
+	for i := range cells {
+		if cells[i] == nil {
+			cells[i] = make([][]patternCell, 64)
+		}
+		for r := range cells[i] {
+			if len(cells[i][r]) >= chanCnt {
+				cells[i][r] = cells[i][r][:chanCnt]
+			} else {
+				cells[i][r] = make([]patternCell, chanCnt)
+			}
+		}
+	}
+	for ch := 0; ch < chanCnt; ch++ {
+		pan := 128 // center (also for surround)
+		if p := int(data[0x40+ch] & 0x7F); p <= 64 && flags&0x01 != 0 {
+			pan = p * 255 / 64
+		}
+		mod.ChannelPan = append(mod.ChannelPan, pan)
+	}
+	cells = mod.addEmptyPattern(cells, chanCnt)
+	mod.convertPatterns(cells, func(cell patternCell, ins int) Note { return mod.convertITNote(cell, ins, song) })
+
+	logEvent(slog.LevelInfo, "module loaded", "file", fn, "name", mod.Name, "format", mod.Format,
+		"instruments", len(mod.SampleMaps), "samples", mod.InstrTableLen, "patterns", mod.PatternCnt)
+	return
+}
+
+// readITSample reads the sample header (at ofs) and data of the sample number num; the samples are
+// streamed through the cache (if it is not nil)
+func (m *Module) readITSample(src *source, cache *SampleCache, ofs, num int) (ins Instrument, c5Speed int, err error) {
+	if ofs+80 > src.size || string(src.bytes(ofs, 4)) != "IMPS" {
+		return ins, 0, fmt.Errorf("truncated header of sample %d", num)
+	}
+	h := src.bytes(ofs, 80)
+	ins = Instrument{
+		Num:    num,
+		Name:   strings.Trim(string(h[0x14:0x2E]), " \t\n\v\f\r\x00"),
+		Volume: int(h[0x13]),
+	}
+	ins.SetFinetune(0) // the finetune is part of the converted periods
+	if ins.Volume > 64 {
+		ins.Volume = 64
+	}
+	flags, convert := h[0x12], h[0x2E]
+	length := int(binary.LittleEndian.Uint32(h[0x30:]))
+	loopStart, loopEnd := int(binary.LittleEndian.Uint32(h[0x34:])), int(binary.LittleEndian.Uint32(h[0x38:]))
+	c5Speed = int(binary.LittleEndian.Uint32(h[0x3C:]))
+	if flags&0x01 == 0 || length == 0 {
+		return ins, c5Speed, nil // no sample data
+	}
+	if length > 1<<24 {
+		return ins, 0, fmt.Errorf("invalid length of sample %d", num)
+	}
+	is16Bit := flags&0x02 != 0
+	if flags&0x04 != 0 {
+		m.Warnf("sample %d: of stereo samples only the left channel is played", num)
+	}
+
+	// the sample data (16-bit samples are reduced to 8 bits)
+	dataOfs := int(binary.LittleEndian.Uint32(h[0x48:]))
+	if dataOfs > src.size {
+		return ins, 0, fmt.Errorf("sample data of sample %d shorter than declared", num)
+	}
+	switch {
+	case flags&0x08 != 0 && cache != nil:
+		// the blocks are decompressed on their own, so they are streamed one by one
+		s := &sampleStream{length: length, is16Bit: is16Bit, it215: convert&0x04 != 0}
+		pos := dataOfs
+		for n := 0; n < length && pos+2 <= src.size; n += itBlockLen {
+			s.blocks = append(s.blocks, pos)
+			pos += 2 + int(binary.LittleEndian.Uint16(src.bytes(pos, 2)))
+		}
+		if len(s.blocks) < (length+itBlockLen-1)/itBlockLen || pos > src.size {
+			return ins, 0, fmt.Errorf("sample %d: truncated compressed data", num)
+		}
+		s.blocks = append(s.blocks, pos)
+		cache.stream(&ins, src, dataOfs, s)
+		ins.Len = length
+	case flags&0x08 != 0:
+		if ins.Sample, err = decompressITSample(src.data[dataOfs:], length, is16Bit, convert&0x04 != 0); err != nil {
+			return ins, 0, fmt.Errorf("sample %d: %v", num, err)
+		}
+		ins.Len = len(ins.Sample)
+	default:
+		size := length
+		if is16Bit {
+			size *= 2
+		}
+		if dataOfs+size > src.size {
+			return ins, 0, fmt.Errorf("sample data of sample %d shorter than declared", num)
+		}
+		if cache != nil {
+			cache.stream(&ins, src, dataOfs, &sampleStream{length: length, is16Bit: is16Bit, unsigned: convert&0x01 == 0})
+			ins.Len = length
+		} else {
+			ins.Sample = decodeS3MSample(src.bytes(dataOfs, size), is16Bit, convert&0x01 == 0)
+			ins.Len = len(ins.Sample)
+		}
+	}
+
+	// loops (the sustain loop is played as a normal loop if there is none)
+	switch {
+	case flags&0x10 != 0:
+	case flags&0x20 != 0:
+		loopStart, loopEnd = int(binary.LittleEndian.Uint32(h[0x40:])), int(binary.LittleEndian.Uint32(h[0x44:]))
+		m.Warnf("sample %d: the sustain loop is played as a normal loop", num)
+	default:
+		loopStart, loopEnd = 0, 0
+	}
+	if flags&0x30 != 0 && flags&0xC0 != 0 {
+		m.Warnf("ping-pong loops are played as forward loops")
+	}
+	if loopEnd > loopStart && loopEnd <= ins.Len {
+		ins.RepStart, ins.RepLen = loopStart, loopEnd-loopStart
+		ins.Len = loopEnd // the player loops at the end of the sample
+		if ins.Sample != nil {
+			ins.Sample = ins.Sample[:ins.Len]
+		}
+	}
+	ins.checkLoop(m)
+	return ins, c5Speed, nil
+}
+
+// readITEnvelope reads a volume envelope of the instrument format of Impulse Tracker 2.0 and later.
+// A sustain loop is played as a sustain point at its end.
+func (m *Module) readITEnvelope(h []byte) *Envelope {
+	flags, pointCnt := h[0], int(h[1])
+	if flags&0x01 == 0 || pointCnt == 0 {
+		return nil
+	}
+	if pointCnt > 25 {
+		pointCnt = 25
+	}
+	env := &Envelope{Sustain: -1, LoopEnd: -1}
+	for i := 0; i < pointCnt; i++ {
+		env.Points = append(env.Points, EnvelopePoint{
+			Tick:  int(binary.LittleEndian.Uint16(h[7+i*3:])),
+			Value: int(h[6+i*3]),
+		})
+	}
+	if loopStart, loopEnd := int(h[2]), int(h[3]); flags&0x02 != 0 && loopStart <= loopEnd && loopEnd < pointCnt {
+		env.LoopStart, env.LoopEnd = loopStart, loopEnd
+	}
+	if susStart, susEnd := int(h[4]), int(h[5]); flags&0x04 != 0 && susStart <= susEnd && susEnd < pointCnt {
+		if susStart != susEnd {
+			m.Warnf("envelope sustain loops are played as a sustain point")
+		}
+		env.Sustain = susEnd
+	}
+	return env
+}
+
+// readOldITEnvelope reads the volume envelope of an instrument of the format of Impulse Tracker 1.x
+func (m *Module) readOldITEnvelope(h []byte) *Envelope {
+	flags := h[0x11]
+	if flags&0x01 == 0 {
+		return nil
+	}
+	env := &Envelope{Sustain: -1, LoopEnd: -1}
+	for i := 0; i < 25 && h[0x1F8+2*i] != 0xFF; i++ {
+		env.Points = append(env.Points, EnvelopePoint{Tick: int(h[0x1F8+2*i]), Value: int(h[0x1F9+2*i])})
+	}
+	pointCnt := len(env.Points)
+	if pointCnt == 0 {
+		return nil
+	}
+	if loopStart, loopEnd := int(h[0x12]), int(h[0x13]); flags&0x02 != 0 && loopStart <= loopEnd && loopEnd < pointCnt {
+		env.LoopStart, env.LoopEnd = loopStart, loopEnd
+	}
+	if susStart, susEnd := int(h[0x14]), int(h[0x15]); flags&0x04 != 0 && susStart <= susEnd && susEnd < pointCnt {
+		if susStart != susEnd {
+			m.Warnf("envelope sustain loops are played as a sustain point")
+		}
+		env.Sustain = susEnd
+	}
+	return env
+}
+
+// unpackITPattern decodes the packed pattern data: every note starts with a byte giving the channel
+// (and whether a new mask follows), the mask gives the fields stored, or which fields repeat the last
+// value of the channel. A zero byte ends a row. Notes of disabled channels (see chanPan) are skipped.
+func unpackITPattern(pd []byte, rows int, chanPan []byte) ([][]patternCell, error) {
+	var masks [64]byte
+	var last [64]patternCell
+	cells := make([][]patternCell, rows)
+	i := 0
+	for r := range cells {
+		cells[r] = make([]patternCell, 64)
+		for i < len(pd) {
+			cv := pd[i]
+			i++
+			if cv == 0 {
+				break
+			}
+			ch := int(cv-1) & 63
+			if cv&0x80 != 0 {
+				if i >= len(pd) {
+					return nil, fmt.Errorf("truncated data in row %d", r)
+				}
+				masks[ch] = pd[i]
+				i++
+			}
+			mask := masks[ch]
+			size := 0
+			for bit, n := range []int{1, 1, 1, 2} {
+				if mask&(1<<bit) != 0 {
+					size += n
+				}
+			}
+			if i+size > len(pd) {
+				return nil, fmt.Errorf("truncated data in row %d", r)
+			}
+			var cell patternCell
+			if mask&0x01 != 0 {
+				last[ch].note = pd[i]
+				if last[ch].note < 120 {
+					last[ch].note++
+				} else if last[ch].note < itNoteFade {
+					last[ch].note = itNoteFade
+				}
+				i++
+			}
+			if mask&0x02 != 0 {
+				last[ch].ins = pd[i]
+				i++
+			}
+			if mask&0x04 != 0 {
+				last[ch].vol = pd[i] + 1
+				if pd[i] > 212 {
+					last[ch].vol = 0
+				}
+				i++
+			}
+			if mask&0x08 != 0 {
+				last[ch].eff, last[ch].par = pd[i], pd[i+1]
+				i += 2
+			}
+			if mask&0x11 != 0 {
+				cell.note = last[ch].note
+			}
+			if mask&0x22 != 0 {
+				cell.ins = last[ch].ins
+			}
+			if mask&0x44 != 0 {
+				cell.vol = last[ch].vol
+			}
+			if mask&0x88 != 0 {
+				cell.eff, cell.par = last[ch].eff, last[ch].par
+			}
+			if chanPan[ch] < 128 {
+				cells[r][ch] = cell
+			}
+		}
+	}
+	return cells, nil
+}
+
+// itBitReader reads the bits of compressed IT samples (starting with the lowest bit of each byte)
+type itBitReader struct {
+	data []byte
+	pos  int // next byte
+	bits uint32
+	cnt  int // number of bits left in bits
+}
+
+func (br *itBitReader) read(n int) (uint32, error) {
+	var v uint32
+	for i := 0; i < n; i++ {
+		if br.cnt == 0 {
+			if br.pos >= len(br.data) {
+				return 0, fmt.Errorf("truncated compressed data")
+			}
+			br.bits, br.cnt = uint32(br.data[br.pos]), 8
+			br.pos++
+		}
+		v |= (br.bits & 1) << i
+		br.bits >>= 1
+		br.cnt--
+	}
+	return v, nil
+}
+
+// decompressITSample decompresses the sample data of length samples in the IT 2.14 format (or 2.15, which
+// integrates twice); 16-bit samples are reduced to 8 bits. The data is stored in blocks of up to 0x8000
+// samples, each one starting with its length. The samples are stored as deltas with a variable bit width,
+// a value out of the range of the current width changes the width.
+func decompressITSample(data []byte, length int, is16Bit, it215 bool) ([]int8, error) {
+	maxWidth, widthBits := 9, 3
+	if is16Bit {
+		maxWidth, widthBits = 17, 4
+	}
+	s := make([]int8, 0, length)
+	for len(s) < length {
+		if len(data) < 2 {
+			return nil, fmt.Errorf("truncated compressed data")
+		}
+		blockLen := int(binary.LittleEndian.Uint16(data))
+		if 2+blockLen > len(data) {
+			return nil, fmt.Errorf("truncated compressed data")
+		}
+		br := itBitReader{data: data[2 : 2+blockLen]}
+		data = data[2+blockLen:]
+
+		end := len(s) + 0x8000
+		if end > length {
+			end = length
+		}
+		width := maxWidth
+		var d1, d2 int32
+		for len(s) < end {
+			if width < 1 || width > maxWidth {
+				return nil, fmt.Errorf("invalid bit width %d", width)
+			}
+			v, err := br.read(width)
+			if err != nil {
+				return nil, err
+			}
+			switch {
+			case width < 7: // a width change is 1 followed by zeros, then the new width
+				if v == 1<<(width-1) {
+					nw, err := br.read(widthBits)
+					if err != nil {
+						return nil, err
+					}
+					width = itNewWidth(int(nw)+1, width)
+					continue
+				}
+			case width < maxWidth: // the values at the top of the range are width changes
+				border := (uint32(1)<<(maxWidth-1) - 1) >> (maxWidth - width)
+				border -= uint32(maxWidth-1) / 2
+				if v > border && v <= border+uint32(maxWidth-1) {
+					width = itNewWidth(int(v-border), width)
+					continue
+				}
+			default: // the highest bit is set for width changes
+				if v&(1<<(maxWidth-1)) != 0 {
+					width = int(v+1) & 0xFF
+					continue
+				}
+			}
+
+			// sign extend the value and integrate
+			var d int32
+			if width < maxWidth-1 {
+				shift := 32 - width
+				d = int32(v<<shift) >> shift
+			} else if is16Bit {
+				d = int32(int16(v))
+			} else {
+				d = int32(int8(v))
+			}
+			d1 += d
+			d2 += d1
+			if is16Bit {
+				d1, d2 = int32(int16(d1)), int32(int16(d2))
+			} else {
+				d1, d2 = int32(int8(d1)), int32(int8(d2))
+			}
+			v16 := d1
+			if it215 {
+				v16 = d2
+			}
+			if is16Bit {
+				v16 >>= 8
+			}
+			s = append(s, int8(v16))
+		}
+	}
+	return s, nil
+}
+
+// itNewWidth returns the new bit width for the width number n (skipping the current width, which
+// wouldn't be a change)
+func itNewWidth(n, width int) int {
+	if n < width {
+		return n
+	}
+	return n + 1
+}
+
+// convertITNote converts a note of an IT pattern, playing the instrument (or sample) ins
+func (m *Module) convertITNote(cell patternCell, ins int, song itSong) (n Note) {
+	n.InsNum = int(cell.ins)
+	n.Ins = &m.Instruments[0]
+	insCnt := len(song.keyboards)
+	if song.keyboards == nil {
+		insCnt = m.InstrTableLen
+	}
+	if n.InsNum > insCnt {
+		m.Warnf("note references instrument %d, but the module only has %d instruments", n.InsNum, insCnt)
+		n.InsNum = 0
+	}
+
+	// the note played and the sample picked for it
+	note, sample := int(cell.note)-1, 0
+	if ins > 0 && ins <= insCnt {
+		sample = ins
+		if song.keyboards != nil {
+			key := note
+			if key < 0 || key >= 120 {
+				key = 60
+			}
+			k := song.keyboards[ins-1][key]
+			sample = k.ins
+			if note >= 0 && note < 120 {
+				note = k.note
+			}
+		}
+	}
+	if n.InsNum > 0 && sample > 0 && m.Instruments[sample].Len > 0 {
+		n.Ins = &m.Instruments[sample]
+	}
+
+	switch {
+	case cell.note == itNoteOff || cell.note == itNoteFade:
+		n.KeyOff = true
+	case cell.note == itNoteCut:
+		n.Vol = 1 // volume 0
+	case cell.note > 0 && cell.note <= 120:
+		n.Period = s3mPeriod(note-12, song.c5Speeds[sample]) // C-5 plays at the C5 speed
+	}
+
+	var ok bool
+	if n.Effect, ok = itEffect(cell.eff, cell.par); !ok {
+		m.Warnf("effect %c%02X is not supported", 'A'+cell.eff-1, cell.par)
+	}
+	switch v := int(cell.vol) - 1; {
+	case v < 0:
+	case v <= 64:
+		n.Vol = v + 1
+	default:
+		// the other volume column commands are played as effects, if the effect column is empty
+		e, ok := itVolumeEffect(v)
+		switch {
+		case !ok:
+		case n.EffCode != 0:
+			m.Warnf("volume column effects in combination with other effects are not supported")
+		default:
+			n.Effect = e
+		}
+	}
+	return
+}
+
+// itEffect converts an effect of the IT format, which are the ones of the S3M format except for a few
+// differences in the parameters
+func itEffect(cmd, par byte) (Effect, bool) {
+	switch cmd {
+	case 'C' - '@': // pattern break to a (hexadecimal) line, converted to the BCD of MOD
+		if par >= 100 {
+			return Effect{}, false
+		}
+		return Effect{PatternBreak, 0xD00 | uint16(par/10)<<4 | uint16(par%10)}, true
+	case 'M' - '@', 'N' - '@', 'Y' - '@', 'Z' - '@': // channel volume, panbrello, MIDI macros
+		return Effect{}, false
+	case 'S' - '@':
+		if x := par >> 4; x == 0x7 || x == 0x9 || x == 0xA {
+			return Effect{}, false // new note actions, sound control, high sample offset
+		}
+	case 'V' - '@': // global volume 00-80
+		if par > 0x80 {
+			par = 0x80
+		}
+		return Effect{SetGlobalVolume, uint16('G'-'A'+10)<<8 | uint16(par/2)}, true
+	case 'X' - '@': // set panning 00-FF
+		return Effect{SetPanning, 0x800 | uint16(par)}, true
+	}
+	return s3mEffect(cmd, par)
+}
+
+// itPortaSpeeds are the speeds of the portamento of the volume column
+var itPortaSpeeds = []uint16{0x00, 0x01, 0x04, 0x08, 0x10, 0x20, 0x40, 0x60, 0x80, 0xFF}
+
+// itVolumeEffect converts a command of the volume column (65-212) into an effect
+func itVolumeEffect(v int) (Effect, bool) {
+	switch {
+	case v < 75: // fine volume slide up
+		return Effect{FineVolSlideUp, 0xEA0 | uint16(v-65)}, true
+	case v < 85: // fine volume slide down
+		return Effect{FineVolSlideDown, 0xEB0 | uint16(v-75)}, true
+	case v < 95: // volume slide up
+		return Effect{VolSlide, 0xA00 | uint16(v-85)<<4}, true
+	case v < 105: // volume slide down
+		return Effect{VolSlide, 0xA00 | uint16(v-95)}, true
+	case v < 115: // pitch slide down
+		return Effect{SlideDown, 0x200 | uint16(v-105)*4}, true
+	case v < 125: // pitch slide up
+		return Effect{SlideUp, 0x100 | uint16(v-115)*4}, true
+	case v >= 128 && v <= 192: // set panning
+		return Effect{SetPanning, 0x800 | uint16(v-128)*255/64}, true
+	case v >= 193 && v <= 202: // portamento
+		return Effect{Portamento, 0x300 | itPortaSpeeds[v-193]}, true
+	case v >= 203 && v <= 212: // vibrato depth
+		return Effect{Vibrato, 0x400 | uint16(v-203)}, true
+	}
+	return Effect{}, false
+}
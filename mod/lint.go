@@ -0,0 +1,115 @@
+package mod
+
+import (
+	"errors"
+	"fmt"
+)
+
+// The checks of Lint (the Check of a LintIssue)
+const (
+	LintWarning   = "warning"   // a problem found while loading the file (see Module.Warnings)
+	LintTruncated = "truncated" // the file ends before all of its pattern or sample data (see ErrTruncated)
+	LintPeriod    = "period"    // a note outside of the Amiga range C-1..B-3 (MOD)
+	LintLoop      = "loop"      // a sample loop past the end of the sample
+	LintVolume    = "volume"    // an instrument volume or Cxx above 64
+	LintJump      = "jump"      // Bxx to an order beyond the pattern table, Dxx to a row beyond the pattern
+	LintPanning   = "panning"   // 8xx or E8x, which ProTracker ignores (MOD)
+	LintUnused    = "unused"    // an instrument with a sample which no note plays
+)
+
+// LintIssue is a problem of a module found by Lint
+type LintIssue struct {
+	Check      string `json:"check"`      // the kind of problem (LintWarning, LintPeriod, ...)
+	Pattern    int    `json:"pattern"`    // -1 if the problem isn't in a pattern
+	Row        int    `json:"row"`        // -1 if the problem isn't in a pattern
+	Channel    int    `json:"channel"`    // 0-based; -1 if the problem isn't in a pattern
+	Instrument int    `json:"instrument"` // 0 if the problem isn't about an instrument
+	Message    string `json:"message"`
+}
+
+func (li LintIssue) String() string {
+	switch {
+	case li.Pattern >= 0:
+		return fmt.Sprintf("%s: pattern %d, row %d, channel %d: %s", li.Check, li.Pattern, li.Row, li.Channel, li.Message)
+	case li.Instrument > 0:
+		return fmt.Sprintf("%s: instrument %d: %s", li.Check, li.Instrument, li.Message)
+	}
+	return fmt.Sprintf("%s: %s", li.Check, li.Message)
+}
+
+// Lint checks the module for problems which may make it sound different in other players or on an Amiga,
+// and returns them (with the warnings of the loader first)
+func (m Module) Lint() []LintIssue {
+	var issues []LintIssue
+	for _, w := range m.Warnings {
+		issues = append(issues, LintIssue{Check: LintWarning, Pattern: -1, Row: -1, Channel: -1, Message: w})
+	}
+	usage := m.InstrumentUsage()
+	for i := 1; i < len(m.Instruments); i++ {
+		ins := m.Instruments[i]
+		add := func(check, format string, a ...interface{}) {
+			issues = append(issues, LintIssue{Check: check, Pattern: -1, Row: -1, Channel: -1, Instrument: i, Message: fmt.Sprintf(format, a...)})
+		}
+		if ins.Volume > 64 {
+			add(LintVolume, "volume %d above 64", ins.Volume)
+		}
+		if ins.RepLen > 0 && ins.RepStart+ins.RepLen > ins.Len {
+			add(LintLoop, "loop end %d is past the sample end (%d)", ins.RepStart+ins.RepLen, ins.Len)
+		}
+		if ins.HasSample() && len(m.SampleMaps) == 0 && i < len(usage.Total) && usage.Total[i] == 0 {
+			add(LintUnused, "the sample (%d samples) isn't played by any note", ins.Len)
+		}
+	}
+
+	isMOD := m.Format == FormatMOD
+	lo, hi := PeriodTables[0][47].period, PeriodTables[0][12].period // B-3 and C-1
+	for p, patt := range m.Patterns {
+		for r, line := range patt {
+			for ch, n := range line {
+				add := func(check, format string, a ...interface{}) {
+					issues = append(issues, LintIssue{Check: check, Pattern: p, Row: r, Channel: ch, Instrument: n.InsNum, Message: fmt.Sprintf(format, a...)})
+				}
+				if isMOD && n.Period != 0 && (n.Period < lo || n.Period > hi) {
+					add(LintPeriod, "period %d outside of the Amiga range (%d-%d)", n.Period, lo, hi)
+				}
+				switch n.EffType {
+				case SetVol:
+					if n.Par() > 64 {
+						add(LintVolume, "C%02X sets a volume above 64", n.Par())
+					}
+				case PositionJump:
+					if n.Par() >= len(m.PatternTable) {
+						add(LintJump, "B%02X jumps to order %d, after the last order (%d)", n.Par(), n.Par(), len(m.PatternTable)-1)
+					}
+				case PatternBreak:
+					if row := n.ParX()*10 + n.ParY(); row >= 64 { // BCD
+						add(LintJump, "D%02X breaks to row %d, which doesn't exist", n.Par(), row)
+					}
+				case NotUsed8:
+					if isMOD {
+						add(LintPanning, "8%02X sets the panning, which only some players do", n.Par())
+					}
+				case NotUsedE8:
+					if isMOD {
+						add(LintPanning, "E8%X sets the panning, which only some players do", n.ParY())
+					}
+				}
+			}
+		}
+	}
+	return issues
+}
+
+// LintFile loads the module file fn and checks it with Lint. A file which is truncated gives a single
+// LintTruncated issue, as it can't be loaded.
+func LintFile(fn string) ([]LintIssue, error) {
+	m, err := LoadFile(fn)
+	if errors.Is(err, ErrTruncated) {
+		return []LintIssue{{Check: LintTruncated, Pattern: -1, Row: -1, Channel: -1, Message: err.Error()}}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer m.Close()
+	return m.Lint(), nil
+}
@@ -0,0 +1,96 @@
+package mod
+
+import (
+	"fmt"
+	"io"
+	"os"
+)
+
+// Format is the file format a module has been loaded from
+type Format int
+
+// The supported module formats
+const (
+	FormatMOD Format = iota // ProTracker MOD (and compatible formats, including the packed ones)
+	FormatXM                // FastTracker II extended module
+	FormatS3M               // Scream Tracker 3 module
+	FormatIT                // Impulse Tracker module
+)
+
+func (f Format) String() string {
+	switch f {
+	case FormatXM:
+		return "XM"
+	case FormatS3M:
+		return "S3M"
+	case FormatIT:
+		return "IT"
+	}
+	return "MOD"
+}
+
+// LoadFile reads the module file fn in any of the supported formats (detected by the file contents)
+func LoadFile(fn string) (Module, error) {
+	data, err := os.ReadFile(fn)
+	if err != nil {
+		return Module{}, err
+	}
+	return LoadData(fn, data)
+}
+
+// Load reads a module in any of the supported formats (see LoadData) from r; the detected format is
+// the module's Format
+func Load(r io.Reader) (Module, error) {
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return Module{}, err
+	}
+	return LoadData("", data)
+}
+
+// LoadData loads the module data (read from the file fn, which is only used as the module's FileName) in
+// any of the supported formats, also if it has been crunched with PowerPacker. For a ZIP archive, the first
+// module inside is loaded; gzipped data is decompressed. Like with ReadModData, the samples may refer to
+// data, which must not be changed afterwards.
+func LoadData(fn string, data []byte) (Module, error) {
+	if isZIP(data) {
+		return loadZIP(fn, data)
+	}
+	if isGzip(data) {
+		return loadGzip(fn, data)
+	}
+	if isPP20(data) {
+		unpacked, err := UnpackPP20(data)
+		if err != nil {
+			return Module{}, fmt.Errorf("PowerPacker: %v", err)
+		}
+		m, err := LoadData(fn, unpacked)
+		if m.Packer == "" {
+			m.Packer = "PowerPacker"
+		}
+		return m, err
+	}
+	switch DetectFormat(data) {
+	case FormatXM:
+		return ReadXMData(fn, data)
+	case FormatS3M:
+		return ReadS3MData(fn, data)
+	case FormatIT:
+		return ReadITData(fn, data)
+	}
+	return ReadModData(fn, data)
+}
+
+// DetectFormat returns the format of the module data by its signature. MOD files (which may have no
+// signature at all) are the fallback. Crunched or archived data is not looked into, see LoadData.
+func DetectFormat(data []byte) Format {
+	switch {
+	case isXM(data):
+		return FormatXM
+	case isS3M(data):
+		return FormatS3M
+	case isIT(data):
+		return FormatIT
+	}
+	return FormatMOD
+}
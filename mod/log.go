@@ -0,0 +1,23 @@
+package mod
+
+import (
+	"context"
+	"log/slog"
+)
+
+// logger receives the events of the loader (nil: logging is disabled)
+var logger *slog.Logger
+
+// SetLogger sets the logger to which the loader emits its events (nil disables logging): loaded modules
+// at Info level and problems with a module at Warn level
+func SetLogger(l *slog.Logger) {
+	logger = l
+}
+
+// logEvent emits an event to the logger (if there is one)
+func logEvent(level slog.Level, msg string, args ...any) {
+	if logger == nil {
+		return
+	}
+	logger.Log(context.Background(), level, msg, args...)
+}
@@ -0,0 +1,288 @@
+package mod
+
+import (
+	"bufio"
+	"encoding/binary"
+	"io"
+	"math"
+	"sort"
+)
+
+// midiEvent is a MIDI event at an absolute time (in ticks)
+type midiEvent struct {
+	tick int
+	data []byte
+}
+
+// midiTrack is a track of a Standard MIDI File
+type midiTrack struct {
+	events []midiEvent
+}
+
+func (t *midiTrack) add(tick int, data ...byte) {
+	t.events = append(t.events, midiEvent{tick, data})
+}
+
+// addMeta adds a meta event (track name, tempo, ...)
+func (t *midiTrack) addMeta(tick int, typ byte, data []byte) {
+	t.add(tick, append([]byte{0xFF, typ, byte(len(data))}, data...)...)
+}
+
+// appendVLQ appends v as a MIDI variable length quantity
+func appendVLQ(buf []byte, v int) []byte {
+	var tmp [4]byte
+	i := len(tmp) - 1
+	tmp[i] = byte(v & 0x7F)
+	for v >>= 7; v > 0; v >>= 7 {
+		i--
+		tmp[i] = byte(v&0x7F) | 0x80
+	}
+	return append(buf, tmp[i:]...)
+}
+
+// bytes encodes the track (events sorted by time, with an "end of track" event)
+func (t *midiTrack) bytes() []byte {
+	sort.SliceStable(t.events, func(i, j int) bool { return t.events[i].tick < t.events[j].tick })
+	var buf []byte
+	last := 0
+	for _, e := range t.events {
+		buf = appendVLQ(buf, e.tick-last)
+		buf = append(buf, e.data...)
+		last = e.tick
+	}
+	return append(buf, 0x00, 0xFF, 0x2F, 0x00)
+}
+
+// writeSMF writes the tracks as a Standard MIDI File (format 1) with the given number of ticks per quarter note
+func writeSMF(w io.Writer, division int, tracks []midiTrack) error {
+	bw := bufio.NewWriter(w)
+	bw.WriteString("MThd")
+	binary.Write(bw, binary.BigEndian, []uint32{6})
+	binary.Write(bw, binary.BigEndian, []uint16{1, uint16(len(tracks)), uint16(division)})
+	for i := range tracks {
+		data := tracks[i].bytes()
+		bw.WriteString("MTrk")
+		binary.Write(bw, binary.BigEndian, uint32(len(data)))
+		bw.Write(data)
+	}
+	return bw.Flush()
+}
+
+// periodToMIDI converts an Amiga period to the nearest MIDI note (C-2 = period 428 = MIDI note 60)
+func periodToMIDI(period int) int {
+	return 60 + int(math.Round(12*math.Log2(428/float64(period))))
+}
+
+// midiTicksPerQuarter is the MIDI file resolution. MIDI ticks are tracker ticks: at the default speed
+// (6 ticks per line, 4 lines per beat) this is 24 ticks per quarter note, and the MIDI tempo is the BPM
+const midiTicksPerQuarter = 24
+
+// midiTempo returns the data of a "set tempo" meta event (microseconds per quarter note) for the given BPM
+func midiTempo(bpm int) []byte {
+	us := 60000000 / bpm
+	return []byte{byte(us >> 16), byte(us >> 8), byte(us)}
+}
+
+// midiBendRange is the pitch bend range (in semitones) which is set up on the MIDI channels
+const midiBendRange = 12
+
+// midiBendRangeRPN returns the controller events setting the pitch bend range (RPN 0) of a MIDI channel
+func midiBendRangeRPN(channel byte) [][]byte {
+	cc := 0xB0 | channel
+	return [][]byte{{cc, 101, 0}, {cc, 100, 0}, {cc, 6, midiBendRange}, {cc, 38, 0}, {cc, 101, 127}, {cc, 100, 127}}
+}
+
+// midiBend returns the pitch bend value (0-16383, 8192: none) which raises a note by the given number of
+// semitones
+func midiBend(semitones float64) int {
+	v := 8192 + int(math.Round(semitones*8192/midiBendRange))
+	if v < 0 {
+		return 0
+	}
+	if v > 16383 {
+		return 16383
+	}
+	return v
+}
+
+// midiVibrato returns the period offset of a sine vibrato at the given position (0-63 is a cycle) and depth,
+// like ProTracker
+func midiVibrato(pos, depth int) int {
+	return int(math.Round(255*math.Sin(2*math.Pi*float64(pos&63)/64))) * depth / 128
+}
+
+// midiChannel is the state of a tracker channel in the MIDI export
+type midiChannel struct {
+	ins     *Instrument
+	on      bool
+	channel byte
+	key     byte
+
+	bendable   bool // the pitch of the note follows its period (not for fixed notes, like drums)
+	offset     int  // difference of the key to the pitch of the period (in semitones from C-2) when transposed
+	bend       int  // current pitch bend value
+	period     int  // current period, changed by slides
+	target     int  // period the tone portamento slides to
+	portaSpeed int
+	vibSpeed   int
+	vibDepth   int
+	vibPos     int
+}
+
+// pitchBend returns the pitch bend value for the current period with the given vibrato offset
+func (c *midiChannel) pitchBend(vib int) int {
+	period := c.period + vib
+	if period < 1 {
+		period = 1
+	}
+	return midiBend(12*math.Log2(428/float64(period)) + float64(c.offset))
+}
+
+// ExportMIDI converts the pattern data of the module into a Standard MIDI File: one track per tracker
+// channel plus a tempo track, with periods mapped to notes, volumes to velocities and BPM changes to tempo
+// events (MIDI ticks are tracker ticks, so speed changes need no events). Slides, tone portamento and
+// vibrato are approximated with pitch bends (with a range of 12 semitones), arpeggios are left out. How
+// channels and instruments are mapped to MIDI channels and programs is configured by mm.
+func (m Module) ExportMIDI(w io.Writer, mm MIDIMapping) error {
+	chanCnt := len(m.Patterns[0][0])
+	tracks := make([]midiTrack, chanCnt+1)
+	tracks[0].addMeta(0, 0x03, []byte(m.Name))
+	tracks[0].addMeta(0, 0x51, midiTempo(125))
+
+	chans := make([]midiChannel, chanCnt)
+	for ch := range chans {
+		chans[ch].bend = 8192
+	}
+	programs := map[int]int{}    // current program per MIDI channel
+	bendRange := map[byte]bool{} // MIDI channels whose pitch bend range is set up
+	noteOff := func(ch, tick int) {
+		if chans[ch].on {
+			tracks[ch+1].add(tick, 0x80|chans[ch].channel, chans[ch].key, 0)
+			chans[ch].on = false
+		}
+	}
+	setBend := func(ch, tick, bend int) {
+		if chans[ch].bend != bend {
+			tracks[ch+1].add(tick, 0xE0|chans[ch].channel, byte(bend&0x7F), byte(bend>>7))
+			chans[ch].bend = bend
+		}
+	}
+
+	bpm, end := 125, 0
+	m.WalkSong(0, func(sl SongLine) bool {
+		if sl.BPM != bpm {
+			bpm = sl.BPM
+			tracks[0].addMeta(sl.Tick, 0x51, midiTempo(bpm))
+		}
+		for ch, note := range m.Patterns[sl.Pattern][sl.Line] {
+			c := &chans[ch]
+			tick := sl.Tick
+			if note.EffType == NoteDelay {
+				tick += note.ParY()
+			}
+			if note.InsNum > 0 && note.Ins.Len > 0 {
+				c.ins = note.Ins
+			}
+			if note.Period > 0 && c.ins != nil && note.EffType != Portamento && note.EffType != PortamentoVolSlide {
+				noteOff(ch, tick)
+				t := mm.target(ch, c.ins)
+				key := t.note
+				if key < 0 {
+					key = periodToMIDI(note.Period) + t.transpose
+				}
+				if key < 0 || key > 127 {
+					continue
+				}
+				vol := c.ins.Volume
+				if note.EffType == SetVol {
+					vol = note.Par()
+				}
+				if vol == 0 {
+					continue
+				}
+				if t.program >= 0 && programs[t.channel] != t.program+1 {
+					programs[t.channel] = t.program + 1
+					tracks[ch+1].add(tick, 0xC0|byte(t.channel), byte(t.program&0x7F))
+				}
+				if byte(t.channel) != c.channel {
+					setBend(ch, tick, 8192) // reset the previous MIDI channel
+				}
+				c.channel, c.key, c.on = byte(t.channel), byte(key), true
+				c.bendable, c.offset, c.period, c.vibPos = t.note < 0, 60+t.transpose-key, note.Period, 0
+				if c.bendable && !bendRange[c.channel] {
+					bendRange[c.channel] = true
+					for _, rpn := range midiBendRangeRPN(c.channel) {
+						tracks[ch+1].add(tick, rpn...)
+					}
+				}
+				if c.bendable {
+					setBend(ch, tick, c.pitchBend(0))
+				} else {
+					setBend(ch, tick, 8192)
+				}
+				tracks[ch+1].add(tick, 0x90|byte(t.channel), byte(key), t.velocity(vol))
+			}
+			if note.EffType == NoteCut {
+				noteOff(ch, sl.Tick+note.ParY())
+			}
+
+			switch note.EffType {
+			case Portamento, PortamentoVolSlide:
+				if note.Period > 0 {
+					c.target = note.Period
+				}
+				if note.EffType == Portamento && note.Par() > 0 {
+					c.portaSpeed = note.Par()
+				}
+			case Vibrato:
+				if note.ParX() > 0 {
+					c.vibSpeed = note.ParX()
+				}
+				if note.ParY() > 0 {
+					c.vibDepth = note.ParY()
+				}
+			case FineSlideUp:
+				c.period -= note.ParY()
+			case FineSlideDown:
+				c.period += note.ParY()
+			}
+			if !c.on || !c.bendable || c.period <= 0 {
+				continue
+			}
+			for t := 0; t < sl.Ticks(); t++ {
+				vib := 0
+				if t%sl.Tempo != 0 {
+					switch note.EffType {
+					case SlideUp:
+						c.period -= note.Par()
+					case SlideDown:
+						c.period += note.Par()
+					case Portamento, PortamentoVolSlide:
+						if c.target > 0 && c.period < c.target {
+							if c.period += c.portaSpeed; c.period > c.target {
+								c.period = c.target
+							}
+						} else if c.target > 0 {
+							if c.period -= c.portaSpeed; c.period < c.target {
+								c.period = c.target
+							}
+						}
+					case Vibrato, VibratoVolSlide:
+						vib = midiVibrato(c.vibPos, c.vibDepth)
+						c.vibPos += c.vibSpeed
+					}
+				}
+				if c.period < 1 {
+					c.period = 1
+				}
+				setBend(ch, sl.Tick+t, c.pitchBend(vib))
+			}
+		}
+		end = sl.Tick + sl.Ticks()
+		return true
+	})
+	for ch := range chans {
+		noteOff(ch, end)
+	}
+	return writeSMF(w, midiTicksPerQuarter, tracks)
+}
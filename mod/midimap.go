@@ -0,0 +1,184 @@
+package mod
+
+import (
+	"encoding/json"
+	"math"
+	"os"
+	"strings"
+)
+
+// MIDIChannelMap configures how a tracker channel is exported to MIDI
+type MIDIChannelMap struct {
+	Channel       int     `json:"channel"`       // MIDI channel (0-15; 9 is the GM drum channel)
+	Program       int     `json:"program"`       // GM program (0-127), used if the instrument has none
+	Transpose     int     `json:"transpose"`     // in semitones
+	VelocityCurve float64 `json:"velocityCurve"` // velocity = 127 * (volume/64)^VelocityCurve (0 or 1: linear)
+}
+
+// MIDIInstrumentMap configures how a MOD instrument is exported to MIDI; unset fields use the channel settings
+type MIDIInstrumentMap struct {
+	Channel   *int `json:"channel,omitempty"`   // MIDI channel (e.g. 9 for drum samples)
+	Program   *int `json:"program,omitempty"`   // GM program (0-127)
+	Note      *int `json:"note,omitempty"`      // fixed MIDI note (e.g. for drums: 36 - kick, 38 - snare)
+	Transpose int  `json:"transpose,omitempty"` // in semitones, added to the channel's transpose
+}
+
+// MIDIMapping configures the MIDI export: settings per tracker channel and per instrument (by number).
+// Tracker channels without settings go to MIDI channels 0-8 and 10-15 in order, keeping the drum channel
+// free; as there are only 15 of them, tracker channel 16 shares MIDI channel 0 with tracker channel 1,
+// and so on. With GuessPrograms, instruments without an explicit mapping get a GM program (or drum note)
+// guessed from their name.
+type MIDIMapping struct {
+	Channels      []MIDIChannelMap          `json:"channels"`
+	Instruments   map[int]MIDIInstrumentMap `json:"instruments"`
+	GuessPrograms bool                      `json:"guessPrograms"`
+}
+
+// DefaultMIDIMapping maps each tracker channel to its own MIDI channel and guesses the programs
+func DefaultMIDIMapping() MIDIMapping {
+	return MIDIMapping{GuessPrograms: true}
+}
+
+// LoadMIDIMapping reads a MIDI mapping from the JSON file fn
+func LoadMIDIMapping(fn string) (MIDIMapping, error) {
+	var mm MIDIMapping
+	data, err := os.ReadFile(fn)
+	if err != nil {
+		return mm, err
+	}
+	err = json.Unmarshal(data, &mm)
+	return mm, err
+}
+
+// gmGuesses maps keywords in instrument names to GM programs (or, for drums, to notes on channel 9).
+// The first match wins, so more specific keywords have to come first.
+var gmGuesses = []struct {
+	keywords []string
+	program  int
+	drumNote int // > 0: drum sound
+}{
+	{keywords: []string{"kick", "bassdrum", "bass drum", "bd"}, drumNote: 36},
+	{keywords: []string{"snare", "sd"}, drumNote: 38},
+	{keywords: []string{"clap"}, drumNote: 39},
+	{keywords: []string{"hihat", "hi-hat", "hat", "hh"}, drumNote: 42},
+	{keywords: []string{"crash", "cymbal"}, drumNote: 49},
+	{keywords: []string{"ride"}, drumNote: 51},
+	{keywords: []string{"tom"}, drumNote: 45},
+	{keywords: []string{"drum", "perc"}, drumNote: 38},
+	{keywords: []string{"bass"}, program: 33},
+	{keywords: []string{"piano"}, program: 0},
+	{keywords: []string{"organ"}, program: 16},
+	{keywords: []string{"guitar", "gtr"}, program: 29},
+	{keywords: []string{"string", "violin", "cello"}, program: 48},
+	{keywords: []string{"choir", "voice", "vox", "aah"}, program: 52},
+	{keywords: []string{"trumpet"}, program: 56},
+	{keywords: []string{"brass", "horn"}, program: 61},
+	{keywords: []string{"sax"}, program: 65},
+	{keywords: []string{"flute"}, program: 73},
+	{keywords: []string{"lead"}, program: 80},
+	{keywords: []string{"pad"}, program: 88},
+	{keywords: []string{"bell"}, program: 14},
+}
+
+// guessGM guesses a GM program or drum note from an instrument name
+func guessGM(name string) (program, drumNote int, ok bool) {
+	words := nameWords(name)
+	for _, g := range gmGuesses {
+		for _, kw := range g.keywords {
+			if hasWords(words, nameWords(kw)) {
+				return g.program, g.drumNote, true
+			}
+		}
+	}
+	return 0, 0, false
+}
+
+// nameWords splits an instrument name into its lower case words (digits and punctuation separate them)
+func nameWords(name string) []string {
+	return strings.FieldsFunc(strings.ToLower(name), func(r rune) bool { return r < 'a' || r > 'z' })
+}
+
+// hasWords reports whether words contains the keyword words kw in a row; the last one may be a plural
+// ("strings", "toms"), but keywords never match within a word ("hat" in "what")
+func hasWords(words, kw []string) bool {
+	for i := 0; i+len(kw) <= len(words); i++ {
+		match := true
+		for j, w := range kw {
+			if words[i+j] != w && (j < len(kw)-1 || words[i+j] != w+"s") {
+				match = false
+				break
+			}
+		}
+		if match && len(kw) > 0 {
+			return true
+		}
+	}
+	return false
+}
+
+// midiTarget is where a note of a tracker channel/instrument ends up in the MIDI file
+type midiTarget struct {
+	channel   int
+	program   int // -1: no program change (drums)
+	note      int // -1: use the note's pitch
+	transpose int
+	curve     float64
+}
+
+// target resolves the mapping for the given tracker channel and instrument
+func (mm MIDIMapping) target(ch int, ins *Instrument) midiTarget {
+	t := midiTarget{channel: ch % 15, note: -1, curve: 1} // the 15 channels apart from the drum channel
+	if t.channel >= 9 {
+		t.channel++ // keep the drum channel free
+	}
+	if ch < len(mm.Channels) {
+		cm := mm.Channels[ch]
+		t.channel, t.program, t.transpose = cm.Channel, cm.Program, cm.Transpose
+		if cm.VelocityCurve > 0 {
+			t.curve = cm.VelocityCurve
+		}
+	}
+	if ins == nil {
+		return t
+	}
+	im, mapped := mm.Instruments[ins.Num]
+	if !mapped && mm.GuessPrograms {
+		if program, drumNote, ok := guessGM(ins.Name); ok {
+			if drumNote > 0 {
+				t.channel, t.note = 9, drumNote
+			} else {
+				t.program = program
+			}
+		}
+	}
+	if im.Channel != nil {
+		t.channel = *im.Channel
+	}
+	if im.Program != nil {
+		t.program = *im.Program
+	}
+	if im.Note != nil {
+		t.note = *im.Note
+	}
+	t.transpose += im.Transpose
+	if t.channel == 9 {
+		t.program = -1
+	}
+	t.channel &= 0x0F
+	return t
+}
+
+// velocity converts a MOD volume (0-64) to a MIDI velocity using the target's velocity curve
+func (t midiTarget) velocity(vol int) byte {
+	if vol <= 0 {
+		return 0
+	}
+	if vol > 64 {
+		vol = 64
+	}
+	v := int(math.Round(127 * math.Pow(float64(vol)/64, t.curve)))
+	if v < 1 {
+		v = 1
+	}
+	return byte(v)
+}
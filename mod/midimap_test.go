@@ -0,0 +1,44 @@
+package mod
+
+import "testing"
+
+// TestMIDIChannels checks that the tracker channels of modules with 16 or more channels stay on the
+// melodic MIDI channels, sharing them from tracker channel 16 on
+func TestMIDIChannels(t *testing.T) {
+	mm := DefaultMIDIMapping()
+	for ch := 0; ch < 32; ch++ {
+		want := ch % 15
+		if want >= 9 {
+			want++
+		}
+		if got := mm.target(ch, nil).channel; got != want {
+			t.Errorf("tracker channel %d: MIDI channel %d, want %d", ch+1, got, want)
+		}
+	}
+}
+
+func TestGuessGM(t *testing.T) {
+	for _, c := range []struct {
+		name     string
+		program  int
+		drumNote int
+		ok       bool
+	}{
+		{"Kick01", 0, 36, true},
+		{"bass drum", 0, 36, true},
+		{"Hi-Hat closed", 0, 42, true},
+		{"st-01:hh", 0, 42, true},
+		{"Strings", 48, 0, true},
+		{"slap bass", 33, 0, true},
+		{"what", 0, 0, false},
+		{"custom", 0, 0, false},
+		{"override", 0, 0, false},
+		{"bdx", 0, 0, false},
+	} {
+		program, drumNote, ok := guessGM(c.name)
+		if program != c.program || drumNote != c.drumNote || ok != c.ok {
+			t.Errorf("%q: program %d, drum note %d, found %v, want %d, %d, %v",
+				c.name, program, drumNote, ok, c.program, c.drumNote, c.ok)
+		}
+	}
+}
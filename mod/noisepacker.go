@@ -0,0 +1,207 @@
+package mod
+
+import (
+	"encoding/binary"
+	"fmt"
+)
+
+// NoisePacker 2 and 3 modules store every pattern as 4 tracks, which patterns can share:
+//
+//	word        number of samples * 16 + $0C
+//	word        size of the position list (a word per position)
+//	word        size of the pattern table (8 bytes per pattern)
+//	word        size of the track data
+//	16 bytes    per sample: address, length (words), finetune, volume, loop address, loop length
+//	            (words) and loop start (bytes); version 3 stores finetune and volume before the address
+//	2 words     unused
+//	words       the position list: pattern numbers * 8
+//	4 words     per pattern: the offsets of its tracks in the track data, from channel 4 to channel 1
+//	track data  3-byte notes, 64 per track: note index * 2 with the high bit of the instrument, the
+//	            low bits of the instrument with the effect, and the parameter; version 3 stores a run
+//	            of n empty notes as the byte -n
+//	samples
+
+// noisePackerRows is the number of rows of a NoisePacker track
+const noisePackerRows = 64
+
+// npLayout is the layout of a NoisePacker module
+type npLayout struct {
+	v3         bool
+	samples    []ptSample
+	positions  []int    // the pattern numbers
+	tracks     [][4]int // the offsets of the tracks of each pattern in trackData, by channel
+	trackData  []byte
+	samplesOfs int // offset of the sample data
+}
+
+// noisePackerLayout returns the layout of a NoisePacker 2 (or 3, if v3) module, if data is one (it has
+// to hold the module up to its samples)
+func noisePackerLayout(data []byte, v3 bool) (l npLayout, ok bool) {
+	if len(data) < 8 || data[1]&0x0F != 0x0C {
+		return l, false
+	}
+	insCnt := int(binary.BigEndian.Uint16(data)) >> 4
+	posLen, pattLen := int(binary.BigEndian.Uint16(data[2:])), int(binary.BigEndian.Uint16(data[4:]))
+	trackLen := int(binary.BigEndian.Uint16(data[6:]))
+	if insCnt == 0 || insCnt > 31 || posLen == 0 || posLen%2 != 0 || posLen > 256 ||
+		pattLen == 0 || pattLen%8 != 0 || pattLen > 64*8 || trackLen == 0 {
+		return l, false
+	}
+	posOfs := 8 + insCnt*16 + 4
+	tracksOfs := posOfs + posLen + pattLen
+	if len(data) < tracksOfs+trackLen {
+		return l, false
+	}
+	l.v3 = v3
+	for i := 0; i < insCnt; i++ {
+		sh := data[8+i*16:]
+		s := ptSample{
+			len:      int(binary.BigEndian.Uint16(sh[4:])),
+			finetune: int(sh[6]),
+			volume:   int(sh[7]),
+			repLen:   int(binary.BigEndian.Uint16(sh[12:])),
+			repStart: int(binary.BigEndian.Uint16(sh[14:])) / 2,
+		}
+		if v3 {
+			s.finetune, s.volume, s.len = int(sh[0]), int(sh[1]), int(binary.BigEndian.Uint16(sh[6:]))
+		}
+		if s.volume > 64 || s.repStart+s.repLen > s.len+1 {
+			return l, false
+		}
+		l.samples = append(l.samples, s)
+	}
+	for i := 0; i < posLen; i += 2 {
+		patt := int(binary.BigEndian.Uint16(data[posOfs+i:]))
+		if patt%8 != 0 || patt >= pattLen {
+			return l, false
+		}
+		l.positions = append(l.positions, patt/8)
+	}
+	l.trackData = data[tracksOfs : tracksOfs+trackLen]
+	for i := 0; i < pattLen; i += 8 {
+		var tracks [4]int
+		for ch := range tracks {
+			tracks[3-ch] = int(binary.BigEndian.Uint16(data[posOfs+posLen+i+ch*2:]))
+		}
+		l.tracks = append(l.tracks, tracks)
+	}
+	// the tracks have to decode to valid notes
+	for _, tracks := range l.tracks {
+		for _, ofs := range tracks {
+			if _, err := l.track(ofs, insCnt); err != nil {
+				return l, false
+			}
+		}
+	}
+	l.samplesOfs = tracksOfs + trackLen
+	return l, true
+}
+
+// track returns the 64 notes of the track at ofs (3 bytes each, empty notes are 0)
+func (l *npLayout) track(ofs, insCnt int) ([]byte, error) {
+	notes := make([]byte, noisePackerRows*3)
+	td := l.trackData
+	for row := 0; row < noisePackerRows; row++ {
+		if ofs >= len(td) {
+			return nil, fmt.Errorf("track at %d ends after %d rows", ofs, row)
+		}
+		if l.v3 && td[ofs] >= 0x80 {
+			row += 0x100 - int(td[ofs]) - 1 // empty notes
+			ofs++
+			continue
+		}
+		if ofs+3 > len(td) {
+			return nil, fmt.Errorf("track at %d ends after %d rows", ofs, row)
+		}
+		n := td[ofs : ofs+3]
+		if n[0] > 36*2+1 || int(n[0]<<4&0x10|n[1]>>4) > insCnt {
+			return nil, fmt.Errorf("invalid note %x in the track at %d", n, ofs)
+		}
+		copy(notes[row*3:], n)
+		ofs += 3
+	}
+	return notes, nil
+}
+
+func detectNoisePacker2(data []byte) bool {
+	_, ok := noisePackerLayout(data, false)
+	return ok
+}
+
+func detectNoisePacker3(data []byte) bool {
+	_, ok := noisePackerLayout(data, true)
+	return ok
+}
+
+func unpackNoisePacker2(data []byte) ([]byte, error) {
+	return unpackNoisePacker(data, false)
+}
+
+func unpackNoisePacker3(data []byte) ([]byte, error) {
+	return unpackNoisePacker(data, true)
+}
+
+// unpackNoisePacker puts the tracks of the patterns together and converts the notes
+func unpackNoisePacker(data []byte, v3 bool) ([]byte, error) {
+	l, ok := noisePackerLayout(data, v3)
+	if !ok {
+		return nil, fmt.Errorf("not a NoisePacker module")
+	}
+	pl := ptLayout{}
+	for _, s := range l.samples {
+		pl.samplesLen += s.len * 2
+	}
+	if len(data) < l.samplesOfs+pl.samplesLen {
+		return nil, fmt.Errorf("NoisePacker module is truncated")
+	}
+	// only the patterns up to the highest one played: ProTracker stores as many
+	for _, patt := range l.positions {
+		if patt >= pl.patternCnt {
+			pl.patternCnt = patt + 1
+		}
+	}
+	var rows []byte
+	for _, tracks := range l.tracks[:pl.patternCnt] {
+		var notes [4][]byte
+		for ch, ofs := range tracks {
+			notes[ch], _ = l.track(ofs, len(l.samples)) // checked by noisePackerLayout
+		}
+		for row := 0; row < noisePackerRows; row++ {
+			for ch := range notes {
+				rows = append(rows, notes[ch][row*3:row*3+3]...)
+			}
+		}
+	}
+	rows = append(rows, data[l.samplesOfs:l.samplesOfs+pl.samplesLen]...)
+	return convertPatterns(rows, ptHeader(l.samples, l.positions), pl, 3, func(n []byte) (int, int, int, int, error) {
+		period, err := ptNoteIndexPeriod(int(n[0] >> 1))
+		eff, par := npEffect(int(n[1]&0x0F), int(n[2]))
+		return int(n[0]<<4&0x10 | n[1]>>4), period, eff, par, err
+	})
+}
+
+// npEffect converts an effect of NoisePacker to ProTracker: the volume slide is stored as effect 7, and
+// the parameters of the volume slides are signed (negative: down); effect 8 is not used
+func npEffect(eff, par int) (int, int) {
+	switch eff {
+	case 0x07:
+		eff = 0x0A
+		fallthrough
+	case 0x05, 0x06:
+		par = signedSlide(par)
+	case 0x08:
+		eff, par = 0, 0
+	case 0x0B:
+		par = (par + 4) / 2 // the position is stored as its offset in the position list, less 4
+	}
+	return eff, par
+}
+
+// signedSlide converts the signed parameter of a volume slide (negative: down) as stored by several
+// packers to ProTracker
+func signedSlide(par int) int {
+	if par >= 0x80 {
+		return (0x100 - par) & 0x0F
+	}
+	return par << 4 & 0xF0
+}
@@ -1,6 +1,10 @@
-package main
+package mod
 
-import "fmt"
+import (
+	"fmt"
+	"math"
+	"strings"
+)
 
 //           C    C#   D    D#   E    F    F#   G    G#   A    A#   B
 // Octave 0:1712,1616,1525,1440,1357,1281,1209,1141,1077,1017, 961, 907 (non-standard)
@@ -9,8 +13,8 @@ import "fmt"
 // Octave 3: 214, 202, 190, 180, 170, 160, 151, 143, 135, 127, 120, 113
 // Octave 4: 107, 101,  95,  90,  85,  80,  76,  71,  67,  64,  60,  57 (non-standard)
 
-// PeriodTables is a slice containing all 15 period tables (initialized on startup)
-var PeriodTables [15]PeriodTable
+// PeriodTables is a slice containing all 16 period tables (initialized on startup)
+var PeriodTables [16]PeriodTable
 
 func init() {
 	for i := range PeriodTables {
@@ -29,18 +33,19 @@ type NotePeriod struct {
 	note     string
 }
 
+// noteNames are the names of the notes of an octave
+var noteNames = []string{"C", "C#", "D", "D#", "E", "F", "F#", "G", "G#", "A", "A#", "B"}
+
 // NewPeriodTable creates a PeriodTable for a given fineTune value
 func NewPeriodTable(fineTune int) PeriodTable {
-	var notes = []string{"C", "C#", "D", "D#", "E", "F", "F#", "G", "G#", "A", "A#", "B"}
-
 	// TODO: exclude "extended" octaves (0 & 4) if needed
 	var (
 		minOctave = 0
 		maxOctave = 4
 	)
-	ret := make(PeriodTable, (maxOctave-minOctave+1)*len(notes))
+	ret := make(PeriodTable, (maxOctave-minOctave+1)*len(noteNames))
 	for oct := minOctave; oct <= maxOctave; oct++ { // hey, wow, an actual "real" for loop...
-		for ni, note := range notes {
+		for ni, note := range noteNames {
 			ret[(oct-minOctave)*12+ni] = NotePeriod{
 				fineTune,
 				periodTableData[fineTune][oct*12+ni],
@@ -52,6 +57,77 @@ func NewPeriodTable(fineTune int) PeriodTable {
 	return ret
 }
 
+// FinetunedPeriod returns the period at which a note is played with the given finetune (-8..7, or the
+// nibble 0..15). Pattern data stores notes with their periods for finetune 0, like ProTracker does, so the
+// note is looked up in the finetune 0 table and the period taken from the table of the finetune. Periods
+// which aren't in the table are returned unchanged.
+func FinetunedPeriod(period, finetune int) int {
+	if finetune&0x0F == 0 {
+		return period
+	}
+	_, idx, err := PeriodTables[0].FindPeriod(period)
+	if err != nil {
+		return period
+	}
+	return PeriodTables[finetune&0x0F][idx].period
+}
+
+// ArpeggioPeriod returns the period halfNotes above the given period with the given finetune, looked up
+// like ProTracker's arpeggio does: in the notes C-1..B-3 of the finetune's table, from the first note
+// whose period is not above the given period. Notes beyond B-3 are read from the table of the next
+// finetune (a bug of ProTracker, which some modules depend on); they are limited to B-3 for the last
+// table. Periods above B-3 are returned unchanged.
+func ArpeggioPeriod(period, finetune, halfNotes int) int {
+	const first, last = 12, 47 // C-1 and B-3 in the tables
+	pt := PeriodTables[finetune&0x0F]
+	for i := first; i <= last; i++ {
+		if pt[i].period > period {
+			continue
+		}
+		i += halfNotes
+		switch {
+		case i <= last:
+			return pt[i].period
+		case finetune&0x0F == 15:
+			return pt[last].period
+		}
+		return PeriodTables[(finetune+1)&0x0F][i-36].period
+	}
+	return period
+}
+
+// PeriodToNote returns the note ("C", "C#", ...) and the octave (0-4, C-2 is period 428 without finetune)
+// of a period in the period table of the given finetune (-8..7, or the nibble 0..15). Periods between the
+// notes of the table give the nearest note, periods beyond the table its lowest or highest note.
+func PeriodToNote(period, finetune int) (note string, octave int) {
+	pt := PeriodTables[finetune&0x0F]
+	best, dist := 0, math.Inf(1)
+	for i, np := range pt {
+		if d := math.Abs(math.Log2(float64(np.period) / float64(period))); d < dist {
+			best, dist = i, d
+		}
+	}
+	return pt[best].note, pt[best].octave
+}
+
+// NoteToPeriod returns the period of a note ("C", "C#", ... or "C-" like in "C-2") in the octave (0-4) with
+// the given finetune (-8..7, or the nibble 0..15)
+func NoteToPeriod(note string, octave, finetune int) (int, error) {
+	name := strings.ToUpper(strings.TrimSuffix(note, "-"))
+	for i, n := range noteNames {
+		if n == name && octave >= 0 && octave <= 4 {
+			return PeriodTables[finetune&0x0F][octave*12+i].period, nil
+		}
+	}
+	return 0, fmt.Errorf("unknown note %s%d", note, octave)
+}
+
+// NoteString returns the name of a note in the octave as trackers show it (e.g. "C-2" or "C#2")
+func NoteString(note string, octave int) string {
+	np := NotePeriod{note: note, octave: octave}
+	return np.String()
+}
+
 // FindPeriod tries to find a period value in the NotePeriod table and returns the index
 func (pt *PeriodTable) FindPeriod(period int) (NotePeriod, int, error) {
 	for ni, np := range *pt {
@@ -79,6 +155,18 @@ func (pt *PeriodTable) IncDecPeriod(period, delta int) (NotePeriod, error) {
 	return (*pt)[idx], nil
 }
 
+// SemitonePeriod returns the period of the first note of the table (from low to high notes) whose period
+// is not above the given period, like the glissando of ProTracker snaps slides to semitones. Periods above
+// the lowest note return the period of the lowest note, periods below the highest note that of the highest note.
+func (pt *PeriodTable) SemitonePeriod(period int) int {
+	for _, np := range *pt {
+		if np.period <= period {
+			return np.period
+		}
+	}
+	return (*pt)[len(*pt)-1].period
+}
+
 func (np *NotePeriod) String() string {
 	var note = np.note
 	if len(note) < 2 {
@@ -89,8 +177,6 @@ func (np *NotePeriod) String() string {
 
 // TODO: PeriodTable method to inc/dec by half-notes!
 
-// TODO: String() method which returns "C-1", "D#3" etc.
-
 // These are the periods for all known notes and all finetune values.
 // Notes are stored as periods in the MOD files, but some effects still
 // operate on notes, so we need these tables to find out which note we
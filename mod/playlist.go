@@ -0,0 +1,79 @@
+package mod
+
+import (
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// isPlaylistFileName returns true for file names of M3U and PLS playlists
+func isPlaylistFileName(name string) bool {
+	switch strings.ToLower(filepath.Ext(name)) {
+	case ".m3u", ".m3u8", ".pls":
+		return true
+	}
+	return false
+}
+
+// ExpandPlaylist returns the files to play for the given paths: directories are replaced by the modules
+// (and archives) below them, in lexical order, and M3U/PLS playlists by their entries (relative entries
+// are relative to the directory of the playlist). All other paths are taken as they are.
+func ExpandPlaylist(paths []string) ([]string, error) {
+	var files []string
+	for _, p := range paths {
+		fi, err := os.Stat(p)
+		switch {
+		case err != nil:
+			return nil, err
+		case fi.IsDir():
+			err = filepath.WalkDir(p, func(fn string, d fs.DirEntry, err error) error {
+				if err != nil || d.IsDir() || !isModFileName(d.Name()) && !isArchiveFileName(d.Name()) {
+					return err
+				}
+				files = append(files, fn)
+				return nil
+			})
+		case isPlaylistFileName(p):
+			var entries []string
+			entries, err = readPlaylist(p)
+			files = append(files, entries...)
+		default:
+			files = append(files, p)
+		}
+		if err != nil {
+			return nil, err
+		}
+	}
+	return files, nil
+}
+
+// readPlaylist reads the entries of the M3U or PLS playlist fn. URLs are skipped, as only local files
+// can be played.
+func readPlaylist(fn string) ([]string, error) {
+	data, err := os.ReadFile(fn)
+	if err != nil {
+		return nil, err
+	}
+	pls := strings.EqualFold(filepath.Ext(fn), ".pls")
+	var entries []string
+	for _, line := range strings.Split(string(data), "\n") {
+		line = strings.TrimSpace(line)
+		if pls {
+			// File1=song.mod (the Title/Length entries are ignored)
+			key, val, ok := strings.Cut(line, "=")
+			if !ok || !strings.HasPrefix(strings.ToLower(key), "file") {
+				continue
+			}
+			line = strings.TrimSpace(val)
+		}
+		if line == "" || strings.HasPrefix(line, "#") || strings.Contains(line, "://") {
+			continue
+		}
+		if !filepath.IsAbs(line) {
+			line = filepath.Join(filepath.Dir(fn), line)
+		}
+		entries = append(entries, line)
+	}
+	return entries, nil
+}
@@ -0,0 +1,134 @@
+package mod
+
+import (
+	"fmt"
+)
+
+// PowerPacker "crunches" whole files (not only modules), so crunched files are decrunched before the
+// format is detected. The crunched data is read backwards, from the end of the file: a stream of bits
+// with runs of literal bytes and matches (copies of bytes decrunched before), which fills the output
+// from its end.
+
+const pp20Signature = "PP20"
+
+// maxDecrunchedLen limits the size claimed by the header of crunched data
+const maxDecrunchedLen = 64 << 20
+
+func isPP20(data []byte) bool {
+	return len(data) >= 12 && string(data[:len(pp20Signature)]) == pp20Signature
+}
+
+// ppBitReader reads the bits of PowerPacker data from the end of the data (starting with the
+// lowest bit of each byte)
+type ppBitReader struct {
+	data []byte
+	pos  int // the byte read last
+	bits uint32
+	cnt  int // number of bits left in bits
+}
+
+// read returns the next n bits (the first one read as the highest bit)
+func (br *ppBitReader) read(n int) (int, error) {
+	v := 0
+	for i := 0; i < n; i++ {
+		if br.cnt == 0 {
+			if br.pos == 0 {
+				return 0, fmt.Errorf("crunched data ends unexpectedly")
+			}
+			br.pos--
+			br.bits, br.cnt = uint32(br.data[br.pos]), 8
+		}
+		v = v<<1 | int(br.bits&1)
+		br.bits >>= 1
+		br.cnt--
+	}
+	return v, nil
+}
+
+// UnpackPP20 decrunches data crunched with PowerPacker 2.0 (or later, with the "PP20" signature). Behind the
+// signature, the data starts with the bit widths of the match offsets and ends with the decrunched length
+// and the number of bits to skip at the start of the bit stream.
+func UnpackPP20(data []byte) ([]byte, error) {
+	if !isPP20(data) {
+		return nil, fmt.Errorf("not PowerPacker data")
+	}
+	n := len(data)
+	outLen := int(data[n-4])<<16 | int(data[n-3])<<8 | int(data[n-2])
+	if outLen == 0 || outLen > maxDecrunchedLen {
+		return nil, fmt.Errorf("invalid decrunched length %d", outLen)
+	}
+	offsetBits := data[4:8]
+	for _, b := range offsetBits {
+		if b == 0 || b > 16 {
+			return nil, fmt.Errorf("invalid offset width %d", b)
+		}
+	}
+	br := ppBitReader{data: data[8 : n-4], pos: n - 12}
+	if _, err := br.read(int(data[n-1])); err != nil {
+		return nil, err
+	}
+
+	out := make([]byte, outLen)
+	pos := outLen // the byte written last
+	for pos > 0 {
+		x, err := br.read(1)
+		if err != nil {
+			return nil, err
+		}
+		if x == 0 {
+			// a run of literal bytes: its length is 1 + the sum of 2-bit values up to one below 3
+			todo := 1
+			for x = 3; x == 3; todo += x {
+				if x, err = br.read(2); err != nil {
+					return nil, err
+				}
+			}
+			if todo > pos {
+				return nil, fmt.Errorf("literal run exceeds the decrunched length")
+			}
+			for ; todo > 0; todo-- {
+				if x, err = br.read(8); err != nil {
+					return nil, err
+				}
+				pos--
+				out[pos] = byte(x)
+			}
+			if pos == 0 {
+				break
+			}
+		}
+
+		// a match: its length is 2 + the width index, the longest ones have an additional length
+		if x, err = br.read(2); err != nil {
+			return nil, err
+		}
+		bits, todo := int(offsetBits[x]), x+2
+		if x == 3 {
+			if x, err = br.read(1); err != nil {
+				return nil, err
+			}
+			if x == 0 {
+				bits = 7
+			}
+		}
+		offset, err := br.read(bits)
+		if err != nil {
+			return nil, err
+		}
+		if todo == 5 {
+			for x = 7; x == 7; todo += x {
+				if x, err = br.read(3); err != nil {
+					return nil, err
+				}
+			}
+		}
+		if pos+offset >= outLen || todo > pos {
+			return nil, fmt.Errorf("match exceeds the decrunched data")
+		}
+		for ; todo > 0; todo-- {
+			pos--
+			out[pos] = out[pos+1+offset]
+		}
+	}
+	return out, nil
+}
@@ -0,0 +1,144 @@
+package mod
+
+import (
+	"encoding/binary"
+	"fmt"
+)
+
+// modHeaderLayout returns the number of instruments and the header length (up to the pattern data) of the
+// MOD file data, using the same signature check as ReadModFile
+func modHeaderLayout(data []byte) (instrCnt, hdrLen int) {
+	if len(data) >= 1084 {
+		isSig := true
+		for _, c := range data[1080:1084] {
+			if c < 32 {
+				isSig = false
+			}
+		}
+		if isSig {
+			return 31, 1084
+		}
+	}
+	return 15, 20 + 15*30 + 2 + 128
+}
+
+// RepairModule checks the header of the MOD file data for impossible values and fixes them: the song
+// length, pattern table entries referring to patterns which are not in the file, sample lengths which
+// exceed the file size, loops past the sample end and invalid volumes/finetunes. It returns the repaired
+// file data (cut to the length given by the header) and a description of every change.
+func RepairModule(data []byte) ([]byte, []string, error) {
+	instrCnt, hdrLen := modHeaderLayout(data)
+	if len(data) < hdrLen {
+		return nil, nil, fmt.Errorf("file too short for a MOD header (%d bytes, need %d)", len(data), hdrLen)
+	}
+	out := append([]byte{}, data...)
+	var changes []string
+	logf := func(format string, a ...interface{}) {
+		changes = append(changes, fmt.Sprintf(format, a...))
+	}
+	word := func(ofs int) int { return int(binary.BigEndian.Uint16(out[ofs:])) }
+	setWord := func(ofs, v int) { binary.BigEndian.PutUint16(out[ofs:], uint16(v)) }
+
+	patternSize := 64 * 4 * 4
+	if hdrLen == 1084 {
+		var sig [4]byte
+		copy(sig[:], data[1080:1084])
+		if chanCnt, flt8 := modChannelLayout(sig); !flt8 {
+			patternSize = 64 * chanCnt * 4 // FLT8 files store 4 channel patterns
+		}
+	}
+
+	songLenOfs := 20 + instrCnt*30
+	orders := out[songLenOfs+2 : songLenOfs+2+128]
+	switch songLen := int(out[songLenOfs]); {
+	case songLen == 0:
+		out[songLenOfs] = 1
+		logf("song length 0 set to 1")
+	case songLen > 128:
+		out[songLenOfs] = 128
+		logf("song length %d set to 128", songLen)
+	}
+
+	// all 128 pattern table entries count for the number of patterns stored (not only the played ones)
+	patternCnt := 0
+	for _, patt := range orders {
+		if int(patt)+1 > patternCnt {
+			patternCnt = int(patt) + 1
+		}
+	}
+	// the patterns are stored between the header and the samples
+	samplesLen := 0
+	for i := 0; i < instrCnt; i++ {
+		samplesLen += word(20+i*30+22) * 2
+	}
+	avail := (len(out) - hdrLen - samplesLen) / patternSize
+	if avail < 0 {
+		avail = 0
+	}
+	if patternCnt > avail {
+		for i, patt := range orders {
+			if int(patt) >= avail && patt > 0 { // an empty pattern 0 is added if there is none
+				logf("pattern table entry %d: pattern %d is not in the file, set to 0", i, patt)
+				orders[i] = 0
+			}
+		}
+		patternCnt = avail
+		if patternCnt == 0 {
+			patternCnt = 1
+			out = append(out[:hdrLen:hdrLen], append(make([]byte, patternSize), out[hdrLen:]...)...)
+			logf("added an empty pattern 0")
+		}
+	}
+
+	// the sample data follows the patterns; a sample which doesn't fit into the file gets the space left
+	// before the following samples (if their lengths are plausible), otherwise is cut at the end of the file
+	sampleOfs := hdrLen + patternCnt*patternSize
+	for i := 0; i < instrCnt; i++ {
+		sh := 20 + i*30
+		length, vol, repStart, repLen := word(sh+22)*2, int(out[sh+25]), word(sh+26)*2, word(sh+28)*2
+		if sampleOfs+length > len(out) {
+			following := 0
+			for j := i + 1; j < instrCnt; j++ {
+				following += word(20+j*30+22) * 2
+			}
+			newLen := (len(out) - sampleOfs - following) &^ 1
+			if newLen < 0 {
+				newLen = (len(out) - sampleOfs) &^ 1
+			}
+			if newLen < 0 {
+				newLen = 0
+			}
+			logf("sample %d: length %d exceeds the file, set to %d", i+1, length, newLen)
+			length = newLen
+			setWord(sh+22, length/2)
+		}
+		if out[sh+24]&0xF0 != 0 {
+			logf("sample %d: invalid finetune byte %#02x, upper nibble cleared", i+1, out[sh+24])
+			out[sh+24] &= 0x0F
+		}
+		if vol > 64 {
+			logf("sample %d: volume %d set to 64", i+1, vol)
+			out[sh+25] = 64
+		}
+		switch {
+		case length == 0:
+			// empty slots, which trackers store with any loop
+		case repLen > 2 && repStart >= length:
+			logf("sample %d: loop start %d is past the sample end (%d), loop removed", i+1, repStart, length)
+			setWord(sh+26, 0)
+			setWord(sh+28, 1)
+		case repLen > 2 && repStart+repLen > length:
+			logf("sample %d: loop end %d is past the sample end (%d), loop shortened", i+1, repStart+repLen, length)
+			setWord(sh+28, (length-repStart)/2)
+		case repLen == 0:
+			logf("sample %d: loop length 0 set to 1", i+1)
+			setWord(sh+28, 1)
+		}
+		sampleOfs += length
+	}
+	if sampleOfs < len(out) {
+		logf("removed %d bytes of trailing data after the samples (%s)", len(out)-sampleOfs, guessDataType(out[sampleOfs:]))
+		out = out[:sampleOfs]
+	}
+	return out, changes, nil
+}
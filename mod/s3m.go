@@ -0,0 +1,416 @@
+package mod
+
+import (
+	"encoding/binary"
+	"fmt"
+	"log/slog"
+	"math"
+	"strings"
+)
+
+// The S3M (Scream Tracker 3) format is converted into the MOD model like the XM format: the notes are
+// converted into Amiga periods (including the C4 speed of the sample), and the effects are mapped onto
+// the corresponding MOD/XM effects. In the pattern cells, notes and volumes use the XM encoding.
+
+const s3mSignature = "SCRM"
+
+func isS3M(data []byte) bool {
+	return len(data) >= 48 && string(data[44:48]) == s3mSignature && data[29] == 16
+}
+
+// ReadS3MData loads the S3M file data (read from the file fn, which is only used as the module's FileName)
+func ReadS3MData(fn string, data []byte) (mod Module, err error) {
+	return readS3M(fn, memSource(data), nil)
+}
+
+// readS3M loads the S3M module from src; the samples are streamed through the cache (if it is not nil)
+func readS3M(fn string, src *source, cache *SampleCache) (mod Module, err error) {
+	if !isS3M(src.data) {
+		return mod, fmt.Errorf("not an S3M file")
+	}
+	const headerLen = 96
+	if src.size < headerLen {
+		return mod, fmt.Errorf("file too short for an S3M header (%d bytes, need at least %d)", src.size, headerLen)
+	}
+	le16 := func(ofs int) int { return int(binary.LittleEndian.Uint16(src.bytes(ofs, 2))) }
+
+	mod.FileName = fn
+	mod.Format = FormatS3M
+	mod.samples = cache
+	mod.Name = strings.Trim(string(src.bytes(0, 28)), " \t\n\v\f\r\x00")
+	ordCnt, insCnt, pattCnt := le16(32), le16(34), le16(36)
+	switch {
+	case ordCnt == 0 || ordCnt > 256:
+		return mod, fmt.Errorf("invalid song length %d", ordCnt)
+	case insCnt > 99:
+		return mod, fmt.Errorf("invalid number of instruments %d", insCnt)
+	case pattCnt > 256:
+		return mod, fmt.Errorf("invalid number of patterns %d", pattCnt)
+	case headerLen+ordCnt+2*insCnt+2*pattCnt > src.size:
+		return mod, fmt.Errorf("truncated pattern order table")
+	}
+	// the header with the order table, the pointers and the channel pannings (if the file has them)
+	hdrLen := headerLen + ordCnt + 2*insCnt + 2*pattCnt + 32
+	if hdrLen > src.size {
+		hdrLen = src.size
+	}
+	data := src.prefix(hdrLen)
+	unsigned := le16(42) != 1
+	mod.InitialGlobalVol = int(data[48])
+	if mod.InitialGlobalVol == 0 || mod.InitialGlobalVol > 64 {
+		mod.InitialGlobalVol = 64
+	}
+	if speed := int(data[49]); speed > 0 && speed < 255 {
+		mod.InitialTempo = speed
+	}
+	if bpm := int(data[50]); bpm >= 33 {
+		mod.InitialBPM = bpm
+	}
+
+	// Channels: only the enabled sample channels are played (Adlib channels are skipped)
+	chanMap := make([]int, 32)
+	for i := range chanMap {
+		chanMap[i] = -1
+		if setting := data[64+i]; setting < 16 {
+			chanMap[i] = len(mod.ChannelPan)
+			pan := 3 // left
+			if setting >= 8 {
+				pan = 12 // right
+			}
+			if data[51]&0x80 == 0 {
+				pan = 8 // mono
+			}
+			mod.ChannelPan = append(mod.ChannelPan, pan*17)
+		}
+	}
+	if len(mod.ChannelPan) == 0 {
+		return mod, fmt.Errorf("invalid number of channels 0")
+	}
+
+	// Orders: 254 is a marker (skipped), 255 the end of the song
+	for _, o := range data[headerLen : headerLen+ordCnt] {
+		if o == 255 {
+			break
+		}
+		if o != 254 {
+			mod.PatternTable = append(mod.PatternTable, int(o))
+		}
+	}
+	if len(mod.PatternTable) == 0 {
+		return mod, fmt.Errorf("invalid song length 0")
+	}
+	insPtrs := headerLen + ordCnt
+	pattPtrs := insPtrs + 2*insCnt
+
+	// the default panning of the channels (if the file has it)
+	if panOfs := pattPtrs + 2*pattCnt; data[53] == 252 && panOfs+32 <= src.size {
+		for i, ch := range chanMap {
+			if p := data[panOfs+i]; ch >= 0 && p&0x20 != 0 && data[51]&0x80 != 0 {
+				mod.ChannelPan[ch] = int(p&0x0F) * 17
+			}
+		}
+	}
+
+	// Instruments
+	mod.Instruments = make([]Instrument, insCnt+1)
+	mod.Instruments[0] = Instrument{Num: 0, Name: "NOP"}
+	mod.Instruments[0].SetFinetune(0)
+	c4Speeds := make([]int, insCnt+1)
+	for i := 1; i <= insCnt; i++ {
+		ins := &mod.Instruments[i]
+		ins.Num = i
+		ins.SetFinetune(0) // the finetune is part of the converted periods
+		ofs := le16(insPtrs+2*(i-1)) * 16
+		if ofs+80 > src.size {
+			return mod, fmt.Errorf("truncated header of instrument %d", i)
+		}
+		h := src.bytes(ofs, 80)
+		ins.Name = strings.Trim(string(h[48:76]), " \t\n\v\f\r\x00")
+		if h[0] != 1 {
+			if h[0] > 1 {
+				mod.Warnf("instrument %d: Adlib instruments are not supported", i)
+			}
+			continue
+		}
+		length, loopStart, loopEnd := binary.LittleEndian.Uint32(h[16:]), binary.LittleEndian.Uint32(h[20:]), binary.LittleEndian.Uint32(h[24:])
+		flags := h[31]
+		ins.Volume = int(h[28])
+		if ins.Volume > 64 {
+			ins.Volume = 64
+		}
+		c4Speeds[i] = int(binary.LittleEndian.Uint32(h[32:]))
+		if h[30] != 0 {
+			mod.Warnf("instrument %d: packed samples are not supported", i)
+			continue
+		}
+
+		// the sample data (16-bit samples are reduced to 8 bits, of stereo samples only the left channel is played)
+		bytesPerSample := 1
+		if flags&0x04 != 0 {
+			bytesPerSample = 2
+		}
+		sampleOfs := (int(h[13])<<16 | int(binary.LittleEndian.Uint16(h[14:]))) * 16
+		if length > 1<<24 || sampleOfs+int(length)*bytesPerSample > src.size {
+			return mod, fmt.Errorf("sample data of instrument %d shorter than declared", i)
+		}
+		ins.Len = int(length)
+		if cache != nil {
+			cache.stream(ins, src, sampleOfs, &sampleStream{length: ins.Len, is16Bit: bytesPerSample == 2, unsigned: unsigned})
+		} else {
+			ins.Sample = decodeS3MSample(src.bytes(sampleOfs, ins.Len*bytesPerSample), bytesPerSample == 2, unsigned)
+		}
+		if flags&0x01 != 0 && loopEnd > loopStart && loopEnd <= length {
+			ins.RepStart, ins.RepLen = int(loopStart), int(loopEnd-loopStart)
+			if ins.RepStart+ins.RepLen < ins.Len {
+				ins.Len = ins.RepStart + ins.RepLen // the player loops at the end of the sample
+				if ins.Sample != nil {
+					ins.Sample = ins.Sample[:ins.Len]
+				}
+			}
+		}
+		ins.checkLoop(&mod)
+	}
+	mod.InstrTableLen = insCnt
+
+	// Patterns
+	cells := make([][][]patternCell, pattCnt)
+	for i := range cells {
+		ofs := le16(pattPtrs+2*i) * 16
+		if ofs == 0 {
+			cells[i] = make([][]patternCell, 64)
+			for r := range cells[i] {
+				cells[i][r] = make([]patternCell, len(mod.ChannelPan))
+			}
+			continue
+		}
+		if ofs+2 > src.size {
+			return mod, fmt.Errorf("truncated data of pattern %d", i)
+		}
+		end := ofs + 2 + le16(ofs) // some trackers include the length word in the length, others don't
+		if end > src.size {
+			end = src.size
+		}
+		if cells[i], err = unpackS3MPattern(src.bytes(ofs+2, end-ofs-2), chanMap, len(mod.ChannelPan)); err != nil {
+			return mod, fmt.Errorf("pattern %d: %v", i, err)
+		}
+	}
+	cells = mod.addEmptyPattern(cells, len(mod.ChannelPan))
+	mod.convertPatterns(cells, func(cell patternCell, ins int) Note { return mod.convertS3MNote(cell, ins, c4Speeds) })
+
+	logEvent(slog.LevelInfo, "module loaded", "file", fn, "name", mod.Name, "format", mod.Format,
+		"instruments", mod.InstrTableLen, "patterns", mod.PatternCnt)
+	return
+}
+
+// unpackS3MPattern decodes the packed pattern data: every note starts with a byte giving the channel
+// (lower bits) and the fields stored (upper bits), a zero byte ends a row. The channels are mapped
+// to the played channels with chanMap, notes of other channels are skipped.
+func unpackS3MPattern(pd []byte, chanMap []int, chanCnt int) ([][]patternCell, error) {
+	cells := make([][]patternCell, 64)
+	i := 0
+	for r := range cells {
+		cells[r] = make([]patternCell, chanCnt)
+		for i < len(pd) {
+			what := pd[i]
+			i++
+			if what == 0 {
+				break
+			}
+			var cell patternCell
+			if what&0x20 != 0 {
+				if i+2 > len(pd) {
+					return nil, fmt.Errorf("truncated data in row %d", r)
+				}
+				switch note := pd[i]; {
+				case note == 254: // note cut
+					cell.note = 97
+				case note < 254 && note>>4 < 8 && note&0x0F < 12:
+					cell.note = (note>>4)*12 + note&0x0F + 1
+				}
+				cell.ins = pd[i+1]
+				i += 2
+			}
+			if what&0x40 != 0 {
+				if i >= len(pd) {
+					return nil, fmt.Errorf("truncated data in row %d", r)
+				}
+				if v := pd[i]; v <= 64 {
+					cell.vol = v + 0x10
+				}
+				i++
+			}
+			if what&0x80 != 0 {
+				if i+2 > len(pd) {
+					return nil, fmt.Errorf("truncated data in row %d", r)
+				}
+				cell.eff, cell.par = pd[i], pd[i+1]
+				i += 2
+			}
+			if ch := chanMap[what&0x1F]; ch >= 0 {
+				cells[r][ch] = cell
+			}
+		}
+	}
+	return cells, nil
+}
+
+// decodeS3MSample converts the sample data into signed 8-bit samples (signed 8-bit data isn't copied)
+func decodeS3MSample(raw []byte, is16Bit, unsigned bool) []int8 {
+	if is16Bit {
+		s := make([]int8, len(raw)/2)
+		for i := range s {
+			v := binary.LittleEndian.Uint16(raw[i*2:])
+			if unsigned {
+				v ^= 0x8000
+			}
+			s[i] = int8(v >> 8)
+		}
+		return s
+	}
+	if !unsigned {
+		return int8Slice(raw) // used as it is
+	}
+	s := make([]int8, len(raw))
+	for i, v := range raw {
+		s[i] = int8(v ^ 0x80)
+	}
+	return s
+}
+
+// s3mPeriod converts a note (0 = C-0, 48 = C-4, which plays a sample at its C4 speed) into an Amiga period
+func s3mPeriod(note, c4Speed int) int {
+	if c4Speed <= 0 {
+		c4Speed = 8363
+	}
+	freq := float64(c4Speed) * math.Pow(2, float64(note-48)/12)
+	return int(math.Round(3546894.6 / freq))
+}
+
+// convertS3MNote converts a note of an S3M pattern, playing the instrument ins
+func (m *Module) convertS3MNote(cell patternCell, ins int, c4Speeds []int) (n Note) {
+	n.InsNum = int(cell.ins)
+	n.Ins = &m.Instruments[0]
+	if n.InsNum > m.InstrTableLen {
+		m.Warnf("note references instrument %d, but the module only has %d instruments", n.InsNum, m.InstrTableLen)
+		n.InsNum = 0
+	} else if n.InsNum > 0 && m.Instruments[n.InsNum].Len > 0 {
+		n.Ins = &m.Instruments[n.InsNum]
+	}
+	switch {
+	case cell.note == 97:
+		n.KeyOff = true // S3M instruments have no envelope, so a release cuts the note
+	case cell.note > 0 && ins <= m.InstrTableLen:
+		n.Period = s3mPeriod(int(cell.note)-1, c4Speeds[ins])
+	}
+	if cell.vol >= 0x10 {
+		n.Vol = int(cell.vol) - 0x10 + 1
+	}
+
+	var ok bool
+	if n.Effect, ok = s3mEffect(cell.eff, cell.par); !ok {
+		m.Warnf("effect %c%02X is not supported", 'A'+cell.eff-1, cell.par)
+	}
+	return
+}
+
+// s3mEffect converts an effect of the S3M format (the commands A-Z are numbered 1-26); the effect code
+// is the one of the corresponding MOD effect, or the letter number and the parameter
+func s3mEffect(cmd, par byte) (Effect, bool) {
+	x, y := uint16(par>>4), uint16(par&0x0F)
+	p := uint16(par)
+	switch cmd {
+	case 0:
+		return Effect{}, true
+	case 'A' - '@': // set speed (speeds above 31 are played as 31)
+		if par > 0x1F {
+			par, p = 0x1F, 0x1F
+		}
+		if par == 0 {
+			return Effect{}, true
+		}
+		return Effect{SetSpeed, 0xF00 | p}, true
+	case 'B' - '@':
+		return Effect{PositionJump, 0xB00 | p}, true
+	case 'C' - '@':
+		return Effect{PatternBreak, 0xD00 | p}, true
+	case 'D' - '@': // volume slide (DxF/DFy: fine slides)
+		switch {
+		case y == 0xF && x > 0:
+			return Effect{FineVolSlideUp, 0xEA0 | x}, true
+		case x == 0xF && y > 0:
+			return Effect{FineVolSlideDown, 0xEB0 | y}, true
+		}
+		return Effect{VolSlide, 0xA00 | p}, true
+	case 'E' - '@', 'F' - '@': // pitch slides (xFy: fine, xEy: extra fine)
+		down := cmd == 'E'-'@'
+		switch {
+		case x == 0xF && down:
+			return Effect{FineSlideDown, 0xE20 | y}, true
+		case x == 0xF:
+			return Effect{FineSlideUp, 0xE10 | y}, true
+		case x == 0xE && down:
+			return Effect{ExtraFineSlideDown, uint16('X'-'A'+10)<<8 | 0x20 | y}, true
+		case x == 0xE:
+			return Effect{ExtraFineSlideUp, uint16('X'-'A'+10)<<8 | 0x10 | y}, true
+		case down:
+			return Effect{SlideDown, 0x200 | p}, true
+		}
+		return Effect{SlideUp, 0x100 | p}, true
+	case 'G' - '@':
+		return Effect{Portamento, 0x300 | p}, true
+	case 'H' - '@':
+		return Effect{Vibrato, 0x400 | p}, true
+	case 'I' - '@':
+		return Effect{Tremor, uint16('T'-'A'+10)<<8 | p}, true
+	case 'J' - '@':
+		return Effect{Arpeggio, p}, true
+	case 'K' - '@':
+		return Effect{VibratoVolSlide, 0x600 | p}, true
+	case 'L' - '@':
+		return Effect{PortamentoVolSlide, 0x500 | p}, true
+	case 'O' - '@':
+		return Effect{SetSampleOffset, 0x900 | p}, true
+	case 'Q' - '@':
+		return Effect{MultiRetrig, uint16('R'-'A'+10)<<8 | p}, true
+	case 'R' - '@':
+		return Effect{Tremolo, 0x700 | p}, true
+	case 'S' - '@':
+		switch x {
+		case 0x0:
+			return Effect{SetFilter, 0xE00 | y}, true
+		case 0x1:
+			return Effect{GlissandoControl, 0xE30 | y}, true
+		case 0x2:
+			return Effect{SetFinetune, 0xE50 | y}, true
+		case 0x3:
+			return Effect{SetVibratoWaveform, 0xE40 | y}, true
+		case 0x4:
+			return Effect{SetTremoloWaveform, 0xE70 | y}, true
+		case 0x8:
+			return Effect{SetPanning, 0x800 | y*17}, true
+		case 0xB:
+			return Effect{PatternLoop, 0xE60 | y}, true
+		case 0xC:
+			return Effect{NoteCut, 0xEC0 | y}, true
+		case 0xD:
+			return Effect{NoteDelay, 0xED0 | y}, true
+		case 0xE:
+			return Effect{PatternDelay, 0xEE0 | y}, true
+		}
+	case 'T' - '@': // set tempo (BPM)
+		if par >= 0x20 {
+			return Effect{SetSpeed, 0xF00 | p}, true
+		}
+	case 'U' - '@': // fine vibrato, played with a quarter of the depth (rounded up)
+		return Effect{Vibrato, 0x400 | x<<4 | (y+3)/4}, true
+	case 'V' - '@':
+		return Effect{SetGlobalVolume, uint16('G'-'A'+10)<<8 | p}, true
+	case 'W' - '@':
+		return Effect{GlobalVolSlide, uint16('H'-'A'+10)<<8 | p}, true
+	case 'X' - '@': // set panning (00-80)
+		if par <= 0x80 {
+			return Effect{SetPanning, 0x800 | p*255/128}, true
+		}
+	}
+	return Effect{}, false
+}
@@ -0,0 +1,354 @@
+package mod
+
+import (
+	"container/list"
+	"encoding/binary"
+	"io"
+	"os"
+	"sync"
+)
+
+// sampleChunkSize is the number of samples in the blocks in which sample data is loaded by a SampleCache
+// (compressed IT samples are loaded in their blocks of itBlockLen samples)
+const sampleChunkSize = 16 * 1024
+
+// itBlockLen is the number of samples in a block of a compressed IT sample
+const itBlockLen = 0x8000
+
+// SampleCache streams sample data from the module file on demand instead of keeping all samples in
+// memory. The samples are loaded (and decoded) in blocks, of which at most MaxBytes are cached (least
+// recently used blocks are dropped first).
+type SampleCache struct {
+	MaxBytes int
+
+	r      io.ReaderAt
+	closer io.Closer
+	mu     sync.Mutex
+	lru    *list.List                 // of *sampleChunk, most recently used first
+	chunks map[chunkKey]*list.Element // by sample and block
+	cached int                        // the size of the cached blocks
+	err    error
+}
+
+// chunkKey identifies a block of samples: by the file offset of the sample data and the index of the
+// block in the sample
+type chunkKey struct {
+	offset, idx int
+}
+
+type sampleChunk struct {
+	key  chunkKey
+	data []int8
+}
+
+// sampleStream is how the samples of an Instrument are stored in the file, for decoding them block
+// by block
+type sampleStream struct {
+	length   int     // the number of samples in the file (the Instrument may play less)
+	is16Bit  bool    // 16-bit samples (reduced to 8 bits)
+	unsigned bool    // unsigned samples (S3M, IT)
+	delta    bool    // delta encoded samples (XM)
+	deltas   []int16 // delta encoded samples: the value before each block
+	blocks   []int   // compressed samples (IT): the file offsets of the blocks and of their end
+	it215    bool    // compressed samples in the IT 2.15 format
+}
+
+// NewSampleCache creates a SampleCache reading from r (the original module data)
+func NewSampleCache(r io.ReaderAt, maxBytes int) *SampleCache {
+	if maxBytes < sampleChunkSize {
+		maxBytes = sampleChunkSize
+	}
+	c := &SampleCache{MaxBytes: maxBytes, r: r, lru: list.New(), chunks: map[chunkKey]*list.Element{}}
+	if cl, ok := r.(io.Closer); ok {
+		c.closer = cl
+	}
+	return c
+}
+
+// at returns the sample at position pos of the instrument, loading (and caching) its block if necessary
+func (c *SampleCache) at(ins *Instrument, pos int) int8 {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	s := ins.stream
+	blockLen := s.blockLen()
+	key := chunkKey{ins.Offset, pos / blockLen}
+	e, ok := c.chunks[key]
+	if ok {
+		c.lru.MoveToFront(e)
+	} else {
+		for c.lru.Len() > 0 && c.cached+blockLen > c.MaxBytes {
+			old := c.lru.Remove(c.lru.Back()).(*sampleChunk)
+			delete(c.chunks, old.key)
+			c.cached -= len(old.data)
+		}
+		data, err := s.decode(c.r, ins.Offset, key.idx)
+		if err != nil && c.err == nil {
+			c.err = err
+		}
+		e = c.lru.PushFront(&sampleChunk{key: key, data: data})
+		c.chunks[key] = e
+		c.cached += len(data)
+	}
+	data := e.Value.(*sampleChunk).data
+	if pos%blockLen >= len(data) {
+		return 0
+	}
+	return data[pos%blockLen]
+}
+
+// blockLen returns the number of samples in the blocks in which the samples are loaded
+func (s *sampleStream) blockLen() int {
+	if s.blocks != nil {
+		return itBlockLen
+	}
+	return sampleChunkSize
+}
+
+// decode reads the block idx of the samples stored at ofs in r and decodes it
+func (s *sampleStream) decode(r io.ReaderAt, ofs, idx int) ([]int8, error) {
+	first := idx * s.blockLen()
+	n := s.length - first
+	if n > s.blockLen() {
+		n = s.blockLen()
+	}
+	if n <= 0 {
+		return nil, nil
+	}
+	if s.blocks != nil {
+		raw := make([]byte, s.blocks[idx+1]-s.blocks[idx])
+		if _, err := readAt(r, raw, s.blocks[idx]); err != nil {
+			return nil, err
+		}
+		return decompressITSample(raw, n, s.is16Bit, s.it215)
+	}
+	width := 1
+	if s.is16Bit {
+		width = 2
+	}
+	raw := make([]byte, n*width)
+	read, err := readAt(r, raw, ofs+first*width)
+	raw = raw[:read/width*width]
+	if !s.delta {
+		return decodeS3MSample(raw, s.is16Bit, s.unsigned), err
+	}
+	samples := make([]int8, len(raw)/width)
+	v := s.deltas[idx]
+	for i := range samples {
+		if s.is16Bit {
+			v += int16(binary.LittleEndian.Uint16(raw[i*2:]))
+			samples[i] = int8(v >> 8)
+		} else {
+			v = int16(int8(v) + int8(raw[i]))
+			samples[i] = int8(v)
+		}
+	}
+	return samples, err
+}
+
+// readAt reads len(b) bytes at offset ofs; reaching the end of the data is an error
+func readAt(r io.ReaderAt, b []byte, ofs int) (int, error) {
+	n, err := r.ReadAt(b, int64(ofs))
+	if n == len(b) {
+		return n, nil
+	}
+	if err == nil || err == io.EOF {
+		err = io.ErrUnexpectedEOF
+	}
+	return n, err
+}
+
+// stream sets up the instrument for streaming its samples (stored at ofs) through the cache. The values
+// before the blocks of delta encoded samples are computed here, reading the sample data once.
+func (c *SampleCache) stream(ins *Instrument, src *source, ofs int, s *sampleStream) {
+	ins.Offset, ins.samples, ins.stream = ofs, c, s
+	if !s.delta {
+		return
+	}
+	width := 1
+	if s.is16Bit {
+		width = 2
+	}
+	var v int16
+	for first := 0; first < s.length; first += sampleChunkSize {
+		s.deltas = append(s.deltas, v)
+		n := s.length - first
+		if n > sampleChunkSize {
+			n = sampleChunkSize
+		}
+		raw := src.bytes(ofs+first*width, n*width)
+		for i := 0; i < n; i++ {
+			if s.is16Bit {
+				v += int16(binary.LittleEndian.Uint16(raw[i*2:]))
+			} else {
+				v = int16(int8(v) + int8(raw[i]))
+			}
+		}
+	}
+}
+
+// Cached returns the number of bytes currently held in memory
+func (c *SampleCache) Cached() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.cached
+}
+
+// Err returns the first read error (reading errors during playback result in silence)
+func (c *SampleCache) Err() error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.err
+}
+
+// Close closes the underlying file (if any)
+func (c *SampleCache) Close() error {
+	if c.closer == nil {
+		return nil
+	}
+	return c.closer.Close()
+}
+
+// ############################################################################
+
+// streamHeadLen is the number of bytes read from the start of a module file for detecting its format
+// (and usually holding its headers) when the samples are streamed
+const streamHeadLen = 64 * 1024
+
+// source is the data of a module file for the loaders: all of it in memory, or the start of an open
+// file, from which the other parts (headers and patterns, but not the samples) are read on demand
+type source struct {
+	data []byte      // the file data (the start of the file, if r is not nil)
+	r    io.ReaderAt // the file (nil: everything is in data)
+	size int         // the size of the file
+	err  error       // the first read error
+}
+
+// memSource returns the source for module data in memory
+func memSource(data []byte) *source {
+	return &source{data: data, size: len(data)}
+}
+
+// openSource opens the module file fn and reads its start
+func openSource(fn string) (src *source, f *os.File, err error) {
+	if f, err = os.Open(fn); err != nil {
+		return
+	}
+	fi, err := f.Stat()
+	if err != nil {
+		f.Close()
+		return
+	}
+	src = &source{r: f, size: int(fi.Size())}
+	n := src.size
+	if n > streamHeadLen {
+		n = streamHeadLen
+	}
+	src.data = make([]byte, n)
+	if _, err = readAt(f, src.data, 0); err != nil {
+		f.Close()
+	}
+	return
+}
+
+// bytes returns the n bytes at offset ofs, which the callers have checked to be in the file. The data in
+// memory is not copied; if reading the file fails, the bytes are 0 and the error is kept in src.err.
+func (src *source) bytes(ofs, n int) []byte {
+	if src.r == nil || ofs+n <= len(src.data) {
+		return src.data[ofs : ofs+n]
+	}
+	b := make([]byte, n)
+	if _, err := readAt(src.r, b, ofs); err != nil && src.err == nil {
+		src.err = err
+	}
+	return b
+}
+
+// prefix returns the first n bytes of the file (reading them into memory if necessary)
+func (src *source) prefix(n int) []byte {
+	if n > len(src.data) {
+		src.data = append(src.data, src.bytes(len(src.data), n-len(src.data))...)
+	}
+	return src.data[:n]
+}
+
+// packed returns true if the module is packed, crunched or archived, so it has to be unpacked in memory
+func (src *source) packed() bool {
+	_, unic := unicLayout(src.data, src.size)
+	_, ok := FindUnpacker(src.data)
+	return ok || unic || isZIP(src.data) || isGzip(src.data)
+}
+
+// ReadModFileStreamed reads the MOD file given by fn like ReadModFile, but does not load the samples:
+// they are streamed from the (open) file while playing, with at most maxBytes of sample data in memory.
+// Only the header and the patterns are read while loading. Packed modules are converted in memory, so
+// their samples are loaded as usual. The module has to be closed after use.
+func ReadModFileStreamed(fn string, maxBytes int) (mod Module, err error) {
+	return loadStreamed(fn, maxBytes, func(src *source, cache *SampleCache) (Module, error) {
+		return readModDataCached(fn, src, cache)
+	})
+}
+
+// LoadFileStreamed reads the module file fn in any of the supported formats like LoadFile, but streams
+// the samples like ReadModFileStreamed. For XM modules, the sample data is read once while loading (it
+// is delta encoded, so the value at the start of each block is needed). Packed, crunched and archived
+// modules are unpacked in memory, so their samples are loaded as usual. The module has to be closed after
+// use.
+func LoadFileStreamed(fn string, maxBytes int) (mod Module, err error) {
+	return loadStreamed(fn, maxBytes, func(src *source, cache *SampleCache) (Module, error) {
+		switch DetectFormat(src.data) {
+		case FormatXM:
+			return readXM(fn, src, cache)
+		case FormatS3M:
+			return readS3M(fn, src, cache)
+		case FormatIT:
+			return readIT(fn, src, cache)
+		}
+		return readModDataCached(fn, src, cache)
+	})
+}
+
+// loadStreamed opens the module file fn and loads it with load, which sets up the samples for streaming
+// through the cache; packed modules are loaded in memory (with LoadData)
+func loadStreamed(fn string, maxBytes int, load func(src *source, cache *SampleCache) (Module, error)) (mod Module, err error) {
+	src, f, err := openSource(fn)
+	if err != nil {
+		return
+	}
+	if src.packed() {
+		data := src.prefix(src.size)
+		f.Close()
+		if src.err != nil {
+			return mod, src.err
+		}
+		return LoadData(fn, data)
+	}
+	mod, err = load(src, NewSampleCache(f, maxBytes))
+	if err == nil {
+		err = src.err
+	}
+	if err != nil || mod.samples == nil {
+		f.Close()
+	}
+	return
+}
+
+// Close releases the resources of a module with streamed samples
+func (m *Module) Close() error {
+	if m.samples == nil {
+		return nil
+	}
+	return m.samples.Close()
+}
+
+// HasSample returns true if the instrument has sample data (loaded or streamed)
+func (i *Instrument) HasSample() bool {
+	return i.Sample != nil || (i.samples != nil && i.Len > 0)
+}
+
+// At returns the sample value at position pos
+func (i *Instrument) At(pos int) int8 {
+	if i.Sample != nil {
+		return i.Sample[pos]
+	}
+	return i.samples.at(i, pos)
+}
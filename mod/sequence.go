@@ -0,0 +1,189 @@
+package mod
+
+import (
+	"errors"
+	"fmt"
+	"time"
+)
+
+// SongLine is a line played during a walk through the song
+type SongLine struct {
+	Order, Pattern, Line int
+	Tempo                int // ticks per line
+	BPM                  int
+	Tick                 int // number of ticks played before this line (since the start of the walk)
+	DelayLines           int // number of times the line is repeated because of a pattern delay (EEx)
+}
+
+// Ticks returns the number of ticks the line takes to play (including repetitions due to pattern delays)
+func (sl SongLine) Ticks() int {
+	return sl.Tempo * (1 + sl.DelayLines)
+}
+
+// WalkSong follows the play flow of the song starting at the given order - pattern table, position jumps,
+// pattern breaks, pattern loops and delays, and speed changes - without rendering any audio. It calls fn
+// for each line played until the song ends, loops (returning to a line in the same state) or fn returns
+// false. It returns true if the walk ended because the song looped. Soundtracker modules are walked with
+// their effects and timing (see IsSoundtracker).
+func (m Module) WalkSong(start int, fn func(SongLine) bool) bool {
+	st := m.IsSoundtracker()
+	loopLine := make([]int, m.ChannelCount())
+	loopCnt := make([]int, m.ChannelCount())
+	visited := map[string]bool{}
+
+	sl := SongLine{Order: start, Tempo: 6, BPM: 125}
+	if m.InitialTempo > 0 {
+		sl.Tempo = m.InitialTempo
+	}
+	if m.InitialBPM >= 32 {
+		sl.BPM = m.InitialBPM
+	}
+	for sl.Order >= 0 && sl.Order < len(m.PatternTable) {
+		key := fmt.Sprint(sl.Order, sl.Line, sl.Tempo, sl.BPM, loopCnt)
+		if visited[key] {
+			return true
+		}
+		visited[key] = true
+
+		sl.Pattern = m.PatternTable[sl.Order]
+		sl.DelayLines = 0
+		var jump *SongLine
+		loopTo := -1
+		for ch, note := range m.Patterns[sl.Pattern][sl.Line] {
+			if st && !SoundtrackerEffects[note.EffType] {
+				continue
+			}
+			switch note.EffType {
+			case PositionJump, PatternBreak:
+				if jump == nil {
+					jump = &SongLine{Order: sl.Order + 1}
+				}
+				if note.EffType == PositionJump {
+					jump.Order = note.Par()
+				} else if newLine := note.ParX()*10 + note.ParY(); newLine < 64 { // BCD
+					jump.Line = newLine
+				}
+				if jump.Order >= len(m.PatternTable) {
+					jump.Order = 0
+				}
+			case PatternLoop:
+				if note.ParY() == 0 {
+					loopLine[ch] = sl.Line
+				} else {
+					if loopCnt[ch] == 0 {
+						loopCnt[ch] = note.ParY()
+					} else {
+						loopCnt[ch]--
+					}
+					if loopCnt[ch] > 0 {
+						loopTo = loopLine[ch]
+					}
+				}
+			case PatternDelay:
+				sl.DelayLines = note.ParY()
+			case SetSpeed:
+				if note.Par() == 0 {
+					continue
+				}
+				if note.Par() <= 0x1F || st {
+					sl.Tempo = note.Par()
+				} else {
+					sl.BPM = note.Par()
+				}
+			}
+		}
+
+		if !fn(sl) {
+			return false
+		}
+		sl.Tick += sl.Ticks()
+
+		switch {
+		case jump != nil: // a jump wins over a loop on the same line
+			sl.Order, sl.Line = jump.Order, jump.Line
+		case loopTo >= 0:
+			sl.Line = loopTo
+		default:
+			sl.Line++
+		}
+		if sl.Line >= len(m.Patterns[sl.Pattern]) {
+			sl.Order, sl.Line = sl.Order+1, 0
+		}
+	}
+	return false
+}
+
+// songDuration returns the play time of the song starting at the given order (up to the end of the song
+// or until it loops), and whether the song loops
+func (m Module) songDuration(start int) (d time.Duration, looped bool) {
+	looped = m.WalkSong(start, func(sl SongLine) bool {
+		// a tick is 2.5/BPM seconds
+		d += time.Duration(sl.Ticks()) * 2500 * time.Millisecond / time.Duration(sl.BPM)
+		return true
+	})
+	return
+}
+
+// Duration returns the play time of one pass through the song (up to the end of the song or until it
+// loops) when rendered at the given sample rate. Like in the player, a tick is a whole number of samples
+// long, with the fractions carried over to the following ticks.
+func (m Module) Duration(rate int) (time.Duration, error) {
+	if rate <= 0 {
+		return 0, fmt.Errorf("invalid sample rate %d", rate)
+	}
+	if len(m.PatternTable) == 0 || len(m.Patterns) == 0 {
+		return 0, errors.New("empty song")
+	}
+	samples, spt, bpm := 0, 0, 0
+	var tickErr float64 // samples by which the ticks so far are shorter than their exact length
+	m.WalkSong(0, func(sl SongLine) bool {
+		// a tick is 2.5/BPM seconds
+		tickLen := float64(rate) / (.4 * float64(sl.BPM))
+		if sl.BPM != bpm {
+			spt, bpm = int(tickLen), sl.BPM // the tempo changes with the tick starting the line
+		}
+		for t := 0; t < sl.Ticks(); t++ {
+			samples += spt
+			spt = int(tickLen)
+			if tickErr += tickLen - float64(spt); tickErr >= 1 {
+				spt++
+				tickErr--
+			}
+		}
+		return true
+	})
+	return time.Duration(samples) * time.Second / time.Duration(rate), nil
+}
+
+// UnreferencedPatterns returns the patterns which are stored in the module but not in its pattern table,
+// so they are never played (hidden patterns, e.g. leftovers or secret tunes)
+func (m Module) UnreferencedPatterns() []int {
+	used := make([]bool, len(m.Patterns))
+	for _, patt := range m.PatternTable {
+		if patt >= 0 && patt < len(used) {
+			used[patt] = true
+		}
+	}
+	var unused []int
+	for patt, u := range used {
+		if !u {
+			unused = append(unused, patt)
+		}
+	}
+	return unused
+}
+
+// WithPatterns returns a copy of the module which plays the given patterns (e.g. unreferenced ones)
+// instead of its pattern table
+func (m Module) WithPatterns(patterns ...int) (Module, error) {
+	if len(patterns) == 0 {
+		return m, errors.New("no patterns given")
+	}
+	for _, patt := range patterns {
+		if patt < 0 || patt >= len(m.Patterns) {
+			return m, fmt.Errorf("pattern %d doesn't exist (the module has %d patterns)", patt, len(m.Patterns))
+		}
+	}
+	m.PatternTable = append([]int(nil), patterns...)
+	return m, nil
+}
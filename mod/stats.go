@@ -0,0 +1,79 @@
+package mod
+
+// EffectStats counts how often each effect is used in the patterns; the counts are indexed by EffectType
+// (arpeggios only count with parameters)
+type EffectStats struct {
+	Total      []int
+	PerPattern [][]int // indexed by pattern, then by effect
+	PerChannel [][]int // indexed by channel, then by effect
+}
+
+// EffectStats counts the effects of the module
+func (m Module) EffectStats() EffectStats {
+	es := EffectStats{Total: make([]int, EffectTypeCnt), PerPattern: make([][]int, len(m.Patterns)),
+		PerChannel: make([][]int, m.ChannelCount())}
+	for ch := range es.PerChannel {
+		es.PerChannel[ch] = make([]int, EffectTypeCnt)
+	}
+	for p, pattern := range m.Patterns {
+		es.PerPattern[p] = make([]int, EffectTypeCnt)
+		for _, line := range pattern {
+			for ch, note := range line {
+				if !note.hasEffect() || ch >= len(es.PerChannel) {
+					continue
+				}
+				es.Total[note.EffType]++
+				es.PerPattern[p][note.EffType]++
+				es.PerChannel[ch][note.EffType]++
+			}
+		}
+	}
+	return es
+}
+
+// InstrumentUsage counts the notes which give each instrument number in the patterns; the counts are
+// indexed by the instrument number (index 0 counts the notes without instrument number)
+type InstrumentUsage struct {
+	Total      []int
+	PerPattern [][]int // indexed by pattern, then by instrument
+	PerChannel [][]int // indexed by channel, then by instrument
+}
+
+// InstrumentUsage counts the notes of each instrument of the module. Notes without a period count too (they
+// reset the volume of the instrument); numbers of instruments which don't exist aren't counted.
+func (m Module) InstrumentUsage() InstrumentUsage {
+	insCnt := len(m.Instruments)
+	if len(m.SampleMaps) > 0 {
+		insCnt = len(m.SampleMaps) + 1 // the notes give the instruments of the sample maps
+	}
+	iu := InstrumentUsage{Total: make([]int, insCnt), PerPattern: make([][]int, len(m.Patterns)),
+		PerChannel: make([][]int, m.ChannelCount())}
+	for ch := range iu.PerChannel {
+		iu.PerChannel[ch] = make([]int, insCnt)
+	}
+	for p, pattern := range m.Patterns {
+		iu.PerPattern[p] = make([]int, insCnt)
+		for _, line := range pattern {
+			for ch, note := range line {
+				if note.InsNum < 0 || note.InsNum >= insCnt || ch >= len(iu.PerChannel) {
+					continue
+				}
+				iu.Total[note.InsNum]++
+				iu.PerPattern[p][note.InsNum]++
+				iu.PerChannel[ch][note.InsNum]++
+			}
+		}
+	}
+	return iu
+}
+
+// Unused returns the numbers of the instruments which no note uses
+func (iu InstrumentUsage) Unused() []int {
+	var unused []int
+	for ins := 1; ins < len(iu.Total); ins++ {
+		if iu.Total[ins] == 0 {
+			unused = append(unused, ins)
+		}
+	}
+	return unused
+}
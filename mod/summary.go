@@ -0,0 +1,82 @@
+package mod
+
+import (
+	"encoding/json"
+	"io"
+	"strings"
+)
+
+// InstrumentSummary describes an instrument with a sample in a Summary
+type InstrumentSummary struct {
+	Num      int    `json:"num"`
+	Name     string `json:"name"`
+	Len      int    `json:"len"` // in samples
+	RepStart int    `json:"repStart"`
+	RepLen   int    `json:"repLen"` // 0: no loop
+	Finetune int    `json:"finetune"`
+	Volume   int    `json:"volume"`
+	Notes    int    `json:"notes"` // number of notes with the instrument number (0 for modules with sample maps)
+}
+
+// Summary is the information on a module which Info prints, for tools and catalogs (e.g. as JSON)
+type Summary struct {
+	FileName     string              `json:"fileName"`
+	Name         string              `json:"name"`
+	Format       string              `json:"format"`
+	Packer       string              `json:"packer,omitempty"` // format the module has been converted from
+	Channels     int                 `json:"channels"`
+	Patterns     int                 `json:"patterns"`
+	PatternTable []int               `json:"patternTable"`
+	Unreferenced []int               `json:"unreferenced,omitempty"` // patterns which aren't in the pattern table
+	Instruments  []InstrumentSummary `json:"instruments"`
+	Effects      map[string]int      `json:"effects"`            // number of uses per effect
+	Duration     float64             `json:"duration"`           // seconds, up to the end of the song or until it loops
+	Looped       bool                `json:"looped"`             // the song loops after Duration
+	Trailing     int                 `json:"trailing,omitempty"` // bytes of data after the end of the module
+	Warnings     []string            `json:"warnings,omitempty"`
+}
+
+// Summary returns the information on the module
+func (m Module) Summary() Summary {
+	s := Summary{
+		FileName:     m.FileName,
+		Name:         strings.TrimRight(m.Name, "\x00 "),
+		Format:       m.Format.String(),
+		Packer:       m.Packer,
+		Channels:     m.ChannelCount(),
+		Patterns:     len(m.Patterns),
+		PatternTable: m.PatternTable,
+		Unreferenced: m.UnreferencedPatterns(),
+		Instruments:  []InstrumentSummary{},
+		Effects:      map[string]int{},
+		Trailing:     len(m.Trailing),
+		Warnings:     m.Warnings,
+	}
+	usage := m.InstrumentUsage()
+	for idx, ins := range m.Instruments {
+		if ins.Len == 0 {
+			continue
+		}
+		is := InstrumentSummary{Num: idx, Name: strings.TrimRight(ins.Name, "\x00 "),
+			Len: ins.Len, RepStart: ins.RepStart, RepLen: ins.RepLen, Finetune: ins.Finetune(), Volume: ins.Volume}
+		if len(m.SampleMaps) == 0 && idx < len(usage.Total) {
+			is.Notes = usage.Total[idx]
+		}
+		s.Instruments = append(s.Instruments, is)
+	}
+	for eff, cnt := range m.EffectStats().Total {
+		if cnt > 0 {
+			s.Effects[EffectType(eff).String()] = cnt
+		}
+	}
+	d, looped := m.songDuration(0)
+	s.Duration, s.Looped = d.Seconds(), looped
+	return s
+}
+
+// WriteJSON writes the summary as JSON
+func (s Summary) WriteJSON(w io.Writer) error {
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(s)
+}
@@ -0,0 +1,261 @@
+package mod
+
+import (
+	"encoding/binary"
+	"fmt"
+)
+
+// The Player 6.1 modules (with the "P61A" signature) store every pattern as 4 tracks of compressed
+// notes, which patterns can share:
+//
+//	"P61A"
+//	word        offset of the sample data (from the end of the signature)
+//	byte        number of patterns
+//	byte        number of samples (with bit 6 or 7 set, samples are packed, which isn't supported)
+//	6 bytes     per sample: length (words; negative: the data of that earlier sample is used again),
+//	            finetune (bit 7: packed), volume and loop start (words, $FFFF: no loop); samples
+//	            loop up to their end
+//	8 bytes     per pattern: the offsets of its tracks in the track data, from channel 1 to channel 4
+//	bytes       the position list: pattern numbers, ended by $FF
+//	track data  notes of 1 to 3 bytes:
+//	              $7F                      an empty note
+//	              $70 + effect, parameter  only an effect (0 to $E)
+//	              $60 + the high 4 bits of the note index, then its low 2 bits, the instrument and a
+//	                                       0 bit: a note without effect
+//	              note index * 2 with the high bit of the instrument, the low bits of the instrument
+//	              with the effect, the parameter
+//	            With bit 7 of the first byte set, a byte c follows: $00-$3F: c empty rows follow,
+//	            $40-$7F: the note is repeated on the next c-$40 rows, $80-$BF: a word follows, and
+//	            the next c&$3F+1 notes are those starting that many bytes before the end of the word.
+//	samples
+
+const p61Signature = "P61A"
+
+// p61Layout is the layout of a The Player 6.1 module
+type p61Layout struct {
+	samples    []ptSample
+	sampleOfs  []int    // offset of the data of each sample
+	tracks     [][4]int // the offsets of the tracks of each pattern in trackData, by channel
+	positions  []int
+	trackData  []byte
+	samplesLen int // the sum of the lengths of the sample data stored
+	packed     bool
+}
+
+// p61Note is a decoded note: instrument, note index, effect and parameter
+type p61Note [4]int
+
+// theplayerLayout returns the layout of a The Player 6.1 module, if data is one (it has to hold the
+// module up to its samples)
+func theplayerLayout(data []byte) (l p61Layout, ok bool) {
+	if !detectSignature(0, p61Signature)(data) || len(data) < 8 {
+		return l, false
+	}
+	h := data[len(p61Signature):]
+	samplesOfs, pattCnt, insCnt := int(binary.BigEndian.Uint16(h)), int(h[2]), int(h[3]&0x3F)
+	l.packed = h[3]&0xC0 != 0
+	ofs := 4
+	if l.packed {
+		ofs += 4 // the length of the unpacked samples
+	}
+	if pattCnt == 0 || pattCnt > 64 || insCnt == 0 || insCnt > 31 || len(h) < ofs+insCnt*6+pattCnt*8 {
+		return l, false
+	}
+	for i := 0; i < insCnt; i++ {
+		sh := h[ofs+i*6:]
+		length, repStart := int(int16(binary.BigEndian.Uint16(sh))), int(binary.BigEndian.Uint16(sh[4:]))
+		s := ptSample{len: length, finetune: int(sh[2] & 0x0F), volume: int(sh[3]), repLen: 1}
+		dataOfs := l.samplesLen
+		if length < 0 {
+			if -length > i {
+				return l, false
+			}
+			s.len, dataOfs = l.samples[-length-1].len, l.sampleOfs[-length-1]
+		} else {
+			l.samplesLen += length * 2
+		}
+		switch {
+		case s.volume > 64 || (repStart != 0xFFFF && repStart >= s.len):
+			return l, false
+		case repStart != 0xFFFF:
+			s.repStart, s.repLen = repStart, s.len-repStart
+		}
+		l.packed = l.packed || sh[2]&0x80 != 0
+		l.samples, l.sampleOfs = append(l.samples, s), append(l.sampleOfs, dataOfs)
+	}
+	ofs += insCnt * 6
+	for i := 0; i < pattCnt; i++ {
+		var tracks [4]int
+		for ch := range tracks {
+			tracks[ch] = int(binary.BigEndian.Uint16(h[ofs+i*8+ch*2:]))
+		}
+		l.tracks = append(l.tracks, tracks)
+	}
+	ofs += pattCnt * 8
+	for ; ; ofs++ {
+		if ofs >= len(h) || len(l.positions) > 128 {
+			return l, false
+		}
+		if h[ofs] == 0xFF {
+			break
+		}
+		if int(h[ofs]) >= pattCnt {
+			return l, false
+		}
+		l.positions = append(l.positions, int(h[ofs]))
+	}
+	if len(l.positions) == 0 || samplesOfs <= ofs || samplesOfs > len(h) {
+		return l, false
+	}
+	l.trackData = h[ofs+1 : samplesOfs]
+	for _, tracks := range l.tracks {
+		for _, tofs := range tracks {
+			if _, err := l.track(tofs); err != nil {
+				return l, false
+			}
+		}
+	}
+	return l, true
+}
+
+// track decodes the 64 notes of the track at ofs
+func (l *p61Layout) track(ofs int) ([]p61Note, error) {
+	notes := make([]p61Note, 0, 64)
+	for len(notes) < 64 {
+		next, err := l.notes(ofs, &notes, true)
+		if err != nil {
+			return nil, err
+		}
+		ofs = next
+	}
+	return notes[:64], nil
+}
+
+// notes decodes the note at ofs and the rows it fills with its compression byte into notes, and returns
+// the offset of the following note. The notes of a jump back are decoded at once (if jump is true:
+// there are no jumps in them).
+func (l *p61Layout) notes(ofs int, notes *[]p61Note, jump bool) (int, error) {
+	td := l.trackData
+	if ofs >= len(td) {
+		return 0, fmt.Errorf("track data ends at %d", ofs)
+	}
+	b := int(td[ofs])
+	n, size := p61Note{}, 3
+	switch {
+	case b&0x7F == 0x7F:
+		size = 1
+	case b&0x70 == 0x70:
+		size = 2
+	case b&0x70 == 0x60:
+		size = 2
+	case b&0x7F > 36*2+1:
+		return 0, fmt.Errorf("invalid note %02x at %d", b, ofs)
+	}
+	if ofs+size > len(td) {
+		return 0, fmt.Errorf("track data ends at %d", ofs)
+	}
+	switch nb := td[ofs:]; {
+	case size == 1:
+	case b&0x70 == 0x70:
+		n[2], n[3] = b&0x0F, int(nb[1])
+	case b&0x70 == 0x60:
+		n[1], n[0] = (b&0x0F)<<2|int(nb[1])>>6, int(nb[1])>>1&0x1F
+	default:
+		n[1], n[0], n[2], n[3] = b>>1&0x3F, (b&1)<<4|int(nb[1])>>4, int(nb[1]&0x0F), int(nb[2])
+	}
+	if n[0] > len(l.samples) || n[1] > 36 {
+		return 0, fmt.Errorf("invalid note at %d", ofs)
+	}
+	*notes = append(*notes, n)
+	ofs += size
+	if b&0x80 == 0 {
+		return ofs, nil
+	}
+	if ofs >= len(td) {
+		return 0, fmt.Errorf("track data ends at %d", ofs)
+	}
+	c := int(td[ofs])
+	ofs++
+	switch {
+	case c < 0x40:
+		for i := 0; i < c; i++ {
+			*notes = append(*notes, p61Note{})
+		}
+	case c < 0x80:
+		for i := 0; i < c-0x40; i++ {
+			*notes = append(*notes, n)
+		}
+	case c < 0xC0 && jump:
+		if ofs+2 > len(td) {
+			return 0, fmt.Errorf("track data ends at %d", ofs)
+		}
+		from := ofs + 2 - int(binary.BigEndian.Uint16(td[ofs:]))
+		if from < 0 {
+			return 0, fmt.Errorf("invalid jump at %d", ofs)
+		}
+		for i := 0; i <= c&0x3F; i++ {
+			var err error
+			if from, err = l.notes(from, notes, false); err != nil {
+				return 0, err
+			}
+		}
+		ofs += 2
+	default:
+		return 0, fmt.Errorf("invalid compression %02x at %d", c, ofs-1)
+	}
+	return ofs, nil
+}
+
+func detectThePlayer61(data []byte) bool {
+	_, ok := theplayerLayout(data)
+	return ok
+}
+
+// unpackThePlayer61 puts the tracks of the patterns together, converts the notes and stores the samples
+// which are used again in full
+func unpackThePlayer61(data []byte) ([]byte, error) {
+	l, ok := theplayerLayout(data)
+	switch {
+	case !ok:
+		return nil, fmt.Errorf("not a The Player 6.1 module")
+	case l.packed:
+		return nil, fmt.Errorf("The Player 6.1 module with packed samples (not supported)")
+	}
+	h := data[len(p61Signature):]
+	samplesOfs := int(binary.BigEndian.Uint16(h))
+	if len(h) < samplesOfs+l.samplesLen {
+		return nil, fmt.Errorf("The Player 6.1 module is truncated")
+	}
+	pl := ptLayout{}
+	for _, patt := range l.positions {
+		if patt >= pl.patternCnt {
+			pl.patternCnt = patt + 1
+		}
+	}
+	var rows []byte
+	for _, tracks := range l.tracks[:pl.patternCnt] {
+		var notes [4][]p61Note
+		for ch, ofs := range tracks {
+			notes[ch], _ = l.track(ofs) // checked by theplayerLayout
+		}
+		for row := 0; row < 64; row++ {
+			for ch := range notes {
+				n := notes[ch][row]
+				rows = append(rows, byte(n[0]), byte(n[1]), byte(n[2]), byte(n[3]))
+			}
+		}
+	}
+	for i, s := range l.samples {
+		ofs := samplesOfs + l.sampleOfs[i]
+		rows = append(rows, h[ofs:ofs+s.len*2]...)
+		pl.samplesLen += s.len * 2
+	}
+	return convertPatterns(rows, ptHeader(l.samples, l.positions), pl, 4, func(n []byte) (int, int, int, int, error) {
+		period, err := ptNoteIndexPeriod(int(n[1]))
+		eff, par := int(n[2]), int(n[3])
+		if eff == 0x05 || eff == 0x06 || eff == 0x0A {
+			par = signedSlide(par)
+		}
+		return int(n[0]), period, eff, par, err
+	})
+}
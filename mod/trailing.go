@@ -0,0 +1,79 @@
+package mod
+
+import (
+	"bytes"
+	"encoding/binary"
+	"unicode/utf8"
+)
+
+// dataSignatures are the magic numbers of file types typically found appended to modules
+var dataSignatures = []struct {
+	offset int
+	magic  string
+	typ    string
+}{
+	{0, "\x89PNG", "PNG image"},
+	{0, "GIF8", "GIF image"},
+	{0, "\xFF\xD8\xFF", "JPEG image"},
+	{0, "FORM", "IFF file"},
+	{0, "PK\x03\x04", "ZIP archive"},
+	{0, "\x1F\x8B", "gzip data"},
+	{0, "RIFF", "RIFF (WAV/AVI) file"},
+	{0, "PP20", "PowerPacker data"},
+	{0, "Extended Module:", "XM module"},
+	{44, "SCRM", "S3M module"},
+	{0, "IMPM", "IT module"},
+	{1080, "M.K.", "MOD module"},
+}
+
+// guessDataType guesses the type of a block of data (e.g. trailing data of a module) from magic numbers
+// and its content; it returns "binary data" if nothing else fits
+func guessDataType(data []byte) string {
+	for _, s := range dataSignatures {
+		if len(data) >= s.offset+len(s.magic) && string(data[s.offset:s.offset+len(s.magic)]) == s.magic {
+			return s.typ
+		}
+	}
+	if len(bytes.Trim(data, "\x00")) == 0 {
+		return "padding"
+	}
+	if utf8.Valid(data) && bytes.IndexFunc(data, func(r rune) bool { return r < 32 && r != '\n' && r != '\r' && r != '\t' && r != 0x1A }) < 0 {
+		return "text"
+	}
+	return "binary data"
+}
+
+// splitTrailing checks the MOD file for data appended after the end of the module (patterns and samples
+// as given in the header) and stores it in mod.Trailing; it returns the size of the module itself. As the
+// samples are read from the end of the file, trailing data would be misread as sample audio otherwise.
+func (mod *Module) splitTrailing(src *source, patternsOffset, chanCnt int, flt8 bool) int {
+	data := src.data
+	// all 128 pattern table entries count for the number of patterns stored (not only the played ones)
+	patternTableOffset := 20 + mod.InstrTableLen*30 + 2
+	patternCnt := 0
+	for _, patt := range data[patternTableOffset : patternTableOffset+128] {
+		if int(patt)+1 > patternCnt {
+			patternCnt = int(patt) + 1
+		}
+	}
+	patternSize := 64 * chanCnt * 4
+	if flt8 {
+		// the entries refer to the first of two stored 4 channel patterns
+		patternCnt, patternSize = (patternCnt+1)&^1, 64*4*4
+	}
+	end := patternsOffset + patternCnt*patternSize
+	for i := 0; i < mod.InstrTableLen; i++ {
+		end += int(binary.BigEndian.Uint16(data[20+i*30+22:])) * 2
+	}
+	if end >= src.size {
+		return src.size
+	}
+	trailing := src.bytes(end, src.size-end)
+	typ := guessDataType(trailing)
+	if typ == "binary data" && len(trailing)%patternSize == 0 {
+		// most probably patterns which are not referenced by the pattern table
+		return src.size
+	}
+	mod.Trailing, mod.TrailingType = trailing, typ
+	return end
+}
@@ -0,0 +1,218 @@
+package mod
+
+import (
+	"encoding/binary"
+	"fmt"
+)
+
+// Unpacker converts a module in a "packed" format (as found in many Amiga game and demo rips) back into
+// a standard ProTracker module, which can then be read as usual
+type Unpacker struct {
+	Name   string
+	Detect func(data []byte) bool
+	Unpack func(data []byte) ([]byte, error)
+}
+
+// Unpackers contains all supported packed formats, in the order in which they are tried: PowerPacker
+// (crunched modules), ProRunner 1, NoisePacker 2 and 3, The Player 6.1 (with the "P61A" signature and
+// without packed samples) and Unic Tracker. Other packers (e.g. Promizer) are not supported, their
+// modules aren't detected.
+var Unpackers = []Unpacker{
+	{Name: "PowerPacker", Detect: isPP20, Unpack: UnpackPP20},
+	{Name: "ProRunner 1", Detect: detectProRunner1, Unpack: unpackProRunner1},
+	{Name: "NoisePacker 2", Detect: detectNoisePacker2, Unpack: unpackNoisePacker2},
+	{Name: "NoisePacker 3", Detect: detectNoisePacker3, Unpack: unpackNoisePacker3},
+	{Name: "The Player 6.1", Detect: detectThePlayer61, Unpack: unpackThePlayer61},
+	{Name: "Unic Tracker", Detect: detectUnic, Unpack: unpackUnic},
+}
+
+// FindUnpacker returns the Unpacker for the packed format of data, if there is one
+func FindUnpacker(data []byte) (Unpacker, bool) {
+	for _, up := range Unpackers {
+		if up.Detect(data) {
+			return up, true
+		}
+	}
+	return Unpacker{}, false
+}
+
+func detectSignature(offset int, sig string) func(data []byte) bool {
+	return func(data []byte) bool {
+		return len(data) >= offset+len(sig) && string(data[offset:offset+len(sig)]) == sig
+	}
+}
+
+// ptNoteIndexPeriod converts a note index (1 = C-1 ... 36 = B-3) as used by several packers into a period
+func ptNoteIndexPeriod(idx int) (int, error) {
+	if idx == 0 {
+		return 0, nil
+	}
+	if idx > 36 {
+		return 0, fmt.Errorf("invalid note index %d", idx)
+	}
+	return periodTableData[0][12+idx-1], nil
+}
+
+// ptNote encodes a note in the ProTracker format
+func ptNote(ins, period, eff, par int) []byte {
+	return []byte{byte(ins&0xF0 | period>>8), byte(period), byte(ins<<4&0xF0 | eff&0x0F), byte(par)}
+}
+
+// ptLayout contains the layout of a module with 31 instruments and a ProTracker-like header
+// (as used by the packed formats derived from it)
+type ptLayout struct {
+	patternCnt  int // number of patterns stored
+	patternsOfs int // offset of the pattern data
+	samplesLen  int // total length of the sample data
+}
+
+// readPTLayout reads the pattern count and sample length from a ProTracker-like header; noteSize is the
+// size of a note in the pattern data and sigLen the length of the signature (0 if there is none). The
+// module has to fit into the size of the file, of which data holds at least the header.
+func readPTLayout(data []byte, size, noteSize, sigLen int) (l ptLayout, ok bool) {
+	if len(data) < 1080+sigLen {
+		return l, false
+	}
+	for i := 0; i < 31; i++ {
+		l.samplesLen += int(binary.BigEndian.Uint16(data[20+i*30+22:])) * 2
+	}
+	for _, patt := range data[952:1080] {
+		if int(patt) >= l.patternCnt {
+			l.patternCnt = int(patt) + 1
+		}
+	}
+	l.patternsOfs = 1080 + sigLen
+	return l, data[950] > 0 && data[950] <= 128 && l.patternCnt <= 64 &&
+		size >= l.patternsOfs+l.patternCnt*64*4*noteSize+l.samplesLen
+}
+
+// ptSample is a sample in the header of a ProTracker module (the lengths and the loop start in words)
+type ptSample struct {
+	len, finetune, volume, repStart, repLen int
+}
+
+// ptHeader assembles the header of a ProTracker module (without title and signature) for a module
+// converted from a packed format which stores the samples and the pattern numbers of the positions in
+// its own way
+func ptHeader(samples []ptSample, positions []int) []byte {
+	h := make([]byte, 1080)
+	for i := 0; i < 31; i++ {
+		s := ptSample{repLen: 1} // an empty sample
+		if i < len(samples) {
+			s = samples[i]
+		}
+		sh := h[20+i*30:]
+		binary.BigEndian.PutUint16(sh[22:], uint16(s.len))
+		sh[24], sh[25] = byte(s.finetune&0x0F), byte(s.volume)
+		binary.BigEndian.PutUint16(sh[26:], uint16(s.repStart))
+		binary.BigEndian.PutUint16(sh[28:], uint16(s.repLen))
+	}
+	h[950], h[951] = byte(len(positions)), 0x7F
+	for i, patt := range positions {
+		h[952+i] = byte(patt)
+	}
+	return h
+}
+
+// convertPatterns re-encodes the pattern data of a packed module into ProTracker notes (decode gets the
+// data of a single note and returns instrument, period, effect and parameter) and assembles the module
+func convertPatterns(data []byte, header []byte, l ptLayout, noteSize int, decode func([]byte) (int, int, int, int, error)) ([]byte, error) {
+	out := append([]byte{}, header...)
+	out = append(out, "M.K."...)
+	notes := data[l.patternsOfs:]
+	for i := 0; i < l.patternCnt*64*4; i++ {
+		ins, period, eff, par, err := decode(notes[i*noteSize : (i+1)*noteSize])
+		if err != nil {
+			return nil, fmt.Errorf("pattern %d: %v", i/256, err)
+		}
+		out = append(out, ptNote(ins, period, eff, par)...)
+	}
+	samples := l.patternsOfs + l.patternCnt*64*4*noteSize
+	return append(out, data[samples:samples+l.samplesLen]...), nil
+}
+
+// ProRunner 1 is a ProTracker module with the signature "SNT." in which notes are stored as
+// instrument, note index, effect and parameter bytes
+
+func detectProRunner1(data []byte) bool {
+	return detectSignature(1080, "SNT.")(data)
+}
+
+func unpackProRunner1(data []byte) ([]byte, error) {
+	l, ok := readPTLayout(data, len(data), 4, 4)
+	if !ok {
+		return nil, fmt.Errorf("ProRunner 1 module is truncated")
+	}
+	return convertPatterns(data, data[:1080], l, 4, func(n []byte) (int, int, int, int, error) {
+		period, err := ptNoteIndexPeriod(int(n[1]))
+		return int(n[0]), period, int(n[2] & 0x0F), int(n[3]), err
+	})
+}
+
+// Unic Tracker modules have 20-character sample names followed by a (negated) finetune word, and 3-byte
+// notes. Depending on the version, there is a "M.K." or "UNIC" signature or none at all.
+
+// unicLayout returns the layout of a Unic Tracker module, if the file of the given size is one (data has
+// to hold at least its header and patterns)
+func unicLayout(data []byte, size int) (ptLayout, bool) {
+	if len(data) < 1084 {
+		return ptLayout{}, false
+	}
+	var sigLens []int
+	switch string(data[1080:1084]) {
+	case "M.K.", "UNIC":
+		sigLens = []int{4}
+	case "\x00\x00\x00\x00":
+		sigLens = []int{4, 0} // could also be the start of the pattern data
+	default:
+		sigLens = []int{0}
+	}
+	var l ptLayout
+	found := false
+	for _, sigLen := range sigLens {
+		var ok bool
+		if l, ok = readPTLayout(data, size, 3, sigLen); !ok {
+			continue
+		}
+		// a normal ProTracker module would be larger - the number of bytes after the patterns has to
+		// match the sample data exactly (at most a few padding bytes)
+		if rest := size - l.patternsOfs - l.patternCnt*64*4*3 - l.samplesLen; rest >= 0 && rest <= 16 {
+			found = true
+			break
+		}
+	}
+	if !found {
+		return l, false
+	}
+	for i := 0; i < l.patternCnt*64*4; i++ {
+		n := data[l.patternsOfs+i*3:]
+		if n[0]&0x3F > 36 {
+			return l, false
+		}
+	}
+	return l, true
+}
+
+func detectUnic(data []byte) bool {
+	_, ok := unicLayout(data, len(data))
+	return ok
+}
+
+func unpackUnic(data []byte) ([]byte, error) {
+	l, ok := unicLayout(data, len(data))
+	if !ok {
+		return nil, fmt.Errorf("not a Unic Tracker module")
+	}
+	header := append([]byte{}, data[:1080]...)
+	for i := 0; i < 31; i++ {
+		sh := header[20+i*30:]
+		finetune := -int(int16(binary.BigEndian.Uint16(sh[20:22])))
+		sh[20], sh[21] = 0, 0 // the last two characters of the ProTracker sample name
+		sh[24] = byte(finetune & 0x0F)
+	}
+	return convertPatterns(data, header, l, 3, func(n []byte) (int, int, int, int, error) {
+		period, err := ptNoteIndexPeriod(int(n[0] & 0x3F))
+		ins := int(n[0]>>2&0x10 | n[1]>>4)
+		return ins, period, int(n[1] & 0x0F), int(n[2]), err
+	})
+}
@@ -0,0 +1,211 @@
+package mod
+
+import (
+	"bytes"
+	"encoding/binary"
+	"testing"
+)
+
+// packedNote is a note of a test module: instrument, note index, effect and parameter
+type packedNote [4]int
+
+// checkNotes compares a channel of a pattern of the converted module with the expected notes (the other
+// rows are empty), given as ProTracker instrument, period and effect code
+func checkNotes(t *testing.T, m Module, patt, ch int, want map[int][3]int) {
+	t.Helper()
+	for row, n := range m.Patterns[patt] {
+		w := want[row]
+		if got := [3]int{n[ch].InsNum, n[ch].Period, int(n[ch].EffCode)}; got != w {
+			t.Errorf("pattern %d, row %d, channel %d: instrument %d, period %d, effect %03X, want %d, %d, %03X",
+				patt, row, ch+1, got[0], got[1], got[2], w[0], w[1], w[2])
+		}
+	}
+}
+
+// testSampleData returns n bytes of sample data, different for every seed
+func testSampleData(n, seed int) []byte {
+	b := make([]byte, n)
+	for i := range b {
+		b[i] = byte(seed*16 + i)
+	}
+	return b
+}
+
+// noisePackerModule returns a NoisePacker module with 2 samples and 2 patterns, which share 3 tracks
+func noisePackerModule(v3 bool) []byte {
+	tracks := [3]map[int]packedNote{
+		{0: {1, 13, 0x7, 0xFE}, 16: {2, 25, 0xC, 0x20}},
+		{},
+		{5: {2, 1, 0xB, 0x02}, 63: {1, 36, 0x5, 0x03}},
+	}
+	var trackData []byte
+	trackOfs := make([]int, len(tracks))
+	for i, notes := range tracks {
+		trackOfs[i] = len(trackData)
+		empty := 0
+		for row := 0; row <= 64; row++ {
+			n, ok := notes[row]
+			if v3 && empty > 0 && (ok || row == 64) {
+				trackData = append(trackData, byte(0x100-empty))
+				empty = 0
+			}
+			if row == 64 {
+				break
+			}
+			if v3 && !ok {
+				empty++
+				continue
+			}
+			trackData = append(trackData, byte(n[1]<<1|n[0]>>4), byte(n[0]<<4|n[2]), byte(n[3]))
+		}
+	}
+	patterns := [][4]int{{0, 1, 2, 1}, {1, 0, 1, 2}} // channels 1 to 4
+	positions := []int{1, 0}
+
+	var b bytes.Buffer
+	w := func(v ...int) {
+		for _, x := range v {
+			binary.Write(&b, binary.BigEndian, uint16(x))
+		}
+	}
+	w(2*16+0x0C, len(positions)*2, len(patterns)*8, len(trackData))
+	for _, s := range []ptSample{{len: 8, volume: 64, repLen: 1}, {len: 4, finetune: 3, volume: 32, repStart: 2, repLen: 2}} {
+		if v3 {
+			b.Write([]byte{byte(s.finetune), byte(s.volume)})
+		}
+		w(0, 0, s.len) // address, length
+		if !v3 {
+			b.Write([]byte{byte(s.finetune), byte(s.volume)})
+		}
+		w(0, 0, s.repLen, s.repStart*2)
+	}
+	w(0, 0)
+	for _, patt := range positions {
+		w(patt * 8)
+	}
+	for _, patt := range patterns {
+		w(trackOfs[patt[3]], trackOfs[patt[2]], trackOfs[patt[1]], trackOfs[patt[0]])
+	}
+	b.Write(trackData)
+	b.Write(testSampleData(16, 1))
+	b.Write(testSampleData(8, 2))
+	return b.Bytes()
+}
+
+func TestNoisePacker(t *testing.T) {
+	for name, v3 := range map[string]bool{"NoisePacker 2": false, "NoisePacker 3": true} {
+		m, err := LoadData("test.np", noisePackerModule(v3))
+		if err != nil {
+			t.Fatalf("%s: %v", name, err)
+		}
+		if m.Packer != name {
+			t.Errorf("%s: converted from %q", name, m.Packer)
+		}
+		if len(m.PatternTable) != 2 || m.PatternTable[0] != 1 || m.PatternTable[1] != 0 || m.PatternCnt != 2 {
+			t.Errorf("%s: pattern table %v (%d patterns), want [1 0] (2)", name, m.PatternTable, m.PatternCnt)
+		}
+		track0 := map[int][3]int{0: {1, 428, 0xA02}, 16: {2, 214, 0xC20}}
+		track2 := map[int][3]int{5: {2, 856, 0xB03}, 63: {1, 113, 0x530}}
+		checkNotes(t, m, 0, 0, track0)
+		checkNotes(t, m, 0, 1, nil)
+		checkNotes(t, m, 0, 2, track2)
+		checkNotes(t, m, 1, 1, track0)
+		checkNotes(t, m, 1, 3, track2)
+
+		ins := m.Instruments[2]
+		if ins.Len != 8 || ins.Volume != 32 || ins.Finetune() != 3 || ins.RepStart != 4 || ins.RepLen != 4 {
+			t.Errorf("%s: instrument 2: length %d, volume %d, finetune %d, loop %d+%d, want 8, 32, 3, 4+4",
+				name, ins.Len, ins.Volume, ins.Finetune(), ins.RepStart, ins.RepLen)
+		}
+		for i, want := range testSampleData(8, 2) {
+			if byte(ins.Sample[i]) != want {
+				t.Fatalf("%s: sample 2 byte %d is %d, want %d", name, i, byte(ins.Sample[i]), want)
+			}
+		}
+	}
+}
+
+// thePlayerModule returns a The Player 6.1 module with a pattern played twice, which uses all kinds of
+// notes and compression, and with a sample which uses the data of another one
+func thePlayerModule() []byte {
+	track0 := []byte{
+		0x80 | 13<<1, 1<<4 | 0xA, 0x03, 0x02, // row 0: full note, 2 empty rows follow
+		0x80 | 0x60 | 25>>2, 25&3<<6 | 3<<1, 0x42, // row 3: note without effect, repeated twice
+		0x80 | 0x70 | 0xC, 0x20, 0x81, 0, 0, // row 6: only an effect, then the 2 notes from the start
+		0xFF, 0x3F, // empty to the end
+	}
+	binary.BigEndian.PutUint16(track0[10:], 12) // the jump back to the start of the track
+	track1 := []byte{0xFF, 0x3F}
+	trackData := append(track0, track1...)
+
+	var b bytes.Buffer
+	w := func(v ...int) {
+		for _, x := range v {
+			binary.Write(&b, binary.BigEndian, uint16(x))
+		}
+	}
+	b.WriteString(p61Signature)
+	samplesOfs := 4 + 3*6 + 8 + 3 + len(trackData)
+	w(samplesOfs)
+	b.Write([]byte{1, 3})
+	w(8)
+	b.Write([]byte{0, 64})
+	w(0xFFFF)
+	w(4)
+	b.Write([]byte{5, 48})
+	w(2)
+	w(0xFFFF) // sample 1 again
+	b.Write([]byte{0, 20})
+	w(0xFFFF)
+	w(0, len(track0), len(track0), 0)
+	b.Write([]byte{0, 0, 0xFF})
+	b.Write(trackData)
+	b.Write(testSampleData(16, 1))
+	b.Write(testSampleData(8, 2))
+	return b.Bytes()
+}
+
+func TestThePlayer(t *testing.T) {
+	m, err := LoadData("test.p61", thePlayerModule())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if m.Packer != "The Player 6.1" || len(m.PatternTable) != 2 || m.PatternCnt != 1 {
+		t.Errorf("converted from %q, pattern table %v (%d patterns), want The Player 6.1, [0 0] (1)", m.Packer, m.PatternTable, m.PatternCnt)
+	}
+	track0 := map[int][3]int{
+		0: {1, 428, 0xA30}, 3: {3, 214, 0}, 4: {3, 214, 0}, 5: {3, 214, 0}, 6: {0, 0, 0xC20},
+		7: {1, 428, 0xA30}, 10: {3, 214, 0}, 11: {3, 214, 0}, 12: {3, 214, 0},
+	}
+	checkNotes(t, m, 0, 0, track0)
+	checkNotes(t, m, 0, 1, nil)
+	checkNotes(t, m, 0, 3, track0)
+
+	for _, c := range []struct {
+		ins, len, volume, repStart, repLen, data int
+	}{{1, 16, 64, 0, 0, 1}, {2, 8, 48, 4, 4, 2}, {3, 16, 20, 0, 0, 1}} {
+		ins := m.Instruments[c.ins]
+		if ins.Len != c.len || ins.Volume != c.volume || ins.RepStart != c.repStart || ins.RepLen != c.repLen {
+			t.Errorf("instrument %d: length %d, volume %d, loop %d+%d, want %d, %d, %d+%d",
+				c.ins, ins.Len, ins.Volume, ins.RepStart, ins.RepLen, c.len, c.volume, c.repStart, c.repLen)
+		}
+		if want := testSampleData(c.len, c.data); !bytes.Equal(int8sToBytes(ins.Sample), want) {
+			t.Errorf("instrument %d: sample data %v, want %v", c.ins, ins.Sample, want)
+		}
+	}
+}
+
+// int8sToBytes returns the bytes of the sample data
+func int8sToBytes(s []int8) []byte {
+	b := make([]byte, len(s))
+	for i, v := range s {
+		b[i] = byte(v)
+	}
+	return b
+}
+
+func TestUnpackersIgnoreMOD(t *testing.T) {
+	if up, ok := FindUnpacker(testModuleData(t)); ok {
+		t.Errorf("MOD file detected as packed with %s", up.Name)
+	}
+}
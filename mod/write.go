@@ -0,0 +1,184 @@
+package mod
+
+import (
+	"encoding/binary"
+	"fmt"
+	"io"
+)
+
+// Write serializes the module into a ProTracker MOD file: the header with the instruments and the
+// pattern table, the patterns (4 bytes per note) and the sample data. Modules with 15 instruments are
+// written in the old Soundtracker layout without signature; otherwise the signature is kept if it fits
+// the channel count, or chosen from it ("M.K." / "M!K!" for 4 channels, "xCHN" / "xxCH" for more).
+// Patterns shorter than 64 lines are padded with empty lines, and patterns which are not in the pattern
+// table are stored as well.
+// Only modules read from MOD files (or built in the same way) can be written: notes of other formats
+// use periods, volumes and effects which do not exist in MOD files.
+func (m Module) Write(w io.Writer) error {
+	if m.Format != FormatMOD {
+		return fmt.Errorf("%v modules cannot be written as MOD files", m.Format)
+	}
+	instrCnt := 31
+	if m.InstrTableLen == 15 {
+		instrCnt = 15
+	}
+	if len(m.Instruments) > instrCnt+1 {
+		return fmt.Errorf("too many instruments (%d, at most %d)", len(m.Instruments)-1, instrCnt)
+	}
+	if len(m.PatternTable) == 0 || len(m.PatternTable) > 128 {
+		return fmt.Errorf("invalid song length %d", len(m.PatternTable))
+	}
+	chanCnt := m.ChannelCount()
+
+	// the number of patterns stored is given by the highest entry of the (full) pattern table
+	patternCnt := 0
+	for _, patt := range m.PatternTable {
+		if patt < 0 || patt >= len(m.Patterns) {
+			return fmt.Errorf("pattern table references pattern %d, but the module only has %d patterns", patt, len(m.Patterns))
+		}
+		if patt+1 > patternCnt {
+			patternCnt = patt + 1
+		}
+	}
+	hidden := len(m.Patterns) > patternCnt && len(m.PatternTable) < 128
+	if hidden {
+		// also store the patterns which are not played: unused entries still count for the pattern number
+		patternCnt = len(m.Patterns)
+	}
+	sig, flt8, err := m.writeSignature(instrCnt, chanCnt, patternCnt)
+	if err != nil {
+		return err
+	}
+	maxPatterns := 128
+	if flt8 {
+		maxPatterns = 64 // stored as two 4 channel patterns each
+	}
+	if patternCnt > maxPatterns {
+		return fmt.Errorf("too many patterns (%d, at most %d)", patternCnt, maxPatterns)
+	}
+
+	sigLen := 4
+	if instrCnt == 15 {
+		sigLen = 0
+	}
+	hdrLen := 20 + instrCnt*30 + 2 + 128 + sigLen
+	data := make([]byte, hdrLen, hdrLen+patternCnt*64*chanCnt*4)
+	copy(data[0:20], m.Name)
+
+	// Instruments
+	sampleLens := make([]int, instrCnt+1)
+	for i := 1; i < len(m.Instruments); i++ {
+		ins := &m.Instruments[i]
+		if ins.Len < 0 || ins.Len > 0x1FFFE {
+			return fmt.Errorf("instrument %d: invalid sample length %d", i, ins.Len)
+		}
+		if ins.Volume < 0 || ins.Volume > 255 {
+			return fmt.Errorf("instrument %d: invalid volume %d", i, ins.Volume)
+		}
+		if ins.Sample != nil && len(ins.Sample) < ins.Len {
+			return fmt.Errorf("instrument %d: %d bytes of sample data for a length of %d", i, len(ins.Sample), ins.Len)
+		}
+		hdr := data[20+(i-1)*30 : 20+i*30]
+		copy(hdr[0:22], ins.Name)
+		sampleLens[i] = (ins.Len + 1) &^ 1
+		binary.BigEndian.PutUint16(hdr[22:], uint16(sampleLens[i]/2))
+		hdr[24] = byte(ins.finetune & 0x0F)
+		hdr[25] = byte(ins.Volume)
+		repStart, repLen := ins.RepStart/2, ins.RepLen/2
+		if ins.RepLen == 0 {
+			repStart, repLen = 0, 1 // no loop
+		}
+		binary.BigEndian.PutUint16(hdr[26:], uint16(repStart))
+		binary.BigEndian.PutUint16(hdr[28:], uint16(repLen))
+	}
+
+	// Pattern table
+	songLenOfs := 20 + instrCnt*30
+	data[songLenOfs] = byte(len(m.PatternTable))
+	data[songLenOfs+1] = 127 // restart position, as written by ProTracker
+	orders := data[songLenOfs+2 : songLenOfs+2+128]
+	for i, patt := range m.PatternTable {
+		orders[i] = byte(patt)
+	}
+	if hidden {
+		orders[127] = byte(patternCnt - 1)
+	}
+	if flt8 {
+		for i := range orders {
+			orders[i] *= 2
+		}
+	}
+	copy(data[hdrLen-sigLen:hdrLen], sig[:sigLen])
+
+	// Patterns
+	for i := 0; i < patternCnt; i++ {
+		patt := m.Patterns[i]
+		if len(patt) > 64 {
+			return fmt.Errorf("pattern %d has %d lines, at most 64 can be stored", i, len(patt))
+		}
+		notes := make([]byte, 64*chanCnt*4)
+		for j, line := range patt {
+			if len(line) > chanCnt {
+				return fmt.Errorf("pattern %d, line %d: %d channels instead of %d", i, j, len(line), chanCnt)
+			}
+			for k, note := range line {
+				if note.InsNum < 0 || note.InsNum > 31 || note.Period < 0 || note.Period > 0xFFF {
+					return fmt.Errorf("pattern %d, line %d, channel %d: note %v cannot be stored", i, j, k, note)
+				}
+				noteOfs := (j*chanCnt + k) * 4
+				if flt8 {
+					noteOfs = ((k/4*64+j)*4 + k%4) * 4
+				}
+				copy(notes[noteOfs:], ptNote(note.InsNum, note.Period, int(note.EffCode>>8), int(note.EffCode)))
+			}
+		}
+		data = append(data, notes...)
+	}
+
+	// Samples
+	for i := 1; i < len(m.Instruments); i++ {
+		ins := &m.Instruments[i]
+		sample := make([]byte, sampleLens[i])
+		if ins.HasSample() {
+			for j := 0; j < ins.Len; j++ {
+				sample[j] = byte(ins.At(j))
+			}
+		}
+		data = append(data, sample...)
+	}
+
+	_, err = w.Write(data)
+	return err
+}
+
+// writeSignature returns the signature the module is written with, and whether it means the FLT8 layout
+func (m Module) writeSignature(instrCnt, chanCnt, patternCnt int) (sig [4]byte, flt8 bool, err error) {
+	if instrCnt == 15 {
+		if chanCnt != 4 {
+			return sig, false, fmt.Errorf("modules with 15 instruments have 4 channels, not %d", chanCnt)
+		}
+		return sig, false, nil
+	}
+	isSig := true
+	for _, c := range m.Signature {
+		if c < 32 {
+			isSig = false // not read from a file with a signature
+		}
+	}
+	if n, flt8 := modChannelLayout(m.Signature); isSig && n == chanCnt && !(string(m.Signature[:]) == "M.K." && patternCnt > 64) {
+		return m.Signature, flt8, nil
+	}
+	switch {
+	case chanCnt == 4 && patternCnt > 64:
+		copy(sig[:], "M!K!")
+	case chanCnt == 4:
+		copy(sig[:], "M.K.")
+	case chanCnt > 0 && chanCnt < 10:
+		copy(sig[:], fmt.Sprintf("%dCHN", chanCnt))
+	case chanCnt >= 10 && chanCnt <= 32:
+		copy(sig[:], fmt.Sprintf("%dCH", chanCnt))
+	default:
+		return sig, false, fmt.Errorf("%d channels cannot be stored in a MOD file", chanCnt)
+	}
+	return sig, false, nil
+}
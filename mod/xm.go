@@ -0,0 +1,442 @@
+package mod
+
+import (
+	"encoding/binary"
+	"fmt"
+	"log/slog"
+	"math"
+	"strings"
+)
+
+// The XM (FastTracker II) format is converted into the MOD model: every sample becomes an Instrument,
+// the instruments with their keymaps become SampleMaps. Notes are converted into Amiga periods including
+// the relative note and finetune of the sample picked for them, so the player can treat them like MOD
+// notes. Pitch slides are played as Amiga period slides, also for modules using linear frequencies.
+
+const xmSignature = "Extended Module: "
+
+func isXM(data []byte) bool {
+	return len(data) >= len(xmSignature) && string(data[:len(xmSignature)]) == xmSignature
+}
+
+// patternCell is a note of an XM (or S3M) pattern as stored in the file
+type patternCell struct {
+	note, ins, vol, eff, par byte
+}
+
+// xmTuning is the pitch of an XM sample relative to the note played
+type xmTuning struct {
+	relNote  int // in half-notes
+	finetune int // in 1/128 half-notes
+}
+
+// ReadXMData loads the XM file data (read from the file fn, which is only used as the module's FileName)
+func ReadXMData(fn string, data []byte) (mod Module, err error) {
+	return readXM(fn, memSource(data), nil)
+}
+
+// readXM loads the XM module from src; the samples are streamed through the cache (if it is not nil)
+func readXM(fn string, src *source, cache *SampleCache) (mod Module, err error) {
+	if !isXM(src.data) {
+		return mod, fmt.Errorf("not an XM file")
+	}
+	const headerLen = 80
+	if src.size < headerLen {
+		return mod, fmt.Errorf("file too short for an XM header (%d bytes, need at least %d)", src.size, headerLen)
+	}
+	le16 := func(ofs int) int { return int(binary.LittleEndian.Uint16(src.bytes(ofs, 2))) }
+	le32 := func(ofs int) int { return int(binary.LittleEndian.Uint32(src.bytes(ofs, 4))) }
+
+	mod.FileName = fn
+	mod.Format = FormatXM
+	mod.samples = cache
+	mod.Name = strings.Trim(string(src.bytes(17, 20)), " \t\n\v\f\r\x00")
+	songLen, chanCnt, pattCnt, insCnt := le16(64), le16(68), le16(70), le16(72)
+	switch {
+	case songLen == 0 || songLen > 256:
+		return mod, fmt.Errorf("invalid song length %d", songLen)
+	case chanCnt == 0 || chanCnt > 32:
+		return mod, fmt.Errorf("invalid number of channels %d", chanCnt)
+	case pattCnt > 256:
+		return mod, fmt.Errorf("invalid number of patterns %d", pattCnt)
+	case insCnt > 128:
+		return mod, fmt.Errorf("invalid number of instruments %d", insCnt)
+	case headerLen+songLen > src.size:
+		return mod, fmt.Errorf("truncated pattern order table")
+	}
+	mod.InitialTempo, mod.InitialBPM = le16(76), le16(78)
+	mod.PatternTable = make([]int, songLen)
+	for i, o := range src.bytes(headerLen, songLen) {
+		mod.PatternTable[i] = int(o)
+	}
+
+	// Patterns (converted when the instruments are known)
+	ofs := 60 + le32(60)
+	cells := make([][][]patternCell, pattCnt)
+	for i := range cells {
+		if ofs+9 > src.size {
+			return mod, fmt.Errorf("truncated header of pattern %d", i)
+		}
+		hdrLen, rows, packedLen := le32(ofs), le16(ofs+5), le16(ofs+7)
+		if hdrLen < 9 || rows == 0 || rows > 256 {
+			return mod, fmt.Errorf("invalid header of pattern %d", i)
+		}
+		ofs += hdrLen
+		if ofs+packedLen > src.size {
+			return mod, fmt.Errorf("truncated data of pattern %d", i)
+		}
+		if cells[i], err = unpackXMPattern(src.bytes(ofs, packedLen), rows, chanCnt); err != nil {
+			return mod, fmt.Errorf("pattern %d: %v", i, err)
+		}
+		ofs += packedLen
+	}
+
+	// Instruments and samples
+	mod.Instruments = []Instrument{{Num: 0, Name: "NOP"}}
+	mod.Instruments[0].SetFinetune(0)
+	tunings := []xmTuning{{}}
+	for i := 0; i < insCnt; i++ {
+		if ofs+29 > src.size {
+			return mod, fmt.Errorf("truncated header of instrument %d", i+1)
+		}
+		insLen, sampleCnt := le32(ofs), le16(ofs+27)
+		sm := SampleMap{Name: strings.Trim(string(src.bytes(ofs+4, 22)), " \t\n\v\f\r\x00")}
+		if sampleCnt == 0 {
+			mod.SampleMaps = append(mod.SampleMaps, sm)
+			ofs += insLen
+			continue
+		}
+		if insLen < 241 || ofs+241 > src.size {
+			return mod, fmt.Errorf("truncated header of instrument %d", i+1)
+		}
+		h := src.bytes(ofs, 241)
+		for n := range sm.Keymap {
+			sm.Keymap[n] = int(h[33+n])
+		}
+		env := readXMEnvelope(h[129:241])
+		fadeOut := le16(ofs + 239)
+		sampleHdrLen := le32(ofs + 29)
+		ofs += insLen
+
+		if ofs+sampleCnt*sampleHdrLen > src.size || sampleHdrLen < 40 {
+			return mod, fmt.Errorf("truncated sample headers of instrument %d", i+1)
+		}
+		headers := src.bytes(ofs, sampleCnt*sampleHdrLen)
+		ofs += sampleCnt * sampleHdrLen
+		for s := 0; s < sampleCnt; s++ {
+			sh := headers[s*sampleHdrLen:]
+			ins := Instrument{
+				Num:      len(mod.Instruments),
+				Name:     strings.Trim(string(sh[18:40]), " \t\n\v\f\r\x00"),
+				Len:      int(binary.LittleEndian.Uint32(sh[0:])),
+				RepStart: int(binary.LittleEndian.Uint32(sh[4:])),
+				RepLen:   int(binary.LittleEndian.Uint32(sh[8:])),
+				Volume:   int(sh[12]),
+				Envelope: env,
+				FadeOut:  fadeOut,
+			}
+			ins.SetFinetune(0) // the finetune is part of the converted periods
+			if ins.Volume > 64 {
+				ins.Volume = 64
+			}
+			if ofs+ins.Len > src.size {
+				return mod, fmt.Errorf("sample data of instrument %d shorter than declared", i+1)
+			}
+			is16Bit := sh[14]&0x10 != 0
+			if cache != nil {
+				length := ins.Len
+				if is16Bit {
+					length /= 2
+				}
+				cache.stream(&ins, src, ofs, &sampleStream{length: length, is16Bit: is16Bit, delta: true})
+				ofs += ins.Len
+				ins.Len = length
+			} else {
+				raw := src.bytes(ofs, ins.Len)
+				ofs += ins.Len
+				ins.Sample = decodeXMSample(raw, is16Bit)
+				ins.Len = len(ins.Sample)
+			}
+			if is16Bit {
+				ins.RepStart /= 2
+				ins.RepLen /= 2
+			}
+			switch sh[14] & 0x03 {
+			case 0:
+				ins.RepStart, ins.RepLen = 0, 0
+			case 2:
+				mod.Warnf("ping-pong loops are played as forward loops")
+			}
+			if ins.RepLen > 0 && ins.RepStart+ins.RepLen < ins.Len {
+				ins.Len = ins.RepStart + ins.RepLen // the player loops at the end of the sample
+				if ins.Sample != nil {
+					ins.Sample = ins.Sample[:ins.Len]
+				}
+			}
+			ins.checkLoop(&mod)
+			sm.Samples = append(sm.Samples, len(mod.Instruments))
+			mod.Instruments = append(mod.Instruments, ins)
+			tunings = append(tunings, xmTuning{relNote: int(int8(sh[16])), finetune: int(int8(sh[13]))})
+		}
+		mod.SampleMaps = append(mod.SampleMaps, sm)
+	}
+	mod.InstrTableLen = len(mod.Instruments) - 1
+	if ofs < src.size {
+		mod.Trailing = src.bytes(ofs, src.size-ofs)
+		mod.TrailingType = guessDataType(mod.Trailing)
+	}
+
+	cells = mod.addEmptyPattern(cells, chanCnt)
+	mod.convertPatterns(cells, func(cell patternCell, ins int) Note { return mod.convertXMNote(cell, ins, tunings) })
+
+	logEvent(slog.LevelInfo, "module loaded", "file", fn, "name", mod.Name, "format", mod.Format,
+		"instruments", len(mod.SampleMaps), "samples", mod.InstrTableLen, "patterns", mod.PatternCnt)
+	return
+}
+
+// unpackXMPattern decodes the packed pattern data: a note starting with a byte with the highest bit set
+// only contains the fields given by the lower bits of this byte, all other notes contain all 5 fields
+func unpackXMPattern(pd []byte, rows, chanCnt int) ([][]patternCell, error) {
+	cells := make([][]patternCell, rows)
+	i := 0
+	for r := range cells {
+		cells[r] = make([]patternCell, chanCnt)
+		if len(pd) == 0 {
+			continue // an empty pattern
+		}
+		for c := range cells[r] {
+			if i >= len(pd) {
+				return nil, fmt.Errorf("truncated data in row %d", r)
+			}
+			cell := &cells[r][c]
+			fields := []*byte{&cell.note, &cell.ins, &cell.vol, &cell.eff, &cell.par}
+			mask := byte(0x1F)
+			if pd[i]&0x80 != 0 {
+				mask = pd[i]
+				i++
+			}
+			for bit, f := range fields {
+				if mask&(1<<bit) == 0 {
+					continue
+				}
+				if i >= len(pd) {
+					return nil, fmt.Errorf("truncated data in row %d", r)
+				}
+				*f = pd[i]
+				i++
+			}
+		}
+	}
+	return cells, nil
+}
+
+// readXMEnvelope reads the volume envelope from the instrument header (starting at the envelope points)
+func readXMEnvelope(h []byte) *Envelope {
+	pointCnt, flags := int(h[96]), h[104]
+	if flags&0x01 == 0 || pointCnt == 0 {
+		return nil
+	}
+	if pointCnt > 12 {
+		pointCnt = 12
+	}
+	env := &Envelope{Sustain: -1, LoopEnd: -1}
+	for i := 0; i < pointCnt; i++ {
+		env.Points = append(env.Points, EnvelopePoint{
+			Tick:  int(binary.LittleEndian.Uint16(h[i*4:])),
+			Value: int(binary.LittleEndian.Uint16(h[i*4+2:])),
+		})
+	}
+	if flags&0x02 != 0 && int(h[98]) < pointCnt {
+		env.Sustain = int(h[98])
+	}
+	if flags&0x04 != 0 && int(h[99]) <= int(h[100]) && int(h[100]) < pointCnt {
+		env.LoopStart, env.LoopEnd = int(h[99]), int(h[100])
+	}
+	return env
+}
+
+// decodeXMSample decodes the delta encoded sample data; 16-bit samples are reduced to 8 bits, which is
+// what the player plays
+func decodeXMSample(raw []byte, is16Bit bool) []int8 {
+	if is16Bit {
+		s := make([]int8, len(raw)/2)
+		var v int16
+		for i := range s {
+			v += int16(binary.LittleEndian.Uint16(raw[i*2:]))
+			s[i] = int8(v >> 8)
+		}
+		return s
+	}
+	s := make([]int8, len(raw))
+	var v int8
+	for i, d := range raw {
+		v += int8(d)
+		s[i] = v
+	}
+	return s
+}
+
+// xmPeriod converts a note (0 = C-0, 48 = C-4, which plays a sample at 8363 Hz) with the given finetune
+// (in 1/128 half-notes) into an Amiga period
+func xmPeriod(note, finetune int) int {
+	freq := 8363 * math.Pow(2, (float64(note-48)+float64(finetune)/128)/12)
+	return int(math.Round(3546894.6 / freq))
+}
+
+// addEmptyPattern makes the orders beyond the stored patterns play an (added) empty pattern
+func (m *Module) addEmptyPattern(cells [][][]patternCell, chanCnt int) [][][]patternCell {
+	pattCnt := len(cells)
+	for i, patt := range m.PatternTable {
+		if patt >= pattCnt {
+			if len(cells) == pattCnt {
+				cells = append(cells, make([][]patternCell, 64))
+				for r := range cells[pattCnt] {
+					cells[pattCnt][r] = make([]patternCell, chanCnt)
+				}
+			}
+			m.PatternTable[i] = pattCnt
+		}
+	}
+	return cells
+}
+
+// convertPatterns converts the pattern data of the XM or S3M format into notes (with convert). Notes
+// without instrument number use the instrument last played in their channel, so the patterns are
+// converted in the order they are played.
+func (m *Module) convertPatterns(cells [][][]patternCell, convert func(cell patternCell, ins int) Note) {
+	m.Patterns = make([][][]Note, len(cells))
+	m.PatternCnt = len(cells)
+	var lastIns []int
+	if len(cells) > 0 && len(cells[0]) > 0 {
+		lastIns = make([]int, len(cells[0][0]))
+	}
+	order := append([]int{}, m.PatternTable...)
+	for i := range cells {
+		order = append(order, i)
+	}
+	for _, patt := range order {
+		if m.Patterns[patt] != nil {
+			continue
+		}
+		m.Patterns[patt] = make([][]Note, len(cells[patt]))
+		for r, row := range cells[patt] {
+			m.Patterns[patt][r] = make([]Note, len(row))
+			for ch, cell := range row {
+				if cell.ins > 0 {
+					lastIns[ch] = int(cell.ins)
+				}
+				m.Patterns[patt][r][ch] = convert(cell, lastIns[ch])
+			}
+		}
+	}
+}
+
+// convertXMNote converts a note of an XM pattern, playing the instrument ins
+func (m *Module) convertXMNote(cell patternCell, ins int, tunings []xmTuning) (n Note) {
+	n.InsNum = int(cell.ins)
+	n.Ins = &m.Instruments[0]
+	sample := 0
+	if ins > 0 && ins <= len(m.SampleMaps) {
+		sm := m.SampleMaps[ins-1]
+		key := 48
+		if cell.note >= 1 && cell.note <= 96 {
+			key = int(cell.note) - 1
+		}
+		if k := sm.Keymap[key]; k < len(sm.Samples) {
+			sample = sm.Samples[k]
+		}
+	} else if n.InsNum > 0 {
+		m.Warnf("note references instrument %d, but the module only has %d instruments", n.InsNum, len(m.SampleMaps))
+	}
+	if n.InsNum > 0 && sample > 0 && m.Instruments[sample].Len > 0 {
+		n.Ins = &m.Instruments[sample]
+	}
+
+	switch {
+	case cell.note == 97:
+		n.KeyOff = true
+	case cell.note >= 1 && cell.note <= 96:
+		t := tunings[sample]
+		n.Period = xmPeriod(int(cell.note)-1+t.relNote, t.finetune)
+	}
+
+	n.Effect = xmEffect(cell.eff, cell.par)
+	if cell.eff == 0 && cell.par == 0 {
+		n.EffCode = 0
+	}
+	switch v := int(cell.vol); {
+	case v >= 0x10 && v <= 0x50:
+		n.Vol = v - 0x10 + 1
+	case v >= 0x60:
+		// the other volume column commands are played as effects, if the effect column is empty
+		e, ok := xmVolumeEffect(v>>4, v&0x0F)
+		switch {
+		case !ok:
+		case n.EffCode != 0:
+			m.Warnf("volume column effects in combination with other effects are not supported")
+		default:
+			n.Effect = e
+		}
+	}
+	return
+}
+
+// xmEffect converts an effect of the XM format
+func xmEffect(eff, par byte) Effect {
+	code := uint16(eff)<<8 | uint16(par)
+	switch {
+	case eff == 0x8:
+		return Effect{SetPanning, code}
+	case eff == 0xE:
+		return Effect{EffectType(16 + par>>4), code}
+	case eff < 0x10:
+		return Effect{EffectType(eff), code}
+	}
+	switch eff {
+	case 'G' - 'A' + 10:
+		return Effect{SetGlobalVolume, code}
+	case 'H' - 'A' + 10:
+		return Effect{GlobalVolSlide, code}
+	case 'K' - 'A' + 10:
+		return Effect{KeyOff, code}
+	case 'L' - 'A' + 10:
+		return Effect{SetEnvelopePos, code}
+	case 'P' - 'A' + 10:
+		return Effect{PanSlide, code}
+	case 'R' - 'A' + 10:
+		return Effect{MultiRetrig, code}
+	case 'T' - 'A' + 10:
+		return Effect{Tremor, code}
+	case 'X' - 'A' + 10:
+		switch par >> 4 {
+		case 1:
+			return Effect{ExtraFineSlideUp, code}
+		case 2:
+			return Effect{ExtraFineSlideDown, code}
+		}
+	}
+	return Effect{}
+}
+
+// xmVolumeEffect converts a command of the volume column (other than set volume) into an effect
+func xmVolumeEffect(cmd, par int) (Effect, bool) {
+	switch cmd {
+	case 0x6: // volume slide down
+		return Effect{VolSlide, 0xA00 | uint16(par)}, true
+	case 0x7: // volume slide up
+		return Effect{VolSlide, 0xA00 | uint16(par)<<4}, true
+	case 0x8: // fine volume slide down
+		return Effect{FineVolSlideDown, 0xEB0 | uint16(par)}, true
+	case 0x9: // fine volume slide up
+		return Effect{FineVolSlideUp, 0xEA0 | uint16(par)}, true
+	case 0xA: // vibrato speed
+		return Effect{Vibrato, 0x400 | uint16(par)<<4}, true
+	case 0xB: // vibrato depth
+		return Effect{Vibrato, 0x400 | uint16(par)}, true
+	case 0xC: // set panning
+		return Effect{SetPanning, 0x800 | uint16(par*17)}, true
+	case 0xF: // tone portamento
+		return Effect{Portamento, 0x300 | uint16(par<<4)}, true
+	}
+	return Effect{}, false
+}
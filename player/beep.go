@@ -0,0 +1,54 @@
+package player
+
+import (
+	"math"
+
+	"github.com/b0nefish/go-modplayer/mod"
+)
+
+// BeepStreamer plays a module as a Streamer of the beep audio library (github.com/gopxl/beep), to be
+// mixed with other sources or played by its speaker. Stream and Err implement the interface, so this
+// package doesn't depend on beep:
+//
+//	s := player.NewBeepStreamer(m, player.PlayerOptions{Rate: 44100})
+//	speaker.Init(beep.SampleRate(s.SampleRate()), 4410)
+//	speaker.Play(s)
+//
+// The embedded Player controls the playback (seeking, muting, callbacks, ...).
+type BeepStreamer struct {
+	*Player
+}
+
+// NewBeepStreamer creates a BeepStreamer playing the module with the given options
+func NewBeepStreamer(module mod.Module, opts PlayerOptions) *BeepStreamer {
+	return &BeepStreamer{NewPlayer(module, opts)}
+}
+
+// SampleRate returns the sample rate of the streamed audio (PlayerOptions.Rate, default SampleRate)
+func (s *BeepStreamer) SampleRate() int {
+	return s.rate
+}
+
+// Stream fills samples with the next stereo samples (-1..1); after the end of the song, it returns
+// ok == false
+func (s *BeepStreamer) Stream(samples [][2]float64) (n int, ok bool) {
+	s.mu.Lock()
+	for ; n < len(samples) && !s.ended; n++ {
+		l, r := s.GetNextSamples()
+		if s.ended {
+			break
+		}
+		// like Read, the mix is clamped to the 16-bit range
+		samples[n][0] = float64(clamp(l, math.MinInt16, math.MaxInt16)) / -math.MinInt16
+		samples[n][1] = float64(clamp(r, math.MinInt16, math.MaxInt16)) / -math.MinInt16
+	}
+	ok = n > 0 || !s.ended
+	s.mu.Unlock()
+	s.dispatch(0)
+	return n, ok
+}
+
+// Err implements the beep Streamer interface; rendering never fails
+func (s *BeepStreamer) Err() error {
+	return nil
+}
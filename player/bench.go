@@ -0,0 +1,86 @@
+package player
+
+import (
+	"runtime"
+	"time"
+
+	"github.com/b0nefish/go-modplayer/mod"
+)
+
+// BenchResult holds the timings of rendering a module with Benchmark
+type BenchResult struct {
+	Parse      time.Duration // loading the module (BenchmarkFile only)
+	Samples    int           // number of sample frames rendered
+	Audio      time.Duration // length of the rendered audio
+	Render     time.Duration // rendering the song
+	Replay     time.Duration // of which processing the lines and ticks (notes and effects)
+	Mixing     time.Duration // of which generating and mixing the samples of the channels
+	Resampling time.Duration // of which computing the sample values (estimated, see Benchmark)
+	Allocs     uint64        // heap allocations while rendering
+	AllocBytes uint64        // bytes allocated on the heap while rendering
+}
+
+// Realtime returns how many times faster than real time the song has been rendered
+func (br BenchResult) Realtime() float64 {
+	if br.Render <= 0 {
+		return 0
+	}
+	return br.Audio.Seconds() / br.Render.Seconds()
+}
+
+// silentResampler returns silence, for measuring the time spent in the other resamplers
+type silentResampler struct{}
+
+// Resample implements the Resampler interface
+func (silentResampler) Resample(ins *mod.Instrument, pos int, t float32) float32 {
+	return 0
+}
+
+// Benchmark renders the song as fast as possible (without output) and returns the time this took. The time
+// of the resampler is estimated as the difference to a second render with a resampler which doesn't read
+// the samples; it is 0 for the PaulaBLEP engine.
+func Benchmark(module mod.Module, opts PlayerOptions) BenchResult {
+	var br BenchResult
+	mp := NewPlayer(module, opts)
+	mp.replayTime = &br.Replay
+	var before, after runtime.MemStats
+	runtime.GC()
+	runtime.ReadMemStats(&before)
+	start := time.Now()
+	for mp.GetNextSamples(); !mp.ended; mp.GetNextSamples() {
+	}
+	br.Render = time.Since(start)
+	runtime.ReadMemStats(&after)
+	br.Samples = mp.sampleCnt
+	br.Audio = time.Duration(mp.sampleCnt) * time.Second / time.Duration(mp.rate)
+	br.Mixing = br.Render - br.Replay
+	br.Allocs, br.AllocBytes = after.Mallocs-before.Mallocs, after.TotalAlloc-before.TotalAlloc
+
+	if opts.Engine != PaulaBLEP {
+		opts.Resampler = silentResampler{}
+		var replay time.Duration
+		mp = NewPlayer(module, opts)
+		mp.replayTime = &replay
+		start = time.Now()
+		for mp.GetNextSamples(); !mp.ended; mp.GetNextSamples() {
+		}
+		if mixing := time.Since(start) - replay; mixing < br.Mixing {
+			br.Resampling = br.Mixing - mixing
+		}
+	}
+	return br
+}
+
+// BenchmarkFile loads the module file fn and renders it with Benchmark, also timing the loading
+func BenchmarkFile(fn string, opts PlayerOptions) (BenchResult, error) {
+	start := time.Now()
+	module, err := mod.LoadFile(fn)
+	if err != nil {
+		return BenchResult{}, err
+	}
+	defer module.Close()
+	parse := time.Since(start)
+	br := Benchmark(module, opts)
+	br.Parse = parse
+	return br, nil
+}
@@ -0,0 +1,175 @@
+package player
+
+import (
+	"math"
+	"math/cmplx"
+)
+
+// Engine determines how the samples of the channels are turned into the output
+type Engine int
+
+const (
+	// EngineResampler - the samples are resampled to the output rate with PlayerOptions.Resampler
+	EngineResampler Engine = iota
+	// PaulaBLEP - like the Amiga's Paula chip, each sample value is held until the next one (so the
+	// typical aliasing of the Amiga is kept); the steps between the values are band-limited (BLEP) to
+	// avoid the aliasing the output rate would add
+	PaulaBLEP
+)
+
+// The minimum-phase band-limited step used by PaulaBLEP: a windowed sinc with blepZeroCrossings zero
+// crossings on each side, oversampled blepOversampling times
+const (
+	blepZeroCrossings = 16
+	blepOversampling  = 64
+	blepRingLen       = 64 // length of the residual buffer of a channel (power of 2 >= 2*blepZeroCrossings)
+)
+
+// blepResidual is the difference of the band-limited step from the ideal step, from the moment of the step
+var blepResidual = makeMinBLEP(blepZeroCrossings, blepOversampling)
+
+// makeMinBLEP computes the residual of a minimum-phase band-limited step (Brandt's minBLEP): a windowed
+// sinc is converted to minimum phase by means of its real cepstrum and integrated
+func makeMinBLEP(zeroCrossings, oversampling int) []float64 {
+	n := zeroCrossings*2*oversampling + 1
+	size := 1
+	for size < n*4 {
+		size *= 2
+	}
+	buf := make([]complex128, size)
+	for i := 0; i < n; i++ {
+		x := float64(i-n/2) / float64(oversampling)
+		sinc := 1.0
+		if x != 0 {
+			sinc = math.Sin(math.Pi*x) / (math.Pi * x)
+		}
+		w := 0.42 - 0.5*math.Cos(2*math.Pi*float64(i)/float64(n-1)) + 0.08*math.Cos(4*math.Pi*float64(i)/float64(n-1))
+		buf[i] = complex(sinc*w, 0)
+	}
+
+	// real cepstrum
+	fft(buf, false)
+	for i, v := range buf {
+		buf[i] = complex(math.Log(cmplx.Abs(v)+1e-100), 0)
+	}
+	fft(buf, true)
+	// fold it into a causal cepstrum, which belongs to the minimum-phase version of the impulse
+	for i := 1; i < size/2; i++ {
+		buf[i] *= 2
+	}
+	for i := size/2 + 1; i < size; i++ {
+		buf[i] = 0
+	}
+	fft(buf, false)
+	for i, v := range buf {
+		buf[i] = cmplx.Exp(v)
+	}
+	fft(buf, true)
+
+	// integrate the impulse to a step, normalized to end at 1
+	step := make([]float64, n)
+	sum := 0.0
+	for i := range step {
+		sum += real(buf[i])
+		step[i] = sum
+	}
+	for i := range step {
+		step[i] = step[i]/sum - 1
+	}
+	return step
+}
+
+// fft transforms a (with a length which is a power of 2) in place with the radix-2 FFT; the inverse
+// transform is scaled by 1/len(a)
+func fft(a []complex128, inverse bool) {
+	n := len(a)
+	for i, j := 1, 0; i < n; i++ {
+		bit := n >> 1
+		for ; j&bit != 0; bit >>= 1 {
+			j ^= bit
+		}
+		j ^= bit
+		if i < j {
+			a[i], a[j] = a[j], a[i]
+		}
+	}
+	for length := 2; length <= n; length <<= 1 {
+		angle := 2 * math.Pi / float64(length)
+		if inverse {
+			angle = -angle
+		}
+		wl := cmplx.Rect(1, -angle)
+		for i := 0; i < n; i += length {
+			w := complex(1, 0)
+			for j := 0; j < length/2; j++ {
+				u, v := a[i+j], a[i+j+length/2]*w
+				a[i+j], a[i+j+length/2] = u+v, u-v
+				w *= wl
+			}
+		}
+	}
+	if inverse {
+		for i := range a {
+			a[i] /= complex(float64(n), 0)
+		}
+	}
+}
+
+// blep holds the band-limited step state of a channel: the held value and the residuals of the steps
+// still to be added to the next output values
+type blep struct {
+	last float64 // the value after the last step
+	ring [blepRingLen]float64
+	idx  int // position of the next output value in ring
+}
+
+// add adds a step to the value v, which happened frac output samples before the next output value
+func (b *blep) add(frac, v float64) {
+	amp := v - b.last
+	b.last = v
+	if amp == 0 {
+		return
+	}
+	f := frac * blepOversampling
+	for i := 0; i < blepRingLen; i++ {
+		j := int(f)
+		if j+1 >= len(blepResidual) {
+			break
+		}
+		t := f - float64(j)
+		b.ring[(b.idx+i)&(blepRingLen-1)] += amp * (blepResidual[j] + t*(blepResidual[j+1]-blepResidual[j]))
+		f += blepOversampling
+	}
+}
+
+// next returns the next output value
+func (b *blep) next() float64 {
+	v := b.last + b.ring[b.idx]
+	b.ring[b.idx] = 0
+	b.idx = (b.idx + 1) & (blepRingLen - 1)
+	return v
+}
+
+// nextBLEP is GetNextSample of the PaulaBLEP engine: it returns the held value of the channel (with the
+// band-limited steps) and advances the sample position, recording the steps to the sample values passed
+func (ch *Channel) nextBLEP() float64 {
+	if !ch.active || ch.note == nil || ch.note.Ins == nil || !ch.note.Ins.HasSample() {
+		ch.blep.add(0, 0)
+		return ch.blep.next()
+	}
+	ins := ch.note.Ins
+	// the channels are mixed at half the sample range
+	scale := float64(ch.VolumeProcessor.Next()*ch.envelope.volume) / 64 / 2
+	pos := int(ch.pos >> fracBits)
+	ch.blep.add(0, float64(sampleAt(ins, pos))*scale) // e.g. volume changes, retriggered notes
+	out := ch.blep.next()
+
+	start := ch.pos
+	ch.SetPeriod(ch.PeriodProcessor.Next())
+	ch.pos += ch.step
+	for k := pos + 1; int64(k)<<fracBits <= ch.pos; k++ {
+		ch.blep.add(1-float64(int64(k)<<fracBits-start)/float64(ch.step), float64(sampleAt(ins, k))*scale)
+	}
+	ch.checkSampleEnd()
+	return out
+}
@@ -0,0 +1,54 @@
+package player
+
+import "github.com/b0nefish/go-modplayer/mod"
+
+// amigaClock is the Amiga PAL clock frequency, which turns periods into sample rates
+const amigaClock = 3546894.6
+
+// ChannelInfo is the state of a channel of the replay engine, e.g. for visualizers and debuggers (see
+// Player.ChannelState). The period and volume are the ones of the current tick, without the vibrato
+// and tremolo added to every sample.
+type ChannelInfo struct {
+	Active     bool       // a sample is playing
+	Muted      bool       // muted by Mute/Solo or PlayerOptions.Channels
+	Instrument int        // number of the instrument of the playing note (0: none)
+	Period     int        // current period (with arpeggio)
+	Frequency  float64    // the rate at which the sample is played in Hz (0: no period)
+	Volume     int        // effective volume 0..64 (the channel volume with the instrument envelope)
+	Pan        float32    // panning of the output (0.0: left; 1.0: right)
+	Effect     mod.Effect // effect of the current line (also while it is applied at later ticks)
+}
+
+// updateInfo takes a snapshot of the channel state (called after every change at a tick or a line)
+func (ch *Channel) updateInfo() {
+	info := ChannelInfo{
+		Active: ch.active,
+		Period: ch.period,
+		Volume: clamp(ch.VolumeProcessor.volume, 0, 64) * ch.envelope.volume / 64,
+		Pan:    ch.outPan(),
+		Effect: ch.effect,
+	}
+	if ch.note != nil && ch.note.Ins != nil {
+		info.Instrument = ch.note.Ins.Num
+	}
+	if ch.arpeggio != nil {
+		info.Period = ch.arpeggio[ch.arpeggioIdx]
+	}
+	if info.Period > 0 {
+		info.Frequency = amigaClock / float64(info.Period)
+	}
+	ch.info = info
+}
+
+// ChannelState returns the state of channel ch (0-based) at the current tick; while playing through
+// the audio output, this is slightly ahead of the audio which is heard
+func (p *Player) ChannelState(ch int) ChannelInfo {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if ch < 0 || ch >= len(p.chans) {
+		return ChannelInfo{}
+	}
+	info := p.chans[ch].info
+	info.Muted = p.chans[ch].muted
+	return info
+}
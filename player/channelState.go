@@ -0,0 +1,80 @@
+package player
+
+import "github.com/b0nefish/go-modplayer/mod"
+
+// ChannelState holds the effect state of a channel which persists across notes: the vibrato and
+// tremolo waveforms, the "slide to note" parameters and the loop/retrig counters.
+// The Player creates one ChannelState per channel; the channel's PPU and VPU share it.
+type ChannelState struct {
+	Vibrato EffectWaveform // waveform for vibrato (4xy/6xy)
+	Tremolo EffectWaveform // waveform for tremolo (7xy)
+
+	portaTarget int  // target period for "slide to note"
+	portaSpeed  int  // speed of "slide to note" (set by 3xx, continued by 5xy)
+	glissando   bool // glissando flag (true - "slide to note" slides in halfnotes)
+
+	loopLine int // line to jump back to for pattern loops (E60)
+	loopCnt  int // remaining repetitions of the pattern loop (0 - no loop active)
+
+	tickCnt    int             // tick counter for note retrig/cut/delay
+	pendingIns *mod.Instrument // instrument to switch to when the current sample reaches its loop point
+
+	memory [mod.EffectTypeCnt]int // last nonzero effect parameter for each memory slot (indexed by EffectType)
+}
+
+// NewChannelState creates the effect state for a channel
+func NewChannelState(samplesPerTick int) *ChannelState {
+	return &ChannelState{
+		Vibrato: NewEffectWaveform(samplesPerTick),
+		Tremolo: NewEffectWaveform(samplesPerTick),
+	}
+}
+
+// PatternLoop handles the pattern loop E6y of the channel on the given line: E60 sets the loop start, E6y
+// with y > 0 plays the loop y more times. It returns the line to loop to, if the loop is repeated.
+// Like in ProTracker, the start isn't reset by a new pattern, and a loop left by a jump keeps its count
+// (so the next E6y continues counting down instead of starting a new loop).
+func (cs *ChannelState) PatternLoop(line, y int) (int, bool) {
+	if y == 0 {
+		cs.loopLine = line
+		return 0, false
+	}
+	if cs.loopCnt == 0 {
+		cs.loopCnt = y
+	} else {
+		cs.loopCnt--
+	}
+	return cs.loopLine, cs.loopCnt > 0
+}
+
+// Recall applies the effect memory to the given effect: if its parameter is 0, the last nonzero
+// parameter stored in the effect's memory slot is used instead (for vibrato and tremolo, both nibbles
+// are remembered separately). Which effects have a memory, and which share a slot, is defined by mem.
+func (cs *ChannelState) Recall(e mod.Effect, mem EffectMemory) mod.Effect {
+	slot, ok := mem[e.EffType]
+	if !ok {
+		return e
+	}
+	par, mask := e.Par(), 0xFF
+	if e.EffType >= mod.SetFilter {
+		// extended effects only have a single nibble as parameter
+		par, mask = e.ParY(), 0x0F
+	}
+	old := cs.memory[slot]
+	switch e.EffType {
+	case mod.Vibrato, mod.Tremolo:
+		if par&0xF0 == 0 {
+			par |= old & 0xF0
+		}
+		if par&0x0F == 0 {
+			par |= old & 0x0F
+		}
+	default:
+		if par == 0 {
+			par = old
+		}
+	}
+	cs.memory[slot] = par
+	e.EffCode = e.EffCode&^uint16(mask) | uint16(par)
+	return e
+}
@@ -0,0 +1,130 @@
+package player
+
+import (
+	"fmt"
+	"sort"
+
+	"github.com/b0nefish/go-modplayer/mod"
+)
+
+// OffsetMode determines what happens when a sample offset (9xx) points beyond the end of the sample
+type OffsetMode int
+
+const (
+	// OffsetSilence - the note is cut
+	OffsetSilence OffsetMode = iota
+	// OffsetLoop - playing starts at the loop start (unlooped samples are cut)
+	OffsetLoop
+	// OffsetDouble - ProTracker 1/2: a 900 which repeats the previous offset adds it twice (to the start
+	// of the sample, which the last 9xx has already moved), so it is doubled; an offset given with the
+	// note (9xx with xx > 0) is taken as it is. Past the end it behaves like OffsetLoop.
+	OffsetDouble
+)
+
+// EffectMemory maps effects to the memory slot in which their last nonzero parameter is remembered.
+// Effects mapped to the same slot share their memory; effects which are not in the map have no memory.
+type EffectMemory map[mod.EffectType]mod.EffectType
+
+// CompatProfile holds the settings for playback quirks in which the various trackers differ
+type CompatProfile struct {
+	Name           string
+	SampleOffset   OffsetMode // 9xx beyond the sample end (and 900 repeating the last offset)
+	InstrumentSwap bool       // an instrument number without a note swaps the sample at the loop point
+	Memory         EffectMemory
+	VBlank         bool                    // timing by the vertical blank: Fxx always sets the ticks per line
+	ArpeggioWrap   bool                    // arpeggio notes like ProTracker (see mod.ArpeggioPeriod)
+	DelayRetrig    bool                    // a note delay (EDx) without a note retriggers the playing note
+	LoopBreakLine  bool                    // a repeated loop (E6x) after a jump (Bxx/Dxx) on the line sets the line of the jump
+	Effects        map[mod.EffectType]bool // the effects played (nil: all), the others are ignored
+}
+
+// filter returns the effect e, or no effect if the profile doesn't play it
+func (cp *CompatProfile) filter(e mod.Effect) mod.Effect {
+	if cp.Effects != nil && !cp.Effects[e.EffType] {
+		return mod.Effect{}
+	}
+	return e
+}
+
+// ProTracker only remembers the parameters of a few effects, each in its own slot: 100, 200 and A00 do
+// nothing, and 5xy/6xy continue the slide to note/vibrato with the parameters of the last 3xx/4xy
+var ptMemory = EffectMemory{
+	mod.Portamento:      mod.Portamento,
+	mod.Vibrato:         mod.Vibrato,
+	mod.Tremolo:         mod.Tremolo,
+	mod.SetSampleOffset: mod.SetSampleOffset,
+}
+
+// later trackers remember (almost) everything, and the volume slide part of 5xy/6xy shares memory with Axy
+var genericMemory = EffectMemory{
+	mod.SlideUp:            mod.SlideUp,
+	mod.SlideDown:          mod.SlideDown,
+	mod.Portamento:         mod.Portamento,
+	mod.Vibrato:            mod.Vibrato,
+	mod.PortamentoVolSlide: mod.VolSlide,
+	mod.VibratoVolSlide:    mod.VolSlide,
+	mod.Tremolo:            mod.Tremolo,
+	mod.SetSampleOffset:    mod.SetSampleOffset,
+	mod.VolSlide:           mod.VolSlide,
+	mod.FineSlideUp:        mod.FineSlideUp,
+	mod.FineSlideDown:      mod.FineSlideDown,
+	mod.RetrigNote:         mod.RetrigNote,
+	mod.FineVolSlideUp:     mod.FineVolSlideUp,
+	mod.FineVolSlideDown:   mod.FineVolSlideDown,
+}
+
+// CompatProfiles contains all known compatibility profiles, indexed by name
+var CompatProfiles = map[string]CompatProfile{
+	"pt2":     {Name: "pt2", SampleOffset: OffsetDouble, InstrumentSwap: true, Memory: ptMemory, ArpeggioWrap: true, LoopBreakLine: true},
+	"pt3":     {Name: "pt3", SampleOffset: OffsetLoop, InstrumentSwap: true, Memory: ptMemory, ArpeggioWrap: true, LoopBreakLine: true},
+	"ft2":     {Name: "ft2", SampleOffset: OffsetSilence, Memory: genericMemory, DelayRetrig: true},
+	"generic": {Name: "generic", SampleOffset: OffsetSilence, Memory: genericMemory},
+	"st":      {Name: "st", SampleOffset: OffsetSilence, VBlank: true, Effects: mod.SoundtrackerEffects},
+}
+
+// DefaultCompat is the name of the profile used for MOD files (other than Soundtracker modules)
+const DefaultCompat = "pt2"
+
+// AutoCompat is the name for detecting the profile from the module (see DetectCompat)
+const AutoCompat = "auto"
+
+// DetectCompat returns the name of the compatibility profile for playing the module: "st" for old
+// Soundtracker modules with 15 instruments, "ft2" for XM files and MOD files with the signatures of
+// FastTracker (xCHN, xxCH), DefaultCompat for all other MOD files and "generic" for the other formats
+func DetectCompat(m mod.Module) string {
+	sig := string(m.Signature[:])
+	switch {
+	case m.IsSoundtracker():
+		return "st"
+	case m.Format == mod.FormatXM:
+		return "ft2"
+	case m.Format == mod.FormatMOD && (sig[1:] == "CHN" && sig != "4CHN" || sig[2:] == "CH"):
+		return "ft2"
+	case m.Format == mod.FormatMOD:
+		return DefaultCompat
+	}
+	return "generic"
+}
+
+// FindCompatProfile returns the compatibility profile with the given name. For AutoCompat (or an empty
+// name), it returns the zero profile, for which the Player detects the profile from the module.
+func FindCompatProfile(name string) (CompatProfile, error) {
+	if name == "" || name == AutoCompat {
+		return CompatProfile{}, nil
+	}
+	cp, ok := CompatProfiles[name]
+	if !ok {
+		return cp, fmt.Errorf("unknown compatibility profile %q (known: %v)", name, CompatProfileNames())
+	}
+	return cp, nil
+}
+
+// CompatProfileNames returns the sorted names of all known compatibility profiles
+func CompatProfileNames() []string {
+	names := make([]string, 0, len(CompatProfiles))
+	for name := range CompatProfiles {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
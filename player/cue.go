@@ -0,0 +1,76 @@
+package player
+
+import (
+	"fmt"
+	"io"
+	"time"
+
+	"github.com/b0nefish/go-modplayer/internal/errwriter"
+)
+
+// CueTrack is a single entry in a CueSheet
+type CueTrack struct {
+	Title     string
+	Performer string
+	Start     time.Duration // start of the track, relative to the start of the file
+}
+
+// CueSheet describes the tracks (modules of a playlist, or order positions of a single module)
+// contained in a rendered audio file
+type CueSheet struct {
+	Title  string
+	File   string // name of the audio file the cue sheet describes
+	End    time.Duration
+	Tracks []CueTrack
+}
+
+// cueTime formats a duration as mm:ss:ff (with 75 frames per second), as used in cue sheets
+func cueTime(d time.Duration) string {
+	frames := int64(d) * 75 / int64(time.Second)
+	return fmt.Sprintf("%02d:%02d:%02d", frames/75/60, frames/75%60, frames%75)
+}
+
+// WriteCue writes the cue sheet in the standard .cue format
+func (cs CueSheet) WriteCue(w io.Writer) error {
+	ew := errwriter.New(w)
+	ew.Printf("TITLE %q\n", cs.Title)
+	ew.Printf("FILE %q WAVE\n", cs.File)
+	for i, t := range cs.Tracks {
+		ew.Printf("  TRACK %02d AUDIO\n", i+1)
+		ew.Printf("    TITLE %q\n", t.Title)
+		if t.Performer != "" {
+			ew.Printf("    PERFORMER %q\n", t.Performer)
+		}
+		ew.Printf("    INDEX 01 %s\n", cueTime(t.Start))
+	}
+	return ew.Err
+}
+
+// WriteFFMetadata writes the cue sheet as an FFMETADATA file with one chapter per track, which ffmpeg
+// can add to m4a/ogg/mkv files (ffmpeg -i in.wav -i in.ffmeta -map_metadata 1 out.m4a)
+func (cs CueSheet) WriteFFMetadata(w io.Writer) error {
+	ew := errwriter.New(w)
+	ew.Printf(";FFMETADATA1\ntitle=%s\n", ffmetaEscape(cs.Title))
+	for i, t := range cs.Tracks {
+		end := cs.End
+		if i+1 < len(cs.Tracks) {
+			end = cs.Tracks[i+1].Start
+		}
+		ew.Printf("\n[CHAPTER]\nTIMEBASE=1/1000\nSTART=%d\nEND=%d\ntitle=%s\n",
+			t.Start.Milliseconds(), end.Milliseconds(), ffmetaEscape(t.Title))
+	}
+	return ew.Err
+}
+
+// ffmetaEscape escapes the characters which have a special meaning in FFMETADATA files
+func ffmetaEscape(s string) string {
+	var ret []rune
+	for _, c := range s {
+		switch c {
+		case '=', ';', '#', '\\', '\n':
+			ret = append(ret, '\\')
+		}
+		ret = append(ret, c)
+	}
+	return string(ret)
+}
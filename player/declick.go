@@ -0,0 +1,72 @@
+package player
+
+import "github.com/b0nefish/go-modplayer/mod"
+
+// declickRate is the number of ramps per second: each ramp lasts 1 ms
+const declickRate = 1000
+
+// declick ramps the volume of a channel, so that volume changes (Cxx, note cuts, ...) don't click, and
+// fades out the previous sound of the channel when a note is started: the declicking ramps
+// (PlayerOptions.NoDeclick)
+type declick struct {
+	len          int     // length of the ramps in samples (0: no ramps, the volume changes at once)
+	vol          float32 // the volume applied (0..64), moving towards target
+	target, step float32 // the volume of the channel, and the change of vol per sample to reach it
+
+	// the sound played when the note was started, faded out in len samples
+	tailIns  *mod.Instrument
+	tailPos  int64 // like Channel.pos and Channel.step
+	tailStep int64
+	tailVol  float32
+	tailPan  float32
+	tailLeft int // samples left of the fade out
+}
+
+// ramp moves the applied volume towards the volume of the channel target (0..64) and returns it
+func (d *declick) ramp(target float32) float32 {
+	if target != d.target {
+		d.target, d.step = target, (target-d.vol)/float32(d.len)
+	}
+	if d.vol != d.target {
+		d.vol += d.step
+		if d.step > 0 && d.vol > d.target || d.step < 0 && d.vol < d.target {
+			d.vol = d.target
+		}
+	}
+	return d.vol
+}
+
+// noteStarting is called before the sample of the channel is started (again): what it plays is faded
+// out, and the new note is faded in
+func (ch *Channel) noteStarting() {
+	d := &ch.declick
+	if d.len == 0 {
+		return
+	}
+	if ch.active && ch.note != nil && ch.note.Ins != nil && ch.note.Ins.HasSample() && d.vol > 0 {
+		d.tailIns, d.tailPos, d.tailStep, d.tailVol, d.tailPan = ch.note.Ins, ch.pos, ch.step, d.vol, ch.outPan()
+		d.tailLeft = d.len
+	}
+	d.vol, d.target = 0, 0
+}
+
+// tailSample returns the next sample of the sound which is faded out (0 if there is none)
+func (ch *Channel) tailSample() (l, r int) {
+	d := &ch.declick
+	if d.tailLeft == 0 {
+		return 0, 0
+	}
+	ins := d.tailIns
+	pos, t := int(d.tailPos>>fracBits), float32(d.tailPos&(fracOne-1))/fracOne
+	val := ch.resample(ins, pos, t) / 2 * d.tailVol * float32(d.tailLeft) / float32(d.len)
+	d.tailLeft--
+	d.tailPos += d.tailStep
+	if d.tailPos >= int64(ins.Len-2)<<fracBits {
+		if ins.RepLen > 2 {
+			d.tailPos = int64(ins.RepStart+2) << fracBits
+		} else {
+			d.tailLeft = 0
+		}
+	}
+	return int(val * (1 - d.tailPan)), int(val * d.tailPan)
+}
@@ -0,0 +1,96 @@
+package player
+
+import (
+	"fmt"
+	"math"
+	"math/rand"
+	"sort"
+	"time"
+)
+
+// Dither is the dithering of the mix when it is rendered with 16 bits (RenderOptions.Dither)
+type Dither int
+
+// The kinds of dithering
+const (
+	DitherNone   Dither = iota // the mix is truncated to 16 bits
+	DitherTPDF                 // noise with a triangular distribution (±1 LSB) is added before rounding
+	DitherShaped               // TPDF, with the quantization noise shaped towards high frequencies
+)
+
+var ditherNames = map[Dither]string{
+	DitherNone:   "none",
+	DitherTPDF:   "tpdf",
+	DitherShaped: "shaped",
+}
+
+func (d Dither) String() string {
+	if name, ok := ditherNames[d]; ok {
+		return name
+	}
+	return fmt.Sprintf("Dither(%d)", int(d))
+}
+
+// DitherNames returns the names of the kinds of dithering, sorted
+func DitherNames() []string {
+	names := make([]string, 0, len(ditherNames))
+	for _, name := range ditherNames {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// ParseDither returns the dithering with the given name (none, tpdf or shaped)
+func ParseDither(name string) (Dither, error) {
+	for d, n := range ditherNames {
+		if n == name {
+			return d, nil
+		}
+	}
+	return 0, fmt.Errorf("unknown dither %q (known: %v)", name, DitherNames())
+}
+
+// ditherer quantizes the precise mix to 16 bits
+type ditherer struct {
+	shaped bool
+	rnd    *rand.Rand
+	err    [2]float64 // the last quantization error of each channel, fed back by DitherShaped
+}
+
+// newDitherer returns the ditherer for d (nil for DitherNone); the noise is random, unless seed != 0
+func newDitherer(d Dither, seed int64) *ditherer {
+	if d == DitherNone {
+		return nil
+	}
+	if seed == 0 {
+		seed = time.Now().UnixNano()
+	}
+	return &ditherer{shaped: d == DitherShaped, rnd: rand.New(rand.NewSource(seed))}
+}
+
+// quantize returns the value x of channel c rounded to 16 bits with dither
+func (d *ditherer) quantize(c int, x float64) int {
+	if d.shaped {
+		// first-order error feedback: the noise rises with the frequency, it is lower where hearing is
+		// more sensitive
+		x -= d.err[c]
+	}
+	y := math.Round(x + d.rnd.Float64() - d.rnd.Float64())
+	d.err[c] = y - x
+	return clamp(int(y), math.MinInt16, math.MaxInt16)
+}
+
+// preciseMix scales the mix like nextSamples, recording the fractions for dithering in p.precise
+func (p *Player) preciseMix(mix [2]int, g float64) (int, int) {
+	for c := range mix {
+		x := float64(mix[c]) * g * float64(p.globalVol) / float64(p.mixDiv)
+		if p.ledUsed {
+			if fx := p.led.process(c, x); p.ledOn {
+				x = fx
+			}
+		}
+		p.precise[c] = x
+	}
+	return int(p.precise[0]), int(p.precise[1])
+}
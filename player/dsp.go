@@ -0,0 +1,293 @@
+package player
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// DSP is an effect which processes the mix of a Player (PlayerOptions.DSP, SetDSP), before the master
+// stage. Process gets interleaved stereo frames (left, right) with the 16-bit range as -1..1 and changes
+// them in place, a block at a time (usually the frames of a Read); the number of frames may change from
+// call to call.
+type DSP interface {
+	Process(buf []float32)
+}
+
+// SetDSP replaces the chain of effects applied to the mix, in the given order; it may be called while
+// playing
+func (p *Player) SetDSP(chain ...DSP) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.dsp = append([]DSP(nil), chain...)
+}
+
+// dspBlockLen is the number of frames processed by the effects at a time when the Player isn't read
+// (but its samples are taken one by one with GetNextSamples)
+const dspBlockLen = 1024
+
+// dspBlock holds the mix processed by the effects in a block, which is returned frame by frame
+type dspBlock struct {
+	buf    []float32 // the processed frames (left and right interleaved)
+	pos    int       // the next frame returned
+	frames int       // the number of frames of the current Read (0: dspBlockLen)
+	done   bool      // the song has ended in the block
+}
+
+// reset drops the processed frames (e.g. after seeking)
+func (b *dspBlock) reset() {
+	b.buf, b.pos, b.done = b.buf[:0], 0, false
+}
+
+// pending reports whether processed frames are waiting to be returned
+func (b *dspBlock) pending() bool {
+	return b.pos < len(b.buf)/2 || b.done
+}
+
+// dspSamples returns the next samples of the mix after the effects. The chain runs once per block: the
+// frames of the current Read are rendered ahead and processed together (frame by frame while the stems
+// are recorded, which have to stay in step with the mix).
+func (p *Player) dspSamples() (float64, float64) {
+	b := &p.dspOut
+	if b.pos >= len(b.buf)/2 {
+		if b.done {
+			p.ended = true
+			return 0, 0
+		}
+		n := b.frames
+		if n < 1 {
+			n = dspBlockLen
+		}
+		if p.stems != nil {
+			n = 1
+		}
+		b.buf, b.pos = b.buf[:0], 0
+		for i := 0; i < n; i++ {
+			x, y := p.mixSamples()
+			if p.ended {
+				b.done = true
+				break
+			}
+			b.buf = append(b.buf, float32(x/-math.MinInt16), float32(y/-math.MinInt16))
+		}
+		if len(b.buf) == 0 {
+			return 0, 0
+		}
+		for _, d := range p.dsp {
+			d.Process(b.buf)
+		}
+	}
+	p.ended = false // until the processed frames have been returned
+	x, y := b.buf[2*b.pos], b.buf[2*b.pos+1]
+	b.pos++
+	return float64(x) * -math.MinInt16, float64(y) * -math.MinInt16
+}
+
+// delayLine is a ring buffer of values, delayed by its length
+type delayLine struct {
+	buf []float32
+	pos int
+}
+
+func newDelayLine(samples int) delayLine {
+	if samples < 1 {
+		samples = 1
+	}
+	return delayLine{buf: make([]float32, samples)}
+}
+
+// next returns the value delayed by the length of the line and stores x
+func (dl *delayLine) next(x float32) float32 {
+	y := dl.buf[dl.pos]
+	dl.buf[dl.pos] = x
+	if dl.pos++; dl.pos == len(dl.buf) {
+		dl.pos = 0
+	}
+	return y
+}
+
+// Crossfeed mixes each side into the other, delayed and low-pass filtered like the sound of a speaker
+// reaching the far ear: the classic "Amiga surround" for the hard-panned channels of MOD files, e.g. on
+// headphones
+type Crossfeed struct {
+	Amount float64 // level of the other side (0..1)
+	delay  [2]delayLine
+	lp     biquad
+}
+
+// NewCrossfeed returns a Crossfeed with the given amount at the sample rate rate
+func NewCrossfeed(amount float64, rate int) *Crossfeed {
+	n := rate * 3 / 10000 // 0.3 ms
+	return &Crossfeed{Amount: amount, delay: [2]delayLine{newDelayLine(n), newDelayLine(n)}, lp: newLowpass(700, rate)}
+}
+
+// Process implements the DSP interface
+func (c *Crossfeed) Process(buf []float32) {
+	a := float32(c.Amount)
+	for i := 0; i+1 < len(buf); i += 2 {
+		l, r := buf[i], buf[i+1]
+		fl := float32(c.lp.process(0, float64(c.delay[0].next(r))))
+		fr := float32(c.lp.process(1, float64(c.delay[1].next(l))))
+		buf[i], buf[i+1] = (l+a*fl)/(1+a), (r+a*fr)/(1+a)
+	}
+}
+
+// The delays of the comb and allpass filters of the Reverb (in samples at 44.1 kHz, from Freeverb), and
+// the spread of the right side
+var (
+	reverbCombs     = [...]int{1116, 1277, 1422, 1557}
+	reverbAllpasses = [...]int{556, 225}
+)
+
+const reverbSpread = 23
+
+// Reverb is a simple reverberation (a Freeverb with fewer filters): parallel damped comb filters followed
+// by allpass filters for each side
+type Reverb struct {
+	Amount   float64 // level of the reverberated sound (0..1)
+	combs    [2][len(reverbCombs)]delayLine
+	damped   [2][len(reverbCombs)]float32 // the low-passed feedback of the combs
+	allpass  [2][len(reverbAllpasses)]delayLine
+	feedback float32
+}
+
+// NewReverb returns a Reverb with the given amount at the sample rate rate
+func NewReverb(amount float64, rate int) *Reverb {
+	rv := &Reverb{Amount: amount, feedback: 0.84}
+	scale := func(n int) int { return n * rate / 44100 }
+	for ch := range rv.combs {
+		for i, n := range reverbCombs {
+			rv.combs[ch][i] = newDelayLine(scale(n + ch*reverbSpread))
+		}
+		for i, n := range reverbAllpasses {
+			rv.allpass[ch][i] = newDelayLine(scale(n + ch*reverbSpread))
+		}
+	}
+	return rv
+}
+
+// Process implements the DSP interface
+func (rv *Reverb) Process(buf []float32) {
+	const damp = 0.2
+	a := float32(rv.Amount)
+	for i := range buf {
+		ch := i % 2
+		x := buf[i] * 0.1 // the combs add up to a much higher level
+		var wet float32
+		for j := range rv.combs[ch] {
+			y := rv.combs[ch][j].buf[rv.combs[ch][j].pos]
+			rv.damped[ch][j] = y*(1-damp) + rv.damped[ch][j]*damp
+			rv.combs[ch][j].next(x + rv.damped[ch][j]*rv.feedback)
+			wet += y
+		}
+		for j := range rv.allpass[ch] {
+			ap := &rv.allpass[ch][j]
+			y := ap.buf[ap.pos]
+			ap.next(wet + y/2)
+			wet = y - wet
+		}
+		buf[i] += a * wet
+	}
+}
+
+// Echo repeats the sound after a delay, fading with each repetition
+type Echo struct {
+	Amount   float64 // level of the first repetition (0..1)
+	Feedback float64 // level of each repetition relative to the previous one (0..1)
+	delay    [2]delayLine
+}
+
+// NewEcho returns an Echo with the given amount, delay and feedback at the sample rate rate
+func NewEcho(amount float64, delay time.Duration, feedback float64, rate int) *Echo {
+	n := int(delay * time.Duration(rate) / time.Second)
+	return &Echo{Amount: amount, Feedback: feedback, delay: [2]delayLine{newDelayLine(n), newDelayLine(n)}}
+}
+
+// Process implements the DSP interface
+func (e *Echo) Process(buf []float32) {
+	a, f := float32(e.Amount), float32(e.Feedback)
+	for i := range buf {
+		dl := &e.delay[i%2]
+		y := dl.buf[dl.pos]
+		dl.next(buf[i] + y*f)
+		buf[i] += a * y
+	}
+}
+
+// Widener changes the stereo width: the difference of the sides is amplified by 1+Amount (negative
+// amounts down to -1 narrow the stereo image, -1 is mono)
+type Widener struct {
+	Amount float64
+}
+
+// Process implements the DSP interface
+func (w Widener) Process(buf []float32) {
+	f := float32(1 + w.Amount)
+	for i := 0; i+1 < len(buf); i += 2 {
+		mid, side := (buf[i]+buf[i+1])/2, (buf[i]-buf[i+1])/2*f
+		buf[i], buf[i+1] = mid+side, mid-side
+	}
+}
+
+// EQ boosts or cuts the bass (below 100 Hz) and the treble (above 8 kHz) with shelving filters
+type EQ struct {
+	Bass, Treble float64 // in dB
+	low, high    biquad
+}
+
+// NewEQ returns an EQ with the given changes of the bass and the treble (in dB) at the sample rate rate
+func NewEQ(bass, treble float64, rate int) *EQ {
+	return &EQ{Bass: bass, Treble: treble, low: newShelf(100, bass, false, rate), high: newShelf(8000, treble, true, rate)}
+}
+
+// Process implements the DSP interface
+func (eq *EQ) Process(buf []float32) {
+	for i := range buf {
+		ch := i % 2
+		buf[i] = float32(eq.high.process(ch, eq.low.process(ch, float64(buf[i]))))
+	}
+}
+
+// DSPNames returns the names of the built-in effects for ParseDSP
+func DSPNames() []string {
+	return []string{"crossfeed", "reverb", "echo", "widen", "bass", "treble"}
+}
+
+// ParseDSP returns the chain of built-in effects given by spec at the sample rate rate: comma-separated
+// effects with their amount, e.g. "reverb:0.3,widen:0.5". The amounts of bass and treble are in dB (e.g.
+// "bass:6"), echo repeats after 300 ms.
+func ParseDSP(spec string, rate int) ([]DSP, error) {
+	if rate <= 0 {
+		rate = SampleRate
+	}
+	var chain []DSP
+	for _, fx := range strings.Split(spec, ",") {
+		if fx = strings.TrimSpace(fx); fx == "" {
+			continue
+		}
+		name, value, _ := strings.Cut(fx, ":")
+		amount, err := strconv.ParseFloat(value, 64)
+		if err != nil {
+			return nil, fmt.Errorf("invalid amount %q of effect %s", value, name)
+		}
+		switch name {
+		case "crossfeed", "surround":
+			chain = append(chain, NewCrossfeed(amount, rate))
+		case "reverb":
+			chain = append(chain, NewReverb(amount, rate))
+		case "echo":
+			chain = append(chain, NewEcho(amount, 300*time.Millisecond, 0.4, rate))
+		case "widen":
+			chain = append(chain, Widener{Amount: amount})
+		case "bass":
+			chain = append(chain, NewEQ(amount, 0, rate))
+		case "treble":
+			chain = append(chain, NewEQ(0, amount, rate))
+		default:
+			return nil, fmt.Errorf("unknown effect %q (known: %v)", name, DSPNames())
+		}
+	}
+	return chain, nil
+}
@@ -0,0 +1,39 @@
+package player
+
+import (
+	"io"
+	"math"
+
+	"github.com/b0nefish/go-modplayer/mod"
+)
+
+// EbitenStream is the soundtrack of an Ebitengine game (github.com/hajimehoshi/ebiten/v2/audio): a Stream
+// for audio.Context.NewPlayer, with PlayerOptions.Rate set to the rate of the audio context. With loop,
+// the song is played forever: its loop (Bxx) over and over again, or the whole song.
+//
+// The event callbacks (OnRow, ...) are called when Ebitengine reads the audio, which is ahead of the
+// audio heard by the buffer of its player (see audio.Player.SetBufferSize). See examples/ebiten.
+type EbitenStream struct {
+	*Stream
+	loop bool
+}
+
+// NewEbitenStream creates an EbitenStream playing the module with the given options
+func NewEbitenStream(module mod.Module, opts PlayerOptions, loop bool) *EbitenStream {
+	if loop {
+		opts.Loops = math.MaxInt32
+	}
+	return &EbitenStream{Stream: NewStream(module, opts), loop: loop}
+}
+
+// Read implements io.Reader
+func (s *EbitenStream) Read(buf []byte) (int, error) {
+	n, err := s.Stream.Read(buf)
+	if err == io.EOF && s.loop {
+		// the song has ended without a loop: start it again
+		if err = s.SeekOrder(s.opts.Start, 0); err == nil {
+			return s.Stream.Read(buf)
+		}
+	}
+	return n, err
+}
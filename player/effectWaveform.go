@@ -0,0 +1,199 @@
+package player
+
+import (
+	"math"
+	"math/rand"
+)
+
+/*
+
+4XY
+
+VIBRATO means to "oscillate the sample pitch using a  particular waveform
+with amplitude yyyy notes, such that (xxxx * speed)/64  full oscillations
+occur in the line".  The waveform to use in vibrating is set using effect
+E4 (see  below). By  placing vibrato  effects on  consecutive lines,  the
+vibrato effect can be sustained for  any length of time.  If  either xxxx
+or yyyy are 0,  then values from  the most recent  prior vibrato will  be
+used.
+
+An example is: mod.Note C-3, with xxxx=12 and yyyy=1 when speed=8.  This will
+play tones  around  C-3,  vibrating through  D-3  and  B-2 to  C-3  again
+(amplitude  yyyy  is 1), with (12*8)/64 = 1.5 full oscillations per line.
+
+8 /
+
+(x*sp)/64 = 2𝛑
+
+Please see effect E4 for the waveform to use for vibrating.
+
+FIXME: notes or HALF-NOTES (SEMITONES)?
+
+
+7XY
+
+TREMOLO means to "oscillate the sample volume using a particular waveform
+with   amplitude   yyyy*(speed-1),   such   that   (xxxx*speed)/64   full
+oscillations occur in the line".  The waveform to use to oscillate is set
+using the  effect  E7  (see  below).    By  placing  tremolo  effects  on
+consecutive lines, the tremolo effect can be sustained for any  length of
+time.  If either  xxxx or yyyy are  0, then values  from the most  recent
+prior tremolo will be used.
+
+The usage of this effect is similar to that of effect 4:mod.Vibrato.
+
+*/
+
+// WaveformType is the type of the envelope waveform used for vibrato/tremolo
+type WaveformType int
+
+const (
+	// Sine - sine waveform
+	Sine WaveformType = iota
+	// RampDown - "sawtooth" waveform
+	RampDown
+	// Square - square wave
+	Square
+	// Random - select one of Sine/RampDown/Square randomly
+	Random
+)
+
+// vibratoTable is the sine table of ProTracker: the magnitude of the first half of a sine cycle in 32 steps
+var vibratoTable = [32]int{
+	0, 24, 49, 74, 97, 120, 141, 161, 180, 197, 212, 224, 235, 244, 250, 253,
+	255, 253, 250, 244, 235, 224, 212, 197, 180, 161, 141, 120, 97, 74, 49, 24,
+}
+
+// waveformLen is the length of a waveform cycle in positions (the x of 4xy/7xy is added per tick)
+const waveformLen = 64
+
+// EffectWaveform contains the parameters for a waveform assigned to an effect
+type EffectWaveform struct {
+	SamplesPerTick int
+	Smooth         bool // "hi-fi" mode: advance the waveform with every sample and compute it with math.Sin
+
+	Active bool
+
+	Type   WaveformType
+	Retrig bool
+
+	CurType   WaveformType // the type played (picked at each note for Random)
+	Pos       float64      // position in the waveform (waveformLen per cycle)
+	Step      float64      // the position is advanced by Step with each tick
+	Amplitude float64      // the value at the peak of the waveform is Amplitude*255/div
+
+	div      float64    // divisor of the waveform values (255 if 0)
+	skipTick bool       // the waveform is not applied on the current tick (the first tick of a line, for vibrato)
+	rnd      *rand.Rand // for picking the type of Random waveforms
+}
+
+// DoStep gets the next value for our waveform
+func (ew *EffectWaveform) DoStep() int {
+	if !ew.Active {
+		return 0
+	}
+	div := ew.div
+	if div == 0 {
+		div = 255
+	}
+	pos := math.Floor(ew.Pos)
+	if ew.Smooth {
+		ew.Pos = math.Mod(ew.Pos+ew.Step/float64(ew.SamplesPerTick), waveformLen)
+		if ew.CurType == Sine {
+			return int(math.Round(ew.Amplitude * 255 / div * math.Sin(ew.Pos*2*math.Pi/waveformLen)))
+		}
+		pos = ew.Pos
+	} else if ew.skipTick {
+		return 0
+	}
+	half := waveformLen / 2
+	var value float64
+	switch ew.CurType {
+	case Sine:
+		value = float64(vibratoTable[int(pos)%half])
+	case RampDown:
+		// like ProTracker: rising in the first half, from -255 in the second (added to the period, this is
+		// a falling pitch)
+		value = math.Mod(pos, float64(half)) * 8
+		if pos >= float64(half) {
+			value = 255 - value
+		}
+	default:
+		value = 255
+	}
+	// like ProTracker, the magnitude is truncated
+	value = math.Trunc(math.Floor(value) * ew.Amplitude / div)
+	if pos >= float64(half) {
+		value = -value
+	}
+	return int(value)
+}
+
+// Tick advances the waveform to the next tick (not after a skipped tick)
+func (ew *EffectWaveform) Tick() {
+	if ew.skipTick {
+		ew.skipTick = false
+		return
+	}
+	if ew.Active && !ew.Smooth {
+		ew.Pos = math.Mod(ew.Pos+ew.Step, waveformLen)
+	}
+}
+
+// NoteTriggered restarts the waveform at a new note, unless its retrig flag has been cleared (E4x/E7x with
+// x >= 4). A Random waveform gets a new type.
+func (ew *EffectWaveform) NoteTriggered() {
+	if ew.Retrig {
+		ew.Pos = 0
+	}
+	if ew.Type == Random && ew.rnd != nil {
+		ew.CurType = WaveformType(ew.rnd.Intn(int(Random)))
+	}
+}
+
+func (ew *EffectWaveform) initWaveform(X, amplitude int) {
+	ew.Active = true
+	if X > 0 && amplitude > 0 {
+		if ew.Type != Random {
+			ew.CurType = ew.Type
+		}
+		ew.Step = float64(X)
+		ew.Amplitude = float64(amplitude)
+	}
+}
+
+// InitTremoloWaveform (re)initializes a waveform for a tremolo (volume) effect: the amplitude is Y*(tempo-1)
+// volume units, i.e. Y for each tick of the line after the first
+func (ew *EffectWaveform) InitTremoloWaveform(X, Y, tempo int) {
+	ew.initWaveform(X, Y*(tempo-1))
+}
+
+// InitVibratoWaveform initializes a waveform for a vibrato (pitch) effect. Like in ProTracker, the period
+// changes by table value * Y / 128, on all ticks of the line but the first.
+func (ew *EffectWaveform) InitVibratoWaveform(X, Y int) {
+	ew.div = 128
+	ew.skipTick = true
+	ew.initWaveform(X, Y)
+}
+
+// DecodeWaveformType sets the type of an EffectWaveform from a "set waveform" command parameter par
+func (ew *EffectWaveform) DecodeWaveformType(par int) {
+	ew.Retrig = par < 4
+	switch par {
+	case 0, 4:
+		ew.Type = Sine
+	case 1, 5:
+		ew.Type = RampDown
+	case 2, 6:
+		ew.Type = Square
+	case 3, 7:
+		ew.Type = Random
+	}
+}
+
+// NewEffectWaveform creates a new EffectWaveform
+func NewEffectWaveform(SamplesPerTick int) (ew EffectWaveform) {
+	ew.SamplesPerTick = SamplesPerTick
+	ew.DecodeWaveformType(0)
+	return
+}
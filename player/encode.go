@@ -0,0 +1,124 @@
+package player
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/b0nefish/go-modplayer/mod"
+)
+
+// AudioInfo describes the rendered audio given to an Encoder
+type AudioInfo struct {
+	Rate     int
+	Channels int
+	Format   SampleFormat
+	Tags     []string // metadata as Vorbis comments ("TITLE=...", see ModuleTags)
+}
+
+// Encoder writes the rendered audio (PCM in the format given by AudioInfo) in a file format
+type Encoder interface {
+	Encode(w io.Writer, r io.Reader, info AudioInfo) error
+}
+
+// Encoders contains the encoders used by RenderFile, indexed by the extension of the file name. OGG
+// Vorbis is encoded by ffmpeg, which has to be installed.
+var Encoders = map[string]Encoder{
+	".wav":  WAVEncoder{},
+	".flac": FLACEncoder{},
+	".ogg":  FFmpegEncoder{Args: []string{"-c:a", "libvorbis", "-q:a", "6", "-f", "ogg"}},
+}
+
+// EncoderExtensions returns the file name extensions which RenderFile can write, sorted
+func EncoderExtensions() []string {
+	exts := make([]string, 0, len(Encoders))
+	for ext := range Encoders {
+		exts = append(exts, ext)
+	}
+	sort.Strings(exts)
+	return exts
+}
+
+// WAVEncoder writes WAV files (see WriteWAVFormat, the loop of the song is marked); the output has to be
+// seekable. The tags aren't written.
+type WAVEncoder struct{}
+
+// Encode implements Encoder
+func (WAVEncoder) Encode(w io.Writer, r io.Reader, info AudioInfo) error {
+	ws, ok := w.(io.WriteSeeker)
+	if !ok {
+		return errors.New("WAV: the output has to be seekable")
+	}
+	return WriteWAVFormat(ws, r, info.Rate, info.Channels, info.Format)
+}
+
+// FFmpegEncoder pipes the audio through ffmpeg, which writes it with the given codec and container
+// arguments (e.g. -c:a libvorbis -f ogg) to its stdout
+type FFmpegEncoder struct {
+	FFmpeg string // path to the ffmpeg binary (default: "ffmpeg" from the PATH)
+	Args   []string
+}
+
+// ffmpegSampleFormats are the names of the raw sample formats for ffmpeg
+var ffmpegSampleFormats = map[SampleFormat]string{
+	FormatInt16:   "s16le",
+	FormatInt24:   "s24le",
+	FormatInt32:   "s32le",
+	FormatFloat32: "f32le",
+}
+
+// Encode implements Encoder
+func (e FFmpegEncoder) Encode(w io.Writer, r io.Reader, info AudioInfo) error {
+	ffmpeg := e.FFmpeg
+	if ffmpeg == "" {
+		ffmpeg = "ffmpeg"
+	}
+	args := []string{"-loglevel", "error", "-f", ffmpegSampleFormats[info.Format],
+		"-ar", strconv.Itoa(info.Rate), "-ac", strconv.Itoa(info.Channels), "-i", "-"}
+	for _, tag := range info.Tags {
+		if key, val, ok := strings.Cut(tag, "="); ok {
+			args = append(args, "-metadata", strings.ToLower(key)+"="+val)
+		}
+	}
+	args = append(args, e.Args...)
+	cmd := exec.Command(ffmpeg, append(args, "-")...)
+	cmd.Stdin, cmd.Stdout, cmd.Stderr = r, w, os.Stderr
+	if err := cmd.Run(); err != nil {
+		return fmt.Errorf("ffmpeg failed: %v", err)
+	}
+	return nil
+}
+
+// ModuleTags returns the metadata of a module for an encoder: its name as TITLE and the sample names (in
+// which MODs usually carry a message) as COMMENT
+func ModuleTags(module mod.Module) []string {
+	var tags []string
+	if name := strings.TrimSpace(module.Name); name != "" {
+		tags = append(tags, "TITLE="+name)
+	}
+	var lines []string
+	for i := 1; i < len(module.Instruments); i++ {
+		lines = append(lines, strings.TrimRight(module.Instruments[i].Name, " "))
+	}
+	if msg := strings.Trim(strings.Join(lines, "\n"), "\n"); msg != "" {
+		tags = append(tags, "COMMENT="+msg)
+	}
+	return tags
+}
+
+// RenderFile renders a module into the file fn, in the format given by its extension (see Encoders),
+// like RenderWAV
+func RenderFile(module mod.Module, fn string, opts RenderOptions) error {
+	enc, ok := Encoders[strings.ToLower(filepath.Ext(fn))]
+	if !ok {
+		return fmt.Errorf("unsupported file type %q (known: %v)", filepath.Ext(fn), EncoderExtensions())
+	}
+	_, err := renderFile(module, fn, opts, enc)
+	return err
+}
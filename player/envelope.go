@@ -0,0 +1,46 @@
+package player
+
+// envelope holds the state of the volume envelope and fadeout of a channel (XM and IT instruments)
+type envelope struct {
+	tick      int  // position in the envelope
+	released  bool // the note has been released (key off): the sustain point is left and the fadeout starts
+	fade      int  // fadeout volume (65536 = full volume)
+	keyOffCnt int  // ticks until the note is released (Kxx); 0 if not pending
+	volume    int  // resulting volume factor (0..64)
+}
+
+// startEnvelope restarts the envelope for a new note
+func (ch *Channel) startEnvelope() {
+	ch.envelope = envelope{fade: 65536, volume: 64}
+	if env := ch.note.Ins.Envelope; env != nil {
+		ch.envelope.volume = env.Value(0)
+	}
+}
+
+// release releases the note: instruments with an envelope continue after the sustain point and fade out,
+// all others are cut
+func (ch *Channel) release() {
+	ch.released = true
+	if ch.note == nil || ch.note.Ins.Envelope == nil {
+		ch.VolumeProcessor.volume = 0
+	}
+}
+
+// envelopeOnTick advances the envelope and the fadeout
+func (ch *Channel) envelopeOnTick() {
+	ins := ch.note.Ins
+	env := ins.Envelope
+	if env == nil {
+		return
+	}
+	if env.Sustain < 0 || ch.released || ch.envelope.tick != env.Points[env.Sustain].Tick {
+		ch.envelope.tick++
+		if env.LoopEnd >= 0 && ch.envelope.tick >= env.Points[env.LoopEnd].Tick {
+			ch.envelope.tick = env.Points[env.LoopStart].Tick
+		}
+	}
+	if ch.released {
+		ch.fade = clamp(ch.fade-ins.FadeOut, 0, 65536)
+	}
+	ch.envelope.volume = env.Value(ch.envelope.tick) * ch.fade / 65536
+}
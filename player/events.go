@@ -0,0 +1,77 @@
+package player
+
+import "github.com/b0nefish/go-modplayer/mod"
+
+// event is a callback waiting until the audio at its sample position is heard
+type event struct {
+	sample int
+	call   func()
+}
+
+// OnRow sets a function which is called for every row played (e.g. to sync graphics or gameplay to the
+// music); nil removes it. Like the other event callbacks, it is called when the row is heard (while
+// playing through the audio output) or after Read has rendered it, never with the Player locked, so it
+// may call the methods of the Player.
+func (p *Player) OnRow(f func(order, pattern, row int)) {
+	p.mu.Lock()
+	p.onRow = f
+	p.mu.Unlock()
+}
+
+// OnOrderChange sets a function which is called when the player starts playing an order (a position in
+// the pattern table): at the start, after the end of a pattern and after jumps to another order
+func (p *Player) OnOrderChange(f func(order, pattern int)) {
+	p.mu.Lock()
+	p.onOrderChange = f
+	p.mu.Unlock()
+}
+
+// OnNoteTrigger sets a function which is called when a channel starts playing a note (also a delayed
+// one, see EDx)
+func (p *Player) OnNoteTrigger(f func(ch int, note mod.Note)) {
+	p.mu.Lock()
+	p.onNoteTrigger = f
+	p.mu.Unlock()
+}
+
+// queue adds a callback for the current sample position (p.mu must be held)
+func (p *Player) queue(call func()) {
+	p.events = append(p.events, event{p.sampleCnt, call})
+}
+
+// lineEvents queues the row and order events of the line starting now (p.mu must be held)
+func (p *Player) lineEvents(ls LineStart) {
+	if f := p.onOrderChange; f != nil && (len(p.history) < 2 || p.history[len(p.history)-2].Order != ls.Order) {
+		p.queue(func() { f(ls.Order, ls.Pattern) })
+	}
+	if f := p.onRow; f != nil {
+		p.queue(func() { f(ls.Order, ls.Pattern, ls.Line) })
+	}
+}
+
+// noteEvent queues a note event if channel ch has started a new note since it played prev (p.mu must
+// be held)
+func (p *Player) noteEvent(ch int, prev *mod.Note) {
+	if f, note := p.onNoteTrigger, p.chans[ch].note; f != nil && note != nil && note != prev {
+		n := *note
+		p.queue(func() { f(ch, n) })
+	}
+}
+
+// dispatch calls the callbacks of the events which are heard, latency samples before the end of the
+// rendered audio (p.mu must not be held)
+func (p *Player) dispatch(latency int) {
+	p.mu.Lock()
+	heard := p.sampleCnt - latency
+	i := 0
+	for i < len(p.events) && p.events[i].sample <= heard {
+		i++
+	}
+	due := p.events[:i:i]
+	p.events = p.events[i:]
+	p.mu.Unlock()
+
+	for _, e := range due {
+		e.call()
+	}
+}
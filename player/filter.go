@@ -0,0 +1,71 @@
+package player
+
+import "math"
+
+// LEDMode determines whether the Amiga "LED" low-pass filter is emulated
+type LEDMode int
+
+const (
+	// LEDAuto - the filter is switched by the E0x commands of MOD files (off at the start of the song)
+	LEDAuto LEDMode = iota
+	// LEDOff - the filter is never used
+	LEDOff
+	// LEDOn - the filter is always used
+	LEDOn
+)
+
+// ledCutoff is the cutoff frequency (in Hz) of the Amiga LED filter, a 2-pole Butterworth low-pass
+const ledCutoff = 3300
+
+// biquad is a second-order IIR filter for the two stereo channels (direct form I)
+type biquad struct {
+	b0, b1, b2, a1, a2 float64
+	x1, x2, y1, y2     [2]float64
+}
+
+// newLowpass returns a Butterworth low-pass filter with the cutoff frequency freq at the sample rate rate
+func newLowpass(freq float64, rate int) biquad {
+	w := 2 * math.Pi * freq / float64(rate)
+	alpha := math.Sin(w) / math.Sqrt2 // Q = 1/sqrt(2)
+	a0 := 1 + alpha
+	b1 := (1 - math.Cos(w)) / a0
+	return biquad{b0: b1 / 2, b1: b1, b2: b1 / 2, a1: -2 * math.Cos(w) / a0, a2: (1 - alpha) / a0}
+}
+
+// process filters the next value x of the stereo channel ch (0: left, 1: right)
+func (f *biquad) process(ch int, x float64) float64 {
+	y := f.b0*x + f.b1*f.x1[ch] + f.b2*f.x2[ch] - f.a1*f.y1[ch] - f.a2*f.y2[ch]
+	f.x2[ch], f.x1[ch] = f.x1[ch], x
+	f.y2[ch], f.y1[ch] = f.y1[ch], y
+	return y
+}
+
+// ledFilter applies the LED filter to the mixed output if it is switched on. While it is off, its state
+// still follows the output, so switching it on doesn't click.
+func (p *Player) ledFilter(l, r int) (int, int) {
+	fl, fr := p.led.process(0, float64(l)), p.led.process(1, float64(r))
+	if !p.ledOn {
+		return l, r
+	}
+	return int(math.Round(fl)), int(math.Round(fr))
+}
+
+// newShelf returns a shelving filter (with a slope of 12 dB per octave) which changes the level below
+// (high == false) or above the frequency freq by gain dB
+func newShelf(freq, gain float64, high bool, rate int) biquad {
+	A := math.Pow(10, gain/40)
+	w := 2 * math.Pi * freq / float64(rate)
+	cos, beta := math.Cos(w), math.Sin(w)*math.Sqrt(A) // 2*sqrt(A)*alpha with S = 1
+	sign := 1.0
+	if high {
+		sign = -1
+	}
+	a0 := (A + 1) + sign*(A-1)*cos + beta
+	return biquad{
+		b0: A * ((A + 1) - sign*(A-1)*cos + beta) / a0,
+		b1: sign * 2 * A * ((A - 1) - sign*(A+1)*cos) / a0,
+		b2: A * ((A + 1) - sign*(A-1)*cos - beta) / a0,
+		a1: -sign * 2 * ((A - 1) + sign*(A+1)*cos) / a0,
+		a2: ((A + 1) + sign*(A-1)*cos - beta) / a0,
+	}
+}
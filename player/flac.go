@@ -0,0 +1,353 @@
+package player
+
+import (
+	"crypto/md5"
+	"encoding/binary"
+	"errors"
+	"hash"
+	"io"
+	"math/bits"
+)
+
+// FLACEncoder encodes the rendered audio as a FLAC file; the samples are predicted with the fixed
+// polynomial predictors of FLAC (orders 0-4) and the residuals Rice coded. Only integer samples up to
+// 24 bits can be encoded.
+type FLACEncoder struct {
+	BlockSize int // number of samples per channel in a frame (0: 4096)
+}
+
+// flacVendor is the vendor string of the Vorbis comment block
+const flacVendor = "go-modplayer"
+
+// Encode implements Encoder. If w is seekable, the length and the MD5 sum of the audio are filled in at
+// the end (otherwise they are left open, which FLAC allows).
+func (e FLACEncoder) Encode(w io.Writer, r io.Reader, info AudioInfo) error {
+	if info.Format != FormatInt16 && info.Format != FormatInt24 {
+		return errors.New("FLAC: only 16-bit and 24-bit samples are supported")
+	}
+	blockSize := e.BlockSize
+	if blockSize <= 0 || blockSize > 65535 {
+		blockSize = 4096
+	}
+	fe := flacStream{w: w, info: info, blockSize: blockSize, bps: info.Format.Bytes() * 8, sum: md5.New()}
+	if err := fe.writeHeader(); err != nil {
+		return err
+	}
+
+	frameLen := info.Format.Bytes() * info.Channels
+	buf := make([]byte, blockSize*frameLen)
+	for {
+		n, err := io.ReadFull(r, buf)
+		n -= n % frameLen
+		if n > 0 {
+			fe.sum.Write(buf[:n])
+			if werr := fe.writeFrame(buf[:n]); werr != nil {
+				return werr
+			}
+		}
+		if err == io.EOF || err == io.ErrUnexpectedEOF {
+			break
+		}
+		if err != nil {
+			return err
+		}
+	}
+	if ws, ok := w.(io.WriteSeeker); ok {
+		// the STREAMINFO block starts after "fLaC" and the block header
+		if _, err := ws.Seek(8, io.SeekStart); err != nil {
+			return err
+		}
+		if _, err := ws.Write(fe.streamInfo()); err != nil {
+			return err
+		}
+		_, err := ws.Seek(0, io.SeekEnd)
+		return err
+	}
+	return nil
+}
+
+// flacStream holds the state of a FLAC stream being encoded
+type flacStream struct {
+	w         io.Writer
+	info      AudioInfo
+	blockSize int
+	bps       int       // bits per sample
+	frame     uint64    // number of the next frame
+	samples   uint64    // samples per channel written so far
+	minFrame  int       // size of the smallest frame in bytes
+	maxFrame  int       // size of the largest frame in bytes
+	sum       hash.Hash // MD5 of the unencoded samples
+
+	// buffers reused for every frame
+	bw        flacBitWriter
+	block     []int64    // the samples of a channel
+	residuals [5][]int64 // the residuals of the predictors (by order)
+}
+
+// streamInfo returns the STREAMINFO metadata block (without its header)
+func (fe *flacStream) streamInfo() []byte {
+	var bw flacBitWriter
+	bw.write(uint64(fe.blockSize), 16)
+	bw.write(uint64(fe.blockSize), 16)
+	bw.write(uint64(fe.minFrame), 24)
+	bw.write(uint64(fe.maxFrame), 24)
+	bw.write(uint64(fe.info.Rate), 20)
+	bw.write(uint64(fe.info.Channels-1), 3)
+	bw.write(uint64(fe.bps-1), 5)
+	bw.write(fe.samples, 36)
+	data := bw.bytes()
+	if fe.samples > 0 {
+		data = fe.sum.Sum(data)
+	} else {
+		data = append(data, make([]byte, md5.Size)...)
+	}
+	return data
+}
+
+// writeHeader writes the stream marker, the STREAMINFO block and the Vorbis comments with the tags
+func (fe *flacStream) writeHeader() error {
+	info := fe.streamInfo()
+	comments := binary.LittleEndian.AppendUint32(nil, uint32(len(flacVendor)))
+	comments = append(comments, flacVendor...)
+	comments = binary.LittleEndian.AppendUint32(comments, uint32(len(fe.info.Tags)))
+	for _, tag := range fe.info.Tags {
+		comments = binary.LittleEndian.AppendUint32(comments, uint32(len(tag)))
+		comments = append(comments, tag...)
+	}
+
+	data := []byte("fLaC")
+	data = append(data, 0, 0, 0, byte(len(info))) // STREAMINFO
+	data = append(data, info...)
+	data = append(data, 0x80|4, byte(len(comments)>>16), byte(len(comments)>>8), byte(len(comments))) // last block: VORBIS_COMMENT
+	data = append(data, comments...)
+	_, err := fe.w.Write(data)
+	return err
+}
+
+// writeFrame encodes a block of interleaved samples as a frame
+func (fe *flacStream) writeFrame(data []byte) error {
+	channels, size := fe.info.Channels, fe.info.Format.Bytes()
+	n := len(data) / (channels * size)
+
+	bw := &fe.bw
+	bw.buf, bw.acc, bw.nacc = bw.buf[:0], 0, 0
+	bw.write(0xFFF8, 16)            // sync code, fixed block size
+	bw.write(7, 4)                  // block size: 16 bit at the end of the header
+	bw.write(0, 4)                  // sample rate: from STREAMINFO
+	bw.write(uint64(channels-1), 4) // independent channels
+	bw.write(0, 4)                  // sample size: from STREAMINFO; reserved bit
+	bw.writeUTF8(fe.frame)
+	bw.write(uint64(n-1), 16)
+	bw.write(uint64(flacCRC8(bw.bytes())), 8)
+
+	if cap(fe.block) < n {
+		fe.block = make([]int64, n)
+	}
+	samples := fe.block[:n]
+	for ch := 0; ch < channels; ch++ {
+		for i := range samples {
+			pos := (i*channels + ch) * size
+			if size == 3 {
+				samples[i] = int64(int32(uint32(data[pos])<<8|uint32(data[pos+1])<<16|uint32(data[pos+2])<<24) >> 8)
+			} else {
+				samples[i] = int64(int16(binary.LittleEndian.Uint16(data[pos:])))
+			}
+		}
+		bw.writeSubframe(samples, fe.bps, &fe.residuals)
+	}
+	bw.align()
+	bw.write(uint64(flacCRC16(bw.bytes())), 16)
+
+	frame := bw.bytes()
+	if fe.frame == 0 || len(frame) < fe.minFrame {
+		fe.minFrame = len(frame)
+	}
+	if len(frame) > fe.maxFrame {
+		fe.maxFrame = len(frame)
+	}
+	fe.frame++
+	fe.samples += uint64(n)
+	_, err := fe.w.Write(frame)
+	return err
+}
+
+// writeSubframe writes the samples of a channel as a constant subframe (silence) or with the fixed
+// predictor which gives the smallest residuals (computed into the buffers res)
+func (bw *flacBitWriter) writeSubframe(samples []int64, bps int, res *[5][]int64) {
+	constant := true
+	for _, s := range samples {
+		constant = constant && s == samples[0]
+	}
+	if constant {
+		bw.write(0, 8) // SUBFRAME_CONSTANT
+		bw.writeSigned(samples[0], bps)
+		return
+	}
+
+	order, residuals := 0, samples
+	best := uint64(1<<63 - 1)
+	for o := 0; o <= 4 && o < len(samples); o++ {
+		res[o] = flacResiduals(res[o], samples, o)
+		var sum uint64
+		for _, v := range res[o] {
+			if v < 0 {
+				v = -v
+			}
+			sum += uint64(v)
+		}
+		if sum < best {
+			order, residuals, best = o, res[o], sum
+		}
+	}
+	bw.write(uint64(0x08|order)<<1, 8) // SUBFRAME_FIXED with the order
+	for _, s := range samples[:order] {
+		bw.writeSigned(s, bps)
+	}
+
+	// a single partition with the Rice parameter giving the fewest bits
+	k := 0
+	if len(residuals) > 0 && best > uint64(len(residuals)) {
+		k = bits.Len64(best/uint64(len(residuals))) - 1
+	}
+	cost := func(k int) (c uint64) {
+		for _, v := range residuals {
+			c += flacZigzag(v)>>k + 1 + uint64(k)
+		}
+		return
+	}
+	for k > 0 && cost(k-1) < cost(k) {
+		k--
+	}
+	for k < 14 && cost(k+1) < cost(k) {
+		k++
+	}
+	bw.write(0, 2) // Rice coding with a 4-bit parameter
+	bw.write(0, 4) // partition order 0
+	bw.write(uint64(k), 4)
+	for _, v := range residuals {
+		u := flacZigzag(v)
+		for q := u >> k; q > 0; q-- {
+			bw.write(0, 1)
+		}
+		bw.write(1, 1)
+		bw.write(u, k)
+	}
+}
+
+// flacResiduals returns the residuals of the fixed predictor of the given order (for the samples after
+// the warm-up samples), reusing the buffer res
+func flacResiduals(res, s []int64, order int) []int64 {
+	if cap(res) < len(s)-order {
+		res = make([]int64, len(s)-order)
+	}
+	res = res[:len(s)-order]
+	for i := order; i < len(s); i++ {
+		var p int64
+		switch order {
+		case 1:
+			p = s[i-1]
+		case 2:
+			p = 2*s[i-1] - s[i-2]
+		case 3:
+			p = 3*s[i-1] - 3*s[i-2] + s[i-3]
+		case 4:
+			p = 4*s[i-1] - 6*s[i-2] + 4*s[i-3] - s[i-4]
+		}
+		res[i-order] = s[i] - p
+	}
+	return res
+}
+
+// flacZigzag maps a signed residual to an unsigned value (0, -1, 1, -2, ... -> 0, 1, 2, 3, ...)
+func flacZigzag(v int64) uint64 {
+	return uint64(v<<1 ^ v>>63)
+}
+
+// flacBitWriter collects a bit stream, most significant bit first
+type flacBitWriter struct {
+	buf  []byte
+	acc  uint64 // bits not written to buf yet
+	nacc int    // number of bits in acc
+}
+
+// write appends the n lowest bits of v
+func (bw *flacBitWriter) write(v uint64, n int) {
+	for n > 0 {
+		c := n
+		if c > 32 {
+			c = 32
+		}
+		n -= c
+		bw.acc = bw.acc<<c | v>>n&(1<<c-1)
+		bw.nacc += c
+		for bw.nacc >= 8 {
+			bw.nacc -= 8
+			bw.buf = append(bw.buf, byte(bw.acc>>bw.nacc))
+		}
+	}
+}
+
+// writeSigned appends v as a two's complement number with n bits
+func (bw *flacBitWriter) writeSigned(v int64, n int) {
+	bw.write(uint64(v)&(1<<n-1), n)
+}
+
+// writeUTF8 appends v coded like UTF-8 (extended to 36 bits), as used for the frame numbers
+func (bw *flacBitWriter) writeUTF8(v uint64) {
+	if v < 0x80 {
+		bw.write(v, 8)
+		return
+	}
+	n := 2 // number of bytes
+	for v >= 1<<(5*n+1) {
+		n++
+	}
+	bw.write(0xFF<<(8-n)&0xFF|v>>(6*(n-1)), 8)
+	for i := n - 2; i >= 0; i-- {
+		bw.write(0x80|v>>(6*i)&0x3F, 8)
+	}
+}
+
+// align pads the stream with zero bits to a whole byte
+func (bw *flacBitWriter) align() {
+	if bw.nacc > 0 {
+		bw.write(0, 8-bw.nacc)
+	}
+}
+
+// bytes returns the complete bytes written so far
+func (bw *flacBitWriter) bytes() []byte {
+	return bw.buf
+}
+
+// flacCRC8 returns the CRC-8 (polynomial x^8 + x^2 + x + 1) of the frame header
+func flacCRC8(data []byte) byte {
+	var crc byte
+	for _, b := range data {
+		crc ^= b
+		for i := 0; i < 8; i++ {
+			if crc&0x80 != 0 {
+				crc = crc<<1 ^ 0x07
+			} else {
+				crc <<= 1
+			}
+		}
+	}
+	return crc
+}
+
+// flacCRC16 returns the CRC-16 (polynomial x^16 + x^15 + x^2 + 1) of the frame
+func flacCRC16(data []byte) uint16 {
+	var crc uint16
+	for _, b := range data {
+		crc ^= uint16(b) << 8
+		for i := 0; i < 8; i++ {
+			if crc&0x8000 != 0 {
+				crc = crc<<1 ^ 0x8005
+			} else {
+				crc <<= 1
+			}
+		}
+	}
+	return crc
+}
@@ -0,0 +1,93 @@
+package player
+
+import (
+	"encoding/binary"
+	"fmt"
+	"math"
+)
+
+// SampleFormat is the format of the samples in the rendered audio (always little endian)
+type SampleFormat int
+
+// Sample formats of the rendered audio
+const (
+	FormatInt16   SampleFormat = iota // 16-bit signed (default)
+	FormatInt24                       // 24-bit signed
+	FormatInt32                       // 32-bit signed
+	FormatFloat32                     // 32-bit float, normalized to -1..1 (loud mixes may exceed it, they aren't clipped)
+)
+
+var sampleFormatNames = map[SampleFormat]string{
+	FormatInt16:   "int16",
+	FormatInt24:   "int24",
+	FormatInt32:   "int32",
+	FormatFloat32: "float32",
+}
+
+func (f SampleFormat) String() string {
+	if name, ok := sampleFormatNames[f]; ok {
+		return name
+	}
+	return fmt.Sprintf("SampleFormat(%d)", int(f))
+}
+
+// ParseSampleFormat returns the sample format with the given name (int16, int24, int32 or float32)
+func ParseSampleFormat(name string) (SampleFormat, error) {
+	for f, n := range sampleFormatNames {
+		if n == name {
+			return f, nil
+		}
+	}
+	return 0, fmt.Errorf("unknown sample format %q (known: int16, int24, int32, float32)", name)
+}
+
+// Bytes returns the size of a sample in bytes
+func (f SampleFormat) Bytes() int {
+	switch f {
+	case FormatInt24:
+		return 3
+	case FormatInt32, FormatFloat32:
+		return 4
+	}
+	return 2
+}
+
+// put stores the mixed value v (in the 16-bit range, which loud mixes may exceed) at the start of buf
+func (f SampleFormat) put(buf []byte, v int) {
+	if f == FormatFloat32 {
+		binary.LittleEndian.PutUint32(buf, math.Float32bits(float32(v)/-math.MinInt16))
+		return
+	}
+	// channels playing loudly at the same time may exceed the 16-bit range
+	v = clamp(v, math.MinInt16, math.MaxInt16)
+	switch f {
+	case FormatInt24:
+		v <<= 8
+		buf[0], buf[1], buf[2] = byte(v), byte(v>>8), byte(v>>16)
+	case FormatInt32:
+		binary.LittleEndian.PutUint32(buf, uint32(int32(v<<16)))
+	default:
+		binary.LittleEndian.PutUint16(buf, uint16(int16(v)))
+	}
+}
+
+// SetFormat sets the format of the audio returned by Read: the sample format and the number of channels
+// (1: mono, a mix of both sides; 2: stereo). It doesn't change the format of the audio output (Play),
+// which always gets 16-bit stereo.
+func (p *Player) SetFormat(f SampleFormat, channels int) error {
+	if _, ok := sampleFormatNames[f]; !ok {
+		return fmt.Errorf("unknown sample format %v", f)
+	}
+	if channels != 1 && channels != 2 {
+		return fmt.Errorf("unsupported number of channels %d (1: mono, 2: stereo)", channels)
+	}
+	p.mu.Lock()
+	p.format, p.outChannels = f, channels
+	p.mu.Unlock()
+	return nil
+}
+
+// frameSize returns the size of a frame (the samples of all channels) returned by Read
+func (p *Player) frameSize() int {
+	return p.format.Bytes() * p.outChannels
+}
@@ -0,0 +1,96 @@
+package player
+
+import (
+	"math"
+	"time"
+)
+
+// gainRampTime is the time in which a gain change is applied completely (instead of at once, which clicks)
+const gainRampTime = 10 * time.Millisecond
+
+// gain is a volume factor (1.0: unchanged) which follows changes with a short linear ramp
+type gain struct {
+	cur, target float64
+	step        float64 // change per sample while ramping
+}
+
+// newGain returns a gain with the factor f
+func newGain(f float64) gain {
+	return gain{cur: f, target: f}
+}
+
+// set starts ramping to the factor f (negative factors are treated as 0), reached after gainRampTime at
+// the given sample rate
+func (g *gain) set(f float64, rate int) {
+	if f < 0 {
+		f = 0
+	}
+	g.target = f
+	g.step = (g.target - g.cur) / (float64(rate) * gainRampTime.Seconds())
+	if g.step == 0 {
+		g.cur = g.target
+	}
+}
+
+// next returns the factor for the next sample
+func (g *gain) next() float64 {
+	if g.cur != g.target {
+		g.cur += g.step
+		if (g.step > 0 && g.cur > g.target) || (g.step < 0 && g.cur < g.target) {
+			g.cur = g.target
+		}
+	}
+	return g.cur
+}
+
+// SetVolume sets the master volume (1.0: unchanged, 0: silent; values above 1 amplify and may clip). The
+// change is ramped over a few milliseconds, so it can be used for fades while playing.
+func (p *Player) SetVolume(v float64) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.volume.set(v, p.rate)
+}
+
+// Volume returns the master volume set with SetVolume
+func (p *Player) Volume() float64 {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.volume.target
+}
+
+// SetChannelGain sets the volume factor of the channel ch (0-based; 1.0: unchanged), ramped like SetVolume
+func (p *Player) SetChannelGain(ch int, g float64) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if ch >= 0 && ch < len(p.chans) {
+		p.chans[ch].gain.set(g, p.rate)
+	}
+}
+
+// ChannelGain returns the volume factor of the channel ch (0-based) set with SetChannelGain
+func (p *Player) ChannelGain(ch int) float64 {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if ch < 0 || ch >= len(p.chans) {
+		return 0
+	}
+	return p.chans[ch].gain.target
+}
+
+// FadeCurve is the shape of the fade out at the end of the song (PlayerOptions.FadeOut)
+type FadeCurve int
+
+// The fade curves
+const (
+	FadeLinear      FadeCurve = iota // the volume decreases linearly
+	FadeExponential                  // the volume decreases by the same number of dB per second, by 60 dB in all
+)
+
+// fadeGain returns the volume factor of a fade out with the given number of samples left of length samples
+func (c FadeCurve) fadeGain(left, length int) float64 {
+	f := float64(left) / float64(length)
+	if c == FadeExponential {
+		return math.Pow(10, -3*(1-f))
+	}
+	return f
+}
@@ -0,0 +1,166 @@
+package player
+
+import (
+	"fmt"
+	"math"
+	"sort"
+
+	"github.com/b0nefish/go-modplayer/mod"
+)
+
+// Resampler computes the values of a sample between its sample points, when the sample is played at a
+// rate which differs from the output rate
+type Resampler interface {
+	// Resample returns the value (-128..127) of the sample of ins at the position pos + t (0 <= t < 1)
+	Resample(ins *mod.Instrument, pos int, t float32) float32
+}
+
+// sampleAt returns the sample value at position pos of ins; positions beyond the end continue at the
+// loop start (or repeat the first/last value for unlooped samples)
+func sampleAt(ins *mod.Instrument, pos int) int8 {
+	if pos >= ins.Len && ins.RepLen > 2 {
+		pos = ins.RepStart + (pos-ins.RepStart)%ins.RepLen
+	}
+	switch {
+	case pos < 0:
+		pos = 0
+	case pos >= ins.Len:
+		pos = ins.Len - 1
+	}
+	return ins.At(pos)
+}
+
+// NearestResampler uses the value of the last sample point (like the Amiga's Paula chip, without filtering)
+type NearestResampler struct{}
+
+// Resample implements the Resampler interface
+func (NearestResampler) Resample(ins *mod.Instrument, pos int, t float32) float32 {
+	return float32(sampleAt(ins, pos))
+}
+
+// LinearResampler interpolates linearly between the two neighbouring sample points
+type LinearResampler struct{}
+
+// Resample implements the Resampler interface
+func (LinearResampler) Resample(ins *mod.Instrument, pos int, t float32) float32 {
+	return InterpolateLinear(0, sampleAt(ins, pos), sampleAt(ins, pos+1), 0, t)
+}
+
+// CubicResampler interpolates with a cubic Hermite spline through the four surrounding sample points
+type CubicResampler struct{}
+
+// Resample implements the Resampler interface
+func (CubicResampler) Resample(ins *mod.Instrument, pos int, t float32) float32 {
+	return InterpolateHermite4pt3oX(sampleAt(ins, pos-1), sampleAt(ins, pos), sampleAt(ins, pos+1), sampleAt(ins, pos+2), t)
+}
+
+// sincPhases is the number of fractional positions for which the filter kernel of a SincResampler is
+// computed in advance
+const sincPhases = 256
+
+// SincResampler interpolates with a windowed sinc filter (Blackman window): the best quality, at the cost of
+// reading Taps sample points for every output value
+type SincResampler struct {
+	Taps   int
+	kernel [][]float32 // the filter kernels per phase
+}
+
+// NewSincResampler returns a SincResampler with the given number of taps (rounded up to an even number,
+// at least 4)
+func NewSincResampler(taps int) *SincResampler {
+	if taps < 4 {
+		taps = 4
+	}
+	taps = (taps + 1) &^ 1
+	sr := &SincResampler{Taps: taps, kernel: make([][]float32, sincPhases+1)}
+	for p := range sr.kernel {
+		t := float64(p) / sincPhases
+		sr.kernel[p] = make([]float32, taps)
+		for i := range sr.kernel[p] {
+			x := float64(i-taps/2+1) - t // distance of the tap from the position
+			w := 0.42 + 0.5*math.Cos(math.Pi*x/float64(taps/2)) + 0.08*math.Cos(2*math.Pi*x/float64(taps/2))
+			sinc := 1.0
+			if x != 0 {
+				sinc = math.Sin(math.Pi*x) / (math.Pi * x)
+			}
+			sr.kernel[p][i] = float32(sinc * w)
+		}
+	}
+	return sr
+}
+
+// Resample implements the Resampler interface
+func (sr *SincResampler) Resample(ins *mod.Instrument, pos int, t float32) float32 {
+	k := sr.kernel[int(t*sincPhases+.5)]
+	var v float32
+	for i, c := range k {
+		v += c * float32(sampleAt(ins, pos+i-sr.Taps/2+1))
+	}
+	return v
+}
+
+// resample is ch.resampler.Resample with direct calls of the built-in resamplers, which don't need an
+// interface call for every sample (and can be inlined)
+func (ch *Channel) resample(ins *mod.Instrument, pos int, t float32) float32 {
+	switch r := ch.resampler.(type) {
+	case LinearResampler:
+		return r.Resample(ins, pos, t)
+	case CubicResampler:
+		return r.Resample(ins, pos, t)
+	case NearestResampler:
+		return r.Resample(ins, pos, t)
+	case *SincResampler:
+		return r.Resample(ins, pos, t)
+	}
+	return ch.resampler.Resample(ins, pos, t)
+}
+
+// Resamplers contains the built-in resamplers, indexed by name
+var Resamplers = map[string]Resampler{
+	"nearest": NearestResampler{},
+	"linear":  LinearResampler{},
+	"cubic":   CubicResampler{},
+	"sinc":    NewSincResampler(16),
+}
+
+// DefaultResampler is the name of the resampler used if PlayerOptions.Resampler is nil
+const DefaultResampler = "linear"
+
+// ResamplerNames returns the names of the built-in resamplers, sorted
+func ResamplerNames() []string {
+	names := make([]string, 0, len(Resamplers))
+	for name := range Resamplers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// FindResampler returns the built-in resampler with the given name
+func FindResampler(name string) (Resampler, error) {
+	r, ok := Resamplers[name]
+	if !ok {
+		return nil, fmt.Errorf("unknown resampler %q (known: %v)", name, ResamplerNames())
+	}
+	return r, nil
+}
+
+// InterpolateNone interpolates the output waveform by not interpolating at all
+func InterpolateNone(x0, x1, x2, x3 int8, t float32) float32 {
+	return float32(x1)
+}
+
+// InterpolateLinear interpolates the output waveform with linear interpolation between x1 and x2
+func InterpolateLinear(x0, x1, x2, x3 int8, t float32) float32 {
+	return float32(x1) + t*(float32(x2)-float32(x1))
+}
+
+// InterpolateHermite4pt3oX interpolates the output waveform with Hermite interpolation between x1 and x2
+func InterpolateHermite4pt3oX(x0, x1, x2, x3 int8, t float32) float32 {
+	f0, f1, f2, f3 := float32(x0), float32(x1), float32(x2), float32(x3)
+	c0 := f1
+	c1 := (f2 - f0) * .5
+	c2 := f0 - f1*2.5 + f2*2 - f3*.5
+	c3 := (f3-f0)*.5 + (f1-f2)*1.5
+	return ((c3*t+c2)*t+c1)*t + c0
+}
@@ -0,0 +1,201 @@
+package player
+
+import (
+	"fmt"
+	"math"
+	"sort"
+)
+
+// Limiter is the master stage which keeps loud mixes from distorting (PlayerOptions.Limiter)
+type Limiter int
+
+// The master stages
+const (
+	LimitNone      Limiter = iota // the mix is clipped to the range of the sample format (except FormatFloat32)
+	LimitClip                     // the mix is clipped to the 16-bit range (also for FormatFloat32)
+	LimitSoft                     // loud parts are saturated smoothly towards the 16-bit range (rounded peaks)
+	LimitLookahead                // the volume is turned down shortly before loud parts (and recovers slowly)
+)
+
+var limiterNames = map[Limiter]string{
+	LimitNone:      "none",
+	LimitClip:      "clip",
+	LimitSoft:      "soft",
+	LimitLookahead: "lookahead",
+}
+
+func (l Limiter) String() string {
+	if name, ok := limiterNames[l]; ok {
+		return name
+	}
+	return fmt.Sprintf("Limiter(%d)", int(l))
+}
+
+// LimiterNames returns the names of the master stages, sorted
+func LimiterNames() []string {
+	names := make([]string, 0, len(limiterNames))
+	for _, name := range limiterNames {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// ParseLimiter returns the master stage with the given name (none, clip, soft or lookahead)
+func ParseLimiter(name string) (Limiter, error) {
+	for l, n := range limiterNames {
+		if n == name {
+			return l, nil
+		}
+	}
+	return 0, fmt.Errorf("unknown limiter %q (known: %v)", name, LimiterNames())
+}
+
+const (
+	limitCeiling = math.MaxInt16 // the highest output level of the limiters
+	softKnee     = 0.5           // LimitSoft: the level (relative to limitCeiling) above which it saturates
+	lookaheadLen = 2             // LimitLookahead: milliseconds by which the gain is reduced before a peak
+	releaseTime  = 0.1           // LimitLookahead: seconds in which the gain recovers by 63%
+)
+
+// master is the master stage of a Player: the headroom and the limiter
+type master struct {
+	mode Limiter
+	gain float64 // the headroom as a factor
+
+	// LimitLookahead: the samples rendered ahead (n..n+len(ahead)-1, n is returned next) and the gains
+	// which keep them below the ceiling; the gain applied is the average of the held minimum of the latter
+	// over the last len(holds) samples, so it is reduced smoothly and in time
+	ahead   [][2]float64
+	need    []float64
+	first   int // index of sample n in ahead and need
+	cnt     int // number of samples in ahead
+	holds   []float64
+	holdPos int
+	holdSum float64
+	hold    float64 // the last held minimum
+	release float64 // part of the remaining gain reduction which is released with each sample
+	done    bool    // the song has ended, the samples ahead are returned
+}
+
+// newMaster returns the master stage for the options and the sample rate
+func newMaster(opts PlayerOptions, rate int) master {
+	m := master{mode: opts.Limiter, gain: math.Pow(10, -opts.Headroom/20)}
+	if m.mode == LimitLookahead {
+		n := rate*lookaheadLen/1000 + 1
+		m.ahead, m.need, m.holds = make([][2]float64, n+1), make([]float64, n+1), make([]float64, n)
+		m.release = 1 - math.Exp(-1/(releaseTime*float64(rate)))
+		m.reset()
+	}
+	return m
+}
+
+// active reports whether the master stage changes the mix
+func (m *master) active() bool {
+	return m.mode != LimitNone || m.gain != 1
+}
+
+// reset forgets the samples ahead and releases the gain reduction (e.g. after seeking)
+func (m *master) reset() {
+	m.first, m.cnt, m.done = 0, 0, false
+	for i := range m.holds {
+		m.holds[i] = 1
+	}
+	m.holdPos, m.holdSum, m.hold = 0, float64(len(m.holds)), 1
+}
+
+// process applies the headroom and LimitClip or LimitSoft to a sample
+func (m *master) process(x float64) float64 {
+	x *= m.gain
+	switch m.mode {
+	case LimitClip:
+		x = math.Max(-limitCeiling, math.Min(x, limitCeiling))
+	case LimitSoft:
+		if a := math.Abs(x) / limitCeiling; a > softKnee {
+			// continues the line with the slope 1 at the knee, approaching the ceiling
+			a = softKnee + (1-softKnee)*math.Tanh((a-softKnee)/(1-softKnee))
+			x = math.Copysign(a*limitCeiling, x)
+		}
+	}
+	return x
+}
+
+// push adds a rendered sample to the samples ahead (LimitLookahead)
+func (m *master) push(l, r float64) {
+	i := (m.first + m.cnt) % len(m.ahead)
+	m.ahead[i] = [2]float64{l * m.gain, r * m.gain}
+	m.need[i] = 1
+	if peak := math.Max(math.Abs(m.ahead[i][0]), math.Abs(m.ahead[i][1])); peak > limitCeiling {
+		m.need[i] = limitCeiling / peak
+	}
+	m.cnt++
+}
+
+// pop returns the next sample with the gain reduction applied (LimitLookahead)
+func (m *master) pop() (float64, float64) {
+	h := 1.0
+	for i := 0; i < m.cnt; i++ {
+		h = math.Min(h, m.need[(m.first+i)%len(m.need)])
+	}
+	m.hold = math.Min(h, m.hold+(1-m.hold)*m.release)
+	m.holdSum += m.hold - m.holds[m.holdPos]
+	m.holds[m.holdPos] = m.hold
+	m.holdPos = (m.holdPos + 1) % len(m.holds)
+	g := math.Min(m.holdSum/float64(len(m.holds)), 1)
+
+	s := m.ahead[m.first]
+	m.first = (m.first + 1) % len(m.ahead)
+	m.cnt--
+	return s[0] * g, s[1] * g
+}
+
+// GetNextSamples returns the values for the next samples to be played (for left and right stereo
+// channel), after the master stage
+func (p *Player) GetNextSamples() (int, int) {
+	m := &p.master
+	if !m.active() && len(p.dsp) == 0 && !p.dspOut.pending() {
+		return p.nextSamples()
+	}
+	var l, r float64
+	if m.mode != LimitLookahead {
+		l, r = p.preciseSamples()
+		l, r = m.process(l), m.process(r)
+	} else {
+		for m.cnt < len(m.ahead) && !m.done {
+			l, r := p.preciseSamples()
+			if p.ended {
+				m.done = true
+				break
+			}
+			m.push(l, r)
+		}
+		if m.cnt == 0 {
+			p.ended = true
+			return 0, 0
+		}
+		p.ended = false // until the samples ahead have been returned
+		l, r = m.pop()
+	}
+	if p.dither != nil {
+		p.precise = [2]float64{l, r}
+	}
+	return int(l), int(r)
+}
+
+// preciseSamples returns the next samples before the master stage (after the effects), with the
+// fractions of the mix if they are kept for dithering
+func (p *Player) preciseSamples() (float64, float64) {
+	if len(p.dsp) > 0 || p.dspOut.pending() {
+		return p.dspSamples()
+	}
+	return p.mixSamples()
+}
+
+// mixSamples returns the next samples of the mix, with their fractions if they are kept for dithering
+func (p *Player) mixSamples() (float64, float64) {
+	l, r := p.nextSamples()
+	if p.dither != nil {
+		return p.precise[0], p.precise[1]
+	}
+	return float64(l), float64(r)
+}
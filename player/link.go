@@ -0,0 +1,75 @@
+//go:build link
+
+// Ableton Link support, using the C wrapper (abl_link) of the Link library:
+//
+//	go build -tags link
+//
+// with abl_link built and installed (headers and static library) where cgo can find them.
+
+package player
+
+/*
+#cgo LDFLAGS: -labl_link -lstdc++ -lm
+#include <abl_link.h>
+*/
+import "C"
+
+import (
+	"math"
+	"time"
+)
+
+func init() {
+	newLinkSync = func(bpm float64) TempoSync { return NewLink(bpm) }
+}
+
+// linkQuantum is the number of beats per bar used for quantizing
+const linkQuantum = 4
+
+// Link is a TempoSync joining an Ableton Link session
+type Link struct {
+	link  C.abl_link
+	state C.abl_link_session_state
+}
+
+// NewLink joins (or starts) a Link session with the given initial tempo
+func NewLink(bpm float64) *Link {
+	l := &Link{link: C.abl_link_create(C.double(bpm)), state: C.abl_link_create_session_state()}
+	C.abl_link_enable(l.link, true)
+	return l
+}
+
+// Close leaves the session
+func (l *Link) Close() {
+	C.abl_link_enable(l.link, false)
+	C.abl_link_destroy_session_state(l.state)
+	C.abl_link_destroy(l.link)
+}
+
+// Peers returns the number of other participants in the session
+func (l *Link) Peers() int {
+	return int(C.abl_link_num_peers(l.link))
+}
+
+// Tempo implements the TempoSync interface
+func (l *Link) Tempo() float64 {
+	C.abl_link_capture_app_session_state(l.link, l.state)
+	return float64(C.abl_link_tempo(l.state))
+}
+
+// SetTempo implements the TempoSync interface
+func (l *Link) SetTempo(bpm float64) {
+	C.abl_link_capture_app_session_state(l.link, l.state)
+	C.abl_link_set_tempo(l.state, C.double(bpm), C.abl_link_clock_micros(l.link))
+	C.abl_link_commit_app_session_state(l.link, l.state)
+}
+
+// WaitForBar implements the TempoSync interface
+func (l *Link) WaitForBar() {
+	C.abl_link_capture_app_session_state(l.link, l.state)
+	now := C.abl_link_clock_micros(l.link)
+	beat := float64(C.abl_link_beat_at_time(l.state, now, linkQuantum))
+	next := math.Ceil(beat/linkQuantum) * linkQuantum
+	at := C.abl_link_time_at_beat(l.state, C.double(next), linkQuantum)
+	time.Sleep(time.Duration(at-now) * time.Microsecond)
+}
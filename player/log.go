@@ -0,0 +1,27 @@
+package player
+
+import (
+	"context"
+	"log/slog"
+
+	"github.com/b0nefish/go-modplayer/mod"
+)
+
+// logger receives the events of the player (nil: logging is disabled)
+var logger *slog.Logger
+
+// SetLogger sets the logger to which the loader and the player emit their events (nil disables logging):
+// loaded modules and playback state changes at Info level, problems with a module and underruns at Warn
+// level, and every line played at Debug level
+func SetLogger(l *slog.Logger) {
+	logger = l
+	mod.SetLogger(l)
+}
+
+// logEvent emits an event to the logger (if there is one)
+func logEvent(level slog.Level, msg string, args ...any) {
+	if logger == nil {
+		return
+	}
+	logger.Log(context.Background(), level, msg, args...)
+}
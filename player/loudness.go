@@ -0,0 +1,106 @@
+package player
+
+import (
+	"math"
+
+	"github.com/b0nefish/go-modplayer/mod"
+)
+
+// ReplayGainLoudness is the reference loudness of ReplayGain 2.0 in LUFS, e.g. for PlayerOptions.Normalize
+const ReplayGainLoudness = -18
+
+// Loudness is the loudness of a rendered song, measured by MeasureLoudness
+type Loudness struct {
+	Integrated float64 // integrated loudness in LUFS (like EBU R128; -Inf for silence)
+	Peak       float64 // level of the highest sample in dBFS
+}
+
+// Gain returns the gain in dB which changes the loudness to target (in LUFS), reduced so that the peak
+// stays below full scale; it is 0 for silence
+func (l Loudness) Gain(target float64) float64 {
+	if math.IsInf(l.Integrated, -1) {
+		return 0
+	}
+	return math.Min(target-l.Integrated, -l.Peak)
+}
+
+// The gates of the integrated loudness: blocks below the absolute gate, or by more than the relative gate
+// below the loudness of the others, are ignored
+const (
+	loudnessAbsGate = -70 // LUFS
+	loudnessRelGate = -10 // LU
+)
+
+// newKWeighting returns the two stages of the K-weighting filter of ITU-R BS.1770 at the sample rate rate:
+// a high shelf modelling the head, and a high-pass
+func newKWeighting(rate int) (shelf, highpass biquad) {
+	// the coefficients of the standard (given for 48 kHz) computed for the rate
+	K := math.Tan(math.Pi * 1681.974450955533 / float64(rate))
+	Q := 0.7071752369554196
+	Vh := math.Pow(10, 3.999843853973347/20)
+	Vb := math.Pow(Vh, 0.4996667741545416)
+	a0 := 1 + K/Q + K*K
+	shelf = biquad{b0: (Vh + Vb*K/Q + K*K) / a0, b1: 2 * (K*K - Vh) / a0, b2: (Vh - Vb*K/Q + K*K) / a0,
+		a1: 2 * (K*K - 1) / a0, a2: (1 - K/Q + K*K) / a0}
+
+	K = math.Tan(math.Pi * 38.13547087602444 / float64(rate))
+	Q = 0.5003270373238773
+	a0 = 1 + K/Q + K*K
+	highpass = biquad{b0: 1, b1: -2, b2: 1, a1: 2 * (K*K - 1) / a0, a2: (1 - K/Q + K*K) / a0}
+	return shelf, highpass
+}
+
+// MeasureLoudness renders the song (without output, as fast as possible) and measures its loudness. The
+// effects (PlayerOptions.DSP), the headroom, the limiter and the normalization aren't applied.
+func MeasureLoudness(module mod.Module, opts PlayerOptions) Loudness {
+	opts.Clock, opts.Sync, opts.OSC, opts.DSP = nil, nil, nil, nil
+	opts.Headroom, opts.Limiter, opts.Normalize = 0, LimitNone, 0
+	mp := NewPlayer(module, opts)
+	shelf, highpass := newKWeighting(mp.rate)
+
+	// the mean square of the K-weighted samples of both channels in segments of 100 ms; the blocks of
+	// 400 ms overlap by 3 segments
+	segLen := mp.rate / 10
+	var segments []float64
+	var sum, peak float64
+	n := 0
+	for l, r := mp.GetNextSamples(); !mp.ended; l, r = mp.GetNextSamples() {
+		for ch, v := range [2]int{l, r} {
+			x := float64(v) / -math.MinInt16
+			peak = math.Max(peak, math.Abs(x))
+			y := highpass.process(ch, shelf.process(ch, x))
+			sum += y * y
+		}
+		if n++; n == segLen {
+			segments = append(segments, sum/float64(segLen))
+			sum, n = 0, 0
+		}
+	}
+
+	var blocks []float64
+	for i := 3; i < len(segments); i++ {
+		blocks = append(blocks, (segments[i-3]+segments[i-2]+segments[i-1]+segments[i])/4)
+	}
+	toLUFS := func(power float64) float64 { return -0.691 + 10*math.Log10(power) }
+	gated := func(gate float64) float64 {
+		var sum float64
+		cnt := 0
+		for _, b := range blocks {
+			if toLUFS(b) > gate {
+				sum += b
+				cnt++
+			}
+		}
+		if cnt == 0 {
+			return 0
+		}
+		return sum / float64(cnt)
+	}
+	l := Loudness{Integrated: math.Inf(-1), Peak: 20 * math.Log10(peak)}
+	if power := gated(loudnessAbsGate); power > 0 {
+		if power = gated(toLUFS(power) + loudnessRelGate); power > 0 {
+			l.Integrated = toLUFS(power)
+		}
+	}
+	return l
+}
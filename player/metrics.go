@@ -0,0 +1,55 @@
+package player
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"sync/atomic"
+)
+
+// Metrics holds the counters and gauges of a long-running player (e.g. a Radio), which are exported in
+// the Prometheus text format
+type Metrics struct {
+	TracksPlayed  atomic.Int64 // modules played to the end
+	Underruns     atomic.Int64 // times rendering could not keep up with real time
+	DroppedChunks atomic.Int64 // audio chunks not delivered to a client because its buffer was full
+	DecodeErrors  atomic.Int64 // modules which could not be loaded
+	Clients       atomic.Int64 // connected stream clients
+	BufferFill    atomic.Int64 // average fill level of the client buffers in percent
+}
+
+// metric describes a single exported value
+type metric struct {
+	name, typ, help string
+	value           *atomic.Int64
+}
+
+func (m *Metrics) metrics() []metric {
+	return []metric{
+		{"modplayer_tracks_played_total", "counter", "Number of modules played to the end.", &m.TracksPlayed},
+		{"modplayer_render_underruns_total", "counter", "Number of times rendering fell behind real time.", &m.Underruns},
+		{"modplayer_dropped_chunks_total", "counter", "Number of audio chunks dropped for slow clients.", &m.DroppedChunks},
+		{"modplayer_decode_errors_total", "counter", "Number of modules which could not be loaded.", &m.DecodeErrors},
+		{"modplayer_stream_clients", "gauge", "Number of connected stream clients.", &m.Clients},
+		{"modplayer_buffer_fill_percent", "gauge", "Average fill level of the client buffers.", &m.BufferFill},
+	}
+}
+
+// WriteTo writes the metrics in the Prometheus text exposition format
+func (m *Metrics) WriteTo(w io.Writer) (int64, error) {
+	var n int64
+	for _, mt := range m.metrics() {
+		c, err := fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s %s\n%s %d\n", mt.name, mt.help, mt.name, mt.typ, mt.name, mt.value.Load())
+		n += int64(c)
+		if err != nil {
+			return n, err
+		}
+	}
+	return n, nil
+}
+
+// ServeHTTP implements the http.Handler interface (for the /metrics endpoint)
+func (m *Metrics) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4")
+	m.WriteTo(w)
+}
@@ -0,0 +1,91 @@
+package player
+
+import (
+	"io"
+	"os"
+	"time"
+)
+
+// MIDI real-time messages
+const (
+	midiClock    = 0xF8
+	midiStart    = 0xFA
+	midiContinue = 0xFB
+	midiStop     = 0xFC
+	midiClockBuf = 1024 // ticks which can be queued (the player renders ahead of the audio output)
+)
+
+// MIDIClock sends MIDI clock messages to a MIDI port while a module is playing, so other devices can sync
+// to it. A MOD tick is 2.5/BPM seconds, i.e. there are 24 ticks per quarter note at any speed, which is
+// exactly the MIDI clock rate - so one clock is sent per tick, following all BPM (Fxx) changes.
+// The player renders ahead of the audio output, so the ticks are timed by their position in the audio
+// stream (plus Latency, the delay of the audio output) rather than by the time they are rendered.
+type MIDIClock struct {
+	Latency time.Duration
+
+	out   io.Writer
+	rate  int      // sample rate of the player
+	ticks chan int // sample positions of the ticks
+	done  chan struct{}
+}
+
+// NewMIDIClock creates a MIDIClock sending to out (e.g. a port opened with OpenMIDIPort)
+func NewMIDIClock(out io.Writer, latency time.Duration) *MIDIClock {
+	return &MIDIClock{Latency: latency, out: out, rate: sampleRate}
+}
+
+// OpenMIDIPort opens a raw MIDI device for writing (e.g. /dev/snd/midiC1D0 or /dev/midi1 on Linux)
+func OpenMIDIPort(name string) (io.WriteCloser, error) {
+	return os.OpenFile(name, os.O_WRONLY, 0)
+}
+
+// Start sends a MIDI start message and starts sending the clock for the ticks played from now on
+func (c *MIDIClock) Start() {
+	c.startAt(0, midiStart)
+}
+
+// Continue sends a MIDI continue message and resumes sending the clock, starting with the tick at
+// the given sample position (after Stop, when a paused player is resumed)
+func (c *MIDIClock) Continue(sample int) {
+	c.startAt(sample, midiContinue)
+}
+
+func (c *MIDIClock) startAt(sample int, msg byte) {
+	c.ticks = make(chan int, midiClockBuf)
+	c.done = make(chan struct{})
+	go c.run(time.Now().Add(c.Latency), sample, msg)
+}
+
+// Stop sends the clock for the remaining ticks and a MIDI stop message
+func (c *MIDIClock) Stop() {
+	if c.ticks == nil {
+		return
+	}
+	close(c.ticks)
+	<-c.done
+	c.ticks = nil
+}
+
+// tick is called by the player at the start of each tick
+func (c *MIDIClock) tick(sample int) {
+	if c.ticks == nil {
+		return
+	}
+	select {
+	case c.ticks <- sample:
+	default: // nobody is listening - don't block playing
+	}
+}
+
+// run sends msg at start and the clock for the ticks queued, where the sample position base
+// plays at start
+func (c *MIDIClock) run(start time.Time, base int, msg byte) {
+	defer close(c.done)
+	time.Sleep(time.Until(start))
+	c.out.Write([]byte{msg})
+	for sample := range c.ticks {
+		time.Sleep(time.Until(start.Add(time.Duration(sample-base) * time.Second / time.Duration(c.rate))))
+		c.out.Write([]byte{midiClock})
+	}
+	c.out.Write([]byte{midiStop})
+}
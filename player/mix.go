@@ -0,0 +1,25 @@
+package player
+
+// addIntsGo adds src to dst (up to the shorter length). It is addInts on architectures without an
+// assembly version (amd64 and arm64 have one, see mix_amd64.s and mix_arm64.s) and with the purego tag.
+func addIntsGo(dst, src []int) {
+	if len(src) > len(dst) {
+		src = src[:len(dst)]
+	}
+	for i, v := range src {
+		dst[i] += v
+	}
+}
+
+// mulAddIntsGo scales src by factor (in place) and adds it to dst (up to the shorter length). It is
+// mulAddInts on architectures without an assembly version and with the purego tag.
+func mulAddIntsGo(dst, src []int, factor float64) {
+	if len(src) > len(dst) {
+		src = src[:len(dst)]
+	}
+	for i, v := range src {
+		v = int(float64(v) * factor)
+		src[i] = v
+		dst[i] += v
+	}
+}
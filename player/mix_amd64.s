@@ -0,0 +1,86 @@
+//go:build !purego
+
+#include "textflag.h"
+
+// func addInts(dst, src []int)
+// adds 4 values per iteration with SSE2 (part of every amd64 CPU), the rest one by one
+TEXT ·addInts(SB), NOSPLIT, $0-48
+	MOVQ dst_base+0(FP), DI
+	MOVQ dst_len+8(FP), CX
+	MOVQ src_base+24(FP), SI
+	MOVQ src_len+32(FP), DX
+	CMPQ DX, CX
+	CMOVQLT DX, CX
+	XORQ AX, AX
+	MOVQ CX, BX
+	ANDQ $-4, BX
+
+loop4:
+	CMPQ AX, BX
+	JGE  tail
+	MOVOU (SI)(AX*8), X0
+	MOVOU 16(SI)(AX*8), X1
+	MOVOU (DI)(AX*8), X2
+	MOVOU 16(DI)(AX*8), X3
+	PADDQ X0, X2
+	PADDQ X1, X3
+	MOVOU X2, (DI)(AX*8)
+	MOVOU X3, 16(DI)(AX*8)
+	ADDQ  $4, AX
+	JMP   loop4
+
+tail:
+	CMPQ AX, CX
+	JGE  done
+	MOVQ (SI)(AX*8), DX
+	ADDQ DX, (DI)(AX*8)
+	INCQ AX
+	JMP  tail
+
+done:
+	RET
+
+// func mulAddInts(dst, src []int, factor float64)
+// scales 2 values per iteration with SSE2 (converted one by one, which truncates like Go), the last one
+// on its own
+TEXT ·mulAddInts(SB), NOSPLIT, $0-56
+	MOVQ  dst_base+0(FP), DI
+	MOVQ  dst_len+8(FP), CX
+	MOVQ  src_base+24(FP), SI
+	MOVQ  src_len+32(FP), DX
+	MOVSD factor+48(FP), X7
+	MOVLHPS X7, X7
+	CMPQ DX, CX
+	CMOVQLT DX, CX
+	XORQ AX, AX
+	MOVQ CX, BX
+	ANDQ $-2, BX
+
+loop2:
+	CMPQ AX, BX
+	JGE  last
+	CVTSQ2SD  (SI)(AX*8), X0
+	CVTSQ2SD  8(SI)(AX*8), X1
+	UNPCKLPD  X1, X0
+	MULPD     X7, X0
+	CVTTSD2SQ X0, DX
+	UNPCKHPD  X0, X0
+	CVTTSD2SQ X0, R8
+	MOVQ DX, (SI)(AX*8)
+	MOVQ R8, 8(SI)(AX*8)
+	ADDQ DX, (DI)(AX*8)
+	ADDQ R8, 8(DI)(AX*8)
+	ADDQ $2, AX
+	JMP  loop2
+
+last:
+	CMPQ AX, CX
+	JGE  done2
+	CVTSQ2SD  (SI)(AX*8), X0
+	MULSD     X7, X0
+	CVTTSD2SQ X0, DX
+	MOVQ DX, (SI)(AX*8)
+	ADDQ DX, (DI)(AX*8)
+
+done2:
+	RET
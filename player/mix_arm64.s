@@ -0,0 +1,80 @@
+//go:build !purego
+
+#include "textflag.h"
+
+// func addInts(dst, src []int)
+// adds 4 values per iteration with NEON (part of every arm64 CPU), the rest one by one
+TEXT ·addInts(SB), NOSPLIT, $0-48
+	MOVD dst_base+0(FP), R0
+	MOVD dst_len+8(FP), R1
+	MOVD src_base+24(FP), R2
+	MOVD src_len+32(FP), R3
+	CMP  R1, R3
+	CSEL LT, R3, R1, R1
+
+loop4:
+	CMP   $4, R1
+	BLT   tail
+	VLD1.P 32(R2), [V0.D2, V1.D2]
+	VLD1  (R0), [V2.D2, V3.D2]
+	VADD  V0.D2, V2.D2, V2.D2
+	VADD  V1.D2, V3.D2, V3.D2
+	VST1.P [V2.D2, V3.D2], 32(R0)
+	SUB   $4, R1
+	B     loop4
+
+tail:
+	CBZ   R1, done
+	MOVD.P 8(R2), R4
+	MOVD  (R0), R5
+	ADD   R4, R5
+	MOVD.P R5, 8(R0)
+	SUB   $1, R1
+	B     tail
+
+done:
+	RET
+
+// func mulAddInts(dst, src []int, factor float64)
+// scales 2 values per iteration (with the scalar conversions, which truncate like Go), the last one on
+// its own
+TEXT ·mulAddInts(SB), NOSPLIT, $0-56
+	MOVD  dst_base+0(FP), R0
+	MOVD  dst_len+8(FP), R1
+	MOVD  src_base+24(FP), R2
+	MOVD  src_len+32(FP), R3
+	FMOVD factor+48(FP), F7
+	CMP   R1, R3
+	CSEL  LT, R3, R1, R1
+
+loop2:
+	CMP     $2, R1
+	BLT     last
+	LDP     (R2), (R4, R5)
+	SCVTFD  R4, F0
+	SCVTFD  R5, F1
+	FMULD   F7, F0, F0
+	FMULD   F7, F1, F1
+	FCVTZSD F0, R4
+	FCVTZSD F1, R5
+	STP.P   (R4, R5), 16(R2)
+	LDP     (R0), (R6, R7)
+	ADD     R4, R6
+	ADD     R5, R7
+	STP.P   (R6, R7), 16(R0)
+	SUB     $2, R1
+	B       loop2
+
+last:
+	CBZ     R1, done2
+	MOVD    (R2), R4
+	SCVTFD  R4, F0
+	FMULD   F7, F0, F0
+	FCVTZSD F0, R4
+	MOVD    R4, (R2)
+	MOVD    (R0), R5
+	ADD     R4, R5
+	MOVD    R5, (R0)
+
+done2:
+	RET
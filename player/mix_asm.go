@@ -0,0 +1,14 @@
+//go:build (amd64 || arm64) && !purego
+
+package player
+
+// addInts adds src to dst (up to the shorter length), see mix_amd64.s and mix_arm64.s
+//
+//go:noescape
+func addInts(dst, src []int)
+
+// mulAddInts scales src by factor (in place) and adds it to dst (up to the shorter length), see
+// mix_amd64.s and mix_arm64.s
+//
+//go:noescape
+func mulAddInts(dst, src []int, factor float64)
@@ -0,0 +1,13 @@
+//go:build !(amd64 || arm64) || purego
+
+package player
+
+// addInts adds src to dst (up to the shorter length)
+func addInts(dst, src []int) {
+	addIntsGo(dst, src)
+}
+
+// mulAddInts scales src by factor (in place) and adds it to dst (up to the shorter length)
+func mulAddInts(dst, src []int, factor float64) {
+	mulAddIntsGo(dst, src, factor)
+}
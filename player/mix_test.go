@@ -0,0 +1,55 @@
+package player
+
+import (
+	"math"
+	"math/rand"
+	"testing"
+)
+
+// testInts returns n random sample values, including the extremes of the 32-bit range
+func testInts(rnd *rand.Rand, n int) []int {
+	v := make([]int, n)
+	for i := range v {
+		v[i] = rnd.Intn(1<<20) - 1<<19
+	}
+	if n > 1 {
+		v[0], v[n-1] = math.MaxInt32, math.MinInt32
+	}
+	return v
+}
+
+// TestMixKernels checks that the kernels of the mix (assembly on amd64 and arm64) add and scale like
+// their Go versions, for all lengths up to a few iterations and shorter sources or destinations
+func TestMixKernels(t *testing.T) {
+	rnd := rand.New(rand.NewSource(1))
+	for n := 0; n < 20; n++ {
+		for _, srcLen := range []int{n, n / 2, n + 3} {
+			src, dst := testInts(rnd, srcLen), testInts(rnd, n)
+			got, want := append([]int(nil), dst...), append([]int(nil), dst...)
+			addInts(got, src)
+			addIntsGo(want, src)
+			for i := range want {
+				if got[i] != want[i] {
+					t.Fatalf("addInts (%d values, %d added): value %d is %d, want %d", n, srcLen, i, got[i], want[i])
+				}
+			}
+
+			for _, g := range []float64{0, 0.3, 0.999, 1.7, -2} {
+				gotSrc, wantSrc := append([]int(nil), src...), append([]int(nil), src...)
+				got, want := append([]int(nil), dst...), append([]int(nil), dst...)
+				mulAddInts(got, gotSrc, g)
+				mulAddIntsGo(want, wantSrc, g)
+				for i := range want {
+					if got[i] != want[i] {
+						t.Fatalf("mulAddInts (%d values, %d added, factor %v): value %d is %d, want %d", n, srcLen, g, i, got[i], want[i])
+					}
+				}
+				for i := range wantSrc {
+					if gotSrc[i] != wantSrc[i] {
+						t.Fatalf("mulAddInts (%d values, %d added, factor %v): scaled value %d is %d, want %d", n, srcLen, g, i, gotSrc[i], wantSrc[i])
+					}
+				}
+			}
+		}
+	}
+}
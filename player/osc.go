@@ -0,0 +1,235 @@
+package player
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"log/slog"
+	"math"
+	"net"
+	"strings"
+	"time"
+
+	"github.com/b0nefish/go-modplayer/mod"
+)
+
+// oscMessage is an OSC message; arguments are int32, float32 or string
+type oscMessage struct {
+	Address string
+	Args    []interface{}
+}
+
+// appendOSCString appends s as an OSC string (null-terminated, padded to a multiple of 4 bytes)
+func appendOSCString(buf []byte, s string) []byte {
+	buf = append(buf, s...)
+	return append(buf, make([]byte, 4-len(s)%4)...)
+}
+
+func (m oscMessage) bytes() []byte {
+	tags := ","
+	var args []byte
+	for _, a := range m.Args {
+		switch v := a.(type) {
+		case int32:
+			tags += "i"
+			args = binary.BigEndian.AppendUint32(args, uint32(v))
+		case float32:
+			tags += "f"
+			args = binary.BigEndian.AppendUint32(args, math.Float32bits(v))
+		case string:
+			tags += "s"
+			args = appendOSCString(args, v)
+		}
+	}
+	buf := appendOSCString(nil, m.Address)
+	buf = appendOSCString(buf, tags)
+	return append(buf, args...)
+}
+
+// readOSCString reads an OSC string from the start of data and returns the rest
+func readOSCString(data []byte) (string, []byte, error) {
+	end := bytes.IndexByte(data, 0)
+	if end < 0 {
+		return "", nil, fmt.Errorf("unterminated OSC string")
+	}
+	next := (end/4 + 1) * 4
+	if next > len(data) {
+		next = len(data)
+	}
+	return string(data[:end]), data[next:], nil
+}
+
+// parseOSCMessage decodes an OSC message (bundles are not supported for incoming messages)
+func parseOSCMessage(data []byte) (m oscMessage, err error) {
+	if m.Address, data, err = readOSCString(data); err != nil {
+		return
+	}
+	var tags string
+	if tags, data, err = readOSCString(data); err != nil {
+		return
+	}
+	for _, t := range strings.TrimPrefix(tags, ",") {
+		switch t {
+		case 'i', 'f':
+			if len(data) < 4 {
+				return m, fmt.Errorf("OSC message %s: missing argument", m.Address)
+			}
+			v := binary.BigEndian.Uint32(data)
+			if t == 'i' {
+				m.Args = append(m.Args, int32(v))
+			} else {
+				m.Args = append(m.Args, math.Float32frombits(v))
+			}
+			data = data[4:]
+		case 's':
+			var s string
+			if s, data, err = readOSCString(data); err != nil {
+				return
+			}
+			m.Args = append(m.Args, s)
+		default:
+			return m, fmt.Errorf("OSC message %s: unsupported argument type %c", m.Address, t)
+		}
+	}
+	return
+}
+
+// intArg returns argument i of the message as an integer
+func (m oscMessage) intArg(i int) (int, bool) {
+	if i >= len(m.Args) {
+		return 0, false
+	}
+	switch v := m.Args[i].(type) {
+	case int32:
+		return int(v), true
+	case float32:
+		return int(v), true
+	}
+	return 0, false
+}
+
+// oscTimeTag converts t to an OSC (NTP) time tag
+func oscTimeTag(t time.Time) uint64 {
+	const ntpEpochOffset = 2208988800 // seconds from 1900 to 1970
+	secs := uint64(t.Unix() + ntpEpochOffset)
+	frac := uint64(t.Nanosecond()) << 32 / 1e9
+	return secs<<32 | frac
+}
+
+// oscBundle encodes messages as an OSC bundle to be executed at time t
+func oscBundle(t time.Time, msgs ...oscMessage) []byte {
+	buf := appendOSCString(nil, "#bundle")
+	buf = binary.BigEndian.AppendUint64(buf, oscTimeTag(t))
+	for _, m := range msgs {
+		data := m.bytes()
+		buf = binary.BigEndian.AppendUint32(buf, uint32(len(data)))
+		buf = append(buf, data...)
+	}
+	return buf
+}
+
+// OSCClient sends the rows and notes played to an OSC receiver (lighting desks, VJ software, Max/Pd, ...):
+//
+//	/modplayer/row order pattern row
+//	/modplayer/note channel instrument period volume
+//
+// The messages are sent as bundles time-tagged with the time at which the row is heard (by its position
+// in the audio stream plus Latency), as the player renders ahead of the audio output.
+type OSCClient struct {
+	Latency time.Duration
+
+	conn  net.Conn
+	rate  int // sample rate of the player
+	start time.Time
+}
+
+// NewOSCClient creates an OSCClient sending to addr (host:port, UDP)
+func NewOSCClient(addr string, latency time.Duration) (*OSCClient, error) {
+	conn, err := net.Dial("udp", addr)
+	if err != nil {
+		return nil, err
+	}
+	return &OSCClient{Latency: latency, conn: conn, rate: sampleRate}, nil
+}
+
+// Start sets the time at which the audio output starts
+func (c *OSCClient) Start() {
+	c.startAt(0)
+}
+
+// startAt sets the time at which the given sample position is output (when resuming playing)
+func (c *OSCClient) startAt(sample int) {
+	c.start = time.Now().Add(c.Latency - time.Duration(sample)*time.Second/time.Duration(c.rate))
+}
+
+// Close closes the connection
+func (c *OSCClient) Close() error {
+	return c.conn.Close()
+}
+
+// line sends the events of a line starting at the given sample position
+func (c *OSCClient) line(sample, order, pattern, line int, notes []mod.Note) {
+	msgs := []oscMessage{{"/modplayer/row", []interface{}{int32(order), int32(pattern), int32(line)}}}
+	for ch, n := range notes {
+		if n.Period > 0 && n.Ins != nil && n.Ins.HasSample() {
+			vol := n.Ins.Volume
+			if n.EffType == mod.SetVol {
+				vol = n.Par()
+			}
+			msgs = append(msgs, oscMessage{"/modplayer/note", []interface{}{int32(ch), int32(n.InsNum), int32(n.Period), int32(vol)}})
+		}
+	}
+	c.conn.Write(oscBundle(c.start.Add(time.Duration(sample)*time.Second/time.Duration(c.rate)), msgs...))
+}
+
+// ServeOSC receives OSC messages on addr (UDP) to control the player:
+//
+//	/modplayer/jump order [row] - continue playing at the given order (and row)
+//	/modplayer/mute ch 0|1      - mute/unmute a channel (1-based)
+//	/modplayer/stop             - stop playing
+//	/modplayer/pause            - pause playing
+//	/modplayer/resume           - resume playing after pause
+//
+// Messages which can't be handled are logged (see SetLogger) and ignored.
+func ServeOSC(addr string, p *Player) error {
+	conn, err := net.ListenPacket("udp", addr)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+	buf := make([]byte, 65536)
+	for {
+		n, from, err := conn.ReadFrom(buf)
+		if err != nil {
+			return err
+		}
+		m, err := parseOSCMessage(buf[:n])
+		if err != nil {
+			logEvent(slog.LevelWarn, "invalid OSC message", "from", from, "error", err)
+			continue
+		}
+		switch m.Address {
+		case "/modplayer/jump":
+			if order, ok := m.intArg(0); ok {
+				row, _ := m.intArg(1)
+				if err := p.SeekOrder(order, row); err != nil {
+					logEvent(slog.LevelWarn, "OSC jump failed", "from", from, "order", order, "row", row, "error", err)
+				}
+			}
+		case "/modplayer/mute":
+			ch, ok1 := m.intArg(0)
+			on, ok2 := m.intArg(1)
+			if ok1 && ok2 {
+				p.Mute(ch-1, on != 0)
+			}
+		case "/modplayer/stop":
+			p.Stop()
+		case "/modplayer/pause":
+			p.Pause()
+		case "/modplayer/resume":
+			p.Resume()
+		default:
+			logEvent(slog.LevelWarn, "unknown OSC address", "from", from, "address", m.Address)
+		}
+	}
+}
@@ -0,0 +1,123 @@
+package player
+
+import (
+	"fmt"
+	"sort"
+
+	"github.com/hajimehoshi/oto"
+)
+
+// Output is an audio output (a sound card) playing the rendered samples; Write blocks until the samples
+// (interleaved stereo) are buffered by the output
+type Output interface {
+	Write(samples []int16) error
+	Close() error
+}
+
+// OutputFactory opens an Output with the given sample rate
+type OutputFactory func(rate int) (Output, error)
+
+// Outputs contains the available audio outputs, indexed by name: oto (pure Go, on all platforms) and,
+// when built with the portaudio tag, portaudio (lower latency)
+var Outputs = map[string]OutputFactory{
+	"oto": OpenOtoOutput,
+}
+
+// DefaultOutput is the name of the output used if PlayerOptions.Output is nil
+const DefaultOutput = "oto"
+
+// OutputNames returns the names of the available outputs, sorted
+func OutputNames() []string {
+	names := make([]string, 0, len(Outputs))
+	for name := range Outputs {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// FindOutput returns the output with the given name
+func FindOutput(name string) (OutputFactory, error) {
+	o, ok := Outputs[name]
+	if !ok {
+		return nil, fmt.Errorf("unknown audio output %q (known: %v)", name, OutputNames())
+	}
+	return o, nil
+}
+
+// openOutput opens the output f (nil: DefaultOutput) at the given rate
+func openOutput(f OutputFactory, rate int) (Output, error) {
+	if f == nil {
+		f = Outputs[DefaultOutput]
+	}
+	return f(rate)
+}
+
+// outputWriter writes the bytes of the rendered audio (as returned by Player.Read) to an Output
+type outputWriter struct {
+	out     Output
+	samples []int16
+}
+
+func (w *outputWriter) Write(buf []byte) (int, error) {
+	w.samples = w.samples[:0]
+	for i := 0; i+1 < len(buf); i += 2 {
+		w.samples = append(w.samples, int16(uint16(buf[i])|uint16(buf[i+1])<<8))
+	}
+	if err := w.out.Write(w.samples); err != nil {
+		return 0, err
+	}
+	return len(buf), nil
+}
+
+var (
+	ctx     *oto.Context
+	ctxRate int // the sample rate of ctx
+)
+
+// otoOutput is the Output of the oto library
+type otoOutput struct {
+	p   *oto.Player
+	buf []byte
+}
+
+// OpenOtoOutput opens an output using the oto library. Oto can only be initialized once, so all its
+// outputs have to use the same sample rate.
+func OpenOtoOutput(rate int) (Output, error) {
+	ctx, err := audioContext(rate)
+	if err != nil {
+		return nil, err
+	}
+	return &otoOutput{p: ctx.NewPlayer()}, nil
+}
+
+func (o *otoOutput) Write(samples []int16) error {
+	o.buf = o.buf[:0]
+	for _, s := range samples {
+		o.buf = append(o.buf, byte(s), byte(uint16(s)>>8))
+	}
+	_, err := o.p.Write(o.buf)
+	return err
+}
+
+func (o *otoOutput) Close() error {
+	return o.p.Close()
+}
+
+// audioContext initializes the audio output on first use (rendering to a file doesn't need it). The
+// output can only be opened once, so all players have to use the same sample rate.
+func audioContext(rate int) (*oto.Context, error) {
+	if ctx != nil {
+		if rate != ctxRate {
+			return nil, fmt.Errorf("audio output already opened at %d Hz", ctxRate)
+		}
+		return ctx, nil
+	}
+	var err error
+	ctx, err = oto.NewContext(rate, channelNum, bitDepthInBytes, bufferSize)
+	if err != nil {
+		return nil, fmt.Errorf("unable to initialize audio: %v", err)
+	}
+	ctxRate = rate
+	return ctx, nil
+}
@@ -0,0 +1,89 @@
+package player
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/b0nefish/go-modplayer/mod"
+)
+
+// PanMode determines how the channels are placed in the stereo output
+type PanMode int
+
+const (
+	// PanAmiga - the panning of the module: hard left/right for MOD files (the Amiga's L R R L), the
+	// channel panning and the panning commands for the other formats
+	PanAmiga PanMode = iota
+	// PanSeparation - like PanAmiga, with the stereo separation reduced to PlayerOptions.Separation
+	// (hard panned channels are hard to listen to with headphones)
+	PanSeparation
+	// PanMono - all channels in the center
+	PanMono
+	// PanReal - like PanAmiga, but the panning commands 8xx and E8x of MOD files (unused by ProTracker,
+	// but written by several PC trackers) set the panning as well
+	PanReal
+)
+
+// DefaultSeparation is the stereo separation (in percent) of PanSeparation if PlayerOptions.Separation is 0
+const DefaultSeparation = 70
+
+func (pm PanMode) String() string {
+	switch pm {
+	case PanSeparation:
+		return "separation"
+	case PanMono:
+		return "mono"
+	case PanReal:
+		return "real"
+	}
+	return "amiga"
+}
+
+// ParsePanning parses a panning setting: "amiga", "mono", "real" or a stereo separation in percent
+// (e.g. "70" or "70%"), which selects PanSeparation
+func ParsePanning(s string) (PanMode, int, error) {
+	switch strings.ToLower(s) {
+	case "", "amiga":
+		return PanAmiga, 0, nil
+	case "mono":
+		return PanMono, 0, nil
+	case "real":
+		return PanReal, 0, nil
+	}
+	sep, err := strconv.Atoi(strings.TrimSuffix(s, "%"))
+	if err != nil || sep < 0 || sep > 100 {
+		return PanAmiga, 0, fmt.Errorf("invalid panning %q (amiga, mono, real or a stereo separation of 0-100%%)", s)
+	}
+	return PanSeparation, sep, nil
+}
+
+// panWidth returns the factor by which the panning of the channels is moved away from the center
+func panWidth(opts PlayerOptions) float32 {
+	switch opts.Panning {
+	case PanMono:
+		return 0
+	case PanSeparation:
+		if opts.Separation == 0 {
+			return DefaultSeparation / 100.
+		}
+		return float32(opts.Separation) / 100
+	}
+	return 1
+}
+
+// realPanning converts the unused effects 8xx and E8x of MOD files into panning commands
+func realPanning(e mod.Effect) mod.Effect {
+	switch e.EffType {
+	case mod.NotUsed8:
+		return mod.Effect{EffType: mod.SetPanning, EffCode: e.EffCode}
+	case mod.NotUsedE8:
+		return mod.Effect{EffType: mod.SetPanning, EffCode: 0x800 | uint16(e.ParY()*17)}
+	}
+	return e
+}
+
+// outPan returns the panning of the channel in the output (with the stereo width of the player applied)
+func (ch *Channel) outPan() float32 {
+	return .5 + (ch.pan-.5)*ch.panWidth
+}
@@ -0,0 +1,122 @@
+package player
+
+import "sync"
+
+// parallelChannels is the number of channels from which PlayerOptions.Workers renders them in parallel;
+// for fewer channels, the goroutines would cost more than they save
+const parallelChannels = 16
+
+// chanBlock holds the output of the channels up to the next line or tick (between lines and ticks, the
+// channels don't depend on each other or on the Player), so they are mixed a block at a time
+type chanBlock struct {
+	workers  int     // the number of goroutines rendering the channels (1: rendered one after the other)
+	out      [][]int // the samples of each channel (left and right interleaved)
+	mix      []int   // the sum of out
+	pos, len int     // the next sample to mix, and the number of samples rendered
+}
+
+// newChanBlock returns the buffers for rendering the channels with the given number of workers (with
+// fewer than parallelChannels, they are rendered by the caller)
+func newChanBlock(workers, channels int) *chanBlock {
+	if workers < 2 || channels < parallelChannels {
+		workers = 1
+	}
+	if workers > channels {
+		workers = channels
+	}
+	return &chanBlock{workers: workers, out: make([][]int, channels)}
+}
+
+// renderChannel renders the samples of the channel into out (left and right interleaved)
+func (ch *Channel) renderChannel(out []int) {
+	for j := 0; j < len(out); j += 2 {
+		out[j], out[j+1] = ch.GetNextSample()
+	}
+}
+
+// mixChannel scales the output of the channel by its volume factor (SetChannelGain), adds it to mix and
+// updates the peak of the channel
+func (ch *Channel) mixChannel(mix, out []int) {
+	switch g := ch.gain.cur; {
+	case g != ch.gain.target: // ramping
+		for j := 0; j < len(out); j += 2 {
+			g := ch.gain.next()
+			out[j], out[j+1] = int(float64(out[j])*g), int(float64(out[j+1])*g)
+			mix[j] += out[j]
+			mix[j+1] += out[j+1]
+		}
+	case g != 1:
+		mulAddInts(mix, out, g)
+	default:
+		addInts(mix, out)
+	}
+	for j := 0; j < len(out); j += 2 {
+		if v := intAbs(out[j]) + intAbs(out[j+1]); v > ch.peak {
+			ch.peak = v
+		}
+	}
+}
+
+// renderBlock renders the samples of all channels up to the next line or tick (in parallel with
+// PlayerOptions.Workers), starting with the current sample, and mixes them. Changes while playing
+// (muting, channel gains) take effect with the next block.
+func (p *Player) renderBlock() {
+	b := p.block
+	n := p.SPT - p.curTiming
+	if p.atLineStart() || n < 1 {
+		n = 1 // the notes of the next line start with the next sample
+	}
+	for i := range b.out {
+		b.out[i] = grow(b.out[i], 2*n)
+	}
+	if b.workers == 1 {
+		for i := range p.chans {
+			p.chans[i].renderChannel(b.out[i])
+		}
+	} else {
+		var wg sync.WaitGroup
+		wg.Add(b.workers)
+		for w := 0; w < b.workers; w++ {
+			go func(w int) {
+				defer wg.Done()
+				for i := w; i < len(p.chans); i += b.workers {
+					p.chans[i].renderChannel(b.out[i])
+				}
+			}(w)
+		}
+		wg.Wait()
+	}
+	b.mix = grow(b.mix, 2*n)
+	for i := range b.mix {
+		b.mix[i] = 0
+	}
+	for i := range p.chans {
+		p.chans[i].mixChannel(b.mix, b.out[i])
+	}
+	b.pos, b.len = 0, n
+}
+
+// blockSample returns the mix of the channels for the current sample, rendering the next block first if
+// all of its samples have been mixed
+func (p *Player) blockSample() [2]int {
+	b := p.block
+	if b.pos >= b.len {
+		p.renderBlock()
+	}
+	j := 2 * b.pos
+	if p.stems != nil {
+		for i, out := range b.out {
+			p.stems[i] = [2]int{out[j], out[j+1]}
+		}
+	}
+	b.pos++
+	return [2]int{b.mix[j], b.mix[j+1]}
+}
+
+// grow returns buf with length n, reallocated if its capacity is too small
+func grow(buf []int, n int) []int {
+	if cap(buf) < n {
+		return make([]int, n)
+	}
+	return buf[:n]
+}
@@ -0,0 +1,156 @@
+package player
+
+import (
+	"github.com/b0nefish/go-modplayer/mod"
+)
+
+// PeriodProcessor is responsible for calculating the current period (=pitch) for a channel
+// considering currently active effect(s)
+type PeriodProcessor struct {
+	period      int   // current period
+	periodΔ     int   // period delta (value to add/subtract for pitch slides)
+	arpeggio    []int // periods for arpeggio (base note, +x and +y half notes; nil: no arpeggio)
+	arpeggioIdx int   // index in arpeggio array (the tick of the line modulo 3)
+
+	arpeggioWrap bool // look up the arpeggio notes like ProTracker (CompatProfile.ArpeggioWrap)
+
+	Smooth  bool // interpolate slides for every sample instead of changing the period once per tick
+	tickPos int  // number of samples played since the last tick
+	tickLen int  // number of samples between the last two ticks (the expected length of the current tick)
+
+	Ins *mod.Instrument
+
+	state *ChannelState // the state of the channel (vibrato waveform, portamento target)
+}
+
+// PeriodFromNote initializes the period (pitch) effects for the given note
+func (ppu *PeriodProcessor) PeriodFromNote(note mod.Note, speed Speed) {
+	resetSlide := true
+	resetVibrato := true
+	if note.Ins != nil && note.Ins.HasSample() && note.Period > 0 {
+		// FIXME: check if Portamento effects contain an instrument? Then we need to ignore it here...
+		ppu.Ins = note.Ins
+		finetune := note.Ins.Finetune()
+		if note.EffType == mod.SetFinetune {
+			finetune = note.ParY() // E5x overrides the finetune of the instrument for this note
+		}
+		ppu.period = mod.FinetunedPeriod(note.Period, finetune)
+	}
+
+	ppu.arpeggio, ppu.arpeggioIdx = nil, 0
+	switch note.EffType {
+	case mod.Arpeggio:
+		if note.Par() != 0 {
+			ppu.arpeggio = []int{ppu.period, ppu.arpeggioPeriod(note.ParX()), ppu.arpeggioPeriod(note.ParY())}
+		}
+	case mod.SlideUp:
+		ppu.periodΔ = -note.Par()
+		resetSlide = false
+	case mod.SlideDown:
+		ppu.periodΔ = note.Par()
+		resetSlide = false
+	case mod.Portamento, mod.PortamentoVolSlide:
+		// 3xx sets the speed (a zero parameter has already been replaced by the effect memory, if the
+		// profile has one), 5xy slides with the last speed; both take the target from their note
+		if note.EffType == mod.Portamento {
+			ppu.state.portaSpeed = note.Par()
+		}
+		if note.Period != 0 && ppu.Ins != nil {
+			ppu.state.portaTarget = ppu.Ins.NotePeriod(note.Period)
+		}
+		switch {
+		case ppu.state.portaTarget == 0: // no note to slide to yet
+			ppu.periodΔ = 0
+		case ppu.state.portaTarget > ppu.period:
+			ppu.periodΔ = ppu.state.portaSpeed
+		default:
+			ppu.periodΔ = -ppu.state.portaSpeed
+		}
+		resetSlide = false
+	case mod.Vibrato:
+		ppu.state.Vibrato.InitVibratoWaveform(note.ParX(), note.ParY())
+		resetVibrato = false
+	case mod.VibratoVolSlide:
+		// continues the vibrato (the parameter is the volume slide)
+		ppu.state.Vibrato.InitVibratoWaveform(0, 0)
+		resetVibrato = false
+	case mod.FineSlideUp:
+		ppu.period -= note.ParY()
+	case mod.FineSlideDown:
+		ppu.period += note.ParY()
+	case mod.GlissandoControl:
+		ppu.state.glissando = note.ParY() == 1
+	case mod.SetVibratoWaveform:
+		ppu.state.Vibrato.DecodeWaveformType(note.ParY())
+	case mod.Tremolo, mod.VolSlide, mod.SetVol, mod.FineVolSlideUp, mod.FineVolSlideDown, mod.NoteCut:
+		ppu.periodΔ = 0
+		ppu.state.portaTarget = 0
+	}
+
+	if resetSlide {
+		ppu.periodΔ = 0
+	}
+	if resetVibrato {
+		ppu.state.Vibrato.Active = false
+	}
+}
+
+// PeriodOnTick computes the period value for the given tick
+func (ppu *PeriodProcessor) PeriodOnTick(curTick int) {
+	ppu.tickLen, ppu.tickPos = ppu.tickPos, 0
+	if ppu.periodΔ != 0 {
+		// FIXME: check period limits!
+		ppu.period = ppu.slidePeriod()
+		if ppu.period == ppu.state.portaTarget {
+			ppu.periodΔ = 0
+		}
+	}
+
+	ppu.state.Vibrato.Tick()
+
+	ppu.arpeggioIdx = (curTick + 1) % 3
+}
+
+// arpeggioPeriod returns the period of the arpeggio note halfNotes above the current period
+func (ppu *PeriodProcessor) arpeggioPeriod(halfNotes int) int {
+	if halfNotes == 0 || ppu.Ins == nil {
+		return ppu.period
+	}
+	if ppu.arpeggioWrap {
+		return mod.ArpeggioPeriod(ppu.period, ppu.Ins.Finetune(), halfNotes)
+	}
+	return ppu.Ins.IncDec(ppu.period, halfNotes)
+}
+
+// slidePeriod returns the period after the next tick of the current slide (which stops at the
+// target period of a "slide to note")
+func (ppu *PeriodProcessor) slidePeriod() int {
+	if ppu.state.portaTarget != 0 && intAbs(ppu.state.portaTarget-ppu.period) < intAbs(ppu.periodΔ) {
+		return ppu.state.portaTarget
+	}
+	return ppu.period + ppu.periodΔ
+}
+
+// Next gets the period value for the next sample
+func (ppu *PeriodProcessor) Next() float32 {
+	ppu.tickPos++
+	if ppu.arpeggio != nil {
+		return float32(ppu.arpeggio[ppu.arpeggioIdx])
+	}
+	period := float32(ppu.period)
+	if ppu.state.glissando && ppu.state.portaTarget != 0 && ppu.periodΔ != 0 {
+		// E31: the slide to note moves in semitones (the slide itself continues unchanged)
+		period = float32(ppu.Ins.Semitone(ppu.period))
+	} else if ppu.Smooth && ppu.periodΔ != 0 && ppu.tickLen > 0 {
+		// move towards the period of the next tick
+		period += float32(ppu.slidePeriod()-ppu.period) * float32(ppu.tickPos-1) / float32(ppu.tickLen)
+	}
+	return period + float32(ppu.state.Vibrato.DoStep())
+}
+
+func intAbs(i int) int {
+	if i < 0 {
+		return -i
+	}
+	return i
+}
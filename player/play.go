@@ -0,0 +1,1202 @@
+// Package player renders modules loaded with package mod into audio and plays them.
+package player
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"math"
+	"math/rand"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/b0nefish/go-modplayer/mod"
+)
+
+// 1/214 .. 16574.27
+// 1/p   .. y
+// y = ((1/p)*16574.27) / (1/214) = (16574.27/p) * 214 = 16574.27 * 214 / p
+
+// p = 428 --> y = 3546894.6 / 428 = 8287.13
+// step = samplerate/y = (samplerate * p) / 3546894.6
+
+const (
+	sampleRate      = 24000 // > 30000 produces artifacts under Windows?!
+	channelNum      = 2
+	bitDepthInBytes = 2
+	bufferSize      = 4096
+	// outputLatency is the number of samples between rendering and hearing them (the buffer of the
+	// output loop and the one of the audio output)
+	outputLatency = 2 * bufferSize / (bitDepthInBytes * channelNum)
+	// channelFullLevel is the output level of a channel playing a sample at full volume
+	channelFullLevel = 64 * 64
+)
+
+// Format of the rendered audio (16-bit signed little endian, interleaved stereo)
+const (
+	SampleRate     = sampleRate
+	Channels       = channelNum
+	BytesPerSample = bitDepthInBytes
+)
+
+// Speed holds all the parameters which affect the speed of playing a MOD file
+type Speed struct {
+	Tempo int // play speed part 1: number of ticks per pattern line (default 6)
+	BPM   int // play speed part 2: so-called "beats per minute", but actually freq = curBPM * 0,4 Hz (default 125)
+	SPT   int // samples per tick (depends on the sample rate we are playing at)
+
+	tickLen float64 // exact number of samples per tick (SPT is rounded, with the error carried over)
+	tickErr float64 // samples by which the ticks played so far are shorter than tickLen
+}
+
+// position holds all the parameters which determine the current play position in a MOD file
+type position struct {
+	curPattern int // cur play position part 1: the pattern table index currently played
+	curLine    int // cur play position part 2: the position inside the pattern
+	curTick    int // cur play position part 3: the current tick (curTempo gives the number of ticks until the next pattern line)
+	curTiming  int // cur play position part 4: the number of samples left until the next tick (depends on the sample rate we are playing at)
+}
+
+// PlayerOptions holds the settings with which a Player is created
+type PlayerOptions struct {
+	Start     int           // start from the specified order (pattern table index; out of range: 0)
+	Rate      int           // sample rate of the rendered audio (0: SampleRate)
+	Channels  string        // comma-separated list of channels to play (1-based; empty for all channels)
+	Compat    CompatProfile // tracker compatibility quirks (zero value: detected from the module, see DetectCompat)
+	Loops     int           // how often the song loop is played: intro + Loops times the loop (< 1: once)
+	FadeOut   time.Duration // if > 0: after Loops loops, the song goes on and is faded out over this time
+	FadeCurve FadeCurve     // the shape of the fade out
+	Smooth    bool          // interpolate pitch slides and vibrato/tremolo for every sample instead of once per tick
+	Clock     *MIDIClock    // if set, MIDI clock is sent for the ticks played (by Play)
+	Sync      TempoSync     // if set, the tempo is synchronized with an external session
+	SyncMode  SyncMode
+	OSC       *OSCClient // if set, the rows and notes played are sent as OSC messages (by Play)
+
+	Panning    PanMode // how the channels are placed in the stereo output
+	Separation int     // with PanSeparation: the stereo separation in percent (0: DefaultSeparation)
+	LEDFilter  LEDMode // emulation of the Amiga LED filter
+
+	Resampler Resampler     // computes the sample values between the sample points (nil: DefaultResampler)
+	Engine    Engine        // how the samples are turned into the output
+	Output    OutputFactory // the audio output used by Play (nil: DefaultOutput)
+	Seed      int64         // seed for the random waveforms of vibrato/tremolo (0: a different one for each player)
+	VBlank    bool          // Fxx always sets the ticks per line (old modules using F20+ as speed), whatever the profile
+	DSP       []DSP         // effects applied to the mix, in this order (see SetDSP)
+	Limiter   Limiter       // the master stage which keeps loud mixes from distorting
+	Headroom  float64       // lowers the mix by the given dB before the master stage (e.g. 6 for modules which clip)
+	Normalize float64       // if < 0: scales the mix to this loudness in LUFS (see MeasureLoudness; the song is rendered twice)
+	NoDeclick bool          // change volumes and start notes at once, without ramps (authentic, but with clicks)
+	Workers   int           // with 16 channels or more: number of goroutines rendering the channels in parallel (< 2: none)
+}
+
+// Player plays a mod file
+type Player struct {
+	mod.Module
+	Compat CompatProfile
+
+	position
+	delayLines int       // remaining repetitions of the current line (pattern delay EEx)
+	delayed    bool      // the current line is a repetition of a pattern delay (its notes aren't played again)
+	jumpPos    *position // position to which to jump
+	doLoop     bool      // set to true when we should jump to loopLine
+	loopLine   int       // line to which to loop (inside the current pattern)
+
+	Speed
+	rate int // sample rate
+
+	chans      []Channel // the channels for playing
+	ended      bool      // indicates whether playing has ended
+	skipping   bool      // the channels are advanced without mixing them (simulating the song for seeking)
+	globalVol  int       // global volume (0..64) applied to the mix (XM Gxx, S3M/IT Vxx)
+	globalVolΔ int       // global volume slide per tick (XM Hxy, S3M/IT Wxy)
+	mixDiv     int       // divisor of the mixed channels (64, higher for modules with more than 4 channels)
+	volume     gain      // master volume (SetVolume)
+	master     master    // the headroom and the limiter
+	led        biquad    // the Amiga LED filter
+	ledUsed    bool      // the LED filter may be switched on (so its state has to follow the output)
+	ledOn      bool      // the LED filter is switched on
+
+	sampleCnt int               // number of samples played so far
+	visited   map[lineState]int // sample counts at which line states were played (for detecting song loops)
+	loopKey   []byte            // buffer for the pattern loop counters of a lineState
+	loopCnt   int               // number of times the song has looped so far
+	loops     int               // number of times the song loop should be played
+	fadeLen   int               // length of the fade out after the loops in samples (0: no fade, the song ends)
+	fadeLeft  int               // samples left of the fade out (-1: not fading)
+	LoopStart int               // sample count at which the song loop starts (valid once LoopLen > 0)
+	LoopLen   int               // length of the song loop in samples (0 until the song has looped once)
+
+	history []LineStart // the lines played so far
+	clock   *MIDIClock
+	sync    TempoSync
+	follow  bool // follow the tempo of sync instead of setting it
+	osc     *OSCClient
+	opts    PlayerOptions // the options the player was created with (for seeking)
+
+	onRow         func(order, pattern, row int) // event callbacks (OnRow, OnOrderChange, OnNoteTrigger)
+	onOrderChange func(order, pattern int)
+	onNoteTrigger func(ch int, note mod.Note)
+	events        []event // callbacks of the rendered audio which hasn't been heard yet
+
+	format      SampleFormat // the format of the audio returned by Read (SetFormat)
+	outChannels int
+	stems       [][2]int       // the output of every channel for the last sample (RenderStems; nil: not recorded)
+	replayTime  *time.Duration // time spent processing lines and ticks (Benchmark; nil: not measured)
+	block       *chanBlock     // the output of the channels up to the next line or tick
+	region      *loopRegion    // the section which is looped (SetLoopRegion; nil: none)
+	dither      *ditherer      // quantizes the output to 16 bits (RenderOptions.Dither; nil: truncated)
+	precise     [2]float64     // the last output with its fractions (only kept with dither)
+	dsp         []DSP          // the effects applied to the mix (SetDSP)
+	dspOut      dspBlock       // the mix processed by the effects, rendered ahead
+
+	mu    sync.Mutex // for controlling the player while it is playing
+	state State
+	wake  *sync.Cond    // signalled when the state changes (for resuming the output)
+	done  chan struct{} // closed when the output has finished
+	err   error         // the error with which the output has finished
+}
+
+// State is the playback state of a Player
+type State int
+
+// The playback states
+const (
+	Stopped State = iota // not started yet, or playing has ended
+	Playing
+	Paused
+)
+
+func (s State) String() string {
+	switch s {
+	case Playing:
+		return "playing"
+	case Paused:
+		return "paused"
+	}
+	return "stopped"
+}
+
+// LineStart records when playing of a line started
+type LineStart struct {
+	Order, Pattern, Line int
+	Sample               int // sample count at which the line started
+}
+
+// Channel is an individual channel of a Player
+type Channel struct {
+	index     int       // the number of this channel
+	rate      int       // sample rate of the player
+	steps     []int64   // the steps of the periods at the rate (see stepTable)
+	muted     bool      // channel currently muted?
+	gain      gain      // volume factor of the channel (SetChannelGain)
+	peak      int       // highest output level since the last call of ChannelLevels (for VU meters)
+	active    bool      // is the channel currently playing something? Set to false if the sample has "played out"
+	note      *mod.Note // currently playing note
+	pan       float32   // panning value (0.0 - fully left; 1.0 - fully right)
+	panWidth  float32   // stereo width of the output (1: as panned, 0: mono)
+	resampler Resampler // computes the sample values between the sample points
+	engine    Engine    // how the samples are turned into the output
+	blep      blep      // the state of the PaulaBLEP engine
+	declick   declick   // the ramps of the volume and of started notes
+	pos, step int64     // the position inside the sample and the step with which to advance it (fixed point, see fracBits)
+	//firstTickOfNote bool    // is this the first tick where we play this note?
+	state  *ChannelState  // effect state of this channel, shared with the PPU and VPU
+	compat *CompatProfile // the compatibility profile of the Player
+
+	effect  mod.Effect // the effect of the current line (for the effects applied at later ticks)
+	speed   Speed      // the speed at the current line
+	delayed *mod.Note  // note of a note delay (EDx), started when state.tickCnt reaches 0
+	reused  bool       // the effect is a 900 which repeats the remembered sample offset
+
+	notes       [2]mod.Note // storage of note, used in turns (a new note gets a new address, see noteEvent)
+	delayedNote mod.Note    // storage of delayed
+
+	info ChannelInfo // snapshot of the state for Player.ChannelState
+
+	envelope // the volume envelope of the instrument (XM, IT)
+
+	PeriodProcessor // this channel's "PPU" (period/pitch processing unit)
+	VolumeProcessor // this channel's "VPU" (volume processing unit)
+}
+
+// NewPlayer creates a Player object for the module mod
+func NewPlayer(module mod.Module, opts PlayerOptions) *Player {
+	compat := opts.Compat
+	if compat.Name == "" {
+		compat = CompatProfiles[DetectCompat(module)]
+	}
+	compat.VBlank = compat.VBlank || opts.VBlank
+	if opts.Start < 0 || opts.Start >= len(module.PatternTable) {
+		logEvent(slog.LevelWarn, "start order out of range, playing from the start", "file", module.FileName, "start", opts.Start, "orders", len(module.PatternTable))
+		opts.Start = 0
+	}
+	p := &Player{
+		Module:    module,
+		Compat:    compat,
+		chans:     make([]Channel, module.ChannelCount()),
+		position:  position{curPattern: opts.Start},
+		visited:   map[lineState]int{},
+		loops:     opts.Loops,
+		fadeLeft:  -1,
+		clock:     opts.Clock,
+		sync:      opts.Sync,
+		follow:    opts.SyncMode == SyncFollow,
+		osc:       opts.OSC,
+		opts:      opts,
+		rate:      opts.Rate,
+		globalVol: 64,
+		volume:    newGain(1),
+	}
+	p.outChannels = channelNum
+	p.block = newChanBlock(opts.Workers, len(p.chans))
+	if p.loops < 1 {
+		p.loops = 1
+	}
+	if p.rate <= 0 {
+		p.rate = sampleRate
+	}
+	p.fadeLen = int(opts.FadeOut * time.Duration(p.rate) / time.Second)
+	p.master = newMaster(opts, p.rate)
+	if opts.Normalize < 0 {
+		p.master.gain *= math.Pow(10, MeasureLoudness(module, opts).Gain(opts.Normalize)/20)
+	}
+	p.dsp = append([]DSP(nil), opts.DSP...)
+	// channels beyond the 4 of the Amiga are mixed at a lower volume (by the square root of the
+	// number of channels), so that loud passages don't clip much more often than with 4 channels
+	p.mixDiv = 64
+	if n := len(p.chans); n > 4 {
+		p.mixDiv = int(math.Round(64 * math.Sqrt(float64(n)/4)))
+	}
+	p.led = newLowpass(ledCutoff, p.rate)
+	p.ledUsed = opts.LEDFilter == LEDOn || opts.LEDFilter == LEDAuto && module.Format == mod.FormatMOD
+	p.ledOn = opts.LEDFilter == LEDOn
+	if module.InitialGlobalVol > 0 {
+		p.globalVol = module.InitialGlobalVol
+	}
+	p.Tempo = 6
+	if module.InitialTempo > 0 {
+		p.Tempo = module.InitialTempo
+	}
+	p.setBPM(125)
+	if module.InitialBPM >= 32 {
+		p.setBPM(module.InitialBPM)
+	}
+
+	seed := opts.Seed
+	if seed == 0 {
+		seed = time.Now().UnixNano()
+	}
+	rnd := rand.New(rand.NewSource(seed))
+	resampler := opts.Resampler
+	if resampler == nil {
+		resampler = Resamplers[DefaultResampler]
+	}
+	chanMask := "," + opts.Channels + ","
+	steps := stepTable(p.rate)
+	for i := range p.chans {
+		p.chans[i].index = i
+		p.chans[i].rate = p.rate
+		p.chans[i].steps = steps
+		p.chans[i].compat = &p.Compat
+		p.chans[i].gain = newGain(1)
+		p.chans[i].muted = chanMask != ",," && !strings.Contains(chanMask, fmt.Sprintf(",%d,", i+1))
+		p.chans[i].pan = 0.0
+		p.chans[i].panWidth = panWidth(opts)
+		p.chans[i].resampler = resampler
+		p.chans[i].engine = opts.Engine
+		if !opts.NoDeclick && opts.Engine != PaulaBLEP {
+			p.chans[i].declick.len = p.rate / declickRate
+		}
+		p.chans[i].envelope.volume = 64
+		if i < len(module.ChannelPan) {
+			p.chans[i].pan = float32(module.ChannelPan[i]) / 255
+		} else if i%4 == 1 || i%4 == 2 {
+			p.chans[i].pan = 1.0
+		}
+		p.chans[i].state = NewChannelState(p.SPT)
+		p.chans[i].PeriodProcessor.state = p.chans[i].state
+		p.chans[i].PeriodProcessor.Smooth = opts.Smooth
+		p.chans[i].PeriodProcessor.arpeggioWrap = compat.ArpeggioWrap
+		p.chans[i].state.Vibrato.Smooth = opts.Smooth
+		p.chans[i].state.Tremolo.Smooth = opts.Smooth
+		p.chans[i].state.Vibrato.rnd = rnd
+		p.chans[i].state.Tremolo.rnd = rnd
+		p.chans[i].VolumeProcessor.state = p.chans[i].state
+	}
+	return p
+}
+
+// SetPeriod sets the internal "step" according to the given period value (looked up in the step table
+// for whole periods, e.g. without smooth slides).
+func (ch *Channel) SetPeriod(period float32) {
+	if p := int(period); float32(p) == period && p >= 0 && p < len(ch.steps) {
+		ch.step = ch.steps[p]
+		return
+	}
+	ch.step = periodStep(float64(period), ch.rate)
+}
+
+// OnNote starts a new note on a channel if the note contains an instrument.
+// Some notes only contain effects, which are then applied on the currently playing note.
+// Notes with a note delay (EDx) are started by OnTick.
+func (ch *Channel) OnNote(note mod.Note, speed Speed) {
+	ch.reused = note.EffType == mod.SetSampleOffset && note.Par() == 0
+	note.Effect = ch.state.Recall(note.Effect, ch.compat.Memory)
+	ch.effect, ch.speed, ch.delayed = note.Effect, speed, nil
+	if note.EffType == mod.NoteDelay && note.ParY() > 0 {
+		// the whole note (instrument, period and volume) is started on tick x, the current note
+		// continues until then
+		ch.delayedNote = note
+		ch.delayed = &ch.delayedNote
+		ch.state.tickCnt = note.ParY()
+		return
+	}
+	ch.playNote(note, speed)
+}
+
+// playNote starts the note (or applies its effects on the current note) after OnNote
+func (ch *Channel) playNote(note mod.Note, speed Speed) {
+	if note.InsNum == 0 && note.Period > 0 && ch.note != nil && note.EffType != mod.Portamento && note.EffType != mod.PortamentoVolSlide {
+		// a note without instrument number plays the current sample again
+		note.Ins = ch.note.Ins
+	}
+	if note.Ins != nil && note.Ins.HasSample() && note.Period > 0 && !note.KeyOff {
+		// if we have an instrument, start playing a new note
+		next := &ch.notes[0]
+		if ch.note == next {
+			next = &ch.notes[1]
+		}
+		*next = note
+		ch.noteStarting()
+		ch.note = next
+		//ch.firstTickOfNote = true
+		ch.active = true
+		ch.pos = 0
+		ch.state.pendingIns = nil
+		ch.startEnvelope()
+		if note.EffType != mod.Portamento && note.EffType != mod.PortamentoVolSlide {
+			ch.state.Vibrato.NoteTriggered()
+			ch.state.Tremolo.NoteTriggered()
+		}
+		if note.EffType == mod.SetSampleOffset {
+			// only a note started on the line is moved (900 has already been replaced by the previous
+			// offset, if the profile remembers it); 9xx alone doesn't change the playing sample
+			ch.SetSampleOffset(note.Par() << 8)
+		}
+	} else if note.Ins != nil && note.Ins.HasSample() && ch.note != nil && note.Ins != ch.note.Ins && ch.compat.InstrumentSwap {
+		// instrument without a note: the new sample is picked up at the loop point, without retriggering
+		ch.state.pendingIns = note.Ins
+	}
+	// If we have an effect, set it on new or currently playing note
+	ch.PeriodFromNote(note, speed)
+	//ch.SetPeriod(ch.PeriodProcessor.Next())
+	ch.VolumeFromNote(note, speed)
+
+	/*if ch.firstTickOfNote {
+		fmt.Printf("ch %d -> active, step %f\n", ch.index, ch.step)
+	} //*/
+
+	switch note.EffType {
+	case mod.RetrigNote:
+		// E9x retriggers on the ticks which are multiples of x; E90 doesn't retrigger at all
+		ch.state.tickCnt = note.ParY()
+		if note.ParY() > 0 && note.Period == 0 {
+			ch.retrigger() // tick 0 without a note (a note has just been started)
+		}
+	case mod.NoteCut:
+		// ECx sets the volume to 0 at tick x (EC0: at once); x >= speed doesn't cut
+		ch.state.tickCnt = note.ParY()
+		if note.ParY() == 0 {
+			ch.VolumeProcessor.volume = 0
+		}
+	case mod.KeyOff:
+		ch.keyOffCnt = note.Par()
+	case mod.SetEnvelopePos:
+		ch.envelope.tick = note.Par()
+	case mod.SetPanning:
+		ch.pan = float32(note.Par()) / 255
+	}
+	if note.KeyOff || note.EffType == mod.KeyOff && note.Par() == 0 {
+		ch.release()
+	}
+
+	if ch.pos < fracOne {
+		ch.pos = fracOne
+	}
+}
+
+// retrigger starts the sample of the current note again (E9x)
+func (ch *Channel) retrigger() {
+	if ch.note == nil || ch.note.Ins == nil || !ch.note.Ins.HasSample() {
+		return
+	}
+	ch.noteStarting()
+	ch.active = true
+	ch.pos = fracOne
+	ch.startEnvelope()
+}
+
+// SetSampleOffset sets the play position inside the current sample. Offsets beyond the end of the sample,
+// and with OffsetDouble a 900 repeating the previous offset, are handled according to the compatibility
+// profile.
+func (ch *Channel) SetSampleOffset(offset int) {
+	ins := ch.note.Ins
+	if ch.compat.SampleOffset == OffsetDouble && ch.reused {
+		offset *= 2
+	}
+	if offset < ins.Len-2 {
+		ch.pos = int64(offset) << fracBits
+		return
+	}
+	switch ch.compat.SampleOffset {
+	case OffsetLoop, OffsetDouble:
+		if ins.RepLen > 2 {
+			ch.pos = int64(ins.RepStart+2) << fracBits
+			return
+		}
+	}
+	ch.active = false
+}
+
+// OnTick computes the necessary parameters for the given tick
+func (ch *Channel) OnTick(curTick int) {
+	/*if ch.index == 0 {
+		fmt.Printf("\n\ntick %d\n", curTick)
+	}//*/
+
+	//if !ch.firstTickOfNote {
+	ch.PeriodOnTick(curTick)
+	//ch.SetPeriod(ch.PeriodProcessor.Next())
+	ch.VolumeOnTick(curTick)
+	//}
+	//ch.firstTickOfNote = false
+
+	ch.state.tickCnt--
+	if ch.delayed != nil && ch.state.tickCnt == 0 {
+		// a delay beyond the end of the line doesn't play the note (like ProTracker)
+		if curTick+1 < ch.speed.Tempo {
+			ch.playNote(*ch.delayed, ch.speed)
+			if ch.delayed.Period == 0 && ch.compat.DelayRetrig {
+				ch.retrigger()
+			}
+		}
+		ch.delayed = nil
+	}
+	if ch.keyOffCnt > 0 {
+		if ch.keyOffCnt--; ch.keyOffCnt == 0 {
+			ch.release()
+		}
+	}
+	if ch.note == nil || ch.note.Ins == nil {
+		return
+	}
+	ch.envelopeOnTick()
+	switch ch.effect.EffType {
+	case mod.RetrigNote:
+		if ch.state.tickCnt == 0 && curTick+1 < ch.speed.Tempo {
+			ch.retrigger()
+			ch.state.tickCnt = ch.effect.ParY()
+		}
+	case mod.NoteCut:
+		if ch.state.tickCnt == 0 && curTick+1 < ch.speed.Tempo {
+			ch.VolumeProcessor.volume = 0
+		}
+	}
+
+}
+
+// GetNextSample advances the internal counter and returns the value for the next sample to be
+// played on this channel.
+func (ch *Channel) GetNextSample() (l, r int) {
+	/*if ch.index == 0 {
+		tremolo := ch.VolumeProcessor.DoStep()
+		fmt.Printf("%d ", tremolo)
+	}//*/
+
+	// a muted channel is played like the others (its position and effects go on), only its output is 0
+	if ch.engine == PaulaBLEP {
+		val := ch.nextBLEP()
+		if ch.muted {
+			return 0, 0
+		}
+		pan := float64(ch.outPan())
+		return int(val * (1 - pan)), int(val * pan)
+	}
+	tl, tr := ch.tailSample()
+	if !ch.active {
+		if ch.muted {
+			return 0, 0
+		}
+		return tl, tr
+	}
+	if ch.note == nil || ch.note.Ins == nil || !ch.note.Ins.HasSample() {
+		fmt.Println("ch.note/ch.note.Ins/ch.note.Ins.Sample nil!")
+		return 0, 0
+	}
+	pos, t := int(ch.pos>>fracBits), float32(ch.pos&(fracOne-1))/fracOne
+	ins := ch.note.Ins
+	// the channels are mixed at half the sample range
+	val := int(ch.resample(ins, pos, t) / 2)
+	ch.SetPeriod(ch.PeriodProcessor.Next())
+	ch.pos += ch.step
+	ch.checkSampleEnd()
+
+	//fmt.Println(ch.pos, ch.step, val, ch.volume)
+	if ch.declick.len > 0 {
+		val = int(float32(val) * ch.declick.ramp(float32(ch.VolumeProcessor.Next()*ch.envelope.volume)/64))
+	} else {
+		val = val * ch.VolumeProcessor.Next() * ch.envelope.volume / 64
+	}
+	if ch.muted {
+		return 0, 0
+	}
+	pan := ch.outPan()
+	return int(float32(val)*(1.0-pan)) + tl, int(float32(val)*pan) + tr
+}
+
+// skip advances the channel by a sample like GetNextSample without rendering it: the sample position
+// and the effects go on (used when seeking)
+func (ch *Channel) skip() {
+	ch.declick.tailLeft = 0 // no tails of notes before the position seeked to
+	if !ch.active || ch.note == nil || ch.note.Ins == nil || !ch.note.Ins.HasSample() {
+		return
+	}
+	ch.SetPeriod(ch.PeriodProcessor.Next())
+	ch.pos += ch.step
+	ch.checkSampleEnd()
+	ch.VolumeProcessor.Next() // tremolo
+}
+
+// checkSampleEnd continues at the loop start (or stops playing) when the position has reached the end
+// of the sample
+func (ch *Channel) checkSampleEnd() {
+	if ch.pos >= int64(ch.note.Ins.Len-2)<<fracBits {
+		if ch.state.pendingIns != nil {
+			ch.note.Ins, ch.state.pendingIns = ch.state.pendingIns, nil
+		}
+		if ch.note.Ins.RepLen > 2 {
+			ch.pos = int64(ch.note.Ins.RepStart+2) << fracBits // repeat TODO: handle RepLen - but how?!
+		} else {
+			ch.active = false // played out
+		}
+	}
+}
+
+// nextSamples advances the internal counter and returns the values for the next samples to be
+// played (for left and right stereo channel), before the master stage.
+func (p *Player) nextSamples() (int, int) {
+	var replayStart time.Time
+	if p.replayTime != nil && (p.curTiming == 0 || p.curTiming+1 >= p.SPT) {
+		replayStart = time.Now() // a line or a tick starts
+	}
+	// if we are at the start of a new line, init the notes and effects
+	if p.curTick == 0 && p.curTiming == 0 && !p.delayed {
+		if p.region == nil && p.detectLoop() && p.fadeLeft < 0 {
+			if p.fadeLen == 0 {
+				p.end("looped")
+				return 0, 0
+			}
+			p.fadeLeft = p.fadeLen // the song goes on while fading out
+		}
+		patt := p.Module.PatternTable[p.curPattern]
+		p.history = append(p.history, LineStart{Order: p.curPattern, Pattern: patt, Line: p.curLine, Sample: p.sampleCnt})
+		p.lineEvents(p.history[len(p.history)-1])
+		logEvent(slog.LevelDebug, "line", "order", p.curPattern, "pattern", patt, "line", p.curLine, "sample", p.sampleCnt)
+		if p.osc != nil {
+			p.osc.line(p.sampleCnt, p.curPattern, patt, p.curLine, p.Module.Patterns[patt][p.curLine])
+		}
+		if p.sync != nil && p.follow {
+			if bpm := int(math.Round(p.sync.Tempo())); bpm != p.BPM && bpm >= 32 {
+				p.setBPM(bpm)
+			}
+		}
+
+		p.jumpPos = nil
+		p.doLoop = false
+		p.globalVolΔ = 0
+		for i := range p.chans {
+			note := p.Module.Patterns[patt][p.curLine][i]
+			note.Effect = p.Compat.filter(note.Effect)
+			if p.opts.Panning == PanReal && p.Module.Format == mod.FormatMOD {
+				note.Effect = realPanning(note.Effect)
+			}
+			if note.EffCode != 0 {
+				logEvent(slog.LevelDebug, "effect", "channel", i, "effect", note.EffType, "x", note.ParX(), "y", note.ParY())
+			}
+			prev := p.chans[i].note
+			p.chans[i].OnNote(note, p.Speed)
+			p.noteEvent(i, prev)
+			p.chans[i].updateInfo()
+
+			switch note.EffType {
+			// we only take care of global position/timing commands here, the rest are handled by the channel or its PPU/VPU
+			case mod.PositionJump, mod.PatternBreak:
+				// Bxx and Dxx on the same line combine: Bxx gives the order, Dxx the line
+				if p.jumpPos == nil {
+					p.jumpPos = &position{curPattern: p.curPattern + 1}
+				}
+				if note.EffType == mod.PositionJump {
+					p.jumpPos.curPattern = note.Par()
+				} else if newLine := note.ParX()*10 + note.ParY(); newLine < 64 { // BCD
+					p.jumpPos.curLine = newLine
+				}
+				if p.jumpPos.curPattern >= len(p.Module.PatternTable) {
+					p.jumpPos.curPattern = 0
+				}
+			case mod.PatternLoop:
+				// with several loops on the line, the last channel gives the line to loop to
+				if line, ok := p.chans[i].state.PatternLoop(p.curLine, note.ParY()); ok {
+					p.doLoop, p.loopLine = true, line
+					if p.jumpPos != nil && p.Compat.LoopBreakLine {
+						// ProTracker keeps a single line for breaks and loops: the jump goes to the loop start
+						p.jumpPos.curLine = line
+					}
+				}
+			case mod.PatternDelay:
+				p.delayLines = note.ParY()
+			case mod.SetFilter:
+				if p.opts.LEDFilter == LEDAuto {
+					p.ledOn = note.ParY() == 0
+				}
+			case mod.SetGlobalVolume:
+				p.globalVol = note.Par()
+				if p.globalVol > 64 {
+					p.globalVol = 64
+				}
+			case mod.GlobalVolSlide:
+				if note.ParX() > 0 {
+					p.globalVolΔ = note.ParX()
+				} else {
+					p.globalVolΔ = -note.ParY()
+				}
+			case mod.SetSpeed:
+				// F00 is ignored; in VBlank mode (old modules timed by the vertical blank), F20 and
+				// above set the ticks per line as well
+				switch {
+				case note.Par() == 0:
+				case note.Par() <= 0x1F || p.Compat.VBlank:
+					p.Tempo = note.Par()
+				case p.sync == nil || !p.follow:
+					p.setBPM(note.Par())
+					if p.sync != nil {
+						p.sync.SetTempo(float64(p.BPM))
+					}
+				}
+			}
+		}
+	}
+
+	if p.curTiming == 0 && p.clock != nil {
+		p.clock.tick(p.sampleCnt)
+	}
+	p.curTiming++
+	if p.curTiming >= p.SPT {
+		// some effects have to be reapplied with each tick
+		for i := range p.chans {
+			prev := p.chans[i].note
+			p.chans[i].OnTick(p.curTick)
+			p.noteEvent(i, prev)
+			p.chans[i].updateInfo()
+		}
+		if p.globalVolΔ != 0 {
+			p.globalVol = clamp(p.globalVol+p.globalVolΔ, 0, 64)
+		}
+		p.curTiming = 0
+		p.curTick++
+		p.nextTick()
+	}
+	if p.curTick >= p.Tempo {
+		// end of line - here we have to do one of several things depending on whether we have...
+		p.curTiming, p.curTick = 0, 0
+		p.delayed = p.delayLines > 0
+		switch {
+		case p.delayed: // (1) a delay (the line is repeated first, without its notes)...
+			p.delayLines--
+		case p.region.endsAt(p.position): // (2) the end of the section looped by SetLoopRegion...
+			p.position = p.region.start
+		case p.jumpPos != nil: // (3) a jump (which wins over a loop on the same line, like in ProTracker)...
+			p.position = *(p.jumpPos)
+		case p.doLoop: // (4) a loop...
+			p.curLine = p.loopLine
+		default: // or (5) none of the above
+			p.curLine++
+		}
+	}
+	if p.curLine >= p.patternLen() {
+		p.curTiming, p.curTick, p.curLine = 0, 0, 0
+		p.curPattern++
+	}
+	if p.curPattern >= len(p.Module.PatternTable) {
+		p.end("end of song")
+		return 0, 0
+	}
+
+	if p.fadeLeft == 0 {
+		p.end("faded out")
+		return 0, 0
+	}
+	if !replayStart.IsZero() {
+		*p.replayTime += time.Since(replayStart)
+	}
+	p.sampleCnt++
+	if p.skipping {
+		for i := range p.chans {
+			p.chans[i].skip()
+		}
+		if p.fadeLeft > 0 {
+			p.fadeLeft--
+		}
+		return 0, 0
+	}
+
+	// mix the current value from all channels
+	mix := p.blockSample()
+	g := p.volume.next()
+	if p.fadeLeft > 0 {
+		g *= p.opts.FadeCurve.fadeGain(p.fadeLeft, p.fadeLen)
+		p.fadeLeft--
+	}
+	if p.dither != nil {
+		return p.preciseMix(mix, g)
+	}
+	if g != 1 {
+		mix[0], mix[1] = int(float64(mix[0])*g), int(float64(mix[1])*g)
+	}
+	l, r := mix[0]*p.globalVol/p.mixDiv, mix[1]*p.globalVol/p.mixDiv
+	if p.ledUsed {
+		l, r = p.ledFilter(l, r)
+	}
+	return l, r
+}
+
+// clamp limits v to the range lo..hi
+func clamp(v, lo, hi int) int {
+	if v < lo {
+		return lo
+	}
+	if v > hi {
+		return hi
+	}
+	return v
+}
+
+// patternLen returns the number of lines of the pattern at the current order
+func (p *Player) patternLen() int {
+	if p.curPattern >= len(p.Module.PatternTable) {
+		return 64
+	}
+	return len(p.Module.Patterns[p.Module.PatternTable[p.curPattern]])
+}
+
+// lineState is the state in which a line is played, for detecting song loops
+type lineState struct {
+	order, line, tempo, bpm int
+	loops                   string // the pattern loop counters of the channels (empty if they are all 0)
+}
+
+// detectLoop checks whether the line we are about to play has been played before in the same state, i.e.
+// whether the song loops. It returns true if playing should end because the song has looped often enough.
+func (p *Player) detectLoop() bool {
+	key := lineState{order: p.curPattern, line: p.curLine, tempo: p.Tempo, bpm: p.BPM}
+	for i := range p.chans {
+		if p.chans[i].state.loopCnt == 0 {
+			continue
+		}
+		// most lines are outside of pattern loops, only the others need a string (allocated)
+		p.loopKey = p.loopKey[:0]
+		for j := range p.chans {
+			p.loopKey = append(strconv.AppendInt(p.loopKey, int64(p.chans[j].state.loopCnt), 10), ',')
+		}
+		key.loops = string(p.loopKey)
+		break
+	}
+	start, seen := p.visited[key]
+	if !seen {
+		p.visited[key] = p.sampleCnt
+		return false
+	}
+	if p.LoopLen == 0 {
+		p.LoopStart, p.LoopLen = start, p.sampleCnt-start
+	}
+	p.loopCnt++
+	logEvent(slog.LevelInfo, "song looped", "file", p.Module.FileName, "loop", p.loopCnt, "start", p.LoopStart, "length", p.LoopLen)
+	// the lines of the loop will be played again, so their first occurrence is now the current one (the
+	// map is reused)
+	for k := range p.visited {
+		delete(p.visited, k)
+	}
+	p.visited[key] = p.sampleCnt
+	return p.loopCnt >= p.loops
+}
+
+// Mute mutes (on) or unmutes a channel (0-based); the channel goes on playing silently (its sample
+// position and effects advance), so it is in time when it is unmuted. It may be called while playing.
+func (p *Player) Mute(ch int, on bool) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if ch >= 0 && ch < len(p.chans) {
+		p.chans[ch].muted = on
+	}
+}
+
+// Solo plays only the channel ch (0-based) and mutes all others; a negative ch unmutes all channels
+func (p *Player) Solo(ch int) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	for i := range p.chans {
+		p.chans[i].muted = ch >= 0 && i != ch
+	}
+}
+
+// Muted reports whether the channel ch (0-based) is muted
+func (p *Player) Muted(ch int) bool {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return ch >= 0 && ch < len(p.chans) && p.chans[ch].muted
+}
+
+// Stop ends playing (also when paused) and waits until the audio output has been closed. A stopped
+// Player can only be played again after seeking.
+func (p *Player) Stop() {
+	p.mu.Lock()
+	if !p.ended {
+		p.end("stopped")
+	}
+	p.setState(Stopped)
+	done := p.done
+	p.mu.Unlock()
+	if done != nil {
+		<-done
+	}
+}
+
+// Pause pauses the audio output (the audio already sent to the output is still played)
+func (p *Player) Pause() {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.state != Playing {
+		return
+	}
+	p.setState(Paused)
+	if p.clock != nil {
+		p.clock.Stop()
+	}
+	logEvent(slog.LevelInfo, "playback paused", "file", p.Module.FileName, "samples", p.sampleCnt)
+}
+
+// Resume continues playing after Pause
+func (p *Player) Resume() {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.state != Paused {
+		return
+	}
+	if p.clock != nil {
+		p.clock.Continue(p.sampleCnt)
+	}
+	if p.osc != nil {
+		p.osc.startAt(p.sampleCnt)
+	}
+	p.setState(Playing)
+	logEvent(slog.LevelInfo, "playback resumed", "file", p.Module.FileName, "samples", p.sampleCnt)
+}
+
+// State returns the current playback state
+func (p *Player) State() State {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.state
+}
+
+// IsPlaying reports whether the player is playing (and not paused)
+func (p *Player) IsPlaying() bool {
+	return p.State() == Playing
+}
+
+// IsPaused reports whether the player is paused
+func (p *Player) IsPaused() bool {
+	return p.State() == Paused
+}
+
+// setState changes the state and wakes the output (p.mu must be held)
+func (p *Player) setState(s State) {
+	p.state = s
+	if p.wake != nil {
+		p.wake.Broadcast()
+	}
+}
+
+// setBPM sets the BPM and the tick length depending on it (CIA timing: a tick lasts 2.5/BPM seconds)
+func (p *Player) setBPM(bpm int) {
+	p.BPM = bpm
+	p.tickLen = float64(p.rate) / (.4 * float64(bpm))
+	p.SPT = int(p.tickLen)
+}
+
+// nextTick sets the length of the next tick: SPT is one sample longer when the rounding error of the
+// previous ticks adds up to a sample
+func (p *Player) nextTick() {
+	p.SPT = int(p.tickLen)
+	p.tickErr += p.tickLen - float64(p.SPT)
+	if p.tickErr >= 1 {
+		p.SPT++
+		p.tickErr--
+	}
+}
+
+// end stops playing
+func (p *Player) end(reason string) {
+	p.ended = true
+	logEvent(slog.LevelInfo, "playback ended", "file", p.Module.FileName, "reason", reason, "samples", p.sampleCnt)
+}
+
+// CueSheet returns a cue sheet with one track per order played so far
+func (p *Player) CueSheet(file string) CueSheet {
+	toDuration := func(samples int) time.Duration {
+		return time.Duration(samples) * time.Second / time.Duration(p.rate)
+	}
+	cs := CueSheet{Title: p.Module.Name, File: file, End: toDuration(p.sampleCnt)}
+	for i, st := range p.history {
+		if i > 0 && p.history[i-1].Order == st.Order {
+			continue
+		}
+		cs.Tracks = append(cs.Tracks, CueTrack{
+			Title: fmt.Sprintf("Order %d (pattern %d)", st.Order, st.Pattern),
+			Start: toDuration(st.Sample),
+		})
+	}
+	return cs
+}
+
+// LineAt returns the line which was playing at the given sample count (ok is false if it's not known)
+func (p *Player) LineAt(sample int) (ls LineStart, ok bool) {
+	i := sort.Search(len(p.history), func(i int) bool { return p.history[i].Sample > sample })
+	if i == 0 {
+		return ls, false
+	}
+	return p.history[i-1], true
+}
+
+// ChannelLevels returns the peak output level of every channel since the last call (0: silent, 1: a
+// sample at full volume), e.g. for VU meters
+func (p *Player) ChannelLevels() []float64 {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	levels := make([]float64, len(p.chans))
+	for i := range p.chans {
+		levels[i] = math.Min(float64(p.chans[i].peak)/channelFullLevel, 1)
+		p.chans[i].peak = 0
+	}
+	return levels
+}
+
+// heardSample returns the number of samples heard so far: while playing through the audio output, the
+// rendered samples which are still buffered are not counted yet
+func (p *Player) heardSample() int {
+	if p.done != nil && p.sampleCnt > outputLatency {
+		return p.sampleCnt - outputLatency
+	}
+	return p.sampleCnt
+}
+
+// HeardLine returns the line which is heard right now (see Position)
+func (p *Player) HeardLine() (ls LineStart, ok bool) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.LineAt(p.heardSample())
+}
+
+// PlayPosition is the position in the song which is heard, returned by Position
+type PlayPosition struct {
+	Order, Pattern, Row int
+	Tick                int           // tick of the row (0..Tempo-1)
+	Elapsed             time.Duration // play time of the audio heard so far
+}
+
+// Position returns the position in the song which is heard right now, e.g. for a progress bar and a time
+// display. While playing through the audio output, the rendered samples which are still buffered are not
+// counted yet, so the position matches what is heard.
+func (p *Player) Position() PlayPosition {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	sample := p.heardSample()
+	pos := PlayPosition{Elapsed: time.Duration(sample) * time.Second / time.Duration(p.rate)}
+	if sample == p.sampleCnt && !p.ended && p.curPattern < len(p.PatternTable) {
+		// nothing buffered: the replay state is heard (also right after seeking, before the line starts)
+		pos.Order, pos.Pattern, pos.Row, pos.Tick = p.curPattern, p.PatternTable[p.curPattern], p.curLine, p.curTick
+	} else if ls, ok := p.LineAt(sample); ok {
+		pos.Order, pos.Pattern, pos.Row = ls.Order, ls.Pattern, ls.Line
+		if p.SPT > 0 && p.Tempo > 0 {
+			pos.Tick = (sample - ls.Sample) / p.SPT % p.Tempo
+		}
+	}
+	return pos
+}
+
+// LoopRegion implements the LoopRegioner interface: if playing has ended because the song looped,
+// it returns the sample positions of the last loop pass, which can be repeated seamlessly
+func (p *Player) LoopRegion() (start, end int, ok bool) {
+	if !p.ended || p.loopCnt < p.loops || p.LoopLen == 0 || p.fadeLen > 0 {
+		return 0, 0, false
+	}
+	return p.sampleCnt - p.LoopLen, p.sampleCnt, true
+}
+
+// Read implements the Reader interface for Player: it renders the audio in the format set by SetFormat
+// (default: 16-bit stereo), as many whole frames as fit into buf. The event callbacks of the rendered
+// audio are called before it returns.
+func (p *Player) Read(buf []byte) (int, error) {
+	n, err := p.read(buf, false)
+	p.dispatch(0)
+	return n, err
+}
+
+// read renders the audio into buf; for the audio output, always as 16-bit stereo
+func (p *Player) read(buf []byte, output bool) (int, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.ended {
+		return 0, io.EOF
+	}
+
+	f, channels := p.format, p.outChannels
+	if output {
+		f, channels = FormatInt16, channelNum
+	}
+	size := f.Bytes()
+	bufLen := len(buf) / (size * channels) * size * channels
+	p.dspOut.frames = bufLen / (size * channels)
+	for bufIdx := 0; bufIdx < bufLen; bufIdx += size * channels {
+		l, r := p.GetNextSamples()
+
+		if p.ended {
+			bufLen = bufIdx
+			break
+		}
+		if p.dither != nil && f == FormatInt16 {
+			if channels == 1 {
+				l = p.dither.quantize(0, (p.precise[0]+p.precise[1])/2)
+				r = l
+			} else {
+				l, r = p.dither.quantize(0, p.precise[0]), p.dither.quantize(1, p.precise[1])
+			}
+		}
+
+		if channels == 1 {
+			f.put(buf[bufIdx:], (l+r)/2)
+		} else {
+			f.put(buf[bufIdx:], l)
+			f.put(buf[bufIdx+size:], r)
+		}
+	}
+	return bufLen, nil
+}
+
+// Play plays a module (blocks until playing has ended)
+func Play(module mod.Module, opts PlayerOptions) error {
+	mp := NewPlayer(module, opts)
+	if err := mp.Play(); err != nil {
+		return err
+	}
+	return mp.Wait()
+}
+
+// Play starts playing the module through the audio output and returns immediately; use Wait to
+// wait until playing has ended. Play also resumes a paused player.
+func (mp *Player) Play() error {
+	if mp.State() == Paused {
+		mp.Resume()
+		return nil
+	}
+	mp.mu.Lock()
+	defer mp.mu.Unlock()
+	switch {
+	case mp.state != Stopped:
+		return nil
+	case mp.ended:
+		return errors.New("playing has ended")
+	}
+	out, err := openOutput(mp.opts.Output, mp.rate)
+	if err != nil {
+		return err
+	}
+
+	logEvent(slog.LevelInfo, "playback started", "file", mp.Module.FileName, "start", mp.curPattern)
+	if mp.sync != nil {
+		if mp.follow {
+			mp.sync.WaitForBar()
+		} else {
+			mp.sync.SetTempo(float64(mp.BPM))
+		}
+	}
+	if mp.clock != nil {
+		mp.clock.rate = mp.rate
+		mp.clock.Start()
+	}
+	if mp.osc != nil {
+		mp.osc.rate = mp.rate
+		mp.osc.Start()
+	}
+	mp.wake = sync.NewCond(&mp.mu)
+	mp.done = make(chan struct{})
+	mp.state = Playing
+	go mp.output(out)
+	return nil
+}
+
+// Wait blocks until playing has ended (or the player has been stopped) and returns the error of the
+// audio output, if any
+func (mp *Player) Wait() error {
+	mp.mu.Lock()
+	done := mp.done
+	mp.mu.Unlock()
+	if done == nil {
+		return nil
+	}
+	<-done
+	return mp.err
+}
+
+// output copies the rendered audio to the audio output, holding back while the player is paused
+func (mp *Player) output(out Output) {
+	buf := make([]byte, bufferSize)
+	w := &outputWriter{out: out}
+	var err error
+	for {
+		mp.mu.Lock()
+		for mp.state == Paused {
+			mp.wake.Wait()
+		}
+		mp.mu.Unlock()
+
+		var n int
+		n, err = mp.read(buf, true)
+		if err != nil {
+			break
+		}
+		if _, err = w.Write(buf[:n]); err != nil {
+			break
+		}
+		mp.dispatch(outputLatency)
+	}
+	mp.dispatch(0)
+	if err == io.EOF {
+		err = nil
+	}
+	if cerr := out.Close(); err == nil {
+		err = cerr
+	}
+
+	mp.mu.Lock()
+	if mp.clock != nil {
+		mp.clock.Stop()
+	}
+	mp.err = err
+	mp.setState(Stopped)
+	close(mp.done)
+	mp.mu.Unlock()
+}
@@ -1,12 +1,14 @@
-package main
+package player
 
 import (
 	"io"
+
+	"github.com/b0nefish/go-modplayer/mod"
 )
 
 // SamplePlayer plays a single sample
 type SamplePlayer struct {
-	Instrument
+	mod.Instrument
 	periods   []int
 	curPeriod int
 	pos, step float32
@@ -14,7 +16,7 @@ type SamplePlayer struct {
 }
 
 // NewSamplePlayer creates a SamplaPlayer object for the instrument ins
-func NewSamplePlayer(ins Instrument, periods []int) *SamplePlayer {
+func NewSamplePlayer(ins mod.Instrument, periods []int) *SamplePlayer {
 	return &SamplePlayer{
 		Instrument: ins,
 		periods:    periods,
@@ -33,10 +35,10 @@ func (sp *SamplePlayer) Read(buf []byte) (int, error) {
 
 	var bufLen = len(buf)
 	for bufIdx := 0; bufIdx < len(buf); bufIdx++ {
-		buf[bufIdx] = byte(sp.Sample[int(sp.pos)])
+		buf[bufIdx] = byte(sp.At(int(sp.pos)))
 
 		sp.pos += sp.step
-		if int(sp.pos) >= len(sp.Sample) {
+		if int(sp.pos) >= sp.Len {
 			sp.curPeriod++
 			sp.pos = 0
 			if sp.curPeriod >= len(sp.periods) {
@@ -54,14 +56,18 @@ func (sp *SamplePlayer) Read(buf []byte) (int, error) {
 }
 
 // PlaySample plays an instrument
-func PlaySample(ins Instrument) error {
-	p := ctx.NewPlayer()
+func PlaySample(ins mod.Instrument) error {
+	out, err := openOutput(nil, sampleRate)
+	if err != nil {
+		return err
+	}
+	p := &outputWriter{out: out}
 
 	sp := NewSamplePlayer(ins, []int{856, 428, 214})
-	if _, err := io.Copy(p, sp); err != nil {
+	if _, err := copyRendered(p, sp); err != nil {
 		return err
 	}
-	if err := p.Close(); err != nil {
+	if err := out.Close(); err != nil {
 		return err
 	}
 	return nil
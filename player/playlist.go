@@ -0,0 +1,203 @@
+package player
+
+import (
+	"encoding/binary"
+	"io"
+	"log/slog"
+	"math"
+	"math/rand"
+	"time"
+
+	"github.com/b0nefish/go-modplayer/mod"
+)
+
+// Playlist plays several modules one after the other, without gaps: the next module starts with the
+// sample after the end of the last one (which ends at its end, or after PlayerOptions.Loops loops), or
+// fades in while the last one fades out (Crossfade)
+type Playlist struct {
+	Files     []string
+	Opts      PlayerOptions
+	Shuffle   bool                          // play the files in random order (a new one for each repetition)
+	Repeat    bool                          // start again after the last file
+	Crossfade time.Duration                 // the length of the crossfade between two modules (0: none)
+	OnTrack   func(fn string, m mod.Module) // if set, called when a module starts
+	OnError   func(fn string, err error)    // if set, called when a module can't be loaded (it is skipped)
+
+	order  []int   // the order in which the files are played in the current pass
+	idx    int     // index in order of the next file
+	loaded bool    // a file of the current pass could be loaded (so repeating doesn't spin)
+	cur    *Player // the player of the current module
+	module mod.Module
+	rnd    *rand.Rand
+
+	// with Crossfade: the audio rendered but not yet returned; the last Crossfade of it is held back, so
+	// that it is mixed with the start of the next module if the current one ends there
+	pending []byte
+	buf     []byte // the memory of pending, reused
+	head    []byte // the start of the next module, reused
+}
+
+// NewPlaylist creates a Playlist for the given files (see mod.ExpandPlaylist for directories and
+// playlist files). With PlayerOptions.Seed, the shuffled order is reproducible.
+func NewPlaylist(files []string, opts PlayerOptions) *Playlist {
+	seed := opts.Seed
+	if seed == 0 {
+		seed = time.Now().UnixNano()
+	}
+	return &Playlist{Files: files, Opts: opts, rnd: rand.New(rand.NewSource(seed))}
+}
+
+// next starts the next module which can be loaded; it returns false at the end of the playlist
+func (pl *Playlist) next() bool {
+	for {
+		if pl.order == nil || pl.idx >= len(pl.order) {
+			if pl.order != nil && (!pl.Repeat || !pl.loaded) {
+				return false
+			}
+			pl.order, pl.idx, pl.loaded = make([]int, len(pl.Files)), 0, false
+			for i := range pl.order {
+				pl.order[i] = i
+			}
+			if pl.Shuffle {
+				pl.rnd.Shuffle(len(pl.order), func(i, j int) { pl.order[i], pl.order[j] = pl.order[j], pl.order[i] })
+			}
+			if len(pl.order) == 0 {
+				return false
+			}
+		}
+		fn := pl.Files[pl.order[pl.idx]]
+		pl.idx++
+		module, err := mod.LoadFile(fn)
+		if err != nil {
+			logEvent(slog.LevelError, "module could not be loaded", "file", fn, "error", err)
+			if pl.OnError != nil {
+				pl.OnError(fn, err)
+			}
+			continue
+		}
+		pl.loaded = true
+		logEvent(slog.LevelInfo, "track started", "file", fn)
+		if pl.OnTrack != nil {
+			pl.OnTrack(fn, module)
+		}
+		pl.module, pl.cur = module, NewPlayer(module, pl.Opts)
+		return true
+	}
+}
+
+// Read renders the audio of the playlist (see Player.Read); it returns io.EOF after the last module
+func (pl *Playlist) Read(buf []byte) (int, error) {
+	buf = buf[:len(buf)/(bitDepthInBytes*channelNum)*bitDepthInBytes*channelNum]
+	if len(buf) == 0 {
+		return 0, nil // not even a frame
+	}
+	if pl.Crossfade > 0 {
+		return pl.readCrossfaded(buf)
+	}
+	for {
+		if pl.cur == nil && !pl.next() {
+			return 0, io.EOF
+		}
+		n, err := pl.cur.Read(buf)
+		if err == io.EOF || pl.cur.ended {
+			pl.module.Close()
+			pl.cur = nil
+			err = nil
+		}
+		if n > 0 || err != nil {
+			return n, err
+		}
+	}
+}
+
+// readCrossfaded is Read with Crossfade: the modules are rendered ahead by the length of the crossfade
+func (pl *Playlist) readCrossfaded(buf []byte) (int, error) {
+	const frame = bitDepthInBytes * channelNum
+	rate := pl.Opts.Rate
+	if rate == 0 {
+		rate = sampleRate
+	}
+	fadeLen := int(pl.Crossfade*time.Duration(rate)/time.Second) * frame
+	for {
+		if pl.cur == nil {
+			if !pl.next() {
+				// the end of the playlist: the rest is returned as it is
+				if len(pl.pending) == 0 {
+					return 0, io.EOF
+				}
+				n := copy(buf, pl.pending)
+				pl.pending = pl.pending[n:]
+				return n, nil
+			}
+			if len(pl.pending) > 0 {
+				pl.fadeIn()
+			}
+		}
+		if pl.cur != nil && len(pl.pending) < fadeLen+len(buf) {
+			// the pending audio is moved to the start of its memory, which is reused
+			pl.pending = append(pl.buf[:0], pl.pending...)
+			for pl.cur != nil && len(pl.pending) < fadeLen+len(buf) {
+				pl.pending = pl.renderAhead(pl.pending, fadeLen+len(buf)-len(pl.pending))
+			}
+			pl.buf = pl.pending
+		}
+		if n := len(pl.pending) - fadeLen; n > 0 {
+			n = copy(buf, pl.pending[:n])
+			pl.pending = pl.pending[n:]
+			return n, nil
+		}
+	}
+}
+
+// renderAhead appends up to size bytes of the current module to buf; the current module is closed when
+// it ends
+func (pl *Playlist) renderAhead(buf []byte, size int) []byte {
+	n := len(buf)
+	buf = append(buf, make([]byte, size)...)
+	m, err := pl.cur.Read(buf[n:])
+	if err == io.EOF || pl.cur.ended {
+		pl.module.Close()
+		pl.cur = nil
+	}
+	return buf[:n+m]
+}
+
+// fadeIn mixes the start of the module which has just been started into the end of the last one (the
+// pending audio), with an equal-power crossfade
+func (pl *Playlist) fadeIn() {
+	const frame = bitDepthInBytes * channelNum
+	head := pl.head[:0]
+	for pl.cur != nil && len(head) < len(pl.pending) {
+		head = pl.renderAhead(head, len(pl.pending)-len(head))
+	}
+	pl.head = head
+	frames := len(pl.pending) / frame
+	for i := 0; i < len(pl.pending); i += bitDepthInBytes {
+		t := (float64(i/frame) + 0.5) / float64(frames) * math.Pi / 2
+		x := float64(int16(binary.LittleEndian.Uint16(pl.pending[i:]))) * math.Cos(t)
+		if i < len(head) {
+			x += float64(int16(binary.LittleEndian.Uint16(head[i:]))) * math.Sin(t)
+		}
+		FormatInt16.put(pl.pending[i:], int(math.Round(x)))
+	}
+	if len(head) > len(pl.pending) {
+		pl.pending = append(pl.pending, head[len(pl.pending):]...)
+	}
+}
+
+// Play plays the playlist through the audio output (blocks until the last module has ended)
+func (pl *Playlist) Play() error {
+	rate := pl.Opts.Rate
+	if rate == 0 {
+		rate = sampleRate
+	}
+	out, err := openOutput(pl.Opts.Output, rate)
+	if err != nil {
+		return err
+	}
+	_, err = copyRendered(&outputWriter{out: out}, pl)
+	if cerr := out.Close(); err == nil {
+		err = cerr
+	}
+	return err
+}
@@ -0,0 +1,24 @@
+package player
+
+import (
+	"io"
+	"sync"
+)
+
+// copyBufferSize is the size of the buffers in which rendered audio is copied into writers
+const copyBufferSize = 32 * 1024
+
+// copyBuffers holds the buffers of copyRendered, so that rendering many files (or a playlist) doesn't
+// allocate a new one each time
+var copyBuffers = sync.Pool{New: func() any {
+	buf := make([]byte, copyBufferSize)
+	return &buf
+}}
+
+// copyRendered is io.Copy with a buffer from copyBuffers
+func copyRendered(w io.Writer, r io.Reader) (int64, error) {
+	buf := copyBuffers.Get().(*[]byte)
+	defer copyBuffers.Put(buf)
+	// hides ReadFrom (e.g. of os.File) and WriteTo, which would copy through a buffer of their own
+	return io.CopyBuffer(struct{ io.Writer }{w}, struct{ io.Reader }{r}, *buf)
+}
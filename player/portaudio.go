@@ -0,0 +1,80 @@
+//go:build portaudio
+
+// The PortAudio output needs the PortAudio library (and cgo):
+//
+//	go build -tags portaudio ./cmd/modplayer
+
+package player
+
+import "github.com/gordonklaus/portaudio"
+
+// portAudioFrames is the size of the PortAudio buffer in frames (stereo samples); smaller than the
+// buffer of oto, for a lower latency
+const portAudioFrames = 256
+
+func init() {
+	Outputs["portaudio"] = OpenPortAudioOutput
+}
+
+// portAudioOutput is the Output of PortAudio, using its blocking API
+type portAudioOutput struct {
+	stream *portaudio.Stream
+	buf    []int16 // the buffer of the stream
+	n      int     // number of samples in buf
+}
+
+// OpenPortAudioOutput opens the default output device of PortAudio
+func OpenPortAudioOutput(rate int) (Output, error) {
+	if err := portaudio.Initialize(); err != nil {
+		return nil, err
+	}
+	o := &portAudioOutput{buf: make([]int16, portAudioFrames*channelNum)}
+	stream, err := portaudio.OpenDefaultStream(0, channelNum, float64(rate), portAudioFrames, &o.buf)
+	if err == nil {
+		if err = stream.Start(); err != nil {
+			stream.Close()
+		}
+	}
+	if err != nil {
+		portaudio.Terminate()
+		return nil, err
+	}
+	o.stream = stream
+	return o, nil
+}
+
+func (o *portAudioOutput) Write(samples []int16) error {
+	for len(samples) > 0 {
+		c := copy(o.buf[o.n:], samples)
+		o.n += c
+		samples = samples[c:]
+		if o.n == len(o.buf) {
+			if err := o.stream.Write(); err != nil {
+				return err
+			}
+			o.n = 0
+		}
+	}
+	return nil
+}
+
+// Close plays the rest of the buffer (filled up with silence) and closes the stream
+func (o *portAudioOutput) Close() error {
+	var err error
+	if o.n > 0 {
+		for i := o.n; i < len(o.buf); i++ {
+			o.buf[i] = 0
+		}
+		err = o.stream.Write()
+	}
+	if serr := o.stream.Stop(); err == nil {
+		err = serr
+	}
+	if cerr := o.stream.Close(); err == nil {
+		err = cerr
+	}
+	if terr := portaudio.Terminate(); err == nil {
+		err = terr
+	}
+	return err
+}
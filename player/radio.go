@@ -0,0 +1,150 @@
+package player
+
+import (
+	"encoding/binary"
+	"io"
+	"log/slog"
+	"math"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/b0nefish/go-modplayer/mod"
+)
+
+// radioChunk is the duration of the audio blocks a Radio renders and sends to its clients
+const radioChunk = 100 * time.Millisecond
+
+// radioClientBuffer is the number of chunks buffered per client before chunks are dropped
+const radioClientBuffer = 20
+
+// Radio streams modules in real time as an endless WAV stream over HTTP: all clients hear the same audio,
+// like a web radio. The files are played in order, over and over again.
+type Radio struct {
+	Files   []string
+	Opts    PlayerOptions
+	Metrics *Metrics
+
+	mu      sync.Mutex
+	clients map[chan []byte]bool
+}
+
+// NewRadio creates a Radio playing the given files
+func NewRadio(files []string, opts PlayerOptions) *Radio {
+	return &Radio{Files: files, Opts: opts, Metrics: &Metrics{}, clients: map[chan []byte]bool{}}
+}
+
+// rate returns the sample rate of the stream
+func (r *Radio) rate() int {
+	if r.Opts.Rate > 0 {
+		return r.Opts.Rate
+	}
+	return sampleRate
+}
+
+// ListenAndServe starts playing and serves the stream at / and the metrics at /metrics
+func (r *Radio) ListenAndServe(addr string) error {
+	go r.run()
+	mux := http.NewServeMux()
+	mux.Handle("/metrics", r.Metrics)
+	mux.HandleFunc("/", r.serveStream)
+	return http.ListenAndServe(addr, mux)
+}
+
+// run renders the modules and passes the audio on to the clients, paced to real time
+func (r *Radio) run() {
+	chunkLen := int(time.Duration(r.rate())*radioChunk/time.Second) * channelNum * bitDepthInBytes
+	next := time.Now()
+	for {
+		loaded := 0
+		for _, fn := range r.Files {
+			module, err := mod.LoadFile(fn)
+			if err != nil {
+				logEvent(slog.LevelError, "module could not be loaded", "file", fn, "error", err)
+				r.Metrics.DecodeErrors.Add(1)
+				continue
+			}
+			loaded++
+			logEvent(slog.LevelInfo, "track started", "file", fn, "clients", r.Metrics.Clients.Load())
+			mp := NewPlayer(module, r.Opts)
+			for {
+				buf := make([]byte, chunkLen)
+				n, err := io.ReadFull(mp, buf)
+				if n > 0 {
+					r.broadcast(buf[:n])
+				}
+				if err != nil {
+					break
+				}
+				next = next.Add(radioChunk)
+				if wait := time.Until(next); wait > 0 {
+					time.Sleep(wait)
+				} else if wait < -radioChunk {
+					logEvent(slog.LevelWarn, "render underrun", "file", fn, "late", -wait)
+					r.Metrics.Underruns.Add(1)
+					next = time.Now() // don't try to catch up
+				}
+			}
+			r.Metrics.TracksPlayed.Add(1)
+		}
+		if loaded == 0 {
+			time.Sleep(time.Second) // nothing to play - don't spin
+		}
+	}
+}
+
+// broadcast sends a chunk of audio to all clients, dropping it for clients which don't keep up
+func (r *Radio) broadcast(chunk []byte) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	fill := 0
+	for c := range r.clients {
+		select {
+		case c <- chunk:
+		default:
+			r.Metrics.DroppedChunks.Add(1)
+		}
+		fill += len(c) * 100 / cap(c)
+	}
+	if len(r.clients) > 0 {
+		fill /= len(r.clients)
+	}
+	r.Metrics.BufferFill.Store(int64(fill))
+}
+
+func (r *Radio) serveStream(w http.ResponseWriter, req *http.Request) {
+	c := make(chan []byte, radioClientBuffer)
+	r.mu.Lock()
+	r.clients[c] = true
+	r.mu.Unlock()
+	r.Metrics.Clients.Add(1)
+	logEvent(slog.LevelInfo, "client connected", "addr", req.RemoteAddr)
+	defer func() {
+		r.mu.Lock()
+		delete(r.clients, c)
+		r.mu.Unlock()
+		r.Metrics.Clients.Add(-1)
+		logEvent(slog.LevelInfo, "client disconnected", "addr", req.RemoteAddr)
+	}()
+
+	w.Header().Set("Content-Type", "audio/wav")
+	// the length of the stream is unknown, so the header announces the maximum size
+	hdr := newWAVHeader(wavPCM, r.rate(), channelNum, bitDepthInBytes*8, math.MaxUint32-36)
+	if err := binary.Write(w, binary.LittleEndian, hdr); err != nil {
+		return
+	}
+	flusher, _ := w.(http.Flusher)
+	for {
+		select {
+		case chunk := <-c:
+			if _, err := w.Write(chunk); err != nil {
+				return
+			}
+			if flusher != nil {
+				flusher.Flush()
+			}
+		case <-req.Context().Done():
+			return
+		}
+	}
+}
@@ -0,0 +1,95 @@
+package player
+
+import (
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/b0nefish/go-modplayer/mod"
+)
+
+// RenderOptions holds the settings for rendering a module into a file
+type RenderOptions struct {
+	PlayerOptions
+	CueSheet bool // also write a cue sheet with one track per order (file name with extension .cue)
+	Chapters bool // also write an FFMETADATA file with one chapter per order (file name with extension .ffmeta)
+
+	// the format of the rendered audio (at PlayerOptions.Rate); Channels is the number of output channels
+	// (1: mono, 2 or 0: stereo), unlike PlayerOptions.Channels, which selects the channels of the module
+	Format   SampleFormat
+	Channels int
+	Dither   Dither // with FormatInt16: the dithering of the mix (the noise follows PlayerOptions.Seed)
+}
+
+// outChannels returns the number of output channels
+func (opts RenderOptions) outChannels() int {
+	if opts.Channels == 0 {
+		return channelNum
+	}
+	return opts.Channels
+}
+
+// RenderWAV renders a module into the WAV file fn (as fast as possible, without using the audio output).
+// With opts.Loops, the song is rendered as intro + Loops times the song loop, ending exactly at the end
+// of the last loop, so the result can be looped seamlessly.
+func RenderWAV(module mod.Module, fn string, opts RenderOptions) error {
+	_, err := renderFile(module, fn, opts, WAVEncoder{})
+	return err
+}
+
+// renderFile renders a module into the file fn with the encoder enc and returns the Player used, which
+// knows the play history of the rendered song
+func renderFile(module mod.Module, fn string, opts RenderOptions, enc Encoder) (*Player, error) {
+	f, err := os.Create(fn)
+	if err != nil {
+		return nil, err
+	}
+	mp := NewPlayer(module, opts.PlayerOptions)
+	if err := mp.SetFormat(opts.Format, opts.outChannels()); err != nil {
+		f.Close()
+		return nil, err
+	}
+	if opts.Format == FormatInt16 {
+		mp.dither = newDitherer(opts.Dither, opts.Seed)
+	}
+	info := AudioInfo{Rate: mp.rate, Channels: opts.outChannels(), Format: opts.Format, Tags: ModuleTags(module)}
+	if err := enc.Encode(f, mp, info); err != nil {
+		f.Close()
+		return nil, err
+	}
+	if err := f.Close(); err != nil {
+		return nil, err
+	}
+
+	cs := mp.CueSheet(filepath.Base(fn))
+	if opts.CueSheet {
+		if err := writeFile(replaceExt(fn, ".cue"), cs.WriteCue); err != nil {
+			return nil, err
+		}
+	}
+	if opts.Chapters {
+		if err := writeFile(replaceExt(fn, ".ffmeta"), cs.WriteFFMetadata); err != nil {
+			return nil, err
+		}
+	}
+	return mp, nil
+}
+
+// replaceExt replaces the extension of the file name fn
+func replaceExt(fn, ext string) string {
+	return strings.TrimSuffix(fn, filepath.Ext(fn)) + ext
+}
+
+// writeFile creates the file fn and writes its contents with the given function
+func writeFile(fn string, write func(w io.Writer) error) error {
+	f, err := os.Create(fn)
+	if err != nil {
+		return err
+	}
+	if err := write(f); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
@@ -0,0 +1,83 @@
+package player
+
+import (
+	"math"
+	"testing"
+
+	"github.com/b0nefish/go-modplayer/mod"
+)
+
+// testModule returns a module with 4 channels playing a looped sample with slides, vibrato and volume
+// changes, which jumps back to the start at the end of its single pattern
+func testModule(tb testing.TB) mod.Module {
+	m, err := mod.NewModule("render test", 4)
+	if err != nil {
+		tb.Fatal(err)
+	}
+	pcm := make([]int8, 256)
+	for i := range pcm {
+		pcm[i] = int8(100 * math.Sin(2*math.Pi*float64(i)/32))
+	}
+	ins, err := m.AddInstrument("sine", pcm, 0, len(pcm))
+	if err != nil {
+		tb.Fatal(err)
+	}
+	effects := []uint16{0x000, 0x447, 0xA02, 0x302, 0x120, 0xC20, 0x037, 0x910}
+	for row := 0; row < 64; row += 4 {
+		for ch := 0; ch < 4; ch++ {
+			n := mod.Note{InsNum: ins, Period: [...]int{428, 339, 285, 214}[(row/4+ch)%4], Effect: mod.NewEffect(effects[(row/4+ch)%len(effects)])}
+			if err := m.SetNote(0, row, ch, n); err != nil {
+				tb.Fatal(err)
+			}
+		}
+	}
+	if err := m.SetNote(0, 63, 3, mod.Note{Effect: mod.NewEffect(0xB00)}); err != nil {
+		tb.Fatal(err)
+	}
+	return m
+}
+
+// renderBufSize is the size of the buffers in which the tests and benchmarks render (1024 frames)
+const renderBufSize = 4096
+
+func BenchmarkRender(b *testing.B) {
+	for _, name := range ResamplerNames() {
+		b.Run(name, func(b *testing.B) {
+			p := NewPlayer(testModule(b), PlayerOptions{Seed: 1, Resampler: Resamplers[name], Loops: math.MaxInt32})
+			buf := make([]byte, renderBufSize)
+			b.SetBytes(renderBufSize)
+			b.ReportAllocs()
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				if _, err := p.Read(buf); err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+	}
+}
+
+// TestRenderAllocs checks that rendering doesn't allocate once the song plays (the play history only
+// grows now and then)
+func TestRenderAllocs(t *testing.T) {
+	for name, opts := range map[string]PlayerOptions{
+		"linear":    {},
+		"sinc":      {Resampler: Resamplers["sinc"]},
+		"paula":     {Engine: PaulaBLEP},
+		"lookahead": {Limiter: LimitLookahead, Headroom: 3},
+	} {
+		opts.Seed, opts.Loops = 1, math.MaxInt32
+		p := NewPlayer(testModule(t), opts)
+		buf := make([]byte, renderBufSize)
+		for i := 0; i < 100; i++ {
+			p.Read(buf) // the song has looped (the loop detection is set up)
+		}
+		if allocs := testing.AllocsPerRun(100, func() {
+			if _, err := p.Read(buf); err != nil {
+				t.Fatal(err)
+			}
+		}); allocs > 0 {
+			t.Errorf("%s: %v allocations per %d bytes rendered, want 0", name, allocs, renderBufSize)
+		}
+	}
+}
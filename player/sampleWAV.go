@@ -0,0 +1,113 @@
+package player
+
+import (
+	"bufio"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/b0nefish/go-modplayer/mod"
+)
+
+// SampleRefRate is the rate at which C-2 is usually assumed to play the samples of MOD files (the
+// convention of the PC trackers; a PAL Amiga plays C-2 at 8287 Hz)
+const SampleRefRate = 8363
+
+// WriteSampleWAV writes the sample of an instrument as a mono WAV file with the given rate (0:
+// SampleRefRate) and 8 or 16 bits. The loop of the sample is stored in a "smpl" chunk.
+func WriteSampleWAV(w io.Writer, ins *mod.Instrument, rate, bits int) error {
+	if bits != 8 && bits != 16 {
+		return fmt.Errorf("unsupported sample size %d bits (8 or 16)", bits)
+	}
+	if rate <= 0 {
+		rate = SampleRefRate
+	}
+	data := make([]byte, 0, ins.Len*bits/8+1)
+	for i := 0; i < ins.Len && ins.HasSample(); i++ {
+		s := ins.At(i)
+		if bits == 8 {
+			data = append(data, byte(int(s)+128)) // 8-bit WAV samples are unsigned
+		} else {
+			data = binary.LittleEndian.AppendUint16(data, uint16(int16(s)<<8))
+		}
+	}
+	hdr := newWAVHeader(wavPCM, rate, 1, bits, uint32(len(data)))
+	if len(data)%2 != 0 {
+		data = append(data, 0) // RIFF chunks are padded to an even size
+		hdr.RIFFSize++
+	}
+
+	var chunks []any
+	if ins.RepLen > 0 {
+		smpl, cue := newWAVLoopChunks(rate, ins.RepStart, ins.RepStart+ins.RepLen)
+		chunks = append(chunks, smpl, cue)
+		hdr.RIFFSize += uint32(binary.Size(smpl) + binary.Size(cue))
+	}
+	if err := binary.Write(w, binary.LittleEndian, hdr); err != nil {
+		return err
+	}
+	if _, err := w.Write(data); err != nil {
+		return err
+	}
+	for _, c := range chunks {
+		if err := binary.Write(w, binary.LittleEndian, c); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// SampleFileName returns the name of the WAV file for an instrument, made of its number and its name
+// (e.g. 01-bassdrum.wav)
+func SampleFileName(ins *mod.Instrument) string {
+	name := strings.Map(func(r rune) rune {
+		switch {
+		case r >= 'a' && r <= 'z', r >= 'A' && r <= 'Z', r >= '0' && r <= '9', r == '-', r == '.':
+			return r
+		case r == ' ', r == '_':
+			return '_'
+		}
+		return -1
+	}, strings.TrimSpace(ins.Name))
+	if name = strings.Trim(name, "_."); name == "" {
+		return fmt.Sprintf("%02d.wav", ins.Num)
+	}
+	return fmt.Sprintf("%02d-%s.wav", ins.Num, name)
+}
+
+// ExportSamples writes the sample of every instrument of a module which has one into the directory dir
+// (see WriteSampleWAV and SampleFileName), which is created if needed. It returns the names of the files
+// written.
+func ExportSamples(module mod.Module, dir string, rate, bits int) ([]string, error) {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, err
+	}
+	var names []string
+	for i := 1; i < len(module.Instruments); i++ {
+		ins := &module.Instruments[i]
+		if !ins.HasSample() {
+			continue
+		}
+		fn := filepath.Join(dir, SampleFileName(ins))
+		f, err := os.Create(fn)
+		if err != nil {
+			return names, err
+		}
+		w := bufio.NewWriter(f)
+		err = WriteSampleWAV(w, ins, rate, bits)
+		if err == nil {
+			err = w.Flush()
+		}
+		if cerr := f.Close(); err == nil {
+			err = cerr
+		}
+		if err != nil {
+			return names, err
+		}
+		names = append(names, fn)
+	}
+	return names, nil
+}
@@ -0,0 +1,178 @@
+package player
+
+import (
+	"errors"
+	"fmt"
+	"time"
+)
+
+// SeekOrder continues playing at the given row of the given order (pattern table index). The song is
+// played silently from the start up to that position, so the speed, the volumes, the effect memory
+// and the loop counters are the same as if it had been played up to there. Orders which aren't
+// reached in one pass through the song (e.g. hidden patterns) are jumped to directly.
+func (p *Player) SeekOrder(order, row int) error {
+	if order < 0 || order >= len(p.Module.PatternTable) {
+		return fmt.Errorf("order %d out of range (song length %d)", order, len(p.Module.PatternTable))
+	}
+	if row < 0 || row >= len(p.Module.Patterns[p.Module.PatternTable[order]]) {
+		return fmt.Errorf("row %d out of range", row)
+	}
+	sim := p.simulate(true, func(sim *Player) bool {
+		return sim.curPattern == order && sim.curLine == row && sim.atLineStart()
+	})
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if sim.ended {
+		sim = p.simulate(true, func(*Player) bool { return true })
+		sim.position = position{curPattern: order, curLine: row}
+	}
+	p.seekTo(sim)
+	return nil
+}
+
+// SeekTime continues playing at the given time offset from the start of the song; like SeekOrder, the
+// song is played silently up to there. Seeking beyond the end of the song (including the configured
+// number of loops) returns an error.
+func (p *Player) SeekTime(d time.Duration) error {
+	if d < 0 {
+		return errors.New("negative seek time")
+	}
+	target := int(d * time.Duration(p.rate) / time.Second)
+	sim := p.simulate(false, func(sim *Player) bool { return sim.sampleCnt >= target })
+	if sim.ended {
+		return fmt.Errorf("seek time %v beyond the end of the song", d)
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.seekTo(sim)
+	return nil
+}
+
+// simulate plays the song from the start until done returns true (checked before each sample) or the
+// song has ended (onePass: when it loops for the first time), and returns the player in that state. Only
+// the lines, ticks and channels are advanced, nothing is mixed.
+func (p *Player) simulate(onePass bool, done func(*Player) bool) *Player {
+	opts := p.opts
+	opts.Start, opts.Clock, opts.Sync, opts.OSC, opts.DSP = 0, nil, nil, nil, nil
+	if onePass {
+		opts.Loops, opts.FadeOut = 1, 0
+	}
+	sim := NewPlayer(p.Module, opts)
+	sim.skipping = true
+	for !sim.ended && !done(sim) {
+		sim.nextSamples()
+	}
+	return sim
+}
+
+// atLineStart reports whether the next sample starts a new line
+func (p *Player) atLineStart() bool {
+	return p.curTick == 0 && p.curTiming == 0 && !p.delayed
+}
+
+// rebaseNotes points the note pointers of ch, copied from the channel from, to the storage of ch
+func (ch *Channel) rebaseNotes(from *Channel) {
+	for i := range from.notes {
+		if ch.note == &from.notes[i] {
+			ch.note = &ch.notes[i]
+		}
+	}
+	if ch.delayed == &from.delayedNote {
+		ch.delayed = &ch.delayedNote
+	}
+}
+
+// seekTo takes over the playing state of the simulated player sim (p.mu must be held)
+func (p *Player) seekTo(sim *Player) {
+	p.position = sim.position
+	p.delayLines, p.delayed, p.jumpPos, p.doLoop, p.loopLine = sim.delayLines, sim.delayed, sim.jumpPos, sim.doLoop, sim.loopLine
+	p.Speed = sim.Speed
+	p.ledOn = sim.ledOn // the filter state goes on from the output before the seek
+	for i := range p.chans {
+		ch := sim.chans[i]
+		ch.muted = p.chans[i].muted
+		ch.gain = p.chans[i].gain
+		ch.blep = p.chans[i].blep // the output goes on from the value played before the seek
+		ch.compat = &p.Compat
+		p.chans[i] = ch
+		p.chans[i].rebaseNotes(&sim.chans[i])
+	}
+	p.block.pos = p.block.len // rendered from the old position
+	if p.master.mode == LimitLookahead {
+		p.master.reset()
+	}
+	p.dspOut.reset()
+	p.ended = false
+	p.sampleCnt, p.visited, p.loopCnt, p.fadeLeft = sim.sampleCnt, sim.visited, sim.loopCnt, sim.fadeLeft
+	p.LoopStart, p.LoopLen = sim.LoopStart, sim.LoopLen
+	p.history = sim.history
+	for i := range p.events {
+		// the rendered audio before the seek is still heard first
+		p.events[i].sample = p.sampleCnt
+	}
+
+	// the MIDI clock and the OSC events are timed by the sample count, which has jumped
+	if p.state == Playing {
+		if p.clock != nil {
+			p.clock.Stop()
+			p.clock.Continue(p.sampleCnt)
+		}
+		if p.osc != nil {
+			p.osc.startAt(p.sampleCnt)
+		}
+	}
+	if p.sync != nil && !p.follow {
+		p.sync.SetTempo(float64(p.BPM))
+	}
+}
+
+// loopRegion is the section of the song which is looped (SetLoopRegion), from the start row to the end
+// of the end row
+type loopRegion struct {
+	start, end position
+}
+
+// endsAt reports whether the row of pos is the last row of the region (false without a region)
+func (r *loopRegion) endsAt(pos position) bool {
+	return r != nil && pos.curPattern == r.end.curPattern && pos.curLine == r.end.curLine
+}
+
+// rowBefore reports whether the row at order and row comes before the row of pos in the pattern table
+func rowBefore(order, row int, pos position) bool {
+	return order < pos.curPattern || order == pos.curPattern && row < pos.curLine
+}
+
+// SetLoopRegion loops the section of the song from the row startRow of the order startOrder to the end
+// of the row endRow of the order endOrder (inclusive) until ClearLoopRegion is called: when that row
+// has been played, playing continues at the start of the section, with the channels as they are (like
+// a pattern jump). If the current row is outside of the section, SetLoopRegion seeks to its start
+// (see SeekOrder). The song doesn't end at its loop while the section is looped.
+func (p *Player) SetLoopRegion(startOrder, startRow, endOrder, endRow int) error {
+	r := &loopRegion{start: position{curPattern: startOrder, curLine: startRow}, end: position{curPattern: endOrder, curLine: endRow}}
+	for _, pos := range []position{r.start, r.end} {
+		if pos.curPattern < 0 || pos.curPattern >= len(p.Module.PatternTable) {
+			return fmt.Errorf("order %d out of range (song length %d)", pos.curPattern, len(p.Module.PatternTable))
+		}
+		if pos.curLine < 0 || pos.curLine >= len(p.Module.Patterns[p.Module.PatternTable[pos.curPattern]]) {
+			return fmt.Errorf("row %d out of range", pos.curLine)
+		}
+	}
+	if rowBefore(endOrder, endRow, r.start) {
+		return fmt.Errorf("loop region ends (%d/%d) before it starts (%d/%d)", endOrder, endRow, startOrder, startRow)
+	}
+	p.mu.Lock()
+	p.region = r
+	outside := rowBefore(p.curPattern, p.curLine, r.start) || rowBefore(endOrder, endRow, p.position)
+	p.mu.Unlock()
+	if outside {
+		return p.SeekOrder(startOrder, startRow)
+	}
+	return nil
+}
+
+// ClearLoopRegion stops looping the section set by SetLoopRegion; playing goes on after its end
+func (p *Player) ClearLoopRegion() {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.region = nil
+}
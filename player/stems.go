@@ -0,0 +1,123 @@
+package player
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/b0nefish/go-modplayer/mod"
+)
+
+// wavFile is a WAV file which is written sample by sample
+type wavFile struct {
+	f        *os.File
+	w        *bufio.Writer
+	format   SampleFormat
+	channels int
+	size     int    // bytes of audio data written
+	frame    []byte // the encoded samples of a frame
+}
+
+// createWAVFile creates the WAV file fn for audio in the given format
+func createWAVFile(fn string, f SampleFormat, channels int) (*wavFile, error) {
+	file, err := os.Create(fn)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := file.Seek(int64(binary.Size(wavHeader{})), io.SeekStart); err != nil {
+		file.Close()
+		return nil, err
+	}
+	return &wavFile{f: file, w: bufio.NewWriter(file), format: f, channels: channels, frame: make([]byte, f.Bytes()*channels)}, nil
+}
+
+// write appends a stereo sample (mixed down for mono files)
+func (wf *wavFile) write(l, r int) error {
+	if wf.channels == 1 {
+		wf.format.put(wf.frame, (l+r)/2)
+	} else {
+		wf.format.put(wf.frame, l)
+		wf.format.put(wf.frame[wf.format.Bytes():], r)
+	}
+	wf.size += len(wf.frame)
+	_, err := wf.w.Write(wf.frame)
+	return err
+}
+
+// close writes the loop chunks (if lr knows the loop) and the header, and closes the file
+func (wf *wavFile) close(lr LoopRegioner, rate int) error {
+	err := wf.w.Flush()
+	if err == nil {
+		err = finishWAV(wf.f, lr, wavFormat(wf.format), rate, wf.channels, wf.format.Bytes()*8, wf.size)
+	}
+	if cerr := wf.f.Close(); err == nil {
+		err = cerr
+	}
+	return err
+}
+
+// StemFileName returns the name of the file with the stem of channel ch (0-based) for the mixdown fn,
+// e.g. song-ch01.wav for song.wav
+func StemFileName(fn string, ch int) string {
+	ext := filepath.Ext(fn)
+	return fmt.Sprintf("%s-ch%02d%s", strings.TrimSuffix(fn, ext), ch+1, ext)
+}
+
+// RenderStems renders a module into a WAV file for every channel (see StemFileName) and the mixdown into
+// fn, in a single pass. The stems are scaled like the mixdown, so together they give the mixdown
+// (without the LED filter and the master stage, which are only applied to the mix, and clipping). It
+// returns the names of the files written. LimitLookahead isn't supported, as it delays the mix.
+func RenderStems(module mod.Module, fn string, opts RenderOptions) ([]string, error) {
+	if opts.Limiter == LimitLookahead {
+		return nil, errors.New("the stems can't be rendered with the lookahead limiter")
+	}
+	mp := NewPlayer(module, opts.PlayerOptions)
+	if err := mp.SetFormat(opts.Format, opts.outChannels()); err != nil {
+		return nil, err
+	}
+	mp.stems = make([][2]int, len(mp.chans))
+
+	files := make([]*wavFile, len(mp.chans)+1) // the stems, then the mixdown
+	names := make([]string, len(files))
+	var err error
+	for i := range files {
+		names[i] = fn
+		if i < len(mp.chans) {
+			names[i] = StemFileName(fn, i)
+		}
+		if files[i], err = createWAVFile(names[i], opts.Format, opts.outChannels()); err != nil {
+			break
+		}
+	}
+	for err == nil {
+		l, r := mp.GetNextSamples()
+		if mp.ended {
+			break
+		}
+		for i, s := range mp.stems {
+			if err = files[i].write(s[0]*mp.globalVol/mp.mixDiv, s[1]*mp.globalVol/mp.mixDiv); err != nil {
+				break
+			}
+		}
+		if err == nil {
+			err = files[len(mp.chans)].write(l, r)
+		}
+	}
+	for _, wf := range files {
+		if wf == nil {
+			continue
+		}
+		if cerr := wf.close(mp, mp.rate); err == nil {
+			err = cerr
+		}
+	}
+	if err != nil {
+		return nil, err
+	}
+	return names, nil
+}
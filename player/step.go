@@ -0,0 +1,47 @@
+package player
+
+import (
+	"math"
+	"sync"
+)
+
+// fracBits is the number of fractional bits of the sample positions and steps of the channels, which are
+// fixed-point numbers (e.g. 16.16 for the steps), so the mixer advances the positions with integer additions
+const (
+	fracBits = 16
+	fracOne  = 1 << fracBits
+)
+
+// stepTablePeriods is the number of periods (from 0) whose steps are precomputed, which covers the
+// periods of MOD files with vibrato and of all but the lowest notes of the other formats
+const stepTablePeriods = 8192
+
+var (
+	stepTablesMu sync.Mutex
+	stepTables   = map[int][]int64{} // by output rate
+)
+
+// stepTable returns the steps of the periods 0..stepTablePeriods-1 at the output rate (the step of
+// period 0 is 0); the table is computed on first use of a rate
+func stepTable(rate int) []int64 {
+	stepTablesMu.Lock()
+	defer stepTablesMu.Unlock()
+	if t, ok := stepTables[rate]; ok {
+		return t
+	}
+	t := make([]int64, stepTablePeriods)
+	for period := 1; period < len(t); period++ {
+		t[period] = periodStep(float64(period), rate)
+	}
+	stepTables[rate] = t
+	return t
+}
+
+// periodStep returns the step (by which the sample position advances per output sample) of a period at
+// the output rate, as a fixed-point number
+func periodStep(period float64, rate int) int64 {
+	if period <= 0 {
+		return 0
+	}
+	return int64(math.Round(amigaClock / (float64(rate) * period) * fracOne))
+}
@@ -0,0 +1,63 @@
+package player
+
+import (
+	"io"
+
+	"github.com/b0nefish/go-modplayer/mod"
+)
+
+// Stream renders a module on demand as PCM, by default interleaved 16-bit signed little endian stereo (at
+// PlayerOptions.Rate, default SampleRate), without using the audio output: it can be copied into any
+// sink, like the stdin of ffmpeg or sox, or an HTTP response. Unlike Player.Read, Read accepts buffers
+// of any size. The embedded Player controls the playback (seeking, muting, callbacks, ...); its SetFormat
+// changes the format of the stream (see NewRenderStream).
+type Stream struct {
+	*Player
+
+	frame []byte // a frame rendered for the end of a buffer which had no room for all of it
+	rest  []byte // the part of frame which hasn't been read yet
+}
+
+// NewStream creates a Stream playing the module with the given options
+func NewStream(module mod.Module, opts PlayerOptions) *Stream {
+	return &Stream{Player: NewPlayer(module, opts)}
+}
+
+// NewRenderStream creates a Stream rendering the module in the format given by the options
+func NewRenderStream(module mod.Module, opts RenderOptions) (*Stream, error) {
+	s := NewStream(module, opts.PlayerOptions)
+	if err := s.SetFormat(opts.Format, opts.outChannels()); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+// Read implements io.Reader; it returns io.EOF after the end of the song
+func (s *Stream) Read(buf []byte) (int, error) {
+	n := copy(buf, s.rest)
+	s.rest = s.rest[n:]
+	for n < len(buf) {
+		var m int
+		var err error
+		frameSize := s.frameSize()
+		if size := (len(buf) - n) / frameSize * frameSize; size > 0 {
+			m, err = s.Player.Read(buf[n : n+size])
+		} else {
+			// less than a frame left: the rest of the frame is returned by the next call
+			if len(s.frame) != frameSize {
+				s.frame = make([]byte, frameSize)
+			}
+			m, err = s.Player.Read(s.frame)
+			s.rest = s.frame[copy(buf[n:], s.frame[:m]):m]
+			m -= len(s.rest)
+		}
+		n += m
+		if err != nil {
+			if n > 0 && err == io.EOF {
+				return n, nil
+			}
+			return n, err
+		}
+	}
+	return n, nil
+}
@@ -0,0 +1,36 @@
+package player
+
+import "errors"
+
+// TempoSync connects the tempo of a Player to an external tempo session (e.g. Ableton Link, see link.go).
+// Tempos are in MOD BPM, which are quarter notes per minute at the usual 4 lines per beat.
+type TempoSync interface {
+	// Tempo returns the current tempo of the session
+	Tempo() float64
+	// SetTempo proposes a new tempo to the session
+	SetTempo(bpm float64)
+	// WaitForBar blocks until the next bar (4 beats) starts in the session
+	WaitForBar()
+}
+
+// newLinkSync creates a TempoSync joining an Ableton Link session (nil if built without Link support)
+var newLinkSync func(bpm float64) TempoSync
+
+// NewLinkSync creates a TempoSync joining an Ableton Link session with the given initial tempo; it fails
+// if the player was built without Link support
+func NewLinkSync(bpm float64) (TempoSync, error) {
+	if newLinkSync == nil {
+		return nil, errors.New("built without Ableton Link support (build with -tags link)")
+	}
+	return newLinkSync(bpm), nil
+}
+
+// SyncMode selects how a Player uses its TempoSync
+type SyncMode int
+
+const (
+	// SyncBroadcast: the module sets the tempo of the session (on start and with each BPM change)
+	SyncBroadcast SyncMode = iota
+	// SyncFollow: playing starts on the next bar of the session and follows the session's tempo
+	SyncFollow
+)
@@ -0,0 +1,94 @@
+package player
+
+import (
+	"fmt"
+	"io"
+	"strings"
+	"time"
+
+	"github.com/b0nefish/go-modplayer/mod"
+)
+
+// tuiRefresh is the interval in which the terminal UI is redrawn
+const tuiRefresh = 40 * time.Millisecond
+
+// ANSI escape sequences of the terminal UI
+const (
+	ansiHome       = "\x1b[H"
+	ansiClear      = "\x1b[2J"
+	ansiClearLine  = "\x1b[K"
+	ansiHideCursor = "\x1b[?25l"
+	ansiShowCursor = "\x1b[?25h"
+	ansiReverse    = "\x1b[7m"
+	ansiBold       = "\x1b[1m"
+	ansiReset      = "\x1b[0m"
+)
+
+// ShowTUI draws a tracker-style view of the playing module on the terminal out (which has the given
+// number of rows) until playing has ended: the pattern scrolls with the row which is heard highlighted,
+// below a VU bar for every channel. It returns the error of Wait.
+func (mp *Player) ShowTUI(out io.Writer, rows int) error {
+	done := make(chan error, 1)
+	go func() { done <- mp.Wait() }()
+	ticker := time.NewTicker(tuiRefresh)
+	defer ticker.Stop()
+
+	fmt.Fprint(out, ansiHideCursor+ansiClear)
+	defer fmt.Fprint(out, ansiReset+ansiShowCursor+"\n")
+	for {
+		select {
+		case err := <-done:
+			return err
+		case <-ticker.C:
+			ls, ok := mp.HeardLine()
+			if !ok {
+				continue
+			}
+			fmt.Fprint(out, tuiFrame(mp.Module, ls, mp.Position().Elapsed, mp.ChannelLevels(), rows))
+		}
+	}
+}
+
+// tuiFrame returns the screen of the terminal UI at the line ls, after the play time elapsed (levels are
+// the VU meter values of the channels, see Player.ChannelLevels)
+func tuiFrame(module mod.Module, ls LineStart, elapsed time.Duration, levels []float64, rows int) string {
+	cellW := len("C-3 01 C20")
+	var sb strings.Builder
+	line := func(s string) {
+		sb.WriteString(s + ansiReset + ansiClearLine + "\n")
+	}
+
+	sb.WriteString(ansiHome)
+	line(ansiBold + module.Name)
+	line(fmt.Sprintf("ORDER %03d/%03d  PATTERN %02d  ROW %02d  TIME %d:%02d",
+		ls.Order, len(module.PatternTable)-1, ls.Pattern, ls.Line, int(elapsed.Minutes()), int(elapsed.Seconds())%60))
+	bars := make([]string, len(levels))
+	for i, l := range levels {
+		n := int(l*float64(cellW) + 0.5)
+		bars[i] = strings.Repeat("█", n) + strings.Repeat("·", cellW-n)
+	}
+	line("   |" + strings.Join(bars, " |"))
+
+	patt := module.Patterns[ls.Pattern]
+	height := rows - 4 // the header, the VU meters and the last line (the cursor)
+	if height < 1 {
+		height = 1
+	}
+	for r := 0; r < height; r++ {
+		l := ls.Line - height/2 + r
+		if l < 0 || l >= len(patt) {
+			line("")
+			continue
+		}
+		cells := make([]string, len(patt[l]))
+		for ch, note := range patt[l] {
+			cells[ch] = noteCell(note)
+		}
+		s := fmt.Sprintf("%02d |%s", l, strings.Join(cells, " |"))
+		if l == ls.Line {
+			s = ansiReverse + s
+		}
+		line(s)
+	}
+	return sb.String()
+}
@@ -0,0 +1,148 @@
+package player
+
+import (
+	"fmt"
+	"image"
+	"image/color"
+	"image/draw"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/b0nefish/go-modplayer/mod"
+)
+
+// VideoOptions holds the settings for rendering a module into a video file
+type VideoOptions struct {
+	PlayerOptions
+	Width, Height int    // frame size in pixels
+	FPS           int    // frames per second
+	FFmpeg        string // path to the ffmpeg binary (default: "ffmpeg" from the PATH)
+}
+
+var (
+	videoBackground = color.RGBA{0x10, 0x10, 0x30, 0xFF}
+	videoText       = color.RGBA{0xC0, 0xC0, 0xC0, 0xFF}
+	videoHighlight  = color.RGBA{0x40, 0x40, 0x90, 0xFF}
+	videoHeader     = color.RGBA{0xFF, 0xFF, 0x80, 0xFF}
+)
+
+// noteCell formats a note for the pattern view: note name (or period), instrument and effect
+func noteCell(n mod.Note) string {
+	s := n.NoteName()
+	if n.InsNum > 0 {
+		s += fmt.Sprintf(" %02X", n.InsNum)
+	} else {
+		s += " .."
+	}
+	if n.EffCode != 0 {
+		s += fmt.Sprintf(" %03X", n.EffCode)
+	} else {
+		s += " ..."
+	}
+	return s
+}
+
+// drawPatternFrame draws the pattern view for the given line into img: a header with the song position
+// and the lines of the current pattern around the playing line (which is highlighted)
+func drawPatternFrame(img *image.RGBA, module mod.Module, ls LineStart) {
+	draw.Draw(img, img.Bounds(), &image.Uniform{videoBackground}, image.Point{}, draw.Src)
+
+	patt := module.Patterns[ls.Pattern]
+	chanCnt := len(patt[0])
+	lineLen := 3 + chanCnt*len("|C-3 01 C20 ")
+	scale := img.Bounds().Dx() / (lineLen * glyphW)
+	if scale < 1 {
+		scale = 1
+	}
+	cellH := glyphH * scale
+
+	drawText(img, scale, scale, module.Name, scale, videoHeader)
+	drawText(img, scale, scale+cellH, fmt.Sprintf("ORDER %03d/%03d  PATTERN %02d  ROW %02d",
+		ls.Order, len(module.PatternTable)-1, ls.Pattern, ls.Line), scale, videoHeader)
+
+	top := 3 * cellH
+	rows := (img.Bounds().Dy() - top) / cellH
+	mid := top + rows/2*cellH
+	draw.Draw(img, image.Rect(0, mid, img.Bounds().Dx(), mid+cellH), &image.Uniform{videoHighlight}, image.Point{}, draw.Src)
+	for r := 0; r < rows; r++ {
+		line := ls.Line - rows/2 + r
+		if line < 0 || line >= len(patt) {
+			continue
+		}
+		cells := make([]string, len(patt[line]))
+		for ch, note := range patt[line] {
+			cells[ch] = noteCell(note)
+		}
+		drawText(img, scale, top+r*cellH+scale/2, fmt.Sprintf("%02d |%s", line, strings.Join(cells, " |")), scale, videoText)
+	}
+}
+
+// videoCodecArgs returns the ffmpeg codec arguments for the container given by the file name extension
+func videoCodecArgs(fn string) []string {
+	switch strings.ToLower(filepath.Ext(fn)) {
+	case ".webm":
+		return []string{"-c:v", "libvpx-vp9", "-c:a", "libopus"}
+	default:
+		return []string{"-c:v", "libx264", "-pix_fmt", "yuv420p", "-c:a", "aac"}
+	}
+}
+
+// RenderVideo renders a module into a video file (MP4, WebM, ... depending on the extension of fn) showing
+// the scrolling pattern view. The audio is rendered into a temporary WAV file first, then the frames are
+// piped into ffmpeg, which has to be installed.
+func RenderVideo(module mod.Module, fn string, opts VideoOptions) error {
+	if opts.Width <= 0 || opts.Height <= 0 {
+		opts.Width, opts.Height = 640, 360
+	}
+	if opts.FPS <= 0 {
+		opts.FPS = 30
+	}
+	if opts.FFmpeg == "" {
+		opts.FFmpeg = "ffmpeg"
+	}
+
+	wav, err := os.CreateTemp("", "modplayer-*.wav")
+	if err != nil {
+		return err
+	}
+	wav.Close()
+	defer os.Remove(wav.Name())
+	mp, err := renderFile(module, wav.Name(), RenderOptions{PlayerOptions: opts.PlayerOptions}, WAVEncoder{})
+	if err != nil {
+		return err
+	}
+
+	args := []string{"-y", "-loglevel", "error",
+		"-f", "rawvideo", "-pix_fmt", "rgba", "-s", fmt.Sprintf("%dx%d", opts.Width, opts.Height),
+		"-r", strconv.Itoa(opts.FPS), "-i", "-", "-i", wav.Name()}
+	args = append(args, videoCodecArgs(fn)...)
+	args = append(args, "-shortest", fn)
+	cmd := exec.Command(opts.FFmpeg, args...)
+	cmd.Stdout, cmd.Stderr = os.Stdout, os.Stderr
+	frames, err := cmd.StdinPipe()
+	if err != nil {
+		return err
+	}
+	if err := cmd.Start(); err != nil {
+		return fmt.Errorf("unable to start ffmpeg: %v", err)
+	}
+
+	img := image.NewRGBA(image.Rect(0, 0, opts.Width, opts.Height))
+	frameCnt := int(int64(mp.sampleCnt) * int64(opts.FPS) / int64(mp.rate))
+	for i := 0; i <= frameCnt; i++ {
+		if ls, ok := mp.LineAt(int(int64(i) * int64(mp.rate) / int64(opts.FPS))); ok {
+			drawPatternFrame(img, mp.Module, ls)
+		}
+		if _, err = frames.Write(img.Pix); err != nil {
+			break
+		}
+	}
+	frames.Close()
+	if werr := cmd.Wait(); werr != nil {
+		return fmt.Errorf("ffmpeg failed: %v", werr)
+	}
+	return err
+}
@@ -1,4 +1,6 @@
-package main
+package player
+
+import "github.com/b0nefish/go-modplayer/mod"
 
 // VolumeProcessor is responsible for calculating the current volume for a channel
 // considering currently active effect(s)
@@ -6,37 +8,40 @@ type VolumeProcessor struct {
 	volume  int // current volume
 	volumeΔ int // volume delta (value to add/subtract for volume slides)
 
-	EffectWaveform
+	state *ChannelState // the state of the channel (tremolo waveform)
 }
 
 // VolumeFromNote initializes the volume effects for the given note
-func (vpu *VolumeProcessor) VolumeFromNote(note Note) {
+func (vpu *VolumeProcessor) VolumeFromNote(note mod.Note, speed Speed) {
 	resetSlide := true
 	resetTremolo := true
-	if note.Ins != nil && note.Ins.Sample != nil && note.Period > 0 {
+	if note.InsNum > 0 && note.Ins != nil && note.Ins.HasSample() {
+		// an instrument number resets the volume, even if there is no note
 		vpu.volume = note.Ins.Volume
 	}
+	if note.Vol > 0 {
+		vpu.volume = note.Vol - 1
+	}
 
 	switch note.EffType {
-	case VolSlide, PortamentoVolSlide, VibratoVolSlide:
-		if note.Par() != 0 {
-			if note.ParX() > 0 {
-				vpu.volumeΔ = note.ParX()
-			} else {
-				vpu.volumeΔ = -note.ParY()
-			}
+	case mod.VolSlide, mod.PortamentoVolSlide, mod.VibratoVolSlide:
+		// a zero parameter has already been replaced by the effect memory (if the profile has one)
+		if note.ParX() > 0 {
+			vpu.volumeΔ = note.ParX()
+		} else {
+			vpu.volumeΔ = -note.ParY()
 		}
 		resetSlide = false
-	case Tremolo:
-		vpu.InitTremoloWaveform(note.ParX(), note.ParY())
+	case mod.Tremolo:
+		vpu.state.Tremolo.InitTremoloWaveform(note.ParX(), note.ParY(), speed.Tempo)
 		resetTremolo = false
-	case SetVol:
+	case mod.SetVol:
 		vpu.volume = note.Par()
-	case SetTremoloWaveform:
-		vpu.DecodeWaveformType(note.ParY())
-	case FineVolSlideUp:
+	case mod.SetTremoloWaveform:
+		vpu.state.Tremolo.DecodeWaveformType(note.ParY())
+	case mod.FineVolSlideUp:
 		vpu.volume += note.ParY()
-	case FineVolSlideDown:
+	case mod.FineVolSlideDown:
 		vpu.volume -= note.ParY()
 	}
 
@@ -44,7 +49,7 @@ func (vpu *VolumeProcessor) VolumeFromNote(note Note) {
 		vpu.volumeΔ = 0
 	}
 	if resetTremolo {
-		vpu.EffectWaveform.Active = false
+		vpu.state.Tremolo.Active = false
 	}
 }
 
@@ -60,9 +65,10 @@ func (vpu *VolumeProcessor) VolumeOnTick(curTick int) {
 		}
 		//fmt.Println("vol", vpu.volume)
 	}
+	vpu.state.Tremolo.Tick()
 }
 
 // Next gets the volume value for the next sample
 func (vpu *VolumeProcessor) Next() int {
-	return vpu.volume + vpu.DoStep()
+	return clamp(vpu.volume+vpu.state.Tremolo.DoStep(), 0, 64)
 }
@@ -0,0 +1,180 @@
+package player
+
+import (
+	"encoding/binary"
+	"io"
+)
+
+// wavHeader is the header of a PCM WAV file (RIFF header, "fmt " chunk and the start of the "data" chunk)
+type wavHeader struct {
+	RIFF          [4]byte
+	RIFFSize      uint32
+	WAVE          [4]byte
+	Fmt           [4]byte
+	FmtSize       uint32
+	AudioFormat   uint16
+	Channels      uint16
+	SampleRate    uint32
+	ByteRate      uint32
+	BlockAlign    uint16
+	BitsPerSample uint16
+	Data          [4]byte
+	DataSize      uint32
+}
+
+// wavSmplChunk is a "smpl" chunk with a single loop; many samplers and game engines honor its loop points
+type wavSmplChunk struct {
+	ID                [4]byte
+	Size              uint32
+	Manufacturer      uint32
+	Product           uint32
+	SamplePeriod      uint32 // in nanoseconds
+	MIDIUnityNote     uint32
+	MIDIPitchFraction uint32
+	SMPTEFormat       uint32
+	SMPTEOffset       uint32
+	NumSampleLoops    uint32
+	SamplerData       uint32
+
+	CuePointID uint32
+	LoopType   uint32 // 0 - loop forward
+	LoopStart  uint32 // in sample frames
+	LoopEnd    uint32 // in sample frames, inclusive
+	Fraction   uint32
+	PlayCount  uint32 // 0 - loop forever
+}
+
+// wavCuePoint is a single cue point in a "cue " chunk
+type wavCuePoint struct {
+	ID           uint32
+	Position     uint32
+	DataChunkID  [4]byte
+	ChunkStart   uint32
+	BlockStart   uint32
+	SampleOffset uint32 // in sample frames
+}
+
+// wavCueChunk is a "cue " chunk marking the start and the end of the loop
+type wavCueChunk struct {
+	ID           [4]byte
+	Size         uint32
+	NumCuePoints uint32
+	Points       [2]wavCuePoint
+}
+
+// LoopRegioner is implemented by audio sources which know which part of their output can be looped seamlessly
+type LoopRegioner interface {
+	// LoopRegion returns the loop start and end (exclusive) in sample frames, ok is false if there is no loop
+	LoopRegion() (start, end int, ok bool)
+}
+
+func newWAVLoopChunks(rate, start, end int) (wavSmplChunk, wavCueChunk) {
+	smpl := wavSmplChunk{
+		ID:             [4]byte{'s', 'm', 'p', 'l'},
+		SamplePeriod:   uint32(1e9 / rate),
+		MIDIUnityNote:  60,
+		NumSampleLoops: 1,
+		CuePointID:     1,
+		LoopStart:      uint32(start),
+		LoopEnd:        uint32(end - 1),
+	}
+	smpl.Size = uint32(binary.Size(smpl) - 8)
+	cue := wavCueChunk{ID: [4]byte{'c', 'u', 'e', ' '}, NumCuePoints: 2}
+	for i, pos := range []int{start, end} {
+		cue.Points[i] = wavCuePoint{
+			ID:           uint32(i + 1),
+			Position:     uint32(pos),
+			DataChunkID:  [4]byte{'d', 'a', 't', 'a'},
+			SampleOffset: uint32(pos),
+		}
+	}
+	cue.Size = uint32(binary.Size(cue) - 8)
+	return smpl, cue
+}
+
+// WAV audio formats
+const (
+	wavPCM   = 1
+	wavFloat = 3 // IEEE float
+)
+
+func newWAVHeader(format, rate, channels, bits int, dataSize uint32) wavHeader {
+	return wavHeader{
+		RIFF:          [4]byte{'R', 'I', 'F', 'F'},
+		RIFFSize:      36 + dataSize,
+		WAVE:          [4]byte{'W', 'A', 'V', 'E'},
+		Fmt:           [4]byte{'f', 'm', 't', ' '},
+		FmtSize:       16,
+		AudioFormat:   uint16(format),
+		Channels:      uint16(channels),
+		SampleRate:    uint32(rate),
+		ByteRate:      uint32(rate * channels * bits / 8),
+		BlockAlign:    uint16(channels * bits / 8),
+		BitsPerSample: uint16(bits),
+		Data:          [4]byte{'d', 'a', 't', 'a'},
+		DataSize:      dataSize,
+	}
+}
+
+// WriteWAV writes all audio data from r (PCM, little endian) to w as a WAV file. If r is a LoopRegioner
+// which knows its loop, "smpl" and "cue " chunks marking the loop are added after the data.
+// The header is written last, when the length of the data is known, so w has to be seekable.
+func WriteWAV(w io.WriteSeeker, r io.Reader, rate, channels, bits int) error {
+	return writeWAV(w, r, wavPCM, rate, channels, bits)
+}
+
+// WriteWAVFormat is WriteWAV for audio data in the sample format f (float samples are written as an
+// IEEE float WAV file)
+func WriteWAVFormat(w io.WriteSeeker, r io.Reader, rate, channels int, f SampleFormat) error {
+	return writeWAV(w, r, wavFormat(f), rate, channels, f.Bytes()*8)
+}
+
+// wavFormat returns the WAV audio format for the sample format f
+func wavFormat(f SampleFormat) int {
+	if f == FormatFloat32 {
+		return wavFloat
+	}
+	return wavPCM
+}
+
+func writeWAV(w io.WriteSeeker, r io.Reader, format, rate, channels, bits int) error {
+	hdrLen := int64(binary.Size(wavHeader{}))
+	if _, err := w.Seek(hdrLen, io.SeekStart); err != nil {
+		return err
+	}
+	n, err := copyRendered(w, r)
+	if err != nil {
+		return err
+	}
+	lr, _ := r.(LoopRegioner)
+	return finishWAV(w, lr, format, rate, channels, bits, int(n))
+}
+
+// finishWAV completes a WAV file after its data: the loop chunks are added if lr (which may be nil) knows
+// the loop, and the header is written at the start. Data of an odd size (e.g. mono 24-bit) is padded to
+// a word, as RIFF chunks have to be; the pad counts for the RIFF size only.
+func finishWAV(w io.WriteSeeker, lr LoopRegioner, format, rate, channels, bits, dataSize int) error {
+	hdr := newWAVHeader(format, rate, channels, bits, uint32(dataSize))
+	if dataSize%2 != 0 {
+		if _, err := w.Write([]byte{0}); err != nil {
+			return err
+		}
+		hdr.RIFFSize++
+	}
+	if lr != nil {
+		if start, end, ok := lr.LoopRegion(); ok {
+			smpl, cue := newWAVLoopChunks(rate, start, end)
+			if err := binary.Write(w, binary.LittleEndian, smpl); err != nil {
+				return err
+			}
+			if err := binary.Write(w, binary.LittleEndian, cue); err != nil {
+				return err
+			}
+			hdr.RIFFSize += uint32(binary.Size(smpl) + binary.Size(cue))
+		}
+	}
+	if _, err := w.Seek(0, io.SeekStart); err != nil {
+		return err
+	}
+	return binary.Write(w, binary.LittleEndian, hdr)
+}
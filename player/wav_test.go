@@ -0,0 +1,53 @@
+package player
+
+import (
+	"bytes"
+	"encoding/binary"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// loopReader is audio data with a known loop
+type loopReader struct {
+	*bytes.Reader
+	start, end int
+}
+
+func (r loopReader) LoopRegion() (start, end int, ok bool) {
+	return r.start, r.end, true
+}
+
+// TestWAVPad checks that the data of mono 24-bit WAV files with an odd number of frames is padded before
+// the loop chunks, and that the pad counts for the RIFF size but not for the data size
+func TestWAVPad(t *testing.T) {
+	fn := filepath.Join(t.TempDir(), "pad.wav")
+	f, err := os.Create(fn)
+	if err != nil {
+		t.Fatal(err)
+	}
+	data := []byte{1, 2, 3, 4, 5, 6, 7, 8, 9} // 3 frames
+	if err := WriteWAVFormat(f, loopReader{bytes.NewReader(data), 1, 3}, 44100, 1, FormatInt24); err != nil {
+		t.Fatal(err)
+	}
+	if err := f.Close(); err != nil {
+		t.Fatal(err)
+	}
+	wav, err := os.ReadFile(fn)
+	if err != nil {
+		t.Fatal(err)
+	}
+	hdrLen := binary.Size(wavHeader{})
+	if riffSize := binary.LittleEndian.Uint32(wav[4:]); int(riffSize) != len(wav)-8 {
+		t.Errorf("RIFF size %d, want %d", riffSize, len(wav)-8)
+	}
+	if dataSize := binary.LittleEndian.Uint32(wav[hdrLen-4:]); dataSize != uint32(len(data)) {
+		t.Errorf("data size %d, want %d", dataSize, len(data))
+	}
+	if !bytes.Equal(wav[hdrLen:hdrLen+len(data)], data) {
+		t.Errorf("data %v, want %v", wav[hdrLen:hdrLen+len(data)], data)
+	}
+	if chunks := wav[hdrLen+len(data):]; len(chunks) < 5 || chunks[0] != 0 || string(chunks[1:5]) != "smpl" {
+		t.Errorf("data followed by %q, want a pad byte and the smpl chunk", chunks)
+	}
+}
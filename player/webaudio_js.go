@@ -0,0 +1,83 @@
+package player
+
+import (
+	"encoding/binary"
+	"errors"
+	"math"
+	"syscall/js"
+	"time"
+)
+
+// webAudioAhead is how far ahead of the audio which is heard the rendered buffers are scheduled
+const webAudioAhead = 200 * time.Millisecond
+
+func init() {
+	Outputs["webaudio"] = OpenWebAudioOutput
+}
+
+// webAudioOutput is the Output of the browser (the Web Audio API): every Write becomes an AudioBuffer,
+// scheduled right after the previous one
+type webAudioOutput struct {
+	ctx  js.Value // the AudioContext
+	rate int
+	next float64 // the time of the AudioContext (in seconds) at which the next buffer starts
+	data []byte  // the float32 samples of a channel
+}
+
+// OpenWebAudioOutput opens an output playing through a new AudioContext of the browser. Browsers only
+// start playing audio after a user interaction, so this should be called from an event handler.
+func OpenWebAudioOutput(rate int) (Output, error) {
+	ac := js.Global().Get("AudioContext")
+	if ac.IsUndefined() {
+		ac = js.Global().Get("webkitAudioContext")
+	}
+	if ac.IsUndefined() {
+		return nil, errors.New("Web Audio is not supported by the browser")
+	}
+	ctx := ac.New(map[string]interface{}{"sampleRate": rate})
+	ctx.Call("resume")
+	return &webAudioOutput{ctx: ctx, rate: rate}, nil
+}
+
+func (o *webAudioOutput) Write(samples []int16) error {
+	frames := len(samples) / channelNum
+	if frames == 0 {
+		return nil
+	}
+	buf := o.ctx.Call("createBuffer", channelNum, frames, o.rate)
+	for c := 0; c < channelNum; c++ {
+		o.data = o.data[:0]
+		for i := c; i < frames*channelNum; i += channelNum {
+			o.data = binary.LittleEndian.AppendUint32(o.data, math.Float32bits(float32(samples[i])/-math.MinInt16))
+		}
+		// the samples are copied as bytes into the memory of the channel's Float32Array
+		ch := buf.Call("getChannelData", c)
+		js.CopyBytesToJS(js.Global().Get("Uint8Array").New(ch.Get("buffer"), ch.Get("byteOffset"), ch.Get("byteLength")), o.data)
+	}
+	src := o.ctx.Call("createBufferSource")
+	src.Set("buffer", buf)
+	src.Call("connect", o.ctx.Get("destination"))
+
+	now := o.ctx.Get("currentTime").Float()
+	if o.next < now {
+		// the output has run dry (or just started)
+		o.next = now
+	}
+	src.Call("start", o.next)
+	o.next += float64(frames) / float64(o.rate)
+
+	// hold back while enough audio is scheduled
+	if ahead := o.next - now - webAudioAhead.Seconds(); ahead > 0 {
+		time.Sleep(time.Duration(ahead * float64(time.Second)))
+	}
+	return nil
+}
+
+// Close waits until the scheduled audio has been played and closes the AudioContext
+func (o *webAudioOutput) Close() error {
+	if rest := o.next - o.ctx.Get("currentTime").Float(); rest > 0 {
+		time.Sleep(time.Duration(rest * float64(time.Second)))
+	}
+	o.ctx.Call("close")
+	return nil
+}